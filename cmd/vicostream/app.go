@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"sync/atomic"
+
+	"vico_home/native/internal/clip"
+	"vico_home/native/internal/events"
+	"vico_home/native/internal/output"
+)
+
+// app holds what a run of vicostream keeps across its sessions. main
+// builds one from the startup configuration, and each session reads and
+// updates it through runSession, so nothing a session depends on lives in
+// package state.
+type app struct {
+	// dashboard is the -tui status display, or nil when -tui is off.
+	dashboard *statusDisplay
+	// status is set in -status mode. The session then skips startLive,
+	// sends the status query once the control channel opens, and ends
+	// after printing the reply.
+	status *statusQuery
+	// progress records how far the current session has got, so a
+	// connect timeout can say where it stopped.
+	progress progress
+	// tickets is the latest ticket, for the next session to refresh.
+	tickets ticketCache
+	// sessionIndex counts the sessions started, for the {index}
+	// placeholder and the event stream.
+	sessionIndex int
+	// outputPath is the file the last session wrote its video to, so a
+	// session can tell whether it continues that file.
+	outputPath string
+
+	// events receives the lifecycle events of -events. Nil discards them.
+	events *events.Emitter
+
+	// The outputs below outlive sessions, like stdout, so a reconnect
+	// continues them.
+
+	// fifo is the -output-fifo pipe. Nil without one.
+	fifo *output.FIFO
+	// preview is the -preview output. Nil without one.
+	preview *os.File
+	// players are the -play and -record subprocesses. They are started
+	// before any signal handling so every exit path can stop them.
+	players playerGroup
+	// clipRing holds the recent video for -clip-buffer, so a clip can
+	// reach back across a reconnect. Nil when disabled.
+	clipRing *clip.Ring
+	// clipCount numbers saved clips for the {index} placeholder.
+	clipCount atomic.Int64
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"vico_home/native/internal/config"
+	"vico_home/native/internal/webrtc"
+)
+
+// printCaps writes what a peer built from cfg offers, for -caps.
+func printCaps(w io.Writer, cfg *config.Config) error {
+	nackMode, err := webrtc.ParseNACKMode(cfg.NACK)
+	if err != nil {
+		return err
+	}
+	caps, err := webrtc.ReadCapabilities(webrtc.Options{
+		NoAudio: cfg.NoAudio,
+		NACK:    nackMode,
+	})
+	if err != nil {
+		return fmt.Errorf("read capabilities: %w", err)
+	}
+
+	fmt.Fprintln(w, "codecs:")
+	for _, c := range caps.Codecs {
+		fmt.Fprintf(w, "  %-5s %3d  %s\n", c.Kind, c.PayloadType, c.Name)
+		if c.Fmtp != "" {
+			fmt.Fprintf(w, "             fmtp: %s\n", c.Fmtp)
+		}
+		if len(c.Feedback) > 0 {
+			fmt.Fprintf(w, "             feedback: %s\n", strings.Join(c.Feedback, ", "))
+		}
+	}
+	fmt.Fprintln(w, "header extensions:")
+	for _, uri := range caps.Extensions {
+		fmt.Fprintf(w, "  %s\n", uri)
+	}
+	fmt.Fprintln(w, "interceptors:")
+	for _, name := range caps.Interceptors {
+		fmt.Fprintf(w, "  %s\n", name)
+	}
+	return nil
+}
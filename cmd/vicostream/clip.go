@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"vico_home/native/internal/clip"
+	"vico_home/native/internal/config"
+	"vico_home/native/internal/output"
+)
+
+// startClips creates the clip ring and starts reading clip triggers from
+// stdin and, on Unix, SIGUSR1. The settings are those at startup; SIGHUP
+// does not change them.
+func (a *app) startClips(cfg *config.Config) {
+	if cfg.ClipBuffer <= 0 {
+		return
+	}
+	a.clipRing = clip.NewRing(cfg.ClipBuffer, cfg.ClipMaxBytes, nil)
+	if clipSignalName != "" {
+		log.Printf("[main] keeping %s of video for clips; send \"clip [PRE [POST]]\" on stdin or %s", cfg.ClipBuffer, clipSignalName)
+	} else {
+		log.Printf("[main] keeping %s of video for clips; send \"clip [PRE [POST]]\" on stdin", cfg.ClipBuffer)
+	}
+
+	go a.readClipCommands(os.Stdin, cfg)
+
+	sig := make(chan os.Signal, 1)
+	notifyClipSignal(sig)
+	go func() {
+		for range sig {
+			a.saveClip(cfg, cfg.ClipBuffer, cfg.ClipPost)
+		}
+	}()
+}
+
+// closeClips ends the clips still recording, so their files are flushed.
+// os.Exit skips deferred calls, so every exit path calls it.
+func (a *app) closeClips() {
+	if a.clipRing != nil {
+		a.clipRing.Close()
+	}
+}
+
+// readClipCommands runs the stdin control loop: one command per line.
+func (a *app) readClipCommands(r io.Reader, cfg *config.Config) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		pre, post, err := parseClipCommand(line, cfg.ClipBuffer, cfg.ClipPost)
+		if err != nil {
+			log.Printf("[main] stdin: %v", err)
+			continue
+		}
+		a.saveClip(cfg, pre, post)
+	}
+}
+
+// parseClipCommand parses "clip [PRE [POST]]", with durations such as 20s
+// defaulting to pre and post.
+func parseClipCommand(line string, pre, post time.Duration) (time.Duration, time.Duration, error) {
+	fields := strings.Fields(line)
+	if fields[0] != "clip" || len(fields) > 3 {
+		return 0, 0, fmt.Errorf("unknown command %q (want clip [PRE [POST]])", line)
+	}
+	for i, d := range []*time.Duration{&pre, &post} {
+		if len(fields) <= i+1 {
+			break
+		}
+		v, err := time.ParseDuration(fields[i+1])
+		if err != nil || v < 0 {
+			return 0, 0, fmt.Errorf("clip: invalid duration %q", fields[i+1])
+		}
+		*d = v
+	}
+	return pre, post, nil
+}
+
+// saveClip starts a clip named by -clip-template.
+func (a *app) saveClip(cfg *config.Config, pre, post time.Duration) {
+	tmpl, err := output.ParseTemplate(cfg.ClipTemplate)
+	if err != nil {
+		log.Printf("[main] clip: %v", err)
+		return
+	}
+	path := tmpl.Expand(output.Fields{
+		Serial: cfg.SerialNumber,
+		Time:   time.Now(),
+		Index:  int(a.clipCount.Add(1)),
+	})
+	if err := a.clipRing.SaveClip(path, pre, post); err != nil {
+		log.Printf("[main] clip: %v", err)
+		return
+	}
+	buffered, _ := a.clipRing.Buffered()
+	log.Printf("[main] saving clip to %s: %s before (%s buffered), %s after", path, pre, buffered, post)
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// clipSignalName is empty where there is no SIGUSR1; clips are then only
+// started from stdin.
+const clipSignalName = ""
+
+func notifyClipSignal(chan<- os.Signal) {}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	ossignal "os/signal"
+	"syscall"
+)
+
+// clipSignalName names the signal that saves a clip, for the log.
+const clipSignalName = "SIGUSR1"
+
+// notifyClipSignal relays SIGUSR1 to c.
+func notifyClipSignal(c chan<- os.Signal) {
+	ossignal.Notify(c, syscall.SIGUSR1)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"vico_home/native/internal/webrtc"
+)
+
+// errConnectTimeout is the cancellation cause when -connect-timeout passes
+// before any video arrives.
+var errConnectTimeout = errors.New("connect timeout")
+
+// progress tracks the setup phase of the running session. Phases up to
+// signaling are set by runSession; after that the peer's ICE and
+// connection state tell the rest.
+type progress struct {
+	mu        sync.Mutex
+	phase     string
+	peer      *webrtc.Peer
+	videoSeen bool
+}
+
+// Start begins a new session in phase.
+func (p *progress) Start(phase string) {
+	p.mu.Lock()
+	p.phase, p.peer = phase, nil
+	p.mu.Unlock()
+}
+
+// Set records that the session reached phase.
+func (p *progress) Set(phase string) {
+	p.mu.Lock()
+	p.phase = phase
+	p.mu.Unlock()
+}
+
+// SetPeer attaches the session's peer once it exists.
+func (p *progress) SetPeer(peer *webrtc.Peer) {
+	p.mu.Lock()
+	p.peer = peer
+	p.mu.Unlock()
+}
+
+// SetVideoSeen records that some session received video.
+func (p *progress) SetVideoSeen() {
+	p.mu.Lock()
+	p.videoSeen = true
+	p.mu.Unlock()
+}
+
+// VideoSeen reports whether any session so far has received video.
+func (p *progress) VideoSeen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peer != nil && p.peer.Stats().VideoPackets > 0 {
+		p.videoSeen = true
+	}
+	return p.videoSeen
+}
+
+// Phase describes the furthest point the current session reached.
+func (p *progress) Phase() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peer == nil {
+		return p.phase
+	}
+	s := p.peer.Stats()
+	switch {
+	case s.ConnectionState == "connected" && s.DataChannelState == "":
+		return "connected, waiting for the control channel"
+	case s.ConnectionState == "connected":
+		return "connected, waiting for video"
+	case s.ICEState != "" && s.ICEState != "new":
+		return "ICE " + s.ICEState
+	default:
+		return p.phase
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"vico_home/native/internal/domain"
+	"vico_home/native/internal/events"
+)
+
+// eventHandler emits the signaling events of the session to events, then
+// passes them on to the viewer.
+type eventHandler struct {
+	domain.Handler
+	events *events.Emitter
+}
+
+func (h eventHandler) OnAuthSuccess() {
+	h.events.Emit(events.Authenticated, "")
+	h.Handler.OnAuthSuccess()
+}
+
+func (h eventHandler) OnPeerIn() {
+	h.events.Emit(events.PeerIn, "")
+	h.Handler.OnPeerIn()
+}
+
+func (h eventHandler) OnPeerOut() {
+	h.events.Emit(events.PeerOut, "")
+	h.Handler.OnPeerOut()
+}
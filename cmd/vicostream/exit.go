@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+
+	"vico_home/native/internal/api"
+	sigclient "vico_home/native/internal/signal"
+	"vico_home/native/internal/webrtc"
+)
+
+// Exit statuses, so a supervising script can tell a retryable failure
+// from one that needs a person.
+const (
+	exitOK            = 0
+	exitFailure       = 1   // any error not covered below
+	exitUsage         = 2   // invalid options or configuration
+	exitAuth          = 3   // token, camera credentials or camera serial rejected
+	exitCameraOffline = 4   // camera not reachable by the cloud
+	exitNetwork       = 5   // API or signaling unreachable or rate limiting, camera at its viewer limit, or timed out
+	exitMediaStall    = 6   // connected, but no usable video arrived
+	exitInterrupted   = 130 // SIGINT or SIGTERM, as shells report it
+)
+
+// exitCode maps the error that ended the process to its exit status.
+func exitCode(err error) int {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, api.ErrUnauthorized), errors.Is(err, sigclient.ErrAuthFailed),
+		errors.Is(err, sigclient.ErrJoinRejected):
+		return exitAuth
+	case errors.Is(err, api.ErrCameraOffline):
+		return exitCameraOffline
+	case errors.Is(err, webrtc.ErrMediaStall):
+		return exitMediaStall
+	case errors.Is(err, errConnectTimeout), errors.Is(err, sigclient.ErrConnectionLost),
+		errors.Is(err, sigclient.ErrRedirected), errors.Is(err, sigclient.ErrServerBusy), errors.Is(err, sigclient.ErrViewerLimit),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, api.ErrRateLimited),
+		errors.Is(err, webrtc.ErrDataChannelTimeout), errors.As(err, &netErr):
+		return exitNetwork
+	default:
+		return exitFailure
+	}
+}
+
+// fatal logs err to w, stops any players, ends any clips and exits with
+// the status for err.
+func (a *app) fatal(w io.Writer, err error) {
+	a.players.Stop()
+	a.closeClips()
+	log.SetOutput(w)
+	log.Printf("[main] %v", err)
+	os.Exit(exitCode(err))
+}
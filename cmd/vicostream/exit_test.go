@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"vico_home/native/internal/api"
+	sigclient "vico_home/native/internal/signal"
+	"vico_home/native/internal/webrtc"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{errors.New("disk full"), exitFailure},
+		{fmt.Errorf("fetch ticket: %w", api.ErrUnauthorized), exitAuth},
+		{sigclient.ErrAuthFailed, exitAuth},
+		{fmt.Errorf("join: %w", sigclient.ErrJoinRejected), exitAuth},
+		{fmt.Errorf("fetch ticket: %w", api.ErrCameraOffline), exitCameraOffline},
+		{webrtc.ErrNoTrack, exitMediaStall},
+		{webrtc.ErrAnswerRejected, exitMediaStall},
+		{fmt.Errorf("%w after 10s", errConnectTimeout), exitNetwork},
+		{sigclient.ErrConnectionLost, exitNetwork},
+		{sigclient.ErrRedirected, exitNetwork},
+		{sigclient.ErrServerBusy, exitNetwork},
+		{sigclient.ErrViewerLimit, exitNetwork},
+		{fmt.Errorf("fetch ticket: %w", api.ErrRateLimited), exitNetwork},
+		{webrtc.ErrDataChannelTimeout, exitNetwork},
+		{fmt.Errorf("dial: %w", context.DeadlineExceeded), exitNetwork},
+		{fmt.Errorf("http request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), exitNetwork},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%v: expected exit status %d, got %d", tt.err, tt.want, got)
+		}
+	}
+}
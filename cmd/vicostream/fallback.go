@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"vico_home/native/internal/domain"
+	"vico_home/native/internal/webrtc"
+)
+
+// profileFallback offers the -h264-profiles in turn. A camera that
+// rejects the answer or sends no track for one profile is offered the
+// next on a new peer connection, keeping the ticket and signaling.
+type profileFallback struct {
+	profiles []domain.H264Profile
+	failed   chan error
+}
+
+func newProfileFallback(profiles []domain.H264Profile) *profileFallback {
+	return &profileFallback{profiles: profiles, failed: make(chan error, 1)}
+}
+
+// First returns the profile to offer first and whether it is also the
+// last to try.
+func (f *profileFallback) First() (domain.H264Profile, bool) {
+	return f.profiles[0], len(f.profiles) == 1
+}
+
+// Fail takes err, from the peer or the viewer, as a codec failure for Run
+// to retry and reports true, or reports false if it should end the
+// session. Only one failure is kept until Run picks it up.
+func (f *profileFallback) Fail(err error) bool {
+	if len(f.profiles) < 2 || !errors.Is(err, webrtc.ErrAnswerRejected) && !errors.Is(err, webrtc.ErrNoTrack) {
+		return false
+	}
+	select {
+	case f.failed <- err:
+	default:
+	}
+	return true
+}
+
+// Run waits for ctx to end. Each codec failure before then calls restart
+// with the next profile, and whether it is the last. The failure after
+// the last profile, or one restart declines, ends the session through
+// cancel, as does a restart error.
+func (f *profileFallback) Run(ctx context.Context, restart func(profile domain.H264Profile, last bool) (bool, error), cancel context.CancelCauseFunc) {
+	for next := 1; ctx.Err() == nil; {
+		select {
+		case <-ctx.Done():
+		case cause := <-f.failed:
+			if next == len(f.profiles) {
+				cancel(cause)
+				continue
+			}
+			profile := f.profiles[next]
+			next++
+			log.Printf("[main] %v; offering H264 profile %s instead", cause, profile)
+			switch restarted, err := restart(profile, next == len(f.profiles)); {
+			case err != nil:
+				cancel(err)
+			case !restarted:
+				cancel(cause)
+			}
+		}
+	}
+}
+
+// Multiple reports whether more than one profile is tried, so the one
+// that brings video is worth logging.
+func (f *profileFallback) Multiple() bool {
+	return len(f.profiles) > 1
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/domain"
+	"vico_home/native/internal/webrtc"
+)
+
+var testProfiles = []domain.H264Profile{
+	{ProfileLevelID: "64001f", PacketizationMode: 0},
+	{ProfileLevelID: "64001f", PacketizationMode: 1},
+	{ProfileLevelID: "42e01f", PacketizationMode: 1},
+}
+
+// runFallback runs f until its session ends, with restart recording the
+// profiles offered, and returns them and the cause the session ended with.
+func runFallback(t *testing.T, f *profileFallback, restart func(domain.H264Profile) (bool, error)) ([]string, error) {
+	t.Helper()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	var offered []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.Run(ctx, func(profile domain.H264Profile, last bool) (bool, error) {
+			offered = append(offered, fmt.Sprintf("%s last=%t", profile, last))
+			return restart(profile)
+		}, cancel)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the session to end")
+	}
+	return offered, context.Cause(ctx)
+}
+
+func TestProfileFallback_OffersEachProfileThenEnds(t *testing.T) {
+	f := newProfileFallback(testProfiles)
+	if p, last := f.First(); p != testProfiles[0] || last {
+		t.Fatalf("expected %s first and not last, got %s last=%t", testProfiles[0], p, last)
+	}
+	noTrack := fmt.Errorf("%w after 5s", webrtc.ErrNoTrack)
+	if !f.Fail(noTrack) {
+		t.Fatal("expected a missing track to be retried")
+	}
+	offered, cause := runFallback(t, f, func(domain.H264Profile) (bool, error) {
+		f.Fail(webrtc.ErrAnswerRejected)
+		return true, nil
+	})
+
+	want := []string{"64001f/1 last=false", "42e01f/1 last=true"}
+	if !slices.Equal(offered, want) {
+		t.Errorf("expected offers %v, got %v", want, offered)
+	}
+	if !errors.Is(cause, webrtc.ErrAnswerRejected) {
+		t.Errorf("expected the last failure as the cause, got %v", cause)
+	}
+}
+
+func TestProfileFallback_RestartDeclinedOrFailed(t *testing.T) {
+	f := newProfileFallback(testProfiles)
+	f.Fail(webrtc.ErrNoTrack)
+	_, cause := runFallback(t, f, func(domain.H264Profile) (bool, error) { return false, nil })
+	if !errors.Is(cause, webrtc.ErrNoTrack) {
+		t.Errorf("declined restart: expected the codec failure as the cause, got %v", cause)
+	}
+
+	f = newProfileFallback(testProfiles)
+	f.Fail(webrtc.ErrNoTrack)
+	boom := errors.New("create peer: boom")
+	_, cause = runFallback(t, f, func(domain.H264Profile) (bool, error) { return false, boom })
+	if !errors.Is(cause, boom) {
+		t.Errorf("failed restart: expected its error as the cause, got %v", cause)
+	}
+}
+
+func TestProfileFallback_FailIgnoresOtherErrors(t *testing.T) {
+	if newProfileFallback(testProfiles[:1]).Fail(webrtc.ErrNoTrack) {
+		t.Error("expected no retry with a single profile")
+	}
+	f := newProfileFallback(testProfiles)
+	if f.Fail(webrtc.ErrMediaStall) || f.Fail(errors.New("signal closed")) {
+		t.Error("expected only codec failures to be retried")
+	}
+}
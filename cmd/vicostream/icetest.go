@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"vico_home/native/internal/domain"
+	"vico_home/native/internal/webrtc"
+)
+
+const iceCheckTimeout = 5 * time.Second
+
+// runICETest checks every ICE server in the ticket and prints a table of
+// results to stdout. It returns false if any server failed.
+func runICETest(servers []domain.ICEServer) bool {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tTYPE\tRESULT\tRTT\tADDRESS")
+
+	ok := true
+	for _, s := range servers {
+		res := webrtc.CheckICEServer(s, iceCheckTimeout)
+		if res.Err != nil {
+			ok = false
+			fmt.Fprintf(tw, "%s\t%s\tFAIL\t-\t%v\n", res.URL, res.Kind, res.Err)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\tPASS\t%s\t%s\n", res.URL, res.Kind, res.RTT.Round(time.Millisecond), res.Addr)
+	}
+	tw.Flush()
+
+	if len(servers) == 0 {
+		fmt.Println("ticket contains no ICE servers")
+		return false
+	}
+	return ok
+}
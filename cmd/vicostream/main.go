@@ -2,17 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	ossignal "os/signal"
+	"sync/atomic"
 	"syscall"
+	"time"
 
-	"vico_home/native/internal/api"
+	"vico_home/native/internal/clock"
 	"vico_home/native/internal/config"
-	sigclient "vico_home/native/internal/signal"
-	"vico_home/native/internal/viewer"
-	"vico_home/native/internal/webrtc"
+	"vico_home/native/internal/events"
+	"vico_home/native/internal/logging"
+	"vico_home/native/internal/output"
 )
 
 const helpText = `vicostream - Stream H264 video from a VICO camera via WebRTC
@@ -21,12 +26,17 @@ Usage:
   vicostream [options]
 
 The raw H264 stream is written to stdout. Pipe to ffplay or ffmpeg for
-playback or recording.
+playback or recording, or let -play and -record start them.
 
 Environment Variables (required):
-  VICO_TOKEN  JWT authentication token from the VICO app
+  VICO_TOKEN  JWT authentication token from the VICO app (not needed with
+              -token-file or -token-stdin)
   VICO_SN     Camera serial number
 
+Environment Variables (optional):
+  VICO_LANGUAGE  Default for -language
+  VICO_TIMEZONE  Default for -timezone
+
 Examples:
   # Live playback
   vicostream | ffplay -f h264 -
@@ -35,81 +45,671 @@ Examples:
   vicostream | ffmpeg -f h264 -i - -c copy output.mp4
 
 Options:
-  -h, --help  Show this help message
+  -token-file PATH         Read the JWT from PATH instead of VICO_TOKEN. The
+                           file is re-read for every ticket request, so
+                           replacing it rotates the token
+  -token-stdin             Read the JWT from stdin instead of VICO_TOKEN
+  -wait-keyframe           Discard video until the first keyframe (IDR with
+                           SPS/PPS) so the output starts cleanly decodable
+  -keyframe-timeout DUR    With -wait-keyframe, fail if no keyframe arrives
+                           within DUR of connecting, also when no video
+                           track does (default 10s, 0 waits forever)
+  -track-timeout DUR       If the connection is up but no video track has
+                           arrived after DUR, log the negotiated media
+                           sections and likely causes (default 5s, 0
+                           disables). Not applied to -status sessions,
+                           which ask for no video
+  -fail-without-track      Also end the session when -track-timeout
+                           passes, with the media stall exit status
+  -validate-answer=false   Apply the camera's SDP answer even if it has no
+                           H264 video to send (port 0, inactive, or no
+                           H264 payload). By default such a session ends
+                           at once with the media stall exit status
+  -h264-profiles LIST      H264 formats to offer, as comma-separated
+                           PROFILE-LEVEL-ID/PACKETIZATION-MODE, e.g.
+                           64001f/0,64001f/1,42e01f/1 (default 64001f/0).
+                           When the camera rejects the answer or sends no
+                           track within -track-timeout, the session is
+                           joined again over the same signaling connection
+                           and the next is offered on a new peer connection
+                           once the camera answers the join. The one that
+                           brings video is logged, and the summary counts
+                           the video of every attempt
+  -keyframe-interval DUR   Request a keyframe (PLI) whenever none has
+                           arrived for DUR, e.g. 2s, for cameras that send
+                           one only at the start; speeds up recovery from
+                           loss and lets players join mid-stream sooner.
+                           Cameras that already send keyframes that often
+                           get no requests. Default 0, off
+  -keyframe-on-loss        Request a keyframe as soon as packet loss is
+                           seen (implied by -low-latency)
+  -keyframe-loss-threshold N
+                           Request a keyframe when N or more packets are
+                           lost within -keyframe-loss-window, so heavy loss
+                           is repaired at the next keyframe instead of
+                           corrupting the picture until the camera sends
+                           one. Gentler than -keyframe-on-loss on a
+                           network that drops the odd packet. Default 0,
+                           off
+  -keyframe-loss-window DUR
+                           Window for -keyframe-loss-threshold (default 1s)
+  -keyframe-loss-cooldown DUR
+                           Minimum time between the keyframe requests
+                           -keyframe-loss-threshold sends, so the camera
+                           can answer one before the next (default 2s)
+  -max-reassembly-size N   Drop fragmented NAL units larger than N bytes
+                           (default 4194304)
+  -max-nalu-size N         Drop any NAL unit larger than N bytes instead of
+                           writing it, with a warning: a safety net
+                           against a depacketizer fault writing garbage.
+                           A dropped keyframe is requested again. Only
+                           takes effect up to -max-reassembly-size
+                           (default 4194304, 0 disables)
+  -low-latency             Live-viewing profile: write each packet's video
+                           immediately, drop the oldest video if the output
+                           falls behind, and request a keyframe on packet
+                           loss. Expect brief glitches instead of delay;
+                           leave off when recording. Packets are never held
+                           for reordering, with or without it
+  -output-template PATH    Write video to PATH instead of stdout, creating
+                           directories as needed. {serial}, {date}
+                           (2006-01-02), {time} (150405) and {index} (the
+                           session number, 001 up) are expanded when each
+                           session starts, so with -reconnect every
+                           session can get its own file, e.g.
+                           rec/{serial}/{date}_{time}.h264. An existing
+                           file is appended to
+  -output-fifo PATH        Write video to the named pipe PATH instead of
+                           stdout, creating it if needed, for a separate
+                           consumer that may stop and restart. While no
+                           process has the pipe open for reading, video is
+                           dropped rather than blocking the stream or
+                           ending vicostream; a reader that attaches gets
+                           the live stream from that point and can decode
+                           from the next keyframe. A reader that is
+                           attached but slow holds the stream back like
+                           any pipe. Video from before a reader attached
+                           is not buffered for it. Combines with
+                           -output-template, -play and -record. Unix only
+  -on-demand               With -output-fifo, stream only while a reader
+                           has the pipe open, to save the camera's battery:
+                           no session starts until one does, and the
+                           session ends 10s after the last reader leaves.
+                           The next reader starts a new session, whether
+                           or not -reconnect is given
+  -play                    Play the video in ffplay instead of writing it
+                           to stdout. Closing the window ends vicostream
+  -record PATH             Record the video with ffmpeg into PATH, e.g.
+                           out.mp4, instead of writing it to stdout. An
+                           existing file is not overwritten. Both need
+                           FFmpeg on PATH, can be combined with each other
+                           and with -output-template, and run for the
+                           whole program, across reconnects
+  -clip-buffer DUR         Keep the last DUR of video in memory, from a
+                           keyframe, so a clip of something that already
+                           happened can be saved. A line "clip [PRE
+                           [POST]]" on stdin, or SIGUSR1 on Unix, writes
+                           PRE of buffered video (default DUR) and the
+                           next POST (default -clip-post) to a new file.
+                           Default 0, off. Not with -token-stdin
+  -clip-post DUR           Video recorded into a clip after it is triggered
+                           (default 10s)
+  -clip-max-bytes N        Memory limit for -clip-buffer; the oldest GOPs
+                           go first (default 64 MiB)
+  -clip-template PATH      File for each clip, with the -output-template
+                           placeholders; {index} counts clips (default
+                           clip_{serial}_{date}_{time}.h264)
+  -resolution WxH          Resolution requested for the main stream (default
+                           1280x720)
+  -strict-resolution       End the session if the camera's stream is not
+                           the requested resolution (within 16 pixels).
+                           With -reconnect the session is retried, as
+                           bandwidth adaptation may have lowered it, but
+                           such a session does not reset the backoff and
+                           counts towards -max-reconnects. Otherwise a
+                           mismatch is only logged
+  -size NAME               Stream size named in startLive with -resolution
+                           (default medium, as the app asks)
+  -no-audio                Offer video only, without an audio m-line, and
+                           reject audio in a camera's offer. Some firmwares
+                           handle video-only offers better. Audio is not
+                           written anywhere either way
+  -preview PATH            Also ask the camera for a low-resolution preview
+                           stream and write it to PATH (a file or FIFO, e.g.
+                           for a dashboard thumbnail) while the main stream
+                           goes to stdout. The request format is a guess:
+                           cameras with a single encoder may ignore or
+                           reject it, which is logged and the session
+                           continues, or lower the main stream to the
+                           preview size. A FIFO blocks startup until read
+  -preview-resolution WxH  Resolution requested for -preview (default
+                           640x360)
+  -video-track ID          Cameras that send several video tracks on the
+                           main stream, e.g. main and sub stream or
+                           simulcast layers, get only one written: the
+                           first, or the one whose track ID, RID or SSRC
+                           is ID. The others are discarded; the log lists
+                           each track's ID, SSRC and RID
+  -dedup-params DUR        Drop an SPS or PPS identical to one written less
+                           than DUR ago, e.g. when the camera sends them
+                           both aggregated and on their own (default 0,
+                           write all). Keep DUR below the keyframe interval
+                           for decoders that need them at every keyframe
+  -drop-frames PCT         Thin the output for slow viewers or links by
+                           dropping PCT percent of the frames between
+                           keyframes (default 0). Keyframes are kept.
+                           Frames are cut from the end of each keyframe
+                           interval so the stream stays decodable, which
+                           shows as a pause before every keyframe: with a
+                           keyframe every 2s, -drop-frames 50 plays 1s and
+                           holds 1s. Re-encode instead for smooth motion
+  -motion-record N         Write video only during activity, to save storage
+                           on mostly static scenes: from the keyframe before
+                           a frame N times the recent average size (e.g. 2,
+                           lower is more sensitive) or a keyframe that comes
+                           at less than half the camera's usual interval,
+                           until -motion-hold passes quietly. This is not
+                           motion detection. Noise at night, rain, moving
+                           trees and day/night switches also grow frames;
+                           small or slow movement may not; keyframes after
+                           loss or -keyframe-interval look forced; cameras
+                           encoding at a constant bitrate show nothing; and
+                           long activity raises the average until it stops
+                           counting. Quiet stretches are left out of the
+                           output without a marker; add -timestamps to keep
+                           each picture's capture time
+  -motion-hold DUR         Keep writing this long after the last sign of
+                           activity (default 10s)
+  -strip-nalu LIST         Drop these NAL unit types from the output, e.g.
+                           6,9,12 for SEI, access unit delimiters and
+                           filler data that some decoders reject. Slice
+                           and parameter set types are refused
+  -nalu-filter CMD         Run CMD, split on spaces, and pass each NAL unit
+                           of the main stream through it for watermarking,
+                           filtering or analysis: the unit goes to its
+                           stdin as a 4-byte big-endian length and the
+                           bytes, and it answers on stdout with the unit to
+                           write in its place, framed the same way, or a
+                           zero length to drop it. Units are passed after
+                           -strip-nalu and before -max-nalu-size and
+                           -wait-keyframe, and video waits for each
+                           answer. The session ends if CMD exits or its
+                           answer is malformed; it is restarted with each
+                           session
+  -insert-aud              Write an access unit delimiter (NAL type 9)
+                           before each picture that lacks one, for strict
+                           parsers and muxers that rely on them to find
+                           picture boundaries (default off)
+  -timestamps              Embed each picture's wall-clock capture time as
+                           an SEI NAL unit (type 6, user data unregistered,
+                           UUID 5d1d8f3c-6a1e-4b8e-9f3a-2c7e0b9d4a61) after
+                           any delimiter, holding e.g.
+                           "2024-05-01T12:00:00.000000Z rtcp". The time is
+                           mapped from the camera's RTCP sender reports
+                           ("rtcp"), or is the local arrival time until the
+                           first report ("arrival"). Written even with type
+                           6 in -strip-nalu
+  -proxy URL               Send the ticket request and the signaling
+                           WebSocket through an http:// or socks5://
+                           proxy. Without it, HTTPS_PROXY (or ALL_PROXY)
+                           and NO_PROXY from the environment apply. Media
+                           is not proxied: STUN, TURN and the video itself
+                           still need direct UDP or TURN reachability, so
+                           use a TURN server over TCP or TLS (-ice-server
+                           with ?transport=tcp) on networks without UDP
+  -events DEST             Write connection lifecycle events as JSON lines
+                           to DEST: fd:N (an inherited descriptor, e.g.
+                           3>events.jsonl), unix:PATH (a socket that every
+                           connected client reads from) or a file. Each
+                           line has v (schema version, 1), time, type,
+                           serial, session and an optional detail. Types:
+                           session-start, authenticated, joined, peer-in,
+                           connected, first-frame, stalled, peer-out,
+                           disconnected, closed (detail: the error) and
+                           reconnecting (detail: the delay). Fields are
+                           only added, never changed, within a version
+  -log-file PATH           Write logs to PATH instead of stderr
+  -log-max-size MIB        Rotate the log file to PATH.1 once it exceeds MIB
+                           mebibytes (default 0, no rotation)
+  -debug LIST              Log verbosely for a comma-separated list of
+                           namespaces, or all: signal (every signaling
+                           frame, with credentials [redacted]), ice,
+                           dtls and datachannel (pion's internals for each),
+                           rtp (every video packet). Signaling frames are
+                           only logged with signal
+  -tui                     Show a status dashboard (state, bitrate, fps,
+                           loss, uptime) on stderr, updated in place, instead
+                           of log output. Requires stderr to be a terminal.
+                           Combine with -log-file to keep the logs
+  -reconnect               Start a new session when the current one ends or
+                           fails, unless the token or camera auth was
+                           rejected. Retries wait a random delay up to a
+                           ceiling that doubles from -reconnect-base to
+                           -reconnect-max, so many instances restarted at
+                           once do not reconnect in lockstep. If the API
+                           rate limits the ticket request, the retry waits
+                           at least as long as its Retry-After header asks,
+                           or a minute, and likewise if the signal server
+                           says it is busy. A signal server that redirects
+                           the client is reconnected to at once, at the
+                           server it names if that is in the same
+                           signaling domain and not a downgrade from wss
+                           to ws; a redirect straight after another waits
+                           at least -reconnect-base, and each counts
+                           towards -max-reconnects. Video that
+                           continues the same stdout, file or player
+                           resumes at a keyframe, after an H264
+                           end-of-sequence marker
+  -reconnect-base DUR      Initial backoff ceiling (default 1s)
+  -reconnect-max DUR       Maximum backoff ceiling (default 1m)
+  -max-reconnects N        With -reconnect, exit with an error after N
+                           consecutive reconnects that fail to get video
+                           (default 0, retry forever). A session that
+                           receives video resets the count. Under a
+                           supervisor that restarts the process (systemd
+                           Restart=, a container restart policy), this is
+                           the inner loop: vicostream retries quickly on
+                           its own, and the supervisor only sees the exit
+                           once the camera has been unreachable for N
+                           attempts
+  -wait-for-slot            When the camera already streams to as many
+                           viewers as it allows, retry with the reconnect
+                           backoff until one leaves, even without
+                           -reconnect. Without it, the process exits with
+                           status 5. -max-reconnects bounds the attempts
+  -ticket-refresh-margin DUR
+                           With -reconnect, refresh the ticket this long
+                           before it expires (default 5m, 0 disables), so a
+                           reconnect late in a multi-hour session starts
+                           from a current one and a failed renewal, such
+                           as an expired VICO_TOKEN, shows while the
+                           session is healthy. A failure is logged as a
+                           warning and retried each minute; the running
+                           session continues
+  -quality-interval DUR    Log a good/fair/poor connection quality rating
+                           every DUR (default 30s, 0 disables). The rating
+                           is the worst of packet loss over the interval,
+                           jitter and ICE round trip time; it also appears
+                           in the summary and -tui
+  -quality-loss FAIR,POOR  Loss percent thresholds (default 1,5)
+  -quality-jitter FAIR,POOR
+                           Jitter thresholds (default 30ms,100ms)
+  -quality-rtt FAIR,POOR   Round trip time thresholds (default 150ms,400ms)
+  -connect-timeout DUR     Give up if no video has arrived DUR after start,
+                           reporting the last phase reached (ticket,
+                           signaling, ICE, ...). Covers every reconnect
+                           attempt until the first video (default 0, no
+                           limit)
+  -ice-timeout DUR         Fail the connection when ICE has had no
+                           connectivity for DUR (default 25s)
+  -stall-timeout DUR       End the session, with the media stall exit
+                           status, when video stops arriving for DUR after
+                           it started (default 0, no limit)
+  -signal-handshake-timeout DUR
+                           Bound connecting to the signal server, from
+                           dialing to the end of the WebSocket handshake
+                           (default 45s, 0 no limit)
+  -signal-write-timeout DUR
+                           Bound sending one signaling message; a write
+                           that times out loses the connection (default
+                           10s, 0 no limit)
+  -signal-ping-timeout DUR Bound sending one signaling keepalive ping, or
+                           the pong to one of the server's (default 5s, 0 no
+                           limit)
+  -signal-read-timeout DUR Drop the signaling connection after DUR without
+                           receiving anything. Pings and pongs count, from
+                           either side; keep DUR above the ticket's ping
+                           interval (default 0, no limit)
+  -shutdown-grace DUR      On SIGINT/SIGTERM, allow DUR to stop the camera
+                           stream and finish writing output before closing
+                           (default 5s). A second signal exits immediately
+  -language CODE           Language sent to the API (default from LANG, or en)
+  -timezone ZONE           IANA time zone sent to the API (default: the
+                           system time zone)
+  -sdp-role ROLE           Which side sends the SDP offer: "offer" (we
+                           offer, camera answers), "answer" (camera offers)
+                           or "auto" (offer, but answer if the camera sends
+                           its own offer). Default auto
+  -early-peer-in MODE      What to do when the server announces the camera
+                           (PEER_IN) before accepting JOIN_LIVE: "queue"
+                           holds it until the join succeeds, "drop"
+                           ignores it, "deliver" offers at once, for
+                           servers that never answer JOIN_LIVE. Default
+                           queue
+  -dtls-role ROLE          DTLS role when answering the camera's offer:
+                           "client" (active), "server" (passive) or "auto".
+                           Try the other role if a camera's DTLS handshake
+                           never completes. When we offer, the offer says
+                           actpass and the camera's answer decides, so
+                           with -sdp-role offer this has no effect.
+                           Default auto
+  -nack MODE               NACK handling: "on" requests retransmission of
+                           lost video and answers the camera's NACKs,
+                           "no-responder" only requests, "off" does
+                           neither, leaving loss to the next keyframe. For
+                           firmwares that misbehave on NACK feedback.
+                           Default on
+  -udp-port-range MIN-MAX  Gather media candidates only on local UDP ports
+                           MIN to MAX, e.g. 50000-50100, for firewalls
+                           that open a known range. Each session needs a
+                           port per network interface while it runs
+  -dscp CLASS              Mark the media UDP packets with a DSCP value,
+                           0 to 63 or a class name such as EF (46) or AF41,
+                           for networks that prioritize marked traffic.
+                           Default unmarked. Best effort: where the OS
+                           refuses, e.g. Windows without a QoS policy, a
+                           warning is logged and packets go out unmarked.
+                           Signaling is not marked
+  -ice-candidate-interval DUR
+                           Send local ICE candidates at most once per DUR
+                           instead of as fast as they are gathered, for
+                           signaling servers that rate-limit (default 0)
+  -ice-candidates LIST     Local ICE candidate types to use, from host,
+                           srflx (public address via STUN) and relay
+                           (TURN), default all three. STUN or TURN servers
+                           a type left out would need are not contacted.
+                           A camera that needs a left-out type cannot
+                           connect
+  -ice-relay-fallback DUR  Send relay candidates only if the connection is
+                           not up DUR after the first candidate is gathered,
+                           so a direct path is found without the camera
+                           also trying relay pairs. Must be shorter than
+                           -connect-timeout, and needs host or srflx in
+                           -ice-candidates. The log shows how long each
+                           connection took and over which candidate types,
+                           for comparing settings. Default 0, relay
+                           candidates are sent at once
+  -ice-server URL          Also use this STUN/TURN server, e.g.
+                           turn:host:3478?user:pass or
+                           turns:host:5349?transport=tcp&user:pass. The
+                           query is percent-decoded: write & and = in a
+                           password as %26 and %3D. Repeatable; also
+                           checked by -ice-test
+  -ice-servers-replace     Use only the -ice-server servers instead of
+                           adding them to the ticket's
+  -datachannel-label NAME  Label of the control DataChannel (default: the
+                           serial number)
+  -datachannel-unordered   Allow out-of-order delivery on the control
+                           DataChannel
+  -datachannel-max-retransmits N
+                           Make the control DataChannel partially reliable
+                           with at most N retransmissions (default -1,
+                           fully reliable)
+  -datachannel-protocol NAME
+                           Subprotocol announced for the control DataChannel.
+                           The -datachannel options are only needed for
+                           camera models that negotiate it differently
+  -datachannel-timeout DUR If the connection is up but the DataChannel has
+                           not opened after DUR, log its state and likely
+                           causes; without it no startLive is sent and no
+                           media starts (default 10s, 0 disables)
+  -fail-without-datachannel
+                           Also end the session when -datachannel-timeout
+                           passes, so -reconnect starts a fresh one
+  -status                  Connect without starting video, send a status
+                           query over the DataChannel, print the camera's
+                           JSON reply (battery, signal, SD card, firmware)
+                           to stdout, and exit
+  -status-action NAME      Action of the status query (default getStatus).
+                           The name differs between camera firmwares
+  -signal-capture PATH     Append every signaling frame sent and received
+                           to PATH, one JSON record per line with the
+                           decoded SDP/ICE payload alongside. The file
+                           contains the signaling access token
+  -signal-dump PATH        Like -signal-capture, but with the access token
+                           and other credentials replaced by [redacted],
+                           so the file can be attached to a bug report.
+                           Written regardless of logging options; cannot
+                           be replayed against a real server
+  -signal-compression=false
+                           Don't ask the signaling server for
+                           permessage-deflate compression of the (large,
+                           base64) SDP frames. Servers without support
+                           decline it anyway; the session summary logs the
+                           bytes saved
+  -session-id ID           Use ID as the signaling session ID instead of
+                           generating PLATFORM-TICKET-MILLIS, e.g. to find
+                           a session in server logs. Every session, also
+                           after a reconnect, uses the same ID
+  -platform NAME           Platform the generated session ID starts with
+                           (default Android)
+  -strict-base64           Accept only padded standard base64 in the
+                           camera's signaling payloads. By default unpadded
+                           and URL-safe payloads, sent by some firmwares,
+                           are accepted too
+  -signal-replay PATH      Resend the frames a capture recorded as sent, in
+                           order and with their original spacing, to
+                           -signal-replay-url, log the responses, and exit.
+                           Combine with -signal-capture to capture the
+                           replayed session. No token or serial is needed
+  -signal-replay-url URL   WebSocket URL of the server to replay against
+  -nalu-log PATH           Write a JSON line per depacketized NAL unit to
+                           PATH: type, nal_ref_idc, size, RTP sequence and
+                           timestamp, and whether it is a keyframe. Units
+                           are logged before -wait-keyframe and
+                           -drop-frames filter them. Appends if PATH
+                           exists
+  -dump-errors PATH        Write a JSON line per video RTP packet the
+                           depacketizer discards, or that follows lost
+                           packets: RTP sequence and timestamp, the reason
+                           (sequence-gap, fua-gap, fua-orphan, fua-oversize,
+                           forbidden-bit, invalid-type, unsupported-type)
+                           and the payload in base64. An abandoned FU-A
+                           chain gets a line per fragment, and a NAL unit
+                           over -max-nalu-size one as oversize-nalu.
+                           Appends if PATH exists
+  -sslkeylog PATH          Append the DTLS session secrets to PATH in NSS key
+                           log format. In Wireshark, set it as the (D)TLS
+                           "(Pre)-Master-Secret log filename" to decrypt
+                           DTLS and the DataChannel in a capture. Pion does
+                           not export the SRTP media keys. Treat the file
+                           like a password: it decrypts the session
+  -ice-test                Fetch a ticket, check each STUN/TURN server it
+                           lists (binding request, after an allocate for
+                           TURN), print a pass/fail table with the binding
+                           round trip, and exit
+  -caps                    Print the codecs, RTCP feedback, header
+                           extensions and interceptors the viewer offers
+                           with the given -nack and -no-audio, and exit
+                           without connecting. No credentials are needed
+  -v, --version            Print version information
+  -h, --help               Show this help message
+
+Exit Status:
+  0    Session ended normally (camera left, or -status/-ice-test passed)
+  1    Other error
+  2    Invalid options or configuration
+  3    Token or camera credentials rejected, or the serial is not in the
+       account's device group
+  4    Camera offline
+  5    API, signaling or ICE servers unreachable, API rate limiting,
+       the camera at its viewer limit, or a timeout (including
+       -connect-timeout)
+  6    Connected, but no usable video arrived (-keyframe-timeout,
+       -stall-timeout)
+  130  Interrupted by SIGINT or SIGTERM
+
+Signals:
+  SIGINT, SIGTERM  Shut down gracefully (see -shutdown-grace)
+  SIGUSR1          Save a clip (see -clip-buffer); not on Windows
+  SIGHUP           Reload configuration and restart the session. The .env
+                   file and -token-file are re-read, a fresh ticket is
+                   fetched, and video continues on stdout. Command-line
+                   options and a token from -token-stdin stay as they were
+                   at startup. Nothing is applied to a running session in
+                   place; every setting takes effect through the restart
 `
 
 func main() {
-	if len(os.Args) > 1 && (os.Args[1] == "-h" || os.Args[1] == "--help") {
+	log.SetOutput(os.Stderr)
+	log.SetFlags(log.Ltime | log.Lmicroseconds)
+
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
 		fmt.Print(helpText)
 		os.Exit(0)
 	}
+	if errors.Is(err, config.ErrVersion) {
+		fmt.Println(versionString())
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Printf("[main] %v", err)
+		os.Exit(exitUsage)
+	}
+	a := &app{}
+	if cfg.Caps {
+		if err := printCaps(os.Stdout, cfg); err != nil {
+			a.fatal(os.Stderr, err)
+		}
+		os.Exit(0)
+	}
+	// fatalOut receives the message for a fatal exit; it always includes
+	// stderr so the reason is visible even when logs go elsewhere.
+	fatalOut := io.Writer(os.Stderr)
+	if cfg.LogFile != "" {
+		logFile, err := logging.OpenRotatingFile(cfg.LogFile, cfg.LogMaxSize)
+		if err != nil {
+			a.fatal(os.Stderr, err)
+		}
+		defer logFile.Close()
+		log.SetOutput(logFile)
+		fatalOut = io.MultiWriter(os.Stderr, logFile)
+	}
+	logging.SetDebug(cfg.Debug)
 
-	log.SetOutput(os.Stderr)
-	log.SetFlags(log.Ltime | log.Lmicroseconds)
+	if cfg.TUI {
+		if !isTerminal(os.Stderr) {
+			log.SetOutput(fatalOut)
+			log.Printf("[main] -tui requires stderr to be a terminal")
+			os.Exit(exitUsage)
+		}
+		a.dashboard = newStatusDisplay(os.Stderr, cfg.SerialNumber, qualityThresholds(cfg))
+		if cfg.LogFile == "" {
+			log.SetOutput(io.Discard)
+		}
+	}
 
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("[main] %v", err)
+	a.startClips(cfg)
+	defer a.closeClips()
+
+	if cfg.Events != "" {
+		sink, err := events.Open(cfg.Events)
+		if err != nil {
+			a.fatal(fatalOut, err)
+		}
+		defer sink.Close()
+		a.events = events.NewEmitter(sink)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	log.Printf("[main] %s", versionString())
+	for _, w := range cfg.Warnings {
+		log.Printf("[main] warning: %s", w)
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
 
+	if cfg.Timeouts.Connect > 0 {
+		timeout := cfg.Timeouts.Connect
+		connectTimer := time.AfterFunc(timeout, func() {
+			if !a.progress.VideoSeen() {
+				cancel(fmt.Errorf("%w: no video within %s (last phase: %s)", errConnectTimeout, timeout, a.progress.Phase()))
+			}
+		})
+		defer connectTimer.Stop()
+	}
+
+	if !cfg.Status && !cfg.ICETest && cfg.SignalReplay == "" {
+		if err := a.startPlayers(cfg, cancel); err != nil {
+			a.fatal(fatalOut, err)
+		}
+		if cfg.OutputFIFO != "" {
+			f, err := output.OpenFIFO(cfg.OutputFIFO)
+			if err != nil {
+				a.fatal(fatalOut, err)
+			}
+			defer f.Close()
+			a.fifo = f
+		}
+		if cfg.Preview != "" {
+			// O_TRUNC: a FIFO blocks here until a reader opens it.
+			f, err := os.OpenFile(cfg.Preview, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+			if err != nil {
+				a.fatal(fatalOut, fmt.Errorf("open preview output: %w", err))
+			}
+			defer f.Close()
+			a.preview = f
+		}
+	}
+
+	var interrupted atomic.Bool
 	sigCh := make(chan os.Signal, 1)
 	ossignal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		sig := <-sigCh
 		log.Printf("[main] received %s, shutting down", sig)
-		cancel()
+		interrupted.Store(true)
+		cancel(nil)
+
+		sig = <-sigCh
+		log.Printf("[main] received %s again, exiting immediately", sig)
+		a.players.Kill()
+		a.closeClips()
+		os.Exit(exitInterrupted)
 	}()
 
-	// Step 1: Fetch ticket
-	apiClient := api.NewClient()
-	log.Printf("[main] getting WebRTC ticket for %s", cfg.SerialNumber)
-	ticket, err := apiClient.FetchTicket(cfg.Token, cfg.SerialNumber)
-	if err != nil {
-		log.Fatalf("[main] get ticket: %v", err)
+	if cfg.SignalReplay != "" {
+		if err := runReplay(ctx, cfg); err != nil {
+			a.fatal(fatalOut, err)
+		}
+		return
 	}
-	log.Printf("[main] ticket obtained: id=%s signal=%s", ticket.ID, ticket.SignalServer)
 
-	// Step 2: Create peer connection
-	peer, err := webrtc.NewPeer(ticket.ICEServers, cfg.SerialNumber)
-	if err != nil {
-		log.Fatalf("[main] create peer: %v", err)
+	if cfg.ICETest {
+		ticket, err := a.tickets.Fetch(ctx, cfg)
+		if err != nil {
+			a.fatal(fatalOut, err)
+		}
+		if !runICETest(iceServers(cfg, ticket)) {
+			a.closeClips()
+			os.Exit(exitNetwork)
+		}
+		return
 	}
 
-	// Step 3: Add transceivers
-	if err := peer.AddTransceivers(); err != nil {
-		log.Fatalf("[main] add transceivers: %v", err)
+	if cfg.Status {
+		a.status = newStatusQuery(cfg.StatusAction, os.Stdout)
+		statusCtx, statusCancel := context.WithTimeoutCause(ctx, statusTimeout,
+			fmt.Errorf("no status reply within %s: %w", statusTimeout, context.DeadlineExceeded))
+		_, err := a.runSession(statusCtx, cfg)
+		statusCancel()
+		if err == nil && !a.status.Answered() {
+			err = errors.New("session ended without a status reply")
+		}
+		if err != nil {
+			a.fatal(fatalOut, fmt.Errorf("status: %w", err))
+		}
+		return
 	}
 
-	// Step 4: Create viewer (implements domain.Handler)
-	v := viewer.New(peer, cancel)
+	hupCh := make(chan os.Signal, 1)
+	ossignal.Notify(hupCh, syscall.SIGHUP)
 
-	// Step 5: Create signal client with viewer as handler
-	sc := sigclient.NewClient(ticket, cfg.SerialNumber, v)
-
-	// Step 6: Complete the circular dependency
-	v.SetSignaler(sc)
-
-	// Step 7: Set up track handler (H264 → stdout)
-	peer.SetOnTrack(os.Stdout)
-
-	// Step 8: Set up ICE candidate forwarding
-	peer.SetOnICECandidate(func(sdpMid string, sdpMLineIndex int, candidate string) {
-		sc.SendICECandidate(sdpMid, sdpMLineIndex, candidate)
-	})
-
-	// Step 9: Connect signaling (AUTH → JOIN_LIVE → PEER_IN → offer flow)
-	if err := sc.Connect(); err != nil {
-		log.Fatalf("[main] signal connect: %v", err)
+	if err := a.reconnectLoop(ctx, cfg, hupCh, clock.Real, a.runSession); err != nil {
+		a.fatal(fatalOut, err)
 	}
 
-	<-ctx.Done()
-	log.Printf("[main] shutting down")
-
-	peer.Close()
-	sc.Close()
-
+	if err := context.Cause(ctx); errors.Is(err, errConnectTimeout) {
+		a.fatal(fatalOut, err)
+	}
+	a.players.Stop()
+	if a.fifo != nil && a.fifo.Dropped() > 0 {
+		log.Printf("[main] %d bytes of video dropped while no reader had %s open", a.fifo.Dropped(), cfg.OutputFIFO)
+	}
 	log.Printf("[main] done")
+	if interrupted.Load() {
+		a.closeClips()
+		os.Exit(exitInterrupted)
+	}
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxNALUFilterReply bounds a NAL unit read back from -nalu-filter, so a
+// confused filter cannot make the reader allocate without limit.
+const maxNALUFilterReply = 16 << 20
+
+// naluFilter is the -nalu-filter subprocess. Each NAL unit of the main
+// stream is written to its stdin as a 4-byte big-endian length and the
+// bytes, and it answers each with a NAL unit framed the same way, which
+// is written in its place. A zero length drops the unit.
+type naluFilter struct {
+	name string
+	cmd  *exec.Cmd
+	in   io.WriteCloser
+	out  *bufio.Reader
+	done chan struct{}
+	// fail reports the first error, after which every NAL unit is
+	// dropped rather than written unfiltered.
+	fail   func(error)
+	failed bool
+}
+
+// startNALUFilter runs command, split on spaces, as a naluFilter. fail is
+// called once if the filter breaks or exits.
+func startNALUFilter(command string, fail func(error)) (*naluFilter, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("-nalu-filter: empty command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("-nalu-filter: %w", err)
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("-nalu-filter: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start -nalu-filter %s: %w", args[0], err)
+	}
+	log.Printf("[main] filtering NAL units through %s (pid %d)", args[0], cmd.Process.Pid)
+	f := &naluFilter{name: args[0], cmd: cmd, in: in, out: bufio.NewReader(out), done: make(chan struct{}), fail: fail}
+	go func() {
+		cmd.Wait()
+		close(f.done)
+	}()
+	return f, nil
+}
+
+// Process sends nalu to the filter and returns its answer, for
+// webrtc.Peer.SetNALUProcessor.
+func (f *naluFilter) Process(nalu []byte) []byte {
+	if f.failed {
+		return nil
+	}
+	reply, err := f.exchange(nalu)
+	if err != nil {
+		f.failed = true
+		f.fail(fmt.Errorf("-nalu-filter %s: %w", f.name, err))
+		return nil
+	}
+	return reply
+}
+
+func (f *naluFilter) exchange(nalu []byte) ([]byte, error) {
+	msg := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(nalu)), uint32(len(nalu)))
+	if _, err := f.in.Write(append(msg, nalu...)); err != nil {
+		return nil, err
+	}
+	var header [4]byte
+	if _, err := io.ReadFull(f.out, header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if n > maxNALUFilterReply {
+		return nil, fmt.Errorf("answered with a %d-byte NAL unit, over the %d-byte limit", n, maxNALUFilterReply)
+	}
+	// A new slice each time: the output may still hold the last one.
+	reply := make([]byte, n)
+	if _, err := io.ReadFull(f.out, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Close closes the filter's input so it can exit, and kills it if it has
+// not within playerStopTimeout.
+func (f *naluFilter) Close() {
+	f.in.Close()
+	select {
+	case <-f.done:
+	case <-time.After(playerStopTimeout):
+		log.Printf("[main] %s did not exit, killing it", f.name)
+		f.cmd.Process.Kill()
+		<-f.done
+	}
+}
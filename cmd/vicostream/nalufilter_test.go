@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// pipeFilter returns a naluFilter talking to answer over pipes instead of
+// a subprocess. answer sees each NAL unit sent and returns the reply to
+// frame, or nil to close the filter's stdout.
+func pipeFilter(t *testing.T, answer func(nalu []byte) []byte) (*naluFilter, *[]error) {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		defer outW.Close()
+		r := bufio.NewReader(inR)
+		for {
+			var header [4]byte
+			if _, err := io.ReadFull(r, header[:]); err != nil {
+				return
+			}
+			nalu := make([]byte, binary.BigEndian.Uint32(header[:]))
+			if _, err := io.ReadFull(r, nalu); err != nil {
+				return
+			}
+			reply := answer(nalu)
+			if reply == nil {
+				inR.CloseWithError(io.ErrClosedPipe)
+				return
+			}
+			outW.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(reply)-1)), reply[1:]...))
+		}
+	}()
+	var errs []error
+	f := &naluFilter{name: "filter", in: inW, out: bufio.NewReader(outR), fail: func(err error) { errs = append(errs, err) }}
+	return f, &errs
+}
+
+func TestNALUFilter_Process(t *testing.T) {
+	// Replies carry a leading marker byte so an empty answer can be told
+	// from a closed pipe: drop SEI, tag slices.
+	f, errs := pipeFilter(t, func(nalu []byte) []byte {
+		switch nalu[0] & 0x1f {
+		case 6:
+			return []byte{0}
+		case 9:
+			return nil
+		}
+		return append(append([]byte{0}, nalu...), 0xff)
+	})
+	tests := []struct {
+		nalu []byte
+		want []byte
+	}{
+		{[]byte{0x65, 0x88}, []byte{0x65, 0x88, 0xff}},
+		{[]byte{0x06, 0x05}, []byte{}},
+		{[]byte{0x41, 0x9a}, []byte{0x41, 0x9a, 0xff}},
+	}
+	for _, tt := range tests {
+		if got := f.Process(tt.nalu); !bytes.Equal(got, tt.want) {
+			t.Errorf("% x: expected % x, got % x", tt.nalu, tt.want, got)
+		}
+	}
+	if len(*errs) != 0 {
+		t.Fatalf("expected no errors, got %v", *errs)
+	}
+
+	// An access unit delimiter closes the filter: that unit and every
+	// later one is dropped, and the failure reported once.
+	if got := f.Process([]byte{0x09, 0xf0}); got != nil {
+		t.Errorf("expected nothing written once the filter broke, got % x", got)
+	}
+	if got := f.Process([]byte{0x41, 0x9a}); got != nil {
+		t.Errorf("expected nothing written after the filter broke, got % x", got)
+	}
+	if len(*errs) != 1 || !errors.Is((*errs)[0], io.ErrClosedPipe) && !errors.Is((*errs)[0], io.EOF) {
+		t.Errorf("expected one error from the broken filter, got %v", *errs)
+	}
+}
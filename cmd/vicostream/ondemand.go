@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"vico_home/native/internal/clock"
+	"vico_home/native/internal/config"
+)
+
+// errNoReader is the cancellation cause when -on-demand ends a session
+// because no reader has had the FIFO open for onDemandLinger.
+var errNoReader = errors.New("no reader on the output FIFO")
+
+// onDemandLinger is how long a session outlives the last FIFO reader, so
+// a consumer that restarts does not also restart the camera stream.
+const onDemandLinger = 10 * time.Second
+
+// waitForReader blocks until a reader has the -output-fifo pipe open. It
+// returns false if ctx ended first.
+func (a *app) waitForReader(ctx context.Context, cfg *config.Config) bool {
+	if a.fifo.Attached() {
+		return true
+	}
+	log.Printf("[main] waiting for a reader on %s before streaming", cfg.OutputFIFO)
+	return a.fifo.WaitReader(ctx) == nil
+}
+
+// watchReader checks attached every second and ends the session with
+// errNoReader once it has reported no reader for onDemandLinger.
+func watchReader(ctx context.Context, clk clock.Clock, attached func() bool, cancel context.CancelCauseFunc) {
+	ticker := clk.NewTicker(time.Second)
+	defer ticker.Stop()
+	var since time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C():
+			switch {
+			case attached():
+				since = time.Time{}
+			case since.IsZero():
+				since = now
+			case now.Sub(since) >= onDemandLinger:
+				log.Printf("[main] no reader on the output FIFO for %s, stopping the stream until one attaches", onDemandLinger)
+				cancel(errNoReader)
+				return
+			}
+		}
+	}
+}
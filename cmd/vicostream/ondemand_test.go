@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+)
+
+// readerWatch runs watchReader on a fake clock. Each check of the reader
+// is handed to the test through polls, so a tick is known to be handled
+// before the next one.
+type readerWatch struct {
+	clk      *clock.Fake
+	attached atomic.Bool
+	polls    chan struct{}
+	ctx      context.Context
+}
+
+func startReaderWatch(t *testing.T) *readerWatch {
+	t.Helper()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	w := &readerWatch{clk: clock.NewFake(time.Unix(1700000000, 0)), polls: make(chan struct{}), ctx: ctx}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watchReader(ctx, w.clk, func() bool {
+			// Read before handing over, so the test's next change of
+			// attached applies to the next tick, not this one.
+			attached := w.attached.Load()
+			w.polls <- struct{}{}
+			return attached
+		}, cancel)
+	}()
+	t.Cleanup(func() {
+		cancel(nil)
+		<-done
+	})
+	w.clk.BlockUntil(1)
+	return w
+}
+
+// tick advances the clock a second and waits for the check it triggers.
+func (w *readerWatch) tick(t *testing.T) {
+	t.Helper()
+	w.clk.Advance(time.Second)
+	select {
+	case <-w.polls:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the reader checked after a tick")
+	}
+}
+
+// ended reports whether watchReader ended the session, waiting a little
+// for it to do so.
+func (w *readerWatch) ended() bool {
+	select {
+	case <-w.ctx.Done():
+		return true
+	case <-time.After(20 * time.Millisecond):
+		return false
+	}
+}
+
+func TestWatchReader_EndsAfterLinger(t *testing.T) {
+	w := startReaderWatch(t)
+	// The first check without a reader starts the linger.
+	for i := 0; i < int(onDemandLinger/time.Second); i++ {
+		w.tick(t)
+	}
+	if w.ended() {
+		t.Fatalf("expected the session kept for %s without a reader", onDemandLinger)
+	}
+	w.tick(t)
+	if !w.ended() {
+		t.Fatalf("expected the session ended after %s without a reader", onDemandLinger)
+	}
+	if cause := context.Cause(w.ctx); !errors.Is(cause, errNoReader) {
+		t.Errorf("expected errNoReader, got %v", cause)
+	}
+}
+
+func TestWatchReader_ReattachRestartsLinger(t *testing.T) {
+	w := startReaderWatch(t)
+	for i := 0; i < int(onDemandLinger/time.Second); i++ {
+		w.tick(t)
+	}
+	w.attached.Store(true)
+	w.tick(t)
+	w.attached.Store(false)
+	for i := 0; i < int(onDemandLinger/time.Second); i++ {
+		w.tick(t)
+	}
+	if w.ended() {
+		t.Fatalf("expected a reattached reader to restart the linger")
+	}
+	w.tick(t)
+	if !w.ended() {
+		t.Fatalf("expected the session ended %s after the reader left again", onDemandLinger)
+	}
+}
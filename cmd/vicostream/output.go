@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"vico_home/native/internal/config"
+	"vico_home/native/internal/output"
+)
+
+// openOutput creates the file -output-template names for the next
+// session, along with any missing directories. An existing file is
+// appended to, which keeps an H264 stream decodable. It reports whether
+// the file is the one the previous session wrote to.
+func (a *app) openOutput(cfg *config.Config) (f *os.File, same bool, err error) {
+	tmpl, err := output.ParseTemplate(cfg.OutputTemplate)
+	if err != nil {
+		return nil, false, err
+	}
+	path := tmpl.Expand(output.Fields{
+		Serial: cfg.SerialNumber,
+		Time:   time.Now(),
+		Index:  a.sessionIndex,
+	})
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, false, fmt.Errorf("create output directory: %w", err)
+		}
+	}
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, false, fmt.Errorf("open output: %w", err)
+	}
+	log.Printf("[main] writing video to %s", path)
+	same = path == a.outputPath
+	a.outputPath = path
+	return f, same, nil
+}
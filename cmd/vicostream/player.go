@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"vico_home/native/internal/config"
+)
+
+// playerStopTimeout bounds how long a player may take to finish once its
+// input is closed; ffmpeg needs the time to write the MP4 index.
+const playerStopTimeout = 5 * time.Second
+
+// player is an FFmpeg process the H264 stream is piped to.
+type player struct {
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	done  chan struct{}
+	err   error
+}
+
+// playerGroup runs players side by side, writing the same video to each.
+// Start them all before the first Out; Stop and Kill end them all.
+type playerGroup struct {
+	players []*player
+	out     io.Writer
+	// stopping is set once the players are being stopped, so their exit
+	// is not mistaken for one closing by itself.
+	stopping atomic.Bool
+	// watchers tracks the goroutines waiting on each player's exit, so
+	// Stop and Kill return only once none can still cancel the program.
+	watchers sync.WaitGroup
+}
+
+// startPlayers starts the subprocesses -play and -record ask for. When
+// one exits by itself, e.g. because its window was closed, cancel ends
+// the program.
+func (a *app) startPlayers(cfg *config.Config, cancel context.CancelCauseFunc) error {
+	if cfg.Play {
+		if err := a.players.Start(cancel, "ffplay", "-hide_banner", "-loglevel", "warning",
+			"-fflags", "nobuffer", "-autoexit", "-f", "h264", "-i", "-"); err != nil {
+			return fmt.Errorf("-play: %w", err)
+		}
+	}
+	if cfg.Record != "" {
+		// -n: never overwrite an earlier recording.
+		if err := a.players.Start(cancel, "ffmpeg", "-hide_banner", "-loglevel", "warning", "-n",
+			"-use_wallclock_as_timestamps", "1", "-f", "h264", "-i", "-", "-c", "copy", cfg.Record); err != nil {
+			a.players.Stop()
+			return fmt.Errorf("-record: %w", err)
+		}
+	}
+	return nil
+}
+
+// Start runs the program name with args and adds it to the group. If it
+// exits before the group is stopped, cancel ends the program, with the
+// error if it failed.
+func (g *playerGroup) Start(cancel context.CancelCauseFunc, name string, args ...string) error {
+	p, err := startPlayer(name, args...)
+	if err != nil {
+		return err
+	}
+	g.players = append(g.players, p)
+	writers := make([]io.Writer, len(g.players))
+	for i, p := range g.players {
+		writers[i] = p
+	}
+	g.out = io.MultiWriter(writers...)
+	g.watchers.Add(1)
+	go func() {
+		defer g.watchers.Done()
+		<-p.done
+		if g.stopping.Load() {
+			return
+		}
+		if p.err != nil {
+			cancel(fmt.Errorf("%s exited: %w", p.name, p.err))
+			return
+		}
+		log.Printf("[main] %s exited, shutting down", p.name)
+		cancel(nil)
+	}()
+	return nil
+}
+
+// Out writes to every player. It is nil when there are none.
+func (g *playerGroup) Out() io.Writer {
+	return g.out
+}
+
+// Stop stops every player; see player.stop.
+func (g *playerGroup) Stop() {
+	g.stopping.Store(true)
+	for _, p := range g.players {
+		p.stop()
+	}
+	g.watchers.Wait()
+}
+
+// Kill kills every player without waiting for it to finish.
+func (g *playerGroup) Kill() {
+	g.stopping.Store(true)
+	for _, p := range g.players {
+		p.kill()
+	}
+	g.watchers.Wait()
+}
+
+func startPlayer(name string, args ...string) (*player, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found; install FFmpeg or add it to PATH: %w", name, err)
+	}
+	cmd := exec.Command(path, args...)
+	// stdout carries no video when players are used, but keep FFmpeg's
+	// chatter on stderr with the rest of the logs regardless.
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", name, err)
+	}
+	log.Printf("[main] piping video to %s (pid %d)", name, cmd.Process.Pid)
+	p := &player{name: name, cmd: cmd, stdin: stdin, done: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+func (p *player) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+// stop closes the player's input so it can finish, and kills it if it
+// has not exited within playerStopTimeout.
+func (p *player) stop() {
+	p.stdin.Close()
+	select {
+	case <-p.done:
+	case <-time.After(playerStopTimeout):
+		log.Printf("[main] %s did not exit, killing it", p.name)
+		p.kill()
+	}
+}
+
+func (p *player) kill() {
+	p.cmd.Process.Kill()
+	<-p.done
+}
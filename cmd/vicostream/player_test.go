@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestPlayers starts a group of players running the shell scripts,
+// which stand in for ffplay and ffmpeg, and returns it with the context
+// an exiting player cancels.
+func startTestPlayers(t *testing.T, scripts ...string) (*playerGroup, context.Context) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run fake players with")
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	t.Cleanup(func() { cancel(nil) })
+	g := &playerGroup{}
+	t.Cleanup(g.Kill)
+	for _, script := range scripts {
+		if err := g.Start(cancel, "sh", "-c", script); err != nil {
+			t.Fatalf("start %q: %v", script, err)
+		}
+	}
+	return g, ctx
+}
+
+func TestPlayerGroup_ExitEndsProgram(t *testing.T) {
+	tests := []struct {
+		script  string
+		wantErr bool
+	}{
+		{"exit 0", false},
+		{"exit 3", true},
+	}
+	for _, tt := range tests {
+		_, ctx := startTestPlayers(t, "cat >/dev/null", tt.script)
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q: expected the exit to end the program", tt.script)
+		}
+		// A clean exit cancels with no cause, which reads as Canceled.
+		err := context.Cause(ctx)
+		if failed := !errors.Is(err, context.Canceled); failed != tt.wantErr {
+			t.Errorf("%q: expected a failure %v, got %v", tt.script, tt.wantErr, err)
+		}
+	}
+}
+
+func TestPlayerGroup_MissingProgram(t *testing.T) {
+	g := &playerGroup{}
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	err := g.Start(cancel, "vicostream-no-such-player")
+	if !errors.Is(err, exec.ErrNotFound) || !strings.Contains(err.Error(), "install FFmpeg") {
+		t.Errorf("expected a not found error naming FFmpeg, got %v", err)
+	}
+	if g.Out() != nil {
+		t.Error("expected no output without players")
+	}
+}
+
+func TestPlayerGroup_StopClosesInputAndWaits(t *testing.T) {
+	g, ctx := startTestPlayers(t, "cat >/dev/null", "cat >/dev/null")
+	if _, err := g.Out().Write([]byte{0, 0, 0, 1, 0x65}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		g.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(playerStopTimeout):
+		t.Fatal("expected the players to exit once their input closed")
+	}
+	for _, p := range g.players {
+		if p.err != nil {
+			t.Errorf("expected a clean exit, got %v", p.err)
+		}
+	}
+	// The exits were asked for, so they do not end the program. Stop
+	// has waited for the goroutines that would have cancelled it.
+	if ctx.Err() != nil {
+		t.Errorf("expected the stop not to cancel the program, got %v", context.Cause(ctx))
+	}
+}
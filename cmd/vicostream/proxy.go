@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+
+	"vico_home/native/internal/config"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyFunc chooses the proxy for the API and signaling connections. An
+// explicit -proxy applies to both. Otherwise the usual environment
+// variables do, with ALL_PROXY as the fallback for HTTPS_PROXY, which
+// Go's own environment handling ignores. Media over ICE never uses it.
+func proxyFunc(cfg *config.Config) func(*http.Request) (*url.URL, error) {
+	if cfg.Proxy != "" {
+		u, _ := url.Parse(cfg.Proxy) // validated by config.Load
+		return http.ProxyURL(u)
+	}
+	pc := &httpproxy.Config{
+		HTTPProxy:  getenvAny("HTTP_PROXY", "http_proxy"),
+		HTTPSProxy: getenvAny("HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy"),
+		NoProxy:    getenvAny("NO_PROXY", "no_proxy"),
+	}
+	fn := pc.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return fn(req.URL)
+	}
+}
+
+// getenvAny returns the first of keys that is set and not empty.
+func getenvAny(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"vico_home/native/internal/config"
+)
+
+func TestProxyFunc(t *testing.T) {
+	tests := []struct {
+		name  string
+		flag  string
+		env   map[string]string
+		url   string
+		proxy string // "" for a direct connection
+	}{
+		{"direct", "", nil, "https://api-us.vicoo.tech/device", ""},
+		{"flag", "socks5://127.0.0.1:1080", map[string]string{"HTTPS_PROXY": "http://env:3128"}, "https://api-us.vicoo.tech/device", "socks5://127.0.0.1:1080"},
+		{"flag ignores NO_PROXY", "http://flag:3128", map[string]string{"NO_PROXY": "vicoo.tech"}, "https://api-us.vicoo.tech/device", "http://flag:3128"},
+		{"HTTPS_PROXY", "", map[string]string{"HTTPS_PROXY": "http://env:3128"}, "https://api-us.vicoo.tech/device", "http://env:3128"},
+		{"lower case", "", map[string]string{"https_proxy": "http://lower:3128"}, "https://api-us.vicoo.tech/device", "http://lower:3128"},
+		{"ALL_PROXY fallback", "", map[string]string{"ALL_PROXY": "socks5://all:1080"}, "https://sig.vicoo.tech/ws", "socks5://all:1080"},
+		{"HTTPS_PROXY over ALL_PROXY", "", map[string]string{"HTTPS_PROXY": "http://env:3128", "ALL_PROXY": "socks5://all:1080"}, "https://api-us.vicoo.tech/device", "http://env:3128"},
+		{"HTTP_PROXY for http only", "", map[string]string{"HTTP_PROXY": "http://plain:3128"}, "https://api-us.vicoo.tech/device", ""},
+		{"HTTP_PROXY", "", map[string]string{"HTTP_PROXY": "http://plain:3128"}, "http://sig.vicoo.tech/ws", "http://plain:3128"},
+		{"NO_PROXY", "", map[string]string{"HTTPS_PROXY": "http://env:3128", "NO_PROXY": ".vicoo.tech"}, "https://api-us.vicoo.tech/device", ""},
+		{"NO_PROXY other host", "", map[string]string{"HTTPS_PROXY": "http://env:3128", "no_proxy": "example.com"}, "https://api-us.vicoo.tech/device", "http://env:3128"},
+	}
+	keys := []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy", "NO_PROXY", "no_proxy", "REQUEST_METHOD"}
+	for _, tt := range tests {
+		for _, k := range keys {
+			t.Setenv(k, tt.env[k])
+		}
+		req, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := proxyFunc(&config.Config{Proxy: tt.flag})(req)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		gotProxy := ""
+		if got != nil {
+			gotProxy = got.String()
+		}
+		if gotProxy != tt.proxy {
+			t.Errorf("%s: expected proxy %q for %s, got %q", tt.name, tt.proxy, tt.url, gotProxy)
+		}
+	}
+}
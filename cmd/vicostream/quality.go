@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"vico_home/native/internal/config"
+	"vico_home/native/internal/webrtc"
+)
+
+// qualityThresholds converts the -quality-* options.
+func qualityThresholds(cfg *config.Config) webrtc.QualityThresholds {
+	return webrtc.QualityThresholds{
+		LossFair: cfg.QualityLoss[0], LossPoor: cfg.QualityLoss[1],
+		JitterFair: cfg.QualityJitter[0], JitterPoor: cfg.QualityJitter[1],
+		RTTFair: cfg.QualityRTT[0], RTTPoor: cfg.QualityRTT[1],
+	}
+}
+
+// logQuality logs the connection quality of each interval until ctx is
+// done. Intervals without video are skipped.
+func logQuality(ctx context.Context, peer *webrtc.Peer, interval time.Duration, th webrtc.QualityThresholds) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	prev := peer.Stats()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cur := peer.Stats()
+			if q := webrtc.ClassifyQuality(prev, cur, th); q != webrtc.QualityUnknown {
+				log.Printf("[main] quality %s: %.2f Mbit/s, %s", q, cur.Bitrate.Average/1e6, formatQuality(prev, cur))
+			}
+			prev = cur
+		}
+	}
+}
+
+// formatQuality describes the classifier inputs for the interval between
+// prev and cur.
+func formatQuality(prev, cur webrtc.Stats) string {
+	received := cur.VideoPackets - prev.VideoPackets
+	lost := cur.PacketsLost - prev.PacketsLost
+	var loss float64
+	if received+lost > 0 {
+		loss = 100 * float64(lost) / float64(received+lost)
+	}
+	return fmt.Sprintf("loss %.1f%%, jitter %s, rtt %s", loss, cur.Jitter.Round(time.Millisecond), formatRTT(cur.RTT))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"vico_home/native/internal/api"
+	"vico_home/native/internal/clock"
+	"vico_home/native/internal/config"
+	"vico_home/native/internal/events"
+	"vico_home/native/internal/logging"
+	"vico_home/native/internal/retry"
+	sigclient "vico_home/native/internal/signal"
+)
+
+// sessionFunc runs one session; app.runSession outside tests.
+type sessionFunc func(ctx context.Context, cfg *config.Config) (gotVideo bool, err error)
+
+// reconnectLoop runs sessions with run until ctx ends, the user gives up
+// on an on-demand reader, or a session fails in a way -reconnect does not
+// retry, waiting on clk between sessions. A signal on hup reloads the
+// configuration and restarts the session. It returns the error to exit
+// with, or nil.
+func (a *app) reconnectLoop(ctx context.Context, cfg *config.Config, hup <-chan os.Signal, clk clock.Clock, run sessionFunc) error {
+	backoff := retry.NewBackoff(cfg.ReconnectBase, cfg.ReconnectMax)
+	redirects := 0 // in a row, without video between them
+	for {
+		if cfg.OnDemand && !a.waitForReader(ctx, cfg) {
+			return nil
+		}
+		sessCtx, cancelSession := context.WithCancelCause(ctx)
+		go func() {
+			select {
+			case <-hup:
+				log.Printf("[main] received SIGHUP, reloading configuration")
+				cancelSession(errReload)
+			case <-sessCtx.Done():
+			}
+		}()
+
+		gotVideo, err := run(sessCtx, cfg)
+		cancelSession(nil)
+		if gotVideo {
+			a.progress.SetVideoSeen()
+		}
+
+		if errors.Is(err, errReload) {
+			reloaded, err := config.Load(os.Args[1:])
+			if err != nil {
+				log.Printf("[main] reload configuration: %v (keeping previous configuration)", err)
+				continue
+			}
+			cfg = reloaded
+			logging.SetDebug(cfg.Debug)
+			for _, w := range cfg.Warnings {
+				log.Printf("[main] warning: %s", w)
+			}
+			backoff = retry.NewBackoff(cfg.ReconnectBase, cfg.ReconnectMax)
+			continue
+		}
+
+		if errors.Is(err, errNoReader) && ctx.Err() == nil {
+			backoff.Reset()
+			continue
+		}
+
+		waitForSlot := cfg.WaitForSlot && errors.Is(err, sigclient.ErrViewerLimit)
+		if ctx.Err() != nil || !(cfg.Reconnect && retryable(err) || waitForSlot) {
+			return err
+		}
+
+		if gotVideo {
+			backoff.Reset()
+			redirects = 0
+		}
+		if errors.Is(err, sigclient.ErrRedirected) {
+			redirects++
+		} else {
+			redirects = 0
+		}
+		if cfg.MaxReconnects > 0 && backoff.Attempt() >= cfg.MaxReconnects {
+			if err == nil {
+				err = errors.New("session ended without video")
+			}
+			return fmt.Errorf("giving up after %d failed reconnects: %w", backoff.Attempt(), err)
+		}
+		delay := backoff.Next()
+		if errors.Is(err, api.ErrRateLimited) {
+			wait := api.RetryAfter(err)
+			if wait == 0 {
+				wait = rateLimitWait
+			}
+			delay = max(delay, wait)
+			log.Printf("[main] warning: the API is rate limiting ticket requests; waiting %s", delay.Round(time.Millisecond))
+		}
+		if errors.Is(err, sigclient.ErrServerBusy) {
+			wait := sigclient.RetryAfter(err)
+			if wait == 0 {
+				wait = rateLimitWait
+			}
+			delay = max(delay, wait)
+			log.Printf("[main] warning: the signal server asked to back off; waiting %s", delay.Round(time.Millisecond))
+		}
+		if waitForSlot {
+			log.Printf("[main] camera %s is at its viewer limit; waiting for a viewer to leave", cfg.SerialNumber)
+		}
+		if redirects > 0 {
+			// The server asked for the reconnect, so it is not a failure
+			// to back off from, unless servers keep redirecting without
+			// any video: then they may be sending the client in circles.
+			a.tickets.NoteRedirect(err)
+			if redirects == 1 {
+				delay = 0
+			} else {
+				delay = max(delay, cfg.ReconnectBase)
+				log.Printf("[main] warning: redirected %d times in a row; backing off", redirects)
+			}
+		}
+		if err != nil {
+			log.Printf("[main] session failed: %v", err)
+		} else {
+			log.Printf("[main] session ended")
+		}
+		log.Printf("[main] reconnecting in %s (attempt %d)", delay.Round(time.Millisecond), backoff.Attempt())
+		a.events.Emit(events.Reconnecting, delay.Round(time.Millisecond).String())
+		select {
+		case <-clk.After(delay):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+	"vico_home/native/internal/config"
+	"vico_home/native/internal/domain"
+	sigclient "vico_home/native/internal/signal"
+	"vico_home/native/internal/signal/signaltest"
+)
+
+// joiningHandler joins the live session once authenticated, as the
+// viewer does, and hands the client's errors to the session.
+type joiningHandler struct {
+	client *sigclient.Client
+	errs   chan error
+}
+
+func (h *joiningHandler) OnAuthSuccess()                                  { h.client.SendJoinLive() }
+func (h *joiningHandler) OnPeerIn()                                       {}
+func (h *joiningHandler) OnPeerOut()                                      {}
+func (h *joiningHandler) OnSDPAnswer(domain.SDPPayload)                   {}
+func (h *joiningHandler) OnSDPOffer(domain.SDPPayload)                    {}
+func (h *joiningHandler) OnRemoteICECandidate(domain.ICECandidatePayload) {}
+func (h *joiningHandler) OnError(err error)                               { h.errs <- err }
+
+// TestReconnectLoop_RedialsAfterDrop runs the reconnect loop with sessions
+// that only sign in to a local signaling server. The server drops the
+// first connection after the join; the loop should wait out its backoff
+// on the clock, then start a session that authenticates and joins again.
+func TestReconnectLoop_RedialsAfterDrop(t *testing.T) {
+	srv := signaltest.NewServer(true)
+	defer srv.Close()
+	ticket := srv.Ticket()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sessions := make(chan error, 10)
+	run := func(ctx context.Context, cfg *config.Config) (bool, error) {
+		h := &joiningHandler{errs: make(chan error, 10)}
+		h.client = sigclient.NewClient(ticket, cfg.SerialNumber, h)
+		if err := h.client.Connect(); err != nil {
+			return false, err
+		}
+		defer h.client.Close()
+		var err error
+		select {
+		case err = <-h.errs:
+		case <-ctx.Done():
+		}
+		sessions <- err
+		return false, err
+	}
+
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	cfg := &config.Config{SerialNumber: "serial", Reconnect: true, ReconnectBase: time.Second, ReconnectMax: time.Second}
+	done := make(chan error, 1)
+	go func() { done <- (&app{}).reconnectLoop(ctx, cfg, nil, clk, run) }()
+
+	select {
+	case err := <-sessions:
+		if !errors.Is(err, sigclient.ErrConnectionLost) {
+			t.Fatalf("expected the first session to end with ErrConnectionLost, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the first session to end when the server dropped it")
+	}
+	clk.BlockUntil(1)
+	if got := len(srv.Methods()); got != 1 {
+		t.Fatalf("expected no redial before the backoff ends, got %d connections", got)
+	}
+	clk.Advance(time.Second)
+
+	want := []string{"AUTH token", "JOIN_LIVE "}
+	deadline := time.After(2 * time.Second)
+	for {
+		got := srv.Methods()
+		if len(got) == 2 && slices.Equal(got[0], want) && slices.Equal(got[1], want) {
+			break
+		}
+		select {
+		case <-srv.Seen():
+		case <-deadline:
+			t.Fatalf("expected both connections to send %q, got %q", want, got)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected the loop to end cleanly once cancelled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the loop to end once cancelled")
+	}
+	if err := <-sessions; err != nil {
+		t.Errorf("expected the redialed session to stay up until cancelled, got %v", err)
+	}
+}
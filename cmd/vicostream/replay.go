@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"vico_home/native/internal/config"
+	sigclient "vico_home/native/internal/signal"
+)
+
+// replayLinger is how long -signal-replay keeps listening for the
+// server's responses after the last frame is sent.
+const replayLinger = 5 * time.Second
+
+// runReplay resends the sent frames of the -signal-replay capture. With
+// -signal-capture the replayed session is captured too, so the server's
+// responses can be compared with the original.
+func runReplay(ctx context.Context, cfg *config.Config) error {
+	f, err := os.Open(cfg.SignalReplay)
+	if err != nil {
+		return fmt.Errorf("open replay: %w", err)
+	}
+	records, err := sigclient.ReadCapture(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	var rec *sigclient.Recorder
+	if cfg.SignalCapture != "" {
+		r, closeCapture, err := openCapture(cfg.SignalCapture, false)
+		if err != nil {
+			return err
+		}
+		defer closeCapture()
+		rec = r
+	}
+
+	log.Printf("[main] replaying %d frames from %s to %s", len(records), cfg.SignalReplay, cfg.SignalReplayURL)
+	return sigclient.Replay(ctx, cfg.SignalReplayURL, records, rec, replayLinger)
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"vico_home/native/internal/api"
+	"vico_home/native/internal/clock"
+	"vico_home/native/internal/config"
+	"vico_home/native/internal/domain"
+	"vico_home/native/internal/events"
+	sigclient "vico_home/native/internal/signal"
+	"vico_home/native/internal/viewer"
+	"vico_home/native/internal/webrtc"
+)
+
+// errReload is the cancellation cause used to end a session so that it
+// can be restarted with reloaded configuration.
+var errReload = errors.New("configuration reload requested")
+
+// ticketCache keeps the latest ticket, from the previous session or a
+// refresh of the running one, which a reconnect refreshes instead of
+// starting from scratch. redirect is the signal server the last session
+// was redirected to, which the next session connects to instead of the
+// ticket's. mu guards them against watchTicket.
+type ticketCache struct {
+	mu       sync.Mutex
+	serial   string
+	ticket   *domain.Ticket
+	redirect string
+}
+
+// Fetch gets a ticket for cfg's camera, refreshing the cached one if it
+// is for the same camera.
+func (c *ticketCache) Fetch(ctx context.Context, cfg *config.Config) (*domain.Ticket, error) {
+	apiClient := api.NewClient(api.Options{
+		Language:    cfg.Language,
+		TimeZone:    cfg.TimeZone,
+		Proxy:       proxyFunc(cfg),
+		Credentials: cfg.Credentials,
+	})
+	c.mu.Lock()
+	prev := c.ticket
+	if c.serial != cfg.SerialNumber {
+		prev = nil
+	}
+	c.mu.Unlock()
+	if prev != nil {
+		log.Printf("[main] refreshing WebRTC ticket for %s", cfg.SerialNumber)
+	} else {
+		log.Printf("[main] getting WebRTC ticket for %s", cfg.SerialNumber)
+	}
+	ticket, err := apiClient.RefreshTicket(ctx, cfg.SerialNumber, prev)
+	if err != nil {
+		return nil, fmt.Errorf("get ticket: %w", err)
+	}
+	log.Printf("[main] ticket obtained: id=%s signal=%s", ticket.ID, ticket.SignalServer)
+	if ticket.MaxAllocationLimit > 0 {
+		log.Printf("[main] camera allows %d concurrent viewers", ticket.MaxAllocationLimit)
+	}
+	if prev != nil {
+		if changes := api.TicketChanges(prev, ticket); len(changes) > 0 {
+			log.Printf("[main] ticket changed: %s", strings.Join(changes, ", "))
+		}
+	}
+	c.mu.Lock()
+	c.serial, c.ticket = cfg.SerialNumber, ticket
+	redirect := c.redirect
+	c.redirect = ""
+	c.mu.Unlock()
+	if redirect != "" && redirect != ticket.SignalServer {
+		log.Printf("[main] signaling with %s, as the server redirected", redirect)
+		redirected := *ticket
+		redirected.SignalServer = redirect
+		return &redirected, nil
+	}
+	return ticket, nil
+}
+
+// NoteRedirect remembers the signal server err redirects to, if any, for
+// the next session.
+func (c *ticketCache) NoteRedirect(err error) {
+	if target := sigclient.RedirectTarget(err); target != "" {
+		c.mu.Lock()
+		c.redirect = target
+		c.mu.Unlock()
+	}
+}
+
+// minTicketRefresh is the shortest wait between ticket refreshes, which
+// also paces retries after a failed refresh.
+const minTicketRefresh = time.Minute
+
+// watchTicket refreshes ticket margin before it expires, until ctx ends,
+// so the ticket a reconnect starts from stays current through a long
+// session. fetch gets the new ticket and records it for the reconnect;
+// the running session keeps the credentials it connected with.
+func watchTicket(ctx context.Context, clk clock.Clock, margin time.Duration, ticket *domain.Ticket, fetch func(context.Context) (*domain.Ticket, error)) {
+	for {
+		expiry := api.TicketExpiry(ticket)
+		if expiry.IsZero() {
+			return
+		}
+		wait := max(expiry.Sub(clk.Now())-margin, minTicketRefresh)
+		select {
+		case <-ctx.Done():
+			return
+		case <-clk.After(wait):
+		}
+		next, err := fetch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("[main] warning: could not refresh the ticket, which expires at %s; a reconnect requests a new one and may fail the same way: %v",
+				expiry.Format(time.DateTime), err)
+			continue
+		}
+		if !api.TicketExpiry(next).After(expiry) {
+			log.Printf("[main] warning: the refreshed ticket still expires at %s; not refreshing it again", expiry.Format(time.DateTime))
+			return
+		}
+		ticket = next
+	}
+}
+
+// openCapture opens path for appending signaling frames, with credentials
+// redacted if redact is set.
+func openCapture(path string, redact bool) (*sigclient.Recorder, func() error, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open signal capture: %w", err)
+	}
+	if redact {
+		return sigclient.NewRedactingRecorder(f), f.Close, nil
+	}
+	return sigclient.NewRecorder(f), f.Close, nil
+}
+
+// iceServers returns the ticket's ICE servers combined with those given
+// by -ice-server.
+func iceServers(cfg *config.Config, ticket *domain.Ticket) []domain.ICEServer {
+	if cfg.ICEServersReplace {
+		return cfg.ICEServers
+	}
+	return append(append([]domain.ICEServer(nil), ticket.ICEServers...), cfg.ICEServers...)
+}
+
+// rateLimitWait is the least time a reconnect waits after the API rate
+// limited a ticket request, or the signal server said it was busy, without
+// saying how long to wait.
+const rateLimitWait = time.Minute
+
+// retryable reports whether a session that ended with err is worth
+// reconnecting. Rejected credentials or serials will not fix themselves.
+// A camera at its viewer limit is only retried with -wait-for-slot.
+func retryable(err error) bool {
+	return !errors.Is(err, api.ErrUnauthorized) && !errors.Is(err, sigclient.ErrAuthFailed) &&
+		!errors.Is(err, sigclient.ErrJoinRejected) && !errors.Is(err, sigclient.ErrViewerLimit)
+}
+
+// runSession streams one camera session to stdout until parent is
+// cancelled or the session ends. It returns nil when the session ended
+// normally (camera left or parent cancelled without a cause), and the
+// cancellation cause or setup error otherwise. gotVideo reports whether
+// any video arrived, which counts as a successful connection.
+func (a *app) runSession(parent context.Context, cfg *config.Config) (gotVideo bool, err error) {
+	ctx, cancelCause := context.WithCancelCause(parent)
+	defer cancelCause(nil)
+
+	role, err := viewer.ParseRole(cfg.SDPRole)
+	if err != nil {
+		return false, err
+	}
+	earlyPeerIn, err := sigclient.ParseEarlyPeerIn(cfg.EarlyPeerIn)
+	if err != nil {
+		return false, err
+	}
+	nackMode, err := webrtc.ParseNACKMode(cfg.NACK)
+	if err != nil {
+		return false, err
+	}
+
+	a.sessionIndex++
+	a.events.StartSession(cfg.SerialNumber, a.sessionIndex)
+	defer func() {
+		detail := ""
+		if err != nil {
+			detail = err.Error()
+		}
+		a.events.Emit(events.Closed, detail)
+	}()
+
+	// Step 1: Fetch ticket
+	a.progress.Start("fetching ticket")
+	ticket, err := a.tickets.Fetch(ctx, cfg)
+	if ctx.Err() != nil {
+		return false, context.Cause(ctx)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if cfg.OnDemand && a.fifo != nil {
+		go watchReader(ctx, clock.Real, a.fifo.Attached, cancelCause)
+	}
+	// The refreshed ticket is only for a reconnect to start from.
+	if cfg.Reconnect && cfg.TicketRefreshMargin > 0 && a.status == nil {
+		go watchTicket(ctx, clock.Real, cfg.TicketRefreshMargin, ticket, func(ctx context.Context) (*domain.Ticket, error) {
+			return a.tickets.Fetch(ctx, cfg)
+		})
+	}
+
+	// Step 2: Create peer connection
+	dcOpts := webrtc.DataChannelOptions{
+		Label:     cfg.DataChannelLabel,
+		Unordered: cfg.DataChannelUnordered,
+		Protocol:  cfg.DataChannelProtocol,
+
+		OpenTimeout:   cfg.DataChannelTimeout,
+		FailIfNotOpen: cfg.FailWithoutDataChannel,
+	}
+	if cfg.DataChannelMaxRetransmits >= 0 {
+		n := uint16(cfg.DataChannelMaxRetransmits)
+		dcOpts.MaxRetransmits = &n
+	}
+	var keyLog io.Writer
+	if cfg.DTLSKeyLog != "" {
+		f, err := os.OpenFile(cfg.DTLSKeyLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return false, fmt.Errorf("open key log: %w", err)
+		}
+		defer f.Close()
+		keyLog = f
+	}
+	var naluLog io.Writer
+	if cfg.NALULog != "" {
+		f, err := os.OpenFile(cfg.NALULog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return false, fmt.Errorf("open NALU log: %w", err)
+		}
+		defer f.Close()
+		naluLog = f
+	}
+	var errDump io.Writer
+	if cfg.ErrorDump != "" {
+		f, err := os.OpenFile(cfg.ErrorDump, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return false, fmt.Errorf("open error dump: %w", err)
+		}
+		defer f.Close()
+		errDump = f
+	}
+	var filter *naluFilter
+	if cfg.NALUFilter != "" && a.status == nil {
+		f, err := startNALUFilter(cfg.NALUFilter, cancelCause)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		filter = f
+	}
+	// Outputs are opened before the peer so they close after it. stdout,
+	// the FIFO, the preview, the players and the clip buffer outlive sessions; after a reconnect
+	// the peer starts their video at a keyframe marked as a seam.
+	var videoOut io.Writer = os.Stdout
+	resume := a.progress.VideoSeen()
+	switch {
+	case a.status != nil:
+		videoOut = io.Discard
+	case cfg.OutputTemplate != "":
+		f, same, err := a.openOutput(cfg)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		videoOut = f
+		resume = resume && (same || a.fifo != nil || a.players.Out() != nil || a.clipRing != nil)
+	}
+	if a.fifo != nil && a.status == nil {
+		if cfg.OutputTemplate != "" {
+			videoOut = io.MultiWriter(videoOut, a.fifo)
+		} else {
+			videoOut = a.fifo
+		}
+	}
+	if a.players.Out() != nil && a.status == nil {
+		if cfg.OutputTemplate != "" || a.fifo != nil {
+			videoOut = io.MultiWriter(videoOut, a.players.Out())
+		} else {
+			videoOut = a.players.Out()
+		}
+	}
+	if a.clipRing != nil && a.status == nil {
+		videoOut = io.MultiWriter(videoOut, a.clipRing)
+	}
+	var preview webrtc.PreviewOptions
+	if a.preview != nil && a.status == nil {
+		preview = webrtc.PreviewOptions{Out: a.preview, Resolution: cfg.PreviewResolution}
+	}
+	lossRecovery := webrtc.LossRecoveryOptions{
+		Threshold: cfg.KeyframeLossThreshold,
+		Window:    cfg.KeyframeLossWindow,
+		Cooldown:  cfg.KeyframeLossCooldown,
+	}
+	opts := webrtc.Options{
+		WaitKeyframe:         cfg.WaitKeyframe,
+		Resume:               resume && a.status == nil,
+		Timeouts:             cfg.Timeouts,
+		TrackTimeout:         cfg.TrackTimeout,
+		FailWithoutTrack:     cfg.FailWithoutTrack,
+		ValidateAnswer:       cfg.ValidateAnswer,
+		KeyframeInterval:     cfg.KeyframeInterval,
+		KeyframeOnLoss:       cfg.KeyframeOnLoss,
+		LossRecovery:         lossRecovery,
+		MaxReassemblySize:    cfg.MaxReassemblySize,
+		MaxNALUSize:          cfg.MaxNALUSize,
+		LowLatency:           cfg.LowLatency,
+		DropFrames:           cfg.DropFrames / 100,
+		Motion:               webrtc.MotionOptions{Sensitivity: cfg.MotionRecord, Hold: cfg.MotionHold},
+		StripNALUTypes:       cfg.StripNALU,
+		InsertAUD:            cfg.InsertAUD,
+		Timestamps:           cfg.Timestamps,
+		DSCP:                 cfg.DSCP,
+		UDPPortMin:           uint16(cfg.UDPPortMin),
+		UDPPortMax:           uint16(cfg.UDPPortMax),
+		DedupParameterSets:   cfg.DedupParams,
+		ICECandidateInterval: cfg.ICECandidateInterval,
+		ICECandidates:        cfg.ICECandidates,
+		RelayFallback:        cfg.ICERelayFallback,
+		NoAudio:              cfg.NoAudio,
+		Resolution:           cfg.Resolution,
+		Size:                 cfg.Size,
+		StrictResolution:     cfg.StrictResolution,
+		ControlOnly:          a.status != nil,
+		DataChannel:          dcOpts,
+		AnsweringDTLSRole:    cfg.DTLSRole,
+		NACK:                 nackMode,
+		DTLSKeyLog:           keyLog,
+		NALULog:              naluLog,
+		ErrorDump:            errDump,
+		Preview:              preview,
+		VideoTrack:           cfg.VideoTrack,
+	}
+
+	// Status requests expect no video, so there is nothing to retry.
+	profiles := cfg.H264Profiles
+	if a.status != nil {
+		profiles = profiles[:1]
+	}
+	fallback := newProfileFallback(profiles)
+	fail := func(err error) {
+		if !fallback.Fail(err) {
+			cancelCause(err)
+		}
+	}
+	var (
+		v          *viewer.Viewer
+		sc         *sigclient.Client
+		peerCancel context.CancelFunc
+		// earlier sums the stats of peers the fallback replaced.
+		earlier webrtc.Stats
+	)
+	// startPeer creates a peer offering profile and wires it into the
+	// session. Unless profile is the last to try, a connection without a
+	// video track fails so the next one is offered.
+	startPeer := func(profile domain.H264Profile, last bool) (*webrtc.Peer, error) {
+		opts.H264Profile = profile
+		opts.FailWithoutTrack = cfg.FailWithoutTrack || !last && cfg.TrackTimeout > 0
+		peer, err := webrtc.NewPeer(iceServers(cfg, ticket), cfg.SerialNumber, opts)
+		if err != nil {
+			return nil, fmt.Errorf("create peer: %w", err)
+		}
+		a.progress.SetPeer(peer)
+		if filter != nil {
+			peer.SetNALUProcessor(filter.Process)
+		}
+		peer.SetOnError(func(err error) {
+			if errors.Is(err, webrtc.ErrMediaStall) {
+				a.events.Emit(events.Stalled, err.Error())
+			}
+			fail(err)
+		})
+		peer.SetOnConnectionState(func(state string) {
+			switch state {
+			case "connected":
+				a.events.Emit(events.Connected, "")
+			case "disconnected", "failed":
+				a.events.Emit(events.Disconnected, state)
+			}
+		})
+		peer.SetOnFirstFrame(func() {
+			if fallback.Multiple() {
+				log.Printf("[main] camera sends video with H264 profile %s", profile)
+			}
+			a.events.Emit(events.FirstFrame, "")
+		})
+		peer.SetOnControlMessage(func(msg webrtc.ControlMessage) {
+			if a.status != nil {
+				a.status.Handle(msg, cancelCause)
+				return
+			}
+			if msg.StartLive && msg.Failed() {
+				cancelCause(fmt.Errorf("camera rejected startLive: %s", msg))
+			}
+		})
+		if a.status != nil {
+			peer.SetOnControlOpen(func() { a.status.Send(peer, cancelCause) })
+		}
+
+		var peerCtx context.Context
+		peerCtx, peerCancel = context.WithCancel(ctx)
+		if a.dashboard != nil {
+			go a.dashboard.Track(peerCtx, peer)
+		}
+		if cfg.QualityInterval > 0 {
+			go logQuality(peerCtx, peer, cfg.QualityInterval, qualityThresholds(cfg))
+		}
+
+		if err := peer.AddTransceivers(); err != nil {
+			peer.Close()
+			return nil, fmt.Errorf("add transceivers: %w", err)
+		}
+		peer.SetOnTrack(videoOut)
+		// Transceiver changes after the first exchange need a new offer.
+		peer.SetOnNegotiationNeeded(func() { v.Renegotiate() })
+		peer.SetOnICECandidate(func(sdpMid string, sdpMLineIndex int, candidate string) {
+			sc.SendICECandidate(sdpMid, sdpMLineIndex, candidate)
+		})
+		return peer, nil
+	}
+
+	// Step 3: Create the peer and add its transceivers
+	peer, err := startPeer(fallback.First())
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		peerCancel()
+		peer.Close()
+	}()
+	defer func() {
+		stats := peer.Stats().Plus(earlier)
+		logSummary(stats, qualityThresholds(cfg))
+		if r := peer.ConnectivityReport(); !r.Connected {
+			logConnectivity(r)
+		}
+		if ps := peer.PreviewStats(); ps.VideoPackets > 0 {
+			log.Printf("[main] summary: preview %s, %d packets, %d lost, %d access units written",
+				ps.Video.Resolution(), ps.VideoPackets, ps.PacketsLost, ps.AccessUnits)
+		}
+		if v != nil {
+			if c := v.RemoteCandidates(); c.Rejected > 0 || c.Dropped > 0 {
+				log.Printf("[main] summary: of %d remote ICE candidates, %d rejected by the peer and %d dropped from a full queue",
+					c.Added+c.Rejected+c.Dropped, c.Rejected, c.Dropped)
+				if c.Err != nil {
+					log.Printf("[main] summary: rejected remote ICE candidates: %v", strings.ReplaceAll(c.Err.Error(), "\n", "; "))
+				}
+			}
+		}
+		// Video at the wrong resolution is not the video asked for, so the
+		// reconnect keeps backing off and counts towards -max-reconnects.
+		gotVideo = stats.VideoPackets > 0 && !errors.Is(err, webrtc.ErrResolutionMismatch)
+	}()
+
+	// Step 4: Create viewer (implements domain.Handler)
+	v = viewer.New(peer, fail)
+	defer v.Close()
+	v.SetRole(role)
+
+	// Step 5: Create signal client with viewer as handler
+	sc = sigclient.NewClient(ticket, cfg.SerialNumber, eventHandler{Handler: v, events: a.events})
+	defer sc.Close()
+	defer func() {
+		t := sc.Traffic()
+		log.Printf("[main] signaling traffic: %d bytes of messages, %d bytes on the wire", t.Messages, t.Wire)
+		if d := sc.DecodeErrors(); d.Total() > 0 {
+			log.Printf("[main] signaling frames dropped as undecodable: %d candidates, %d offers, %d answers, %d malformed", d.Candidates, d.Offers, d.Answers, d.Frames)
+		}
+	}()
+	sc.SetProxy(proxyFunc(cfg))
+	sc.SetCompression(cfg.SignalCompression)
+	sc.SetStrictBase64(cfg.StrictBase64)
+	sc.SetTimeouts(cfg.Timeouts)
+	sc.SetPlatform(cfg.Platform)
+	sc.SetEarlyPeerIn(earlyPeerIn)
+	if cfg.SessionID != "" {
+		sc.SetSessionID(cfg.SessionID)
+	}
+	sc.SetOnJoined(func(code int, msg string) {
+		if code == 0 {
+			a.events.Emit(events.Joined, "")
+		}
+	})
+	if cfg.SignalCapture != "" {
+		rec, closeCapture, err := openCapture(cfg.SignalCapture, false)
+		if err != nil {
+			return false, err
+		}
+		defer closeCapture()
+		sc.AddRecorder(rec)
+	}
+	if cfg.SignalDump != "" {
+		rec, closeDump, err := openCapture(cfg.SignalDump, true)
+		if err != nil {
+			return false, err
+		}
+		defer closeDump()
+		sc.AddRecorder(rec)
+	}
+
+	// Step 6: Complete the circular dependency
+	v.SetSignaler(sc)
+
+	// Step 9: Connect signaling (AUTH → JOIN_LIVE → PEER_IN → offer flow)
+	a.progress.Set("connecting to signaling server")
+	if err := sc.Connect(); err != nil {
+		return false, fmt.Errorf("signal connect: %w", err)
+	}
+	a.progress.Set("waiting for the camera to join")
+
+	fallback.Run(ctx, func(profile domain.H264Profile, last bool) (bool, error) {
+		peerCancel()
+		peer.Close()
+		earlier = peer.Stats().Plus(earlier)
+		restarted, err := startPeer(profile, last)
+		if err != nil {
+			return false, err
+		}
+		peer = restarted
+		if !v.Restart(peer) {
+			log.Printf("[main] the camera offered this session, so it picks the codec; not retrying")
+			return false, nil
+		}
+		return true, nil
+	}, cancelCause)
+	log.Printf("[main] ending session")
+
+	graceCtx, graceCancel := context.WithTimeout(context.Background(), cfg.ShutdownGrace)
+	if err := peer.Shutdown(graceCtx); err != nil {
+		log.Printf("[main] graceful shutdown: %v", err)
+	}
+	graceCancel()
+
+	if err := context.Cause(ctx); !errors.Is(err, context.Canceled) {
+		return false, err
+	}
+	return false, nil
+}
+
+// logConnectivity logs how far ICE got in a session that never
+// connected, and the likeliest reason it stopped there.
+func logConnectivity(r webrtc.ConnectivityReport) {
+	log.Printf("[main] connectivity: never connected; ICE got as far as %s (ended %s)", r.ICEState, r.ICEFinal)
+	log.Printf("[main] connectivity: local candidates gathered: %s; sent: %s", r.Gathered, r.Sent)
+	log.Printf("[main] connectivity: remote candidates received: %s", r.Received)
+	log.Printf("[main] connectivity: %d candidate pairs checked, %d succeeded", r.Pairs, r.PairsSucceeded)
+	if r.SelectedPair != "" {
+		log.Printf("[main] connectivity: selected pair: %s", r.SelectedPair)
+	}
+	if cause := r.LikelyCause(); cause != "" {
+		log.Printf("[main] connectivity: likely cause: %s", cause)
+	}
+}
+
+// logSummary logs what a session received, so the negotiated stream can be
+// checked after the fact.
+func logSummary(s webrtc.Stats, th webrtc.QualityThresholds) {
+	log.Printf("[main] summary: video %s, %s", s.Video, s.Video.Resolution())
+	if s.Audio.MimeType != "" {
+		log.Printf("[main] summary: audio %s", s.Audio)
+	}
+	log.Printf("[main] summary: %d packets (%d bytes), %d lost, %d access units written",
+		s.VideoPackets, s.VideoBytes, s.PacketsLost, s.AccessUnits)
+	if s.MediaTime > 0 {
+		log.Printf("[main] summary: %s of video by RTP timestamp", s.MediaTime.Round(time.Millisecond))
+	}
+	if s.FramesDropped > 0 {
+		log.Printf("[main] summary: %d frames dropped by -drop-frames", s.FramesDropped)
+	}
+	if s.OversizeNALUs > 0 {
+		log.Printf("[main] summary: %d NAL units dropped by -max-nalu-size", s.OversizeNALUs)
+	}
+	if q := webrtc.ClassifyQuality(webrtc.Stats{}, s, th); q != webrtc.QualityUnknown {
+		log.Printf("[main] summary: quality %s (%s)", q, formatQuality(webrtc.Stats{}, s))
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/api"
+	"vico_home/native/internal/clock"
+	"vico_home/native/internal/domain"
+	sigclient "vico_home/native/internal/signal"
+	"vico_home/native/internal/webrtc"
+)
+
+// ticketWatch runs watchTicket on a fake clock, with fetch answered by
+// the test through the returned channels.
+type ticketWatch struct {
+	clk     *clock.Fake
+	fetches chan struct{}
+	answers chan ticketAnswer
+	done    chan struct{}
+	cancel  context.CancelFunc
+}
+
+type ticketAnswer struct {
+	ticket *domain.Ticket
+	err    error
+}
+
+func expiringTicket(at time.Time) *domain.Ticket {
+	return &domain.Ticket{ExpirationTime: at.Unix()}
+}
+
+func startTicketWatch(t *testing.T, start, expiry time.Time) *ticketWatch {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &ticketWatch{
+		clk:     clock.NewFake(start),
+		fetches: make(chan struct{}, 1),
+		answers: make(chan ticketAnswer),
+		done:    make(chan struct{}),
+		cancel:  cancel,
+	}
+	go func() {
+		defer close(w.done)
+		watchTicket(ctx, w.clk, 5*time.Minute, expiringTicket(expiry), func(ctx context.Context) (*domain.Ticket, error) {
+			w.fetches <- struct{}{}
+			a := <-w.answers
+			return a.ticket, a.err
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-w.done
+	})
+	return w
+}
+
+// expectFetch advances the clock by d and expects a refresh, which it
+// answers with a.
+func (w *ticketWatch) expectFetch(t *testing.T, d time.Duration, a ticketAnswer) {
+	t.Helper()
+	w.clk.BlockUntil(1)
+	w.clk.Advance(d - time.Second)
+	select {
+	case <-w.fetches:
+		t.Fatalf("expected no refresh before %s", d)
+	case <-time.After(20 * time.Millisecond):
+	}
+	w.clk.Advance(time.Second)
+	select {
+	case <-w.fetches:
+	case <-time.After(time.Second):
+		t.Fatalf("expected a refresh after %s", d)
+	}
+	w.answers <- a
+}
+
+func TestWatchTicket_RefreshesBeforeExpiry(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	w := startTicketWatch(t, start, start.Add(time.Hour))
+
+	// The margin is 5m; each refreshed ticket lasts another hour.
+	w.expectFetch(t, 55*time.Minute, ticketAnswer{ticket: expiringTicket(start.Add(2 * time.Hour))})
+	w.expectFetch(t, time.Hour, ticketAnswer{ticket: expiringTicket(start.Add(3 * time.Hour))})
+}
+
+func TestWatchTicket_RetriesFailedRefresh(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	w := startTicketWatch(t, start, start.Add(time.Hour))
+
+	w.expectFetch(t, 55*time.Minute, ticketAnswer{err: errors.New("get ticket: unauthorized")})
+	// Retried after minTicketRefresh, not 5m before an expiry already
+	// that close.
+	w.expectFetch(t, minTicketRefresh, ticketAnswer{ticket: expiringTicket(start.Add(2 * time.Hour))})
+	w.expectFetch(t, time.Hour-minTicketRefresh, ticketAnswer{ticket: expiringTicket(start.Add(3 * time.Hour))})
+}
+
+func TestWatchTicket_StopsWhenExpiryDoesNotMove(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	w := startTicketWatch(t, start, start.Add(time.Hour))
+
+	w.expectFetch(t, 55*time.Minute, ticketAnswer{ticket: expiringTicket(start.Add(time.Hour))})
+	select {
+	case <-w.done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the watch to stop when the refreshed ticket expires no later")
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, true},
+		{sigclient.ErrConnectionLost, true},
+		{fmt.Errorf("session: %w", webrtc.ErrResolutionMismatch), true},
+		{api.ErrUnauthorized, false},
+		{sigclient.ErrAuthFailed, false},
+		{sigclient.ErrViewerLimit, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("%v: expected %v, got %v", tt.err, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"vico_home/native/internal/webrtc"
+)
+
+// statusTimeout bounds a -status run, from fetching the ticket to the
+// camera's reply.
+const statusTimeout = 30 * time.Second
+
+// statusQuery sends one control command and prints the camera's reply.
+type statusQuery struct {
+	action string
+	out    io.Writer
+
+	mu        sync.Mutex
+	requestID string
+	answered  bool
+}
+
+func newStatusQuery(action string, out io.Writer) *statusQuery {
+	return &statusQuery{action: action, out: out}
+}
+
+// Send issues the query. It is called when the control channel opens.
+// The request ID is recorded first, so a reply that arrives before
+// SendControl returns is recognized.
+func (q *statusQuery) Send(peer *webrtc.Peer, cancel context.CancelCauseFunc) {
+	id := peer.NewRequestID()
+	q.mu.Lock()
+	q.requestID = id
+	q.mu.Unlock()
+	if err := peer.SendControl(q.action, id); err != nil {
+		cancel(err)
+	}
+}
+
+// Handle prints msg and ends the session if it answers the query. Replies
+// are matched by request ID, or by action when the camera does not echo
+// the ID.
+func (q *statusQuery) Handle(msg webrtc.ControlMessage, cancel context.CancelCauseFunc) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.answered || q.requestID == "" {
+		return
+	}
+	if msg.RequestID != q.requestID && (msg.RequestID != "" || msg.Action != q.action) {
+		return
+	}
+	q.answered = true
+
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, msg.Raw, "", "  "); err != nil {
+		pretty.Reset()
+		pretty.Write(msg.Raw)
+	}
+	fmt.Fprintln(q.out, pretty.String())
+	cancel(nil)
+}
+
+// Answered reports whether a reply was printed.
+func (q *statusQuery) Answered() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.answered
+}
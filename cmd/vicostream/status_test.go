@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"vico_home/native/internal/webrtc"
+)
+
+func TestStatusQuery_MatchesReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		sent     string
+		msg      string
+		answered bool
+	}{
+		{"same request ID", "1700000000000", `{"action":"getStatus","requestID":"1700000000000","result":0}`, true},
+		{"no request ID, same action", "1700000000000", `{"action":"getStatus","result":0}`, true},
+		{"other request ID", "1700000000000", `{"action":"getStatus","requestID":"1700000000001","result":0}`, false},
+		{"no request ID, other action", "1700000000000", `{"action":"startLive","result":0}`, false},
+		{"before sending", "", `{"action":"getStatus","requestID":"1700000000000","result":0}`, false},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		q := newStatusQuery("getStatus", &out)
+		q.requestID = tt.sent
+		msg, err := webrtc.ParseControlMessage([]byte(tt.msg))
+		if err != nil {
+			t.Fatalf("%s: parse: %v", tt.name, err)
+		}
+		cancelled := false
+		q.Handle(msg, func(error) { cancelled = true })
+
+		if q.Answered() != tt.answered || cancelled != tt.answered || (out.Len() > 0) != tt.answered {
+			t.Errorf("%s: expected answered=%v, got answered=%v cancelled=%v output %q", tt.name, tt.answered, q.Answered(), cancelled, out.String())
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"vico_home/native/internal/webrtc"
+)
+
+// statusDisplay draws a compact status dashboard and redraws it in place
+// using plain ANSI cursor controls.
+type statusDisplay struct {
+	w       io.Writer
+	serial  string
+	quality webrtc.QualityThresholds
+	started time.Time
+
+	mu    sync.Mutex
+	lines int
+}
+
+func newStatusDisplay(w io.Writer, serial string, quality webrtc.QualityThresholds) *statusDisplay {
+	return &statusDisplay{w: w, serial: serial, quality: quality, started: time.Now()}
+}
+
+// isTerminal reports whether f is a character device, which is as close as
+// the standard library gets to isatty.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Track redraws the dashboard from peer's stats every second until ctx is
+// done.
+func (d *statusDisplay) Track(ctx context.Context, peer *webrtc.Peer) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	prev := peer.Stats()
+	prevAt := time.Now()
+	d.draw(prev, prev, 0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			cur := peer.Stats()
+			d.draw(prev, cur, now.Sub(prevAt))
+			prev, prevAt = cur, now
+		}
+	}
+}
+
+func (d *statusDisplay) draw(prev, cur webrtc.Stats, elapsed time.Duration) {
+	var fps, loss float64
+	if secs := elapsed.Seconds(); secs > 0 {
+		fps = float64(cur.AccessUnits-prev.AccessUnits) / secs
+	}
+	received := cur.VideoPackets - prev.VideoPackets
+	lost := cur.PacketsLost - prev.PacketsLost
+	if received+lost > 0 {
+		loss = 100 * float64(lost) / float64(received+lost)
+	}
+
+	state := orDash(cur.ConnectionState)
+	if cur.ICEState != "" {
+		state += " (ICE " + cur.ICEState + ")"
+	}
+	if cur.Recovering {
+		state += ", recovering from loss"
+	}
+	if !cur.LastPacket.IsZero() {
+		if idle := time.Since(cur.LastPacket); idle > 2*time.Second {
+			state += fmt.Sprintf(", no video for %s", idle.Round(time.Second))
+		}
+	}
+
+	dp := cur.Depacketizer
+	lines := []string{
+		fmt.Sprintf("vicostream  %s  up %s", d.serial, formatUptime(time.Since(d.started))),
+		fmt.Sprintf("state       %s", state),
+		fmt.Sprintf("video       %6.2f Mbit/s (%.2f avg 10s)  %5.1f fps  resolution %s",
+			cur.Bitrate.Current/1e6, cur.Bitrate.Average/1e6, fps, cur.Video.Resolution()),
+		fmt.Sprintf("codec       %s", cur.Video),
+		fmt.Sprintf("packets     %d received, %d lost (%.1f%% now)", cur.VideoPackets, cur.PacketsLost, loss),
+		fmt.Sprintf("quality     %s  jitter %s  rtt %s", webrtc.ClassifyQuality(prev, cur, d.quality),
+			cur.Jitter.Round(time.Millisecond), formatRTT(cur.RTT)),
+		fmt.Sprintf("depacketize %d NALUs, FU-A %d ok / %d dropped, %d malformed",
+			dp.NALUs, dp.FUACompleted, dp.FUADropped+dp.FUAOrphans+dp.FUAOversize, dp.ForbiddenBit+dp.InvalidType),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b strings.Builder
+	if d.lines > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", d.lines)
+	}
+	for _, l := range lines {
+		b.WriteString("\x1b[2K")
+		b.WriteString(l)
+		b.WriteString("\n")
+	}
+	d.lines = len(lines)
+	io.WriteString(d.w, b.String())
+}
+
+func formatUptime(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+func formatRTT(rtt time.Duration) string {
+	if rtt <= 0 {
+		return "-"
+	}
+	return rtt.Round(time.Millisecond).String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
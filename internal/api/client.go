@@ -2,12 +2,14 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/sha1"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 
 	"vico_home/native/internal/domain"
 )
@@ -41,12 +43,46 @@ type ticketResponse struct {
 	Data   domain.Ticket `json:"data"`
 }
 
+// Options sets the regional details sent with ticket requests. Empty
+// fields use the values the VicoHome app sends for a US English install.
+type Options struct {
+	Language string
+	TimeZone string
+	// Proxy chooses the proxy for API requests, as http.Transport.Proxy
+	// does. Nil uses HTTPS_PROXY and friends from the environment.
+	Proxy func(*http.Request) (*url.URL, error)
+	// Credentials supplies the JWT, asked for on every request.
+	Credentials domain.CredentialProvider
+}
+
 // Client fetches WebRTC tickets from the VicoHome API.
-type Client struct{}
+type Client struct {
+	language string
+	timeZone string
+	http     *http.Client
+	creds    domain.CredentialProvider
+}
 
 // NewClient creates an API client.
-func NewClient() *Client {
-	return &Client{}
+func NewClient(opts Options) *Client {
+	c := &Client{
+		language: opts.Language,
+		timeZone: opts.TimeZone,
+		http:     http.DefaultClient,
+		creds:    opts.Credentials,
+	}
+	if opts.Proxy != nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.Proxy = opts.Proxy
+		c.http = &http.Client{Transport: t}
+	}
+	if c.language == "" {
+		c.language = "en"
+	}
+	if c.timeZone == "" {
+		c.timeZone = "America/New_York"
+	}
+	return c
 }
 
 func generateRequestID() string {
@@ -57,18 +93,30 @@ func generateRequestID() string {
 }
 
 // FetchTicket calls the VicoHome API to obtain signaling credentials and ICE servers.
-func (c *Client) FetchTicket(jwt, serialNumber string) (*domain.Ticket, error) {
+func (c *Client) FetchTicket(serialNumber string) (*domain.Ticket, error) {
+	return c.fetchTicket(context.Background(), serialNumber)
+}
+
+func (c *Client) fetchTicket(ctx context.Context, serialNumber string) (*domain.Ticket, error) {
+	if c.creds == nil {
+		return nil, fmt.Errorf("no credentials configured")
+	}
+	jwt, err := c.creds.Token()
+	if err != nil {
+		return nil, fmt.Errorf("get token: %w", err)
+	}
+
 	req := ticketRequest{
 		SerialNumber:              serialNumber,
 		CountryNo:                 "US",
 		RequestID:                 generateRequestID(),
-		Language:                  "en",
+		Language:                  c.language,
 		SupportUnlimitedWebsocket: true,
 		List:                      []any{},
 		App: appMetadata{
 			VersionName: "3.50.0(2f68e2)",
 			Bundle:      "addx.ai.vicoo",
-			TimeZone:    "America/New_York",
+			TimeZone:    c.timeZone,
 			AppName:     "VicoHome",
 			TenantID:    "vicoo",
 			Env:         "prod-k8s",
@@ -82,14 +130,14 @@ func (c *Client) FetchTicket(jwt, serialNumber string) (*domain.Ticket, error) {
 		return nil, fmt.Errorf("marshal ticket request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", ticketURL, bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", ticketURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("create http request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+jwt)
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, err := c.http.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("http request: %w", err)
 	}
@@ -101,7 +149,7 @@ func (c *Client) FetchTicket(jwt, serialNumber string) (*domain.Ticket, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, string(respBody))
+		return nil, httpError(resp.StatusCode, string(respBody), resp.Header)
 	}
 
 	var ticketResp ticketResponse
@@ -110,7 +158,7 @@ func (c *Client) FetchTicket(jwt, serialNumber string) (*domain.Ticket, error) {
 	}
 
 	if ticketResp.Result != 0 {
-		return nil, fmt.Errorf("API error (result=%d): %s", ticketResp.Result, ticketResp.Msg)
+		return nil, resultError(ticketResp.Result, ticketResp.Msg)
 	}
 
 	return &ticketResp.Data, nil
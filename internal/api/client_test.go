@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"vico_home/native/internal/domain"
+)
+
+// roundTripFunc answers requests without a network, for a Client's
+// http.Client.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestFetchTicket_SendsLanguageAndTimeZone(t *testing.T) {
+	tests := []struct {
+		opts         Options
+		lang, tzName string
+	}{
+		{Options{}, "en", "America/New_York"},
+		{Options{Language: "de", TimeZone: "Europe/Berlin"}, "de", "Europe/Berlin"},
+		{Options{TimeZone: "Asia/Tokyo"}, "en", "Asia/Tokyo"},
+	}
+	for _, tt := range tests {
+		tt.opts.Credentials = domain.StaticToken("jwt")
+		c := NewClient(tt.opts)
+		var sent ticketRequest
+		c.http = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if err := json.NewDecoder(r.Body).Decode(&sent); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`{"result":0}`))}, nil
+		})}
+		if _, err := c.FetchTicket("serial"); err != nil {
+			t.Fatalf("%+v: unexpected error: %v", tt.opts, err)
+		}
+		if sent.Language != tt.lang || sent.App.TimeZone != tt.tzName {
+			t.Errorf("%+v: expected %s in %s, got %s in %s", tt.opts, tt.lang, tt.tzName, sent.Language, sent.App.TimeZone)
+		}
+	}
+}
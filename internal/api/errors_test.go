@@ -0,0 +1,92 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{"soon", 0},
+		{"Sat, 09 Mar 2024 12:00:30 GMT", 30 * time.Second},
+		{"Sat, 09 Mar 2024 11:59:00 GMT", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.in, now); got != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestRateLimitedErrors(t *testing.T) {
+	h := http.Header{}
+	h.Set("Retry-After", "30")
+	err := error(httpError(http.StatusTooManyRequests, "slow down", h))
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected HTTP 429 to be ErrRateLimited, got %v", err)
+	}
+	if got := RetryAfter(err); got != 30*time.Second {
+		t.Errorf("expected Retry-After 30s, got %s", got)
+	}
+}
+
+func TestResultError_Kinds(t *testing.T) {
+	tests := []struct {
+		result int
+		kind   error
+	}{
+		{-1, nil},
+		{-1025, nil},
+		{-9999, nil},
+	}
+	kinds := []error{ErrUnauthorized, ErrCameraOffline, ErrRateLimited}
+	for _, tt := range tests {
+		err := resultError(tt.result, "server text")
+		for _, kind := range kinds {
+			if got := errors.Is(err, kind); got != (kind == tt.kind) {
+				t.Errorf("result %d: expected errors.Is(%v) %v, got %v", tt.result, kind, kind == tt.kind, got)
+			}
+		}
+	}
+}
+
+func TestHTTPError_Kinds(t *testing.T) {
+	tests := []struct {
+		status int
+		kind   error
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrUnauthorized},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		err := httpError(tt.status, "body", http.Header{})
+		if got := errors.Unwrap(err); got != tt.kind {
+			t.Errorf("HTTP %d: expected %v, got %v", tt.status, tt.kind, got)
+		}
+	}
+}
+
+func TestResultError_Messages(t *testing.T) {
+	tests := []struct {
+		result   int
+		expected string
+	}{
+		{-9999, "API error (result=-9999): server text"},
+	}
+	for _, tt := range tests {
+		if got := resultError(tt.result, "server text").Error(); got != tt.expected {
+			t.Errorf("result %d: expected %q, got %q", tt.result, tt.expected, got)
+		}
+	}
+}
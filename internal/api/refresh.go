@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"vico_home/native/internal/domain"
+)
+
+// RefreshTicket obtains fresh signaling credentials for a camera that prev
+// was issued for, so a long or reconnecting session can renew its access
+// token and TURN credentials before they expire. Connection details the
+// new ticket leaves empty are carried over from prev, as carryOver
+// describes. prev may be nil, in which case this is FetchTicket with a
+// context. Use TicketChanges to see what differs from prev.
+func (c *Client) RefreshTicket(ctx context.Context, serialNumber string, prev *domain.Ticket) (*domain.Ticket, error) {
+	t, err := c.fetchTicket(ctx, serialNumber)
+	if err != nil || prev == nil {
+		return t, err
+	}
+	carryOver(t, prev)
+	return t, nil
+}
+
+// carryOver fills in the connection details t leaves empty from prev: the
+// signal server and its ping interval, and the STUN servers when t lists
+// no ICE servers. TURN servers are not carried over, since their
+// credentials are issued with the ticket and expire with prev's; a
+// refresh without any leaves the session to connect without relay.
+func carryOver(t, prev *domain.Ticket) {
+	if t.SignalServer == "" {
+		t.SignalServer, t.SignalServerIP, t.WebsocketPath = prev.SignalServer, prev.SignalServerIP, prev.WebsocketPath
+	}
+	if len(t.ICEServers) == 0 {
+		for _, s := range prev.ICEServers {
+			if strings.HasPrefix(s.URL, "stun:") || strings.HasPrefix(s.URL, "stuns:") {
+				t.ICEServers = append(t.ICEServers, s)
+			}
+		}
+	}
+	if t.SignalPingInterval == 0 {
+		t.SignalPingInterval = prev.SignalPingInterval
+	}
+}
+
+// TicketExpiry returns when t's credentials expire, or the zero time if the
+// ticket does not say. The API has sent ExpirationTime both in Unix
+// seconds and in milliseconds; values too large to be seconds are read as
+// milliseconds.
+func TicketExpiry(t *domain.Ticket) time.Time {
+	switch e := t.ExpirationTime; {
+	case e <= 0:
+		return time.Time{}
+	case e >= 1e12:
+		return time.UnixMilli(e)
+	default:
+		return time.Unix(e, 0)
+	}
+}
+
+// TicketChanges names what differs between two tickets for the same
+// camera: "signal server", "access token", "ICE servers", "ICE
+// credentials" and "expiration". It returns nil if nothing relevant to
+// the connection changed.
+func TicketChanges(prev, next *domain.Ticket) []string {
+	var changes []string
+	if prev.SignalServer != next.SignalServer || prev.WebsocketPath != next.WebsocketPath {
+		changes = append(changes, "signal server")
+	}
+	if prev.AccessToken != next.AccessToken || prev.Sign != next.Sign {
+		changes = append(changes, "access token")
+	}
+	sameURL := func(a, b domain.ICEServer) bool { return a.URL == b.URL }
+	if !slices.EqualFunc(prev.ICEServers, next.ICEServers, sameURL) {
+		changes = append(changes, "ICE servers")
+	} else if !slices.Equal(prev.ICEServers, next.ICEServers) {
+		changes = append(changes, "ICE credentials")
+	}
+	if prev.ExpirationTime != next.ExpirationTime {
+		changes = append(changes, "expiration")
+	}
+	return changes
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/domain"
+)
+
+func TestTicketExpiry(t *testing.T) {
+	want := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expiration int64
+		want       time.Time
+	}{
+		{0, time.Time{}},
+		{want.Unix(), want},
+		{want.UnixMilli(), want},
+	}
+	for _, tt := range tests {
+		if got := TicketExpiry(&domain.Ticket{ExpirationTime: tt.expiration}); !got.Equal(tt.want) {
+			t.Errorf("%d: expected %v, got %v", tt.expiration, tt.want, got)
+		}
+	}
+}
+
+func TestTicketChanges(t *testing.T) {
+	base := domain.Ticket{
+		SignalServer:   "wss://signal.example.com",
+		AccessToken:    "token-1",
+		ExpirationTime: 1000,
+		ICEServers: []domain.ICEServer{
+			{URL: "turn:turn.example.com:3478", Username: "u1", Credential: "c1"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		modify func(t *domain.Ticket)
+		want   []string
+	}{
+		{"unchanged", func(t *domain.Ticket) {}, nil},
+		{"credentials lapsed", func(t *domain.Ticket) {
+			t.AccessToken = "token-2"
+			t.ExpirationTime = 2000
+			t.ICEServers = []domain.ICEServer{{URL: "turn:turn.example.com:3478", Username: "u2", Credential: "c2"}}
+		}, []string{"access token", "ICE credentials", "expiration"}},
+		{"moved", func(t *domain.Ticket) {
+			t.SignalServer = "wss://signal2.example.com"
+			t.ICEServers = nil
+		}, []string{"signal server", "ICE servers"}},
+	}
+	for _, tt := range tests {
+		next := base
+		next.ICEServers = slices.Clone(base.ICEServers)
+		tt.modify(&next)
+		if got := TicketChanges(&base, &next); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestCarryOver(t *testing.T) {
+	stun := domain.ICEServer{URL: "stun:stun.example.com:3478"}
+	turn := domain.ICEServer{URL: "turn:turn.example.com:3478", Username: "old", Credential: "expired"}
+	prev := &domain.Ticket{
+		SignalServer:       "wss://a.example.com",
+		WebsocketPath:      "/ws",
+		SignalPingInterval: 30,
+		ICEServers:         []domain.ICEServer{stun, turn},
+	}
+	freshTURN := domain.ICEServer{URL: "turn:turn.example.com:3478", Username: "new", Credential: "fresh"}
+	tests := []struct {
+		name       string
+		next       domain.Ticket
+		wantServer string
+		wantICE    []domain.ICEServer
+	}{
+		{"keeps what the refresh sends", domain.Ticket{SignalServer: "wss://b.example.com", SignalPingInterval: 20, ICEServers: []domain.ICEServer{freshTURN}},
+			"wss://b.example.com", []domain.ICEServer{freshTURN}},
+		{"carries over STUN only", domain.Ticket{},
+			"wss://a.example.com", []domain.ICEServer{stun}},
+	}
+	for _, tt := range tests {
+		next := tt.next
+		carryOver(&next, prev)
+		if next.SignalServer != tt.wantServer || next.SignalPingInterval == 0 {
+			t.Errorf("%s: expected signal server %s with a ping interval, got %s every %ds", tt.name, tt.wantServer, next.SignalServer, next.SignalPingInterval)
+		}
+		if !slices.Equal(next.ICEServers, tt.wantICE) {
+			t.Errorf("%s: expected ICE servers %+v, got %+v", tt.name, tt.wantICE, next.ICEServers)
+		}
+	}
+}
+
+type failingCredentials struct{}
+
+func (failingCredentials) Token() (string, error) { return "", errors.New("keychain locked") }
+
+func TestFetchTicket_AsksCredentialsFirst(t *testing.T) {
+	c := NewClient(Options{Credentials: failingCredentials{}})
+	_, err := c.FetchTicket("serial")
+	if err == nil || !strings.Contains(err.Error(), "keychain locked") {
+		t.Errorf("expected the provider's error, got %v", err)
+	}
+}
@@ -0,0 +1,367 @@
+// Package clip keeps the last stretch of an H264 stream in memory so that
+// a clip covering a moment that has already passed can be saved.
+package clip
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"vico_home/native/internal/clock"
+)
+
+// DefaultMaxBytes bounds the memory a Ring holds when no limit is given.
+const DefaultMaxBytes = 64 << 20
+
+const (
+	naluTypeIDR = 5
+	naluTypeSPS = 7
+	naluTypePPS = 8
+)
+
+var startCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// Ring is an io.Writer for an Annex B H264 stream that retains the most
+// recent groups of pictures, each starting at a keyframe, covering at
+// least the window it was created with. Saved clips therefore always
+// start decodable. Write and SaveClip may be called from different
+// goroutines.
+type Ring struct {
+	clock    clock.Clock
+	window   time.Duration
+	maxBytes int
+
+	mu       sync.Mutex
+	pending  []byte // bytes from the last start code on
+	gops     []*gop
+	size     int // bytes held in gops
+	sps, pps []byte
+	clips    []*clipFile
+	capped   bool // the current GOP exceeded maxBytes and was discarded
+
+	// finished is called with each clip's path once it is closed after
+	// its post-roll; nil outside tests.
+	finished func(path string)
+}
+
+// gop is the stream from one keyframe up to the next.
+type gop struct {
+	start      time.Time
+	data       []byte
+	hasSlice   bool
+	hasNonIDR  bool
+	startsWith uint8 // NAL unit type of the first unit
+}
+
+// clipFile receives the live stream after the pre-roll until it ends.
+// While the pre-roll is written, outside the ring's lock, live units are
+// held in backlog instead.
+type clipFile struct {
+	path    string
+	f       *os.File
+	w       *bufio.Writer
+	err     error
+	preroll bool
+	backlog [][]byte
+}
+
+// NewRing returns a Ring keeping window of video in at most maxBytes
+// (DefaultMaxBytes if zero or less). A nil clk uses clock.Real.
+func NewRing(window time.Duration, maxBytes int, clk clock.Clock) *Ring {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	if clk == nil {
+		clk = clock.Real
+	}
+	return &Ring{clock: clk, window: window, maxBytes: maxBytes}
+}
+
+// Write buffers p. NAL units are taken in once the next start code
+// arrives. It never fails, so it can sit beside the real output in an
+// io.MultiWriter.
+func (r *Ring) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending = append(r.pending, p...)
+	for {
+		// The unit at the front ends where the next start code begins.
+		first := bytes.Index(r.pending, startCode[1:])
+		if first < 0 {
+			break
+		}
+		body := first + 3
+		next := bytes.Index(r.pending[body:], startCode[1:])
+		if next < 0 {
+			break
+		}
+		nalu := bytes.TrimRight(r.pending[body:body+next], "\x00")
+		if len(nalu) > 0 {
+			r.add(nalu)
+		}
+		r.pending = r.pending[body+next:]
+	}
+	if len(r.pending) > r.maxBytes {
+		// No start code for longer than the whole buffer: not H264.
+		r.pending = nil
+	}
+	return len(p), nil
+}
+
+// add appends one NAL unit, starting a new GOP at a keyframe.
+func (r *Ring) add(nalu []byte) {
+	now := r.clock.Now()
+	typ := nalu[0] & 0x1f
+
+	switch typ {
+	case naluTypeSPS:
+		r.sps = append(r.sps[:0], nalu...)
+	case naluTypePPS:
+		r.pps = append(r.pps[:0], nalu...)
+	}
+
+	cur := r.current()
+	switch {
+	case typ == naluTypeSPS && (cur == nil || cur.hasSlice),
+		typ == naluTypeIDR && (cur == nil || cur.hasNonIDR):
+		cur = &gop{start: now, startsWith: typ}
+		r.gops = append(r.gops, cur)
+		r.capped = false
+	case cur == nil:
+		// Nothing before the first keyframe is worth keeping.
+		r.forward(nalu)
+		return
+	}
+	if typ >= 1 && typ <= 5 {
+		cur.hasSlice = true
+		if typ != naluTypeIDR {
+			cur.hasNonIDR = true
+		}
+	}
+	cur.data = append(cur.data, startCode...)
+	cur.data = append(cur.data, nalu...)
+	r.size += len(startCode) + len(nalu)
+	r.forward(nalu)
+	r.trim(now)
+}
+
+// current returns the GOP being filled, or nil while waiting for a
+// keyframe.
+func (r *Ring) current() *gop {
+	if len(r.gops) == 0 || r.capped {
+		return nil
+	}
+	return r.gops[len(r.gops)-1]
+}
+
+// trim drops the oldest GOPs that are no longer needed to cover the
+// window, or that do not fit in maxBytes.
+func (r *Ring) trim(now time.Time) {
+	for len(r.gops) > 1 && !r.gops[1].start.After(now.Add(-r.window)) {
+		r.drop()
+	}
+	for len(r.gops) > 1 && r.size > r.maxBytes {
+		r.drop()
+	}
+	if r.size > r.maxBytes {
+		log.Printf("[clip] warning: a single GOP exceeds %d bytes; clips start at the next keyframe", r.maxBytes)
+		r.drop()
+		r.capped = true
+	}
+}
+
+func (r *Ring) drop() {
+	r.size -= len(r.gops[0].data)
+	r.gops[0] = nil
+	r.gops = r.gops[1:]
+}
+
+// forward writes nalu to the clips being recorded.
+func (r *Ring) forward(nalu []byte) {
+	for _, c := range r.clips {
+		if c.preroll {
+			c.backlog = append(c.backlog, append([]byte(nil), nalu...))
+			continue
+		}
+		c.writeNALU(nalu)
+	}
+}
+
+// writeNALU appends one live unit to c unless it already failed.
+func (c *clipFile) writeNALU(nalu []byte) {
+	if c.err != nil {
+		return
+	}
+	if _, err := c.w.Write(startCode); err != nil {
+		c.fail(err)
+		return
+	}
+	if _, err := c.w.Write(nalu); err != nil {
+		c.fail(err)
+	}
+}
+
+func (c *clipFile) fail(err error) {
+	log.Printf("[clip] write %s: %v", c.path, err)
+	c.err = err
+}
+
+// SaveClip writes the last pre of buffered video to path, from the
+// keyframe at or before that point, then keeps appending the live stream
+// for post. pre is capped at the ring's window. It returns once the
+// pre-roll is written; the file is closed when post has passed or Close
+// is called.
+func (r *Ring) SaveClip(path string, pre, post time.Duration) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("create clip directory: %w", err)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create clip: %w", err)
+	}
+	c := &clipFile{path: path, f: f, w: bufio.NewWriter(f), preroll: post > 0}
+
+	// The pre-roll is collected under the lock and written outside it,
+	// so a slow disk does not hold up Write and the video output behind it.
+	// GOP data is only ever appended to, so the slices stay valid.
+	r.mu.Lock()
+	pre = min(pre, r.window)
+	from := r.clock.Now().Add(-pre)
+	first := 0
+	for i, g := range r.gops {
+		if !g.start.After(from) {
+			first = i
+		}
+	}
+	var preroll [][]byte
+	gops := r.gops[first:]
+	if len(gops) > 0 && gops[0].startsWith != naluTypeSPS && r.sps != nil {
+		// The keyframe came without parameter sets; write the last ones.
+		for _, ps := range [][]byte{r.sps, r.pps} {
+			if ps != nil {
+				preroll = append(preroll, startCode, append([]byte(nil), ps...))
+			}
+		}
+	}
+	for _, g := range gops {
+		preroll = append(preroll, g.data)
+	}
+	if post > 0 {
+		r.clips = append(r.clips, c)
+	}
+	r.mu.Unlock()
+
+	for _, b := range preroll {
+		if _, err := c.w.Write(b); err != nil {
+			c.err = err
+			break
+		}
+	}
+	if post <= 0 {
+		return c.close()
+	}
+
+	r.mu.Lock()
+	recording := r.remove(c) // Close may have ended it meanwhile
+	c.preroll = false
+	if recording && c.err == nil {
+		for _, nalu := range c.backlog {
+			c.writeNALU(nalu)
+		}
+		r.clips = append(r.clips, c)
+	}
+	c.backlog = nil
+	r.mu.Unlock()
+
+	if !recording || c.err != nil {
+		return c.close()
+	}
+	go func() {
+		<-r.clock.After(post)
+		r.finish(c)
+	}()
+	return nil
+}
+
+// remove takes c off the clips being recorded and reports whether it was
+// there. r.mu must be held.
+func (r *Ring) remove(c *clipFile) bool {
+	for i, other := range r.clips {
+		if other == c {
+			r.clips = append(r.clips[:i], r.clips[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// finish stops recording c and closes it.
+func (r *Ring) finish(c *clipFile) {
+	r.mu.Lock()
+	found := r.remove(c)
+	finished := r.finished
+	r.mu.Unlock()
+	if !found {
+		return // Close got there first
+	}
+	if err := c.close(); err != nil {
+		log.Printf("[clip] %v", err)
+	} else {
+		log.Printf("[clip] saved %s", c.path)
+	}
+	if finished != nil {
+		finished(c.path)
+	}
+}
+
+func (c *clipFile) close() error {
+	err := c.err
+	if err == nil {
+		err = c.w.Flush()
+	}
+	if cerr := c.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write clip %s: %w", c.path, err)
+	}
+	return nil
+}
+
+// Close ends the clips still recording. A clip whose pre-roll is still
+// being written is closed by SaveClip once it is.
+func (r *Ring) Close() {
+	r.mu.Lock()
+	var clips []*clipFile
+	for _, c := range r.clips {
+		if !c.preroll {
+			clips = append(clips, c)
+		}
+	}
+	r.clips = nil
+	r.mu.Unlock()
+	for _, c := range clips {
+		if err := c.close(); err != nil {
+			log.Printf("[clip] %v", err)
+		}
+	}
+}
+
+// Buffered returns how much video the ring holds: the time since its
+// oldest keyframe and the bytes kept.
+func (r *Ring) Buffered() (time.Duration, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.gops) == 0 {
+		return 0, 0
+	}
+	return r.clock.Now().Sub(r.gops[0].start), r.size
+}
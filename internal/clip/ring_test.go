@@ -0,0 +1,126 @@
+package clip
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+)
+
+var (
+	sps   = []byte{0x67, 0x64, 0x00, 0x1f}
+	pps   = []byte{0x68, 0xee, 0x3c}
+	idr   = []byte{0x65, 0x88, 0x84}
+	slice = []byte{0x41, 0x9a, 0x02}
+)
+
+func annexB(nalus ...[]byte) []byte {
+	var b []byte
+	for _, n := range nalus {
+		b = append(b, startCode...)
+		b = append(b, n...)
+	}
+	return b
+}
+
+// writeGOP writes a keyframe and n P-frames, one per second of clk.
+func writeGOP(r *Ring, clk *clock.Fake, n int, withParams bool) {
+	if withParams {
+		r.Write(annexB(sps, pps))
+	}
+	r.Write(annexB(idr))
+	clk.Advance(time.Second)
+	for i := 0; i < n; i++ {
+		r.Write(annexB(slice))
+		clk.Advance(time.Second)
+	}
+}
+
+func TestRing_KeepsKeyframeAlignedWindow(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	r := NewRing(5*time.Second, 0, clk)
+
+	for i := 0; i < 4; i++ {
+		writeGOP(r, clk, 2, true) // 3s per GOP
+	}
+	r.Write(startCode) // completes the last unit
+
+	// 12s written; covering 5s needs the GOPs starting at 6s and 9s.
+	if got, _ := r.Buffered(); got != 6*time.Second {
+		t.Errorf("expected 6s buffered, got %s", got)
+	}
+	if !bytes.HasPrefix(r.gops[0].data, annexB(sps)) {
+		t.Error("expected the buffer to start at a keyframe's SPS")
+	}
+}
+
+func TestRing_BoundsMemory(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	r := NewRing(time.Hour, 64, clk)
+
+	for i := 0; i < 10; i++ {
+		writeGOP(r, clk, 2, true)
+	}
+	r.Write(startCode)
+
+	if _, size := r.Buffered(); size > 64 {
+		t.Errorf("expected at most 64 bytes buffered, got %d", size)
+	}
+	if len(r.gops) == 0 {
+		t.Fatal("expected the last GOP kept")
+	}
+}
+
+func TestRing_SaveClipWritesPreRollAndPost(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	r := NewRing(30*time.Second, 0, clk)
+	defer r.Close()
+
+	writeGOP(r, clk, 2, true)
+	writeGOP(r, clk, 2, false) // keyframe without parameter sets
+	r.Write(startCode)
+
+	saved := make(chan string, 1)
+	r.finished = func(path string) { saved <- path }
+
+	path := filepath.Join(t.TempDir(), "clips", "event.h264")
+	if err := r.SaveClip(path, 2*time.Second, 3*time.Second); err != nil {
+		t.Fatalf("save clip: %v", err)
+	}
+	r.Write(slice) // completes a live unit
+	r.Write(startCode)
+	clk.BlockUntil(1)
+	clk.Advance(3 * time.Second)
+
+	select {
+	case <-saved:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the clip to be saved")
+	}
+	want := annexB(sps, pps, idr, slice, slice, slice)
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, want) {
+		t.Fatalf("expected clip\n%x\ngot\n%x", want, got)
+	}
+}
+
+func TestRing_CloseEndsClips(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	r := NewRing(30*time.Second, 0, clk)
+
+	writeGOP(r, clk, 1, true)
+	r.Write(startCode)
+
+	path := filepath.Join(t.TempDir(), "event.h264")
+	if err := r.SaveClip(path, time.Minute, time.Hour); err != nil {
+		t.Fatalf("save clip: %v", err)
+	}
+	r.Close()
+
+	want := annexB(sps, pps, idr, slice)
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, want) {
+		t.Errorf("expected the clip flushed on Close\n%x\ngot\n%x", want, got)
+	}
+}
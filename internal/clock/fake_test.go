@@ -0,0 +1,66 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFake_AfterFiresOnAdvance(t *testing.T) {
+	f := NewFake(epoch)
+	c := f.After(time.Second)
+
+	f.Advance(999 * time.Millisecond)
+	select {
+	case <-c:
+		t.Fatal("expected After not to fire early")
+	default:
+	}
+
+	f.Advance(time.Millisecond)
+	select {
+	case got := <-c:
+		if want := epoch.Add(time.Second); !got.Equal(want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	default:
+		t.Fatal("expected After to fire")
+	}
+}
+
+func TestFake_TickerDropsMissedTicksAndStops(t *testing.T) {
+	f := NewFake(epoch)
+	tk := f.NewTicker(time.Second)
+
+	f.Advance(3 * time.Second)
+	if got := <-tk.C(); !got.Equal(epoch.Add(time.Second)) {
+		t.Errorf("expected first tick at 1s, got %v", got.Sub(epoch))
+	}
+	select {
+	case <-tk.C():
+		t.Error("expected missed ticks dropped")
+	default:
+	}
+
+	tk.Stop()
+	f.Advance(time.Second)
+	select {
+	case <-tk.C():
+		t.Error("expected no tick after Stop")
+	default:
+	}
+}
+
+func TestFake_BlockUntilWaitsForWaiters(t *testing.T) {
+	f := NewFake(epoch)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-f.After(time.Minute)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Minute)
+	<-done
+}
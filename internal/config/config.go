@@ -1,36 +1,907 @@
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vico_home/native/internal/domain"
+	"vico_home/native/internal/logging"
+	"vico_home/native/internal/output"
 
 	"github.com/joho/godotenv"
 )
 
+// ErrVersion is returned by Load when -v or --version was given.
+var ErrVersion = errors.New("version requested")
+
 // Config holds the application configuration.
 type Config struct {
-	Token        string
+	// Credentials supplies the JWT. Load sets it from VICO_TOKEN,
+	// -token-file or -token-stdin; embedders may substitute their own.
+	Credentials  domain.CredentialProvider
 	SerialNumber string
+
+	// WaitKeyframe discards video until the first IDR with parameter sets.
+	WaitKeyframe bool
+	// TrackTimeout logs a diagnostic when no video track arrives this long
+	// after connecting; zero disables it. FailWithoutTrack also ends the
+	// session.
+	TrackTimeout     time.Duration
+	FailWithoutTrack bool
+	// ValidateAnswer ends the session when the camera's SDP answer
+	// declines to send H264 video.
+	ValidateAnswer bool
+	// H264Profiles lists the H264 formats to offer, as
+	// profile-level-id/packetization-mode, in order of preference. After
+	// the first, each is tried in turn when the camera rejects the answer
+	// or sends no video track.
+	H264Profiles []domain.H264Profile
+	// KeyframeInterval requests a keyframe when none arrived for this
+	// long; zero disables it. KeyframeOnLoss requests one on packet loss.
+	KeyframeInterval time.Duration
+	KeyframeOnLoss   bool
+	// KeyframeLossThreshold, if positive, requests a keyframe when that
+	// many packets are lost within KeyframeLossWindow, at most once per
+	// KeyframeLossCooldown.
+	KeyframeLossThreshold int
+	KeyframeLossWindow    time.Duration
+	KeyframeLossCooldown  time.Duration
+	// MaxReassemblySize caps the size of a NAL unit reassembled from FU-A
+	// fragments, in bytes.
+	MaxReassemblySize int
+	// MaxNALUSize drops any NAL unit larger than this from the output;
+	// zero disables the check.
+	MaxNALUSize int
+	// LowLatency favors freshness over completeness of the output.
+	LowLatency bool
+	// OutputTemplate, if set, names a file per session to write video to
+	// instead of stdout; see output.ParseTemplate.
+	OutputTemplate string
+	// OutputFIFO, if set, is a named pipe to write video to instead of
+	// stdout, dropping it while no reader is attached; see output.FIFO.
+	OutputFIFO string
+	// OnDemand streams only while a reader has OutputFIFO open, ending
+	// the session when the last one leaves and starting one when the
+	// next arrives.
+	OnDemand bool
+	// Play pipes the video to ffplay, and Record, if set, to ffmpeg
+	// writing this file, instead of stdout.
+	Play   bool
+	Record string
+	// ClipBuffer, if positive, keeps this much recent video in memory so
+	// "clip" commands on stdin and SIGUSR1 can save it, plus ClipPost of
+	// what follows, to a file named by ClipTemplate. ClipMaxBytes bounds
+	// the memory used.
+	ClipBuffer   time.Duration
+	ClipPost     time.Duration
+	ClipMaxBytes int
+	ClipTemplate string
+	// Resolution is requested for the main stream. StrictResolution ends
+	// the session when the camera sends a different size.
+	Resolution       string
+	StrictResolution bool
+	// Size is the stream size named in startLive with Resolution.
+	Size string
+	// NoAudio negotiates a video-only session.
+	NoAudio bool
+	// Preview, if set, is a file the camera's low-resolution preview
+	// stream is written to, requested at PreviewResolution.
+	Preview           string
+	PreviewResolution string
+	// VideoTrack selects the main video track by ID, RID or SSRC when
+	// the camera sends several; empty takes the first.
+	VideoTrack string
+	// DedupParams drops repeated identical SPS/PPS within this window.
+	DedupParams time.Duration
+	// DropFrames is the percentage of frames between keyframes left out
+	// of the output.
+	DropFrames float64
+	// MotionRecord, if positive, writes video only while frames grow this
+	// many times the recent average or keyframes come early, and for
+	// MotionHold after.
+	MotionRecord float64
+	MotionHold   time.Duration
+	// StripNALU lists NAL unit types left out of the output.
+	StripNALU []uint8
+	// NALUFilter, if set, is a command each NAL unit of the main stream
+	// is passed through on its way to the output.
+	NALUFilter string
+	// InsertAUD writes an access unit delimiter before each access unit.
+	InsertAUD bool
+	// Timestamps writes each picture's wall-clock capture time into the
+	// stream as an SEI NAL unit.
+	Timestamps bool
+	// SDPRole selects who sends the SDP offer: "offer", "answer" or "auto".
+	SDPRole string
+	// EarlyPeerIn handles a PEER_IN before JOIN_LIVE succeeds: "queue",
+	// "drop" or "deliver".
+	EarlyPeerIn string
+	// UDPPortMin and UDPPortMax limit the local media ports; zero leaves
+	// the choice to the OS.
+	UDPPortMin, UDPPortMax int
+	// DSCP marks the media packets with this DSCP value; zero leaves
+	// them unmarked.
+	DSCP int
+	// NACK selects the NACK interceptors: "on", "no-responder" or "off".
+	NACK string
+	// DTLSRole forces the DTLS role when answering.
+	DTLSRole domain.DTLSRole
+	// ICECandidateInterval is the minimum spacing between local ICE
+	// candidate sends.
+	ICECandidateInterval time.Duration
+	// ICECandidates is the set of local candidate types to use, from
+	// host, srflx and relay. ICERelayFallback, if positive, holds relay
+	// candidates back until the connection is not up after this long.
+	ICECandidates    domain.CandidateTypes
+	ICERelayFallback time.Duration
+	// ICEServers are extra STUN/TURN servers from -ice-server. They are
+	// added to the ticket's servers, or replace them if ICEServersReplace
+	// is set.
+	ICEServers        []domain.ICEServer
+	ICEServersReplace bool
+	// DataChannelLabel names the control DataChannel; empty uses the
+	// serial number.
+	DataChannelLabel string
+	// DataChannelUnordered, DataChannelMaxRetransmits (-1 for reliable)
+	// and DataChannelProtocol set the control channel's delivery options.
+	DataChannelUnordered      bool
+	DataChannelMaxRetransmits int
+	DataChannelProtocol       string
+	// DataChannelTimeout logs a diagnostic when the control channel is
+	// not open this long after connecting; zero disables it.
+	// FailWithoutDataChannel also ends the session.
+	DataChannelTimeout     time.Duration
+	FailWithoutDataChannel bool
+	// Status queries the camera's status over the DataChannel and exits
+	// instead of streaming. StatusAction is the command sent.
+	Status       bool
+	StatusAction string
+	// SignalCapture, if set, is a file every signaling frame is appended
+	// to. SignalReplay, if set, is a capture whose sent frames are resent
+	// to SignalReplayURL instead of streaming.
+	SignalCapture   string
+	SignalReplay    string
+	SignalReplayURL string
+	// SignalDump, if set, is a file every signaling frame is appended to
+	// as SignalCapture does, with the access token redacted.
+	SignalDump string
+	// SessionID, if set, replaces the generated signaling session ID.
+	// Platform starts the generated one.
+	SessionID string
+	Platform  string
+	// SignalCompression negotiates permessage-deflate on the signaling
+	// WebSocket.
+	SignalCompression bool
+	// StrictBase64 rejects signaling payloads that are not padded
+	// standard base64.
+	StrictBase64 bool
+	// DTLSKeyLog, if set, is a file the DTLS secrets are appended to.
+	DTLSKeyLog string
+	// NALULog, if set, is a file a JSON line per NAL unit is appended to.
+	NALULog string
+	// ErrorDump, if set, is a file a JSON line per discarded video RTP
+	// packet is appended to.
+	ErrorDump string
+	// ICETest checks the ticket's ICE servers and exits instead of streaming.
+	ICETest bool
+	// Caps prints the codecs and interceptors the peer registers and exits
+	// without connecting.
+	Caps bool
+	// Proxy, if set, is the http:// or socks5:// proxy for the API and
+	// signaling connections, overriding the environment.
+	Proxy string
+	// Events, if set, is where lifecycle events are written as JSON lines:
+	// "fd:N", "unix:PATH" or a file path.
+	Events string
+	// LogFile, if set, receives log output instead of stderr.
+	LogFile string
+	// LogMaxSize rotates LogFile once it exceeds this many bytes. Zero
+	// disables rotation.
+	LogMaxSize int64
+	// Debug lists the debug namespaces logged verbosely, from the
+	// logging package's Namespaces.
+	Debug []string
+	// TUI shows a status dashboard on stderr instead of log output.
+	TUI bool
+	// Reconnect restarts the session with backoff when it ends for any
+	// reason other than shutdown or an authentication failure.
+	Reconnect bool
+	// ReconnectBase and ReconnectMax bound the jittered backoff between
+	// reconnect attempts.
+	ReconnectBase time.Duration
+	ReconnectMax  time.Duration
+	// TicketRefreshMargin is how long before the ticket expires a running
+	// session refreshes it, with Reconnect. Zero disables the refresh.
+	TicketRefreshMargin time.Duration
+	// MaxReconnects ends the process after this many consecutive failed
+	// reconnects. Zero retries forever.
+	MaxReconnects int
+	// WaitForSlot retries with backoff, with or without Reconnect, while
+	// the camera is at its viewer limit.
+	WaitForSlot bool
+	// QualityInterval is how often the connection quality is logged. Zero
+	// disables the log line.
+	QualityInterval time.Duration
+	// QualityLoss, QualityJitter and QualityRTT are the fair and poor
+	// thresholds for the quality rating. Loss is in percent.
+	QualityLoss   [2]float64
+	QualityJitter [2]time.Duration
+	QualityRTT    [2]time.Duration
+	// Timeouts holds the session's time limits.
+	Timeouts domain.Timeouts
+	// ShutdownGrace bounds how long a graceful shutdown may take.
+	ShutdownGrace time.Duration
+
+	// Language and TimeZone are sent to the API in the ticket request.
+	Language string
+	TimeZone string
+
+	// Warnings lists non-fatal problems found while loading, for the
+	// caller to log.
+	Warnings []string
 }
 
-// Load reads configuration from a .env file (if present) and environment variables.
-// Environment variables take precedence over .env values.
-func Load() (*Config, error) {
-	// godotenv.Load does not overwrite existing env vars
-	_ = godotenv.Load()
+// Load parses command-line options from args and reads credentials from a
+// .env file (if present) and environment variables. Environment variables
+// take precedence over .env values. It returns flag.ErrHelp if -h or --help
+// was given, and ErrVersion if -v or --version was given.
+//
+// Load may be called again to pick up changes to the .env file and the
+// token file. A token given on stdin is read once and reused.
+func Load(args []string) (*Config, error) {
+	env := loadEnv()
 
-	token := os.Getenv("VICO_TOKEN")
-	if token == "" {
-		return nil, fmt.Errorf("VICO_TOKEN environment variable is required")
+	cfg := &Config{Timeouts: domain.DefaultTimeouts()}
+	var tokenFile string
+	var tokenStdin bool
+	var showVersion bool
+
+	fs := flag.NewFlagSet("vicostream", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&showVersion, "v", false, "print version information")
+	fs.BoolVar(&showVersion, "version", false, "print version information")
+	fs.StringVar(&tokenFile, "token-file", "", "read the JWT from this file instead of VICO_TOKEN")
+	fs.BoolVar(&tokenStdin, "token-stdin", false, "read the JWT from stdin instead of VICO_TOKEN")
+	fs.BoolVar(&cfg.WaitKeyframe, "wait-keyframe", false, "discard video until the first keyframe")
+	registerTimeouts(fs, &cfg.Timeouts)
+	fs.DurationVar(&cfg.TrackTimeout, "track-timeout", 5*time.Second, "diagnose a connection that carries no video track after this long (0 disables)")
+	fs.BoolVar(&cfg.FailWithoutTrack, "fail-without-track", false, "end the session when -track-timeout passes without a video track")
+	fs.BoolVar(&cfg.ValidateAnswer, "validate-answer", true, "end the session when the camera's SDP answer declines H264 video")
+	h264Profiles := fs.String("h264-profiles", "64001f/0", "H264 formats to offer as profile-level-id/packetization-mode, tried in order when the camera sends no video")
+	fs.DurationVar(&cfg.KeyframeInterval, "keyframe-interval", 0, "request a keyframe when none arrived for this long (0 disables)")
+	fs.BoolVar(&cfg.KeyframeOnLoss, "keyframe-on-loss", false, "request a keyframe as soon as packet loss is seen")
+	fs.IntVar(&cfg.KeyframeLossThreshold, "keyframe-loss-threshold", 0, "request a keyframe when this many packets are lost within -keyframe-loss-window (0 disables)")
+	fs.DurationVar(&cfg.KeyframeLossWindow, "keyframe-loss-window", time.Second, "window for -keyframe-loss-threshold")
+	fs.DurationVar(&cfg.KeyframeLossCooldown, "keyframe-loss-cooldown", 2*time.Second, "minimum time between keyframe requests from -keyframe-loss-threshold")
+	fs.IntVar(&cfg.MaxReassemblySize, "max-reassembly-size", 4<<20, "maximum size in bytes of a reassembled FU-A NAL unit")
+	fs.IntVar(&cfg.MaxNALUSize, "max-nalu-size", 4<<20, "drop NAL units larger than this many bytes from the output (0 disables)")
+	fs.BoolVar(&cfg.LowLatency, "low-latency", false, "write video immediately and drop stale data for live viewing")
+	fs.DurationVar(&cfg.ClipBuffer, "clip-buffer", 0, "keep this much recent video in memory for clips saved on demand (0 disables)")
+	fs.DurationVar(&cfg.ClipPost, "clip-post", 10*time.Second, "video recorded into a clip after it is triggered")
+	fs.IntVar(&cfg.ClipMaxBytes, "clip-max-bytes", 64<<20, "memory limit in bytes for -clip-buffer")
+	fs.StringVar(&cfg.ClipTemplate, "clip-template", "clip_{serial}_{date}_{time}.h264", "file name for saved clips; placeholders as for -output-template")
+	fs.StringVar(&cfg.OutputFIFO, "output-fifo", "", "write video to this named pipe, dropping it while no reader is attached")
+	fs.BoolVar(&cfg.OnDemand, "on-demand", false, "with -output-fifo, stream only while a reader has the pipe open")
+	fs.StringVar(&cfg.OutputTemplate, "output-template", "", "write video to this file instead of stdout; {serial}, {date}, {time} and {index} are expanded per session")
+	fs.StringVar(&cfg.Resolution, "resolution", "1280x720", "resolution requested for the main stream")
+	fs.BoolVar(&cfg.StrictResolution, "strict-resolution", false, "end the session if the camera sends a different resolution than requested")
+	fs.StringVar(&cfg.Size, "size", "medium", "stream size named in startLive with -resolution")
+	fs.BoolVar(&cfg.Play, "play", false, "pipe the video to ffplay instead of stdout")
+	fs.StringVar(&cfg.Record, "record", "", "pipe the video to ffmpeg recording this file, e.g. out.mp4, instead of stdout")
+	fs.BoolVar(&cfg.NoAudio, "no-audio", false, "negotiate video only, without an audio m-line")
+	fs.StringVar(&cfg.Preview, "preview", "", "also request a low-resolution preview stream and write it to this file")
+	fs.StringVar(&cfg.PreviewResolution, "preview-resolution", "640x360", "resolution requested for -preview")
+	fs.StringVar(&cfg.VideoTrack, "video-track", "", "with several video tracks on the main stream, write the one with this track ID, RID or SSRC")
+	fs.DurationVar(&cfg.DedupParams, "dedup-params", 0, "drop SPS/PPS identical to one written within this duration (0 keeps all)")
+	fs.Float64Var(&cfg.DropFrames, "drop-frames", 0, "percent of frames between keyframes to drop from the output")
+	fs.Float64Var(&cfg.MotionRecord, "motion-record", 0, "write video only while frames grow this many times the average or keyframes come early, e.g. 2 (0 writes everything)")
+	fs.DurationVar(&cfg.MotionHold, "motion-hold", domain.DefaultMotionHold, "keep writing this long after the last sign of activity with -motion-record")
+	fs.StringVar(&cfg.NALUFilter, "nalu-filter", "", "pass each NAL unit through this command, length-prefixed both ways")
+	fs.StringVar(&cfg.SDPRole, "sdp-role", "auto", "who sends the SDP offer: offer, answer or auto")
+	fs.StringVar(&cfg.EarlyPeerIn, "early-peer-in", "queue", "a PEER_IN before the join succeeds: queue, drop or deliver")
+	dtlsRole := fs.String("dtls-role", "auto", "DTLS role when answering the camera's offer: auto, client or server")
+	fs.DurationVar(&cfg.ICECandidateInterval, "ice-candidate-interval", 0, "minimum time between sending local ICE candidates")
+	iceCandidates := fs.String("ice-candidates", "host,srflx,relay", "local ICE candidate types to use")
+	fs.DurationVar(&cfg.ICERelayFallback, "ice-relay-fallback", 0, "send relay candidates only if not connected this long after the first candidate (0 sends them at once)")
+	fs.Var((*iceServerList)(&cfg.ICEServers), "ice-server", "extra STUN/TURN server as URL?user:pass (repeatable)")
+	fs.BoolVar(&cfg.ICEServersReplace, "ice-servers-replace", false, "use only -ice-server servers, not the ticket's")
+	fs.StringVar(&cfg.DataChannelLabel, "datachannel-label", "", "label of the control DataChannel (default: the serial number)")
+	fs.BoolVar(&cfg.DataChannelUnordered, "datachannel-unordered", false, "allow out-of-order delivery on the control DataChannel")
+	fs.IntVar(&cfg.DataChannelMaxRetransmits, "datachannel-max-retransmits", -1, "retransmission limit for the control DataChannel (-1 is reliable)")
+	fs.StringVar(&cfg.DataChannelProtocol, "datachannel-protocol", "", "subprotocol of the control DataChannel")
+	fs.DurationVar(&cfg.DataChannelTimeout, "datachannel-timeout", 10*time.Second, "diagnose a control DataChannel not open this long after connecting (0 disables)")
+	fs.BoolVar(&cfg.FailWithoutDataChannel, "fail-without-datachannel", false, "end the session when -datachannel-timeout passes, so -reconnect retries it")
+	fs.BoolVar(&cfg.Status, "status", false, "print the camera's status reply and exit")
+	fs.StringVar(&cfg.StatusAction, "status-action", "getStatus", "DataChannel action sent by -status")
+	fs.StringVar(&cfg.SignalCapture, "signal-capture", "", "append every signaling frame to this file as JSON lines")
+	fs.StringVar(&cfg.SignalDump, "signal-dump", "", "append every signaling frame to this file as JSON lines, with the access token redacted")
+	fs.StringVar(&cfg.SignalReplay, "signal-replay", "", "resend the sent frames of this capture to -signal-replay-url and exit")
+	fs.StringVar(&cfg.SessionID, "session-id", "", "signaling session ID to use instead of a generated one")
+	fs.StringVar(&cfg.Platform, "platform", "Android", "platform the generated signaling session ID starts with")
+	fs.BoolVar(&cfg.SignalCompression, "signal-compression", true, "negotiate permessage-deflate compression on the signaling WebSocket")
+	fs.BoolVar(&cfg.StrictBase64, "strict-base64", false, "reject signaling payloads that are not padded standard base64")
+	fs.StringVar(&cfg.SignalReplayURL, "signal-replay-url", "", "WebSocket URL for -signal-replay")
+	fs.StringVar(&cfg.NACK, "nack", "on", "NACK handling: on, no-responder (only request retransmissions) or off")
+	fs.StringVar(&cfg.Proxy, "proxy", "", "http:// or socks5:// proxy for the API and signaling (default: from HTTPS_PROXY/ALL_PROXY)")
+	fs.StringVar(&cfg.Events, "events", "", "write lifecycle events as JSON lines to fd:N, unix:PATH or a file")
+	fs.StringVar(&cfg.NALULog, "nalu-log", "", "append each NAL unit's type, size and RTP timestamp to this file as JSON lines")
+	fs.StringVar(&cfg.ErrorDump, "dump-errors", "", "append each discarded video RTP packet's sequence number, drop reason and payload to this file as JSON lines")
+	fs.StringVar(&cfg.DTLSKeyLog, "sslkeylog", "", "append DTLS secrets to this file for Wireshark (sensitive)")
+	fs.BoolVar(&cfg.ICETest, "ice-test", false, "check the ticket's STUN/TURN servers and exit")
+	fs.BoolVar(&cfg.Caps, "caps", false, "print the codecs and interceptors this build negotiates and exit")
+	fs.StringVar(&cfg.LogFile, "log-file", "", "write logs to this file instead of stderr")
+	logMaxMB := fs.Int("log-max-size", 0, "rotate the log file after this many MiB (0 disables)")
+	debug := fs.String("debug", "", "comma-separated namespaces to log verbosely: signal, ice, dtls, rtp, datachannel or all")
+	fs.BoolVar(&cfg.TUI, "tui", false, "show a live status dashboard on stderr instead of logs")
+	fs.BoolVar(&cfg.Reconnect, "reconnect", false, "reconnect automatically when the session ends")
+	fs.DurationVar(&cfg.ReconnectBase, "reconnect-base", time.Second, "initial reconnect backoff ceiling")
+	fs.DurationVar(&cfg.ReconnectMax, "reconnect-max", time.Minute, "maximum reconnect backoff ceiling")
+	fs.DurationVar(&cfg.TicketRefreshMargin, "ticket-refresh-margin", 5*time.Minute, "refresh the ticket this long before it expires (0 disables)")
+	fs.IntVar(&cfg.MaxReconnects, "max-reconnects", 0, "give up after this many consecutive failed reconnects (0 retries forever)")
+	fs.BoolVar(&cfg.WaitForSlot, "wait-for-slot", false, "when the camera is at its viewer limit, retry until a viewer leaves")
+	fs.DurationVar(&cfg.QualityInterval, "quality-interval", 30*time.Second, "how often to log the connection quality (0 disables)")
+	udpPortRange := fs.String("udp-port-range", "", "local UDP ports for media, e.g. 50000-50100")
+	dscp := fs.String("dscp", "", "mark media packets with this DSCP value: 0 to 63, EF, AF11 to AF43 or CS0 to CS7")
+	fs.BoolVar(&cfg.InsertAUD, "insert-aud", false, "write an access unit delimiter before each access unit")
+	fs.BoolVar(&cfg.Timestamps, "timestamps", false, "embed each picture's wall-clock capture time as an SEI NAL unit")
+	stripNALU := fs.String("strip-nalu", "", "comma-separated NAL unit types to drop from the output, e.g. 6,9,12")
+	qualityLoss := fs.String("quality-loss", "1,5", "packet loss percent at which quality is fair,poor")
+	qualityJitter := fs.String("quality-jitter", "30ms,100ms", "jitter at which quality is fair,poor")
+	qualityRTT := fs.String("quality-rtt", "150ms,400ms", "round trip time at which quality is fair,poor")
+	fs.DurationVar(&cfg.ShutdownGrace, "shutdown-grace", 5*time.Second, "time allowed for a graceful shutdown")
+	fs.StringVar(&cfg.Language, "language", env.getOr("VICO_LANGUAGE", systemLanguage()), "language sent to the API")
+	fs.StringVar(&cfg.TimeZone, "timezone", env.getOr("VICO_TIMEZONE", systemTimeZone()), "IANA time zone sent to the API")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if showVersion {
+		return nil, ErrVersion
+	}
+	switch cfg.SDPRole {
+	case "offer", "answer", "auto":
+	default:
+		return nil, fmt.Errorf("-sdp-role must be offer, answer or auto, not %q", cfg.SDPRole)
+	}
+	switch cfg.EarlyPeerIn {
+	case "queue", "drop", "deliver":
+	default:
+		return nil, fmt.Errorf("-early-peer-in must be queue, drop or deliver, not %q", cfg.EarlyPeerIn)
+	}
+	if cfg.ICEServersReplace && len(cfg.ICEServers) == 0 {
+		return nil, fmt.Errorf("-ice-servers-replace needs at least one -ice-server")
+	}
+	if cfg.Status && cfg.StatusAction == "" {
+		return nil, fmt.Errorf("-status-action must not be empty")
+	}
+	switch cfg.NACK {
+	case "on", "no-responder", "off":
+	default:
+		return nil, fmt.Errorf("-nack must be on, no-responder or off, not %q", cfg.NACK)
+	}
+	if cfg.DataChannelMaxRetransmits < -1 || cfg.DataChannelMaxRetransmits > 65535 {
+		return nil, fmt.Errorf("-datachannel-max-retransmits must be between -1 and 65535")
+	}
+	if cfg.ReconnectBase <= 0 || cfg.ReconnectMax < cfg.ReconnectBase {
+		return nil, fmt.Errorf("-reconnect-base must be positive and no larger than -reconnect-max")
+	}
+	if cfg.KeyframeLossThreshold < 0 {
+		return nil, fmt.Errorf("-keyframe-loss-threshold must not be negative")
+	}
+	if cfg.KeyframeLossWindow <= 0 || cfg.KeyframeLossCooldown < 0 {
+		return nil, fmt.Errorf("-keyframe-loss-window must be positive and -keyframe-loss-cooldown not negative")
+	}
+	if cfg.TicketRefreshMargin < 0 {
+		return nil, fmt.Errorf("-ticket-refresh-margin must not be negative")
+	}
+	var err error
+	if cfg.UDPPortMin, cfg.UDPPortMax, err = parsePortRange(*udpPortRange); err != nil {
+		return nil, err
+	}
+	if cfg.DSCP, err = parseDSCP(*dscp); err != nil {
+		return nil, err
+	}
+	if cfg.StripNALU, err = parseNALUTypes(*stripNALU); err != nil {
+		return nil, err
+	}
+	if cfg.InsertAUD && slices.Contains(cfg.StripNALU, 9) {
+		return nil, fmt.Errorf("-insert-aud conflicts with stripping type 9 in -strip-nalu")
+	}
+	if cfg.QualityLoss, err = parseThresholds("-quality-loss", *qualityLoss, parsePercent); err != nil {
+		return nil, err
+	}
+	if cfg.QualityJitter, err = parseThresholds("-quality-jitter", *qualityJitter, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if cfg.QualityRTT, err = parseThresholds("-quality-rtt", *qualityRTT, time.ParseDuration); err != nil {
+		return nil, err
+	}
+	if err := validateTimeouts(cfg.Timeouts); err != nil {
+		return nil, err
+	}
+	if cfg.ICECandidates, err = domain.ParseCandidateTypes(*iceCandidates); err != nil {
+		return nil, fmt.Errorf("-ice-candidates: %w", err)
+	}
+	if cfg.H264Profiles, err = domain.ParseH264Profiles(*h264Profiles); err != nil {
+		return nil, fmt.Errorf("-h264-profiles: %w", err)
+	}
+	if cfg.DTLSRole, err = domain.ParseDTLSRole(*dtlsRole); err != nil {
+		return nil, fmt.Errorf("-dtls-role: %w", err)
+	}
+	if cfg.DTLSRole != domain.DTLSRoleAuto && cfg.SDPRole == "offer" {
+		cfg.Warnings = append(cfg.Warnings, fmt.Sprintf(
+			"-dtls-role %s has no effect with -sdp-role offer: the camera's answer picks the DTLS role", cfg.DTLSRole))
+	}
+	if cfg.ICERelayFallback < 0 {
+		return nil, fmt.Errorf("-ice-relay-fallback must not be negative")
+	}
+	if cfg.ICERelayFallback > 0 && cfg.ICECandidates&domain.CandidateRelay == 0 {
+		return nil, fmt.Errorf("-ice-relay-fallback needs relay in -ice-candidates")
+	}
+	if cfg.ICERelayFallback > 0 && cfg.ICECandidates == domain.CandidateRelay {
+		return nil, fmt.Errorf("-ice-relay-fallback needs host or srflx in -ice-candidates to fall back from")
+	}
+	if cfg.ICERelayFallback > 0 && cfg.Timeouts.Connect > 0 && cfg.ICERelayFallback >= cfg.Timeouts.Connect {
+		return nil, fmt.Errorf("-ice-relay-fallback must be shorter than -connect-timeout, or relay is never tried")
+	}
+	if cfg.OnDemand && cfg.OutputFIFO == "" {
+		return nil, fmt.Errorf("-on-demand needs -output-fifo")
+	}
+	if cfg.OnDemand && cfg.Timeouts.Connect > 0 {
+		return nil, fmt.Errorf("-on-demand cannot be combined with -connect-timeout, which would pass while waiting for a reader")
+	}
+	if cfg.MaxReconnects < 0 {
+		return nil, fmt.Errorf("-max-reconnects must not be negative")
+	}
+	if *logMaxMB < 0 {
+		return nil, fmt.Errorf("-log-max-size must not be negative")
+	}
+	cfg.LogMaxSize = int64(*logMaxMB) << 20
+	if cfg.Debug, err = logging.ParseDebug(*debug); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+	}
+	if cfg.Proxy != "" {
+		if err := validateProxy(cfg.Proxy); err != nil {
+			return nil, fmt.Errorf("-proxy: %w", err)
+		}
+	}
+	if cfg.OutputTemplate != "" {
+		if _, err := output.ParseTemplate(cfg.OutputTemplate); err != nil {
+			return nil, fmt.Errorf("-output-template: %w", err)
+		}
+	}
+	if cfg.ClipBuffer < 0 || cfg.ClipPost < 0 {
+		return nil, fmt.Errorf("-clip-buffer and -clip-post must not be negative")
+	}
+	if cfg.ClipBuffer > 0 {
+		if cfg.ClipMaxBytes <= 0 {
+			return nil, fmt.Errorf("-clip-max-bytes must be positive")
+		}
+		if _, err := output.ParseTemplate(cfg.ClipTemplate); err != nil {
+			return nil, fmt.Errorf("-clip-template: %w", err)
+		}
+		if tokenStdin {
+			return nil, fmt.Errorf("-clip-buffer reads commands from stdin and cannot be combined with -token-stdin")
+		}
+	}
+	if cfg.Platform == "" {
+		return nil, fmt.Errorf("-platform must not be empty")
+	}
+	if _, _, err := domain.ParseResolution(cfg.Resolution); err != nil {
+		return nil, fmt.Errorf("-resolution: %w", err)
+	}
+	if cfg.Preview != "" {
+		if _, _, err := domain.ParseResolution(cfg.PreviewResolution); err != nil {
+			return nil, fmt.Errorf("-preview-resolution: %w", err)
+		}
+	}
+	if cfg.DataChannelTimeout < 0 {
+		return nil, fmt.Errorf("-datachannel-timeout must not be negative")
+	}
+	if cfg.FailWithoutDataChannel && cfg.DataChannelTimeout == 0 {
+		return nil, fmt.Errorf("-fail-without-datachannel requires a -datachannel-timeout")
+	}
+	if cfg.TrackTimeout < 0 {
+		return nil, fmt.Errorf("-track-timeout must not be negative")
+	}
+	if cfg.FailWithoutTrack && cfg.TrackTimeout == 0 {
+		return nil, fmt.Errorf("-fail-without-track requires a -track-timeout")
+	}
+	if cfg.KeyframeInterval < 0 {
+		return nil, fmt.Errorf("-keyframe-interval must not be negative")
+	}
+	if cfg.DedupParams < 0 {
+		return nil, fmt.Errorf("-dedup-params must not be negative")
+	}
+	if cfg.DropFrames < 0 || cfg.DropFrames > 100 {
+		return nil, fmt.Errorf("-drop-frames must be between 0 and 100")
+	}
+	if cfg.MotionRecord != 0 && cfg.MotionRecord <= 1 {
+		return nil, fmt.Errorf("-motion-record must be 0 or more than 1")
+	}
+	if cfg.MotionHold <= 0 {
+		return nil, fmt.Errorf("-motion-hold must be positive")
+	}
+	if cfg.MaxReassemblySize <= 0 {
+		return nil, fmt.Errorf("-max-reassembly-size must be positive")
+	}
+	if cfg.MaxNALUSize < 0 {
+		return nil, fmt.Errorf("-max-nalu-size must not be negative")
+	}
+	if cfg.MaxNALUSize > cfg.MaxReassemblySize {
+		// Single packets are far smaller, so only reassembled units could
+		// be this large, and those are capped already.
+		cfg.Warnings = append(cfg.Warnings, fmt.Sprintf(
+			"-max-nalu-size %d is above -max-reassembly-size %d, so it never drops anything", cfg.MaxNALUSize, cfg.MaxReassemblySize))
 	}
 
-	sn := os.Getenv("VICO_SN")
-	if sn == "" {
+	if cfg.Caps {
+		// Nothing connects, so no credentials are needed.
+		return cfg, nil
+	}
+	if cfg.SignalReplay != "" {
+		// Replaying needs no credentials: the capture carries its own.
+		if cfg.SignalReplayURL == "" {
+			return nil, fmt.Errorf("-signal-replay needs -signal-replay-url")
+		}
+		return cfg, nil
+	}
+
+	creds, err := loadCredentials(env, tokenFile, tokenStdin)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Credentials = creds
+
+	cfg.SerialNumber = strings.TrimSpace(env.get("VICO_SN"))
+	if cfg.SerialNumber == "" {
 		return nil, fmt.Errorf("VICO_SN environment variable is required")
 	}
+	warning, err := validateSerial(cfg.SerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	if warning != "" {
+		cfg.Warnings = append(cfg.Warnings, warning)
+	}
+	if cfg.SignalCapture != "" {
+		cfg.Warnings = append(cfg.Warnings, fmt.Sprintf(
+			"-signal-capture writes the signaling access token to %s; remove it before sharing the file", cfg.SignalCapture))
+	}
+	if cfg.DTLSKeyLog != "" {
+		cfg.Warnings = append(cfg.Warnings, fmt.Sprintf(
+			"-sslkeylog writes session secrets to %s; anyone with this file and a capture can decrypt the session", cfg.DTLSKeyLog))
+	}
+
+	return cfg, nil
+}
+
+// validateSerial rejects serial numbers that cannot belong to any device
+// and warns about ones that do not look like the usual VICO format of 32
+// hex characters, since unusual but valid serials do exist.
+func validateSerial(sn string) (warning string, err error) {
+	if len(sn) < 8 || len(sn) > 64 {
+		return "", fmt.Errorf("VICO_SN %q has %d characters; serial numbers are 8 to 64 letters and digits", sn, len(sn))
+	}
+	hex := true
+	for _, r := range sn {
+		switch {
+		case r >= '0' && r <= '9', r >= 'a' && r <= 'f':
+		case r >= 'A' && r <= 'Z', r >= 'g' && r <= 'z':
+			hex = false
+		default:
+			return "", fmt.Errorf("VICO_SN %q contains %q; serial numbers are letters and digits only", sn, r)
+		}
+	}
+	if !hex || len(sn) != 32 {
+		return fmt.Sprintf("VICO_SN %q is not the usual 32 hex characters; check it if the camera never answers", sn), nil
+	}
+	return "", nil
+}
+
+// parseThresholds parses a "fair,poor" pair of increasing values.
+func parseThresholds[T float64 | time.Duration](flagName, value string, parse func(string) (T, error)) ([2]T, error) {
+	var out [2]T
+	fair, poor, ok := strings.Cut(value, ",")
+	if !ok {
+		return out, fmt.Errorf("%s must be two values, fair,poor, not %q", flagName, value)
+	}
+	var err error
+	if out[0], err = parse(strings.TrimSpace(fair)); err != nil {
+		return out, fmt.Errorf("%s: %w", flagName, err)
+	}
+	if out[1], err = parse(strings.TrimSpace(poor)); err != nil {
+		return out, fmt.Errorf("%s: %w", flagName, err)
+	}
+	if out[0] < 0 || out[1] < out[0] {
+		return out, fmt.Errorf("%s: the poor threshold must not be below the fair one", flagName)
+	}
+	return out, nil
+}
+
+// validateProxy checks s is a proxy URL both the API and the WebSocket
+// dialer can use.
+func validateProxy(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "socks5" {
+		return fmt.Errorf("unsupported proxy scheme %q (want http or socks5)", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy URL %q has no host", s)
+	}
+	return nil
+}
+
+// parsePortRange parses -udp-port-range, "MIN-MAX".
+func parsePortRange(s string) (lo, hi int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	first, last, ok := strings.Cut(s, "-")
+	lo, err1 := strconv.Atoi(strings.TrimSpace(first))
+	hi, err2 := strconv.Atoi(strings.TrimSpace(last))
+	if !ok || err1 != nil || err2 != nil || lo < 1 || hi > 65535 || lo > hi {
+		return 0, 0, fmt.Errorf("-udp-port-range must be MIN-MAX with 1 <= MIN <= MAX <= 65535, not %q", s)
+	}
+	return lo, hi, nil
+}
+
+// parseDSCP parses -dscp: a number or one of the standard class names.
+func parseDSCP(s string) (int, error) {
+	name := strings.ToUpper(s)
+	switch {
+	case s == "":
+		return 0, nil
+	case name == "EF":
+		return 46, nil
+	case len(name) == 3 && strings.HasPrefix(name, "CS") && name[2] >= '0' && name[2] <= '7':
+		return int(name[2]-'0') * 8, nil
+	case len(name) == 4 && strings.HasPrefix(name, "AF"):
+		x, y := int(name[2]-'0'), int(name[3]-'0')
+		if x >= 1 && x <= 4 && y >= 1 && y <= 3 {
+			return x*8 + y*2, nil
+		}
+	default:
+		if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= 63 {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("-dscp must be 0 to 63, EF, AF11 to AF43 or CS0 to CS7, not %q", s)
+}
+
+// parseNALUTypes parses the -strip-nalu list. The types a decoder cannot
+// do without, slices (1, 5) and parameter sets (7, 8), are refused.
+func parseNALUTypes(s string) ([]uint8, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var types []uint8
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n < 0 || n > 31 {
+			return nil, fmt.Errorf("-strip-nalu: %q is not a NAL unit type (0 to 31)", f)
+		}
+		switch n {
+		case 1, 5, 7, 8:
+			return nil, fmt.Errorf("-strip-nalu: type %d carries picture data or parameter sets and cannot be stripped", n)
+		}
+		types = append(types, uint8(n))
+	}
+	return types, nil
+}
+
+func parsePercent(s string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+}
+
+// iceServerList collects repeated -ice-server flags.
+type iceServerList []domain.ICEServer
+
+func (l *iceServerList) String() string {
+	if l == nil {
+		return ""
+	}
+	urls := make([]string, len(*l))
+	for i, s := range *l {
+		urls[i] = s.URL
+	}
+	return strings.Join(urls, ",")
+}
+
+func (l *iceServerList) Set(value string) error {
+	s, err := parseICEServer(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, s)
+	return nil
+}
+
+// parseICEServer parses a STUN/TURN server given as a URL with optional
+// credentials in the query, e.g. "turn:host:3478?user:pass" or
+// "turns:host:5349?transport=tcp&user:pass". The query is percent-decoded,
+// so credentials may hold "&" or "=" as %26 and %3D. Query parameters
+// other than the credentials stay part of the URL.
+func parseICEServer(value string) (domain.ICEServer, error) {
+	scheme, _, _ := strings.Cut(value, ":")
+	switch scheme {
+	case "stun", "stuns", "turn", "turns":
+	default:
+		return domain.ICEServer{}, fmt.Errorf("ICE server %q must start with stun:, stuns:, turn: or turns:", value)
+	}
+
+	base, query, _ := strings.Cut(value, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return domain.ICEServer{}, fmt.Errorf("ICE server %q: %w", value, err)
+	}
+	s := domain.ICEServer{URL: base}
+	credentials := false
+	for key, values := range params {
+		// A parameter without "=" parses as a key with an empty value.
+		if !strings.Contains(key, ":") || len(values) != 1 || values[0] != "" {
+			continue
+		}
+		if credentials {
+			return domain.ICEServer{}, fmt.Errorf("ICE server %q has more than one user:pass", value)
+		}
+		credentials = true
+		s.Username, s.Credential, _ = strings.Cut(key, ":")
+		params.Del(key)
+	}
+	if len(params) > 0 {
+		s.URL += "?" + params.Encode()
+	}
+	if strings.HasPrefix(scheme, "turn") && s.Username == "" {
+		return domain.ICEServer{}, fmt.Errorf("TURN server %q needs credentials as ?user:pass", value)
+	}
+	return s, nil
+}
+
+// environment resolves configuration variables from the process
+// environment, falling back to the .env file. The .env file is read fresh
+// on every Load and never copied into the process environment, so edits to
+// it take effect on reload.
+type environment map[string]string
 
-	return &Config{
-		Token:        token,
-		SerialNumber: sn,
-	}, nil
+func loadEnv() environment {
+	dotenv, err := godotenv.Read()
+	if err != nil {
+		return environment{}
+	}
+	return dotenv
+}
+
+func (e environment) get(key string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return e[key]
+}
+
+func (e environment) getOr(key, fallback string) string {
+	if v := e.get(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// systemLanguage returns the two-letter language from the POSIX locale
+// (e.g. "de" for LANG=de_DE.UTF-8), defaulting to "en".
+func systemLanguage() string {
+	for _, key := range []string{"LC_ALL", "LANG"} {
+		locale := os.Getenv(key)
+		if locale == "" || locale == "C" || locale == "POSIX" {
+			continue
+		}
+		if lang, _, _ := strings.Cut(locale, "_"); len(lang) == 2 {
+			return strings.ToLower(lang)
+		}
+	}
+	return "en"
+}
+
+// systemTimeZone returns the IANA name of the local time zone. time.Local
+// only knows its name when TZ is set, so fall back to the /etc/localtime
+// symlink target, and finally to the zone the app was modelled on.
+func systemTimeZone() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" {
+		if _, err := time.LoadLocation(tz); err == nil {
+			return tz
+		}
+	}
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if _, name, ok := strings.Cut(target, "zoneinfo/"); ok {
+			return name
+		}
+	}
+	return "America/New_York"
+}
+
+// stdinToken holds the token read from stdin, which can only be read once.
+var stdinToken struct {
+	once  sync.Once
+	token string
+	err   error
+}
+
+// fileToken is a CredentialProvider that reads the token from a file on
+// every request, so replacing the file rotates the token.
+type fileToken string
+
+func (f fileToken) Token() (string, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return "", fmt.Errorf("read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", string(f))
+	}
+	return token, nil
+}
+
+// loadCredentials returns the provider for the configured token source,
+// after checking that it yields a token now.
+func loadCredentials(env environment, path string, fromStdin bool) (domain.CredentialProvider, error) {
+	token, err := loadToken(env, path, fromStdin)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		return fileToken(path), nil
+	}
+	return domain.StaticToken(token), nil
+}
+
+// loadToken reads the JWT from a file or stdin if requested, falling back
+// to the VICO_TOKEN environment variable. Surrounding whitespace, including
+// the trailing newline most editors and echo add, is removed.
+func loadToken(env environment, path string, fromStdin bool) (string, error) {
+	var token string
+	switch {
+	case path != "" && fromStdin:
+		return "", fmt.Errorf("-token-file and -token-stdin are mutually exclusive")
+	case path != "":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("read token file: %w", err)
+		}
+		token = string(data)
+	case fromStdin:
+		stdinToken.once.Do(func() {
+			data, err := io.ReadAll(os.Stdin)
+			stdinToken.token, stdinToken.err = string(data), err
+		})
+		if stdinToken.err != nil {
+			return "", fmt.Errorf("read token from stdin: %w", stdinToken.err)
+		}
+		token = stdinToken.token
+	default:
+		token = env.get("VICO_TOKEN")
+		if strings.TrimSpace(token) == "" {
+			return "", fmt.Errorf("VICO_TOKEN environment variable is required")
+		}
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("token is empty")
+	}
+	return token, nil
 }
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"vico_home/native/internal/domain"
+)
+
+// timeoutFlag ties one Timeouts field to its flag.
+type timeoutFlag struct {
+	name  string
+	field *time.Duration
+	usage string
+}
+
+func timeoutFlags(t *domain.Timeouts) []timeoutFlag {
+	return []timeoutFlag{
+		{"connect-timeout", &t.Connect, "give up if no video arrives within this duration of starting"},
+		{"ice-timeout", &t.ICE, "fail the connection after ICE has no connectivity for this long"},
+		{"keyframe-timeout", &t.FirstFrame, "fail if no keyframe arrives within this duration"},
+		{"stall-timeout", &t.Stall, "end the session when video stops arriving for this long (0 disables)"},
+		{"signal-write-timeout", &t.Write, "bound sending one signaling message (0 disables)"},
+		{"signal-handshake-timeout", &t.Handshake, "bound connecting to the signal server (0 disables)"},
+		{"signal-ping-timeout", &t.Ping, "bound sending one signaling ping (0 disables)"},
+		{"signal-read-timeout", &t.Read, "drop the signaling connection after receiving nothing for this long (0 disables)"},
+	}
+}
+
+// registerTimeouts adds a flag for each field of t to fs, defaulting to
+// the field's current value.
+func registerTimeouts(fs *flag.FlagSet, t *domain.Timeouts) {
+	for _, f := range timeoutFlags(t) {
+		fs.DurationVar(f.field, f.name, *f.field, f.usage)
+	}
+}
+
+// validateTimeouts reports the first field of t that is out of range.
+func validateTimeouts(t domain.Timeouts) error {
+	for _, f := range timeoutFlags(&t) {
+		if *f.field < 0 {
+			return fmt.Errorf("-%s must not be negative", f.name)
+		}
+	}
+	if t.ICE == 0 {
+		return fmt.Errorf("-ice-timeout must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/domain"
+)
+
+func TestTimeouts_FlagsOverrideDefaults(t *testing.T) {
+	tests := []struct {
+		args []string
+		want domain.Timeouts
+	}{
+		{nil, domain.DefaultTimeouts()},
+		{
+			[]string{"-connect-timeout", "1m", "-stall-timeout", "8s", "-signal-ping-timeout", "0"},
+			domain.Timeouts{Connect: time.Minute, ICE: 25 * time.Second, FirstFrame: 10 * time.Second, Stall: 8 * time.Second,
+				Write: 10 * time.Second, Handshake: 45 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		got := domain.DefaultTimeouts()
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		registerTimeouts(fs, &got)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if got != tt.want {
+			t.Errorf("%v: expected %+v, got %+v", tt.args, tt.want, got)
+		}
+		if err := validateTimeouts(got); err != nil {
+			t.Errorf("%v: unexpected error: %v", tt.args, err)
+		}
+	}
+}
+
+func TestTimeouts_Validate(t *testing.T) {
+	tests := []struct {
+		mutate func(*domain.Timeouts)
+		want   string
+	}{
+		{func(t *domain.Timeouts) { t.Stall = -time.Second }, "-stall-timeout must not be negative"},
+		{func(t *domain.Timeouts) { t.Write = -1 }, "-signal-write-timeout must not be negative"},
+		{func(t *domain.Timeouts) { t.ICE = 0 }, "-ice-timeout must be positive"},
+	}
+	for _, tt := range tests {
+		to := domain.DefaultTimeouts()
+		tt.mutate(&to)
+		if err := validateTimeouts(to); err == nil || err.Error() != tt.want {
+			t.Errorf("expected %q, got %v", tt.want, err)
+		}
+	}
+}
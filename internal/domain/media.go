@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CandidateTypes is a set of local ICE candidate types.
+type CandidateTypes uint8
+
+const (
+	CandidateHost  CandidateTypes = 1 << iota // addresses of the local interfaces
+	CandidateSrflx                            // public addresses learned from STUN
+	CandidateRelay                            // addresses allocated on a TURN server
+
+	AllCandidateTypes = CandidateHost | CandidateSrflx | CandidateRelay
+)
+
+var candidateTypeNames = []struct {
+	t    CandidateTypes
+	name string
+}{
+	{CandidateHost, "host"},
+	{CandidateSrflx, "srflx"},
+	{CandidateRelay, "relay"},
+}
+
+// ParseCandidateTypes parses a comma-separated list of host, srflx and
+// relay.
+func ParseCandidateTypes(s string) (CandidateTypes, error) {
+	var t CandidateTypes
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		found := false
+		for _, n := range candidateTypeNames {
+			if f == n.name {
+				t |= n.t
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown ICE candidate type %q (want host, srflx or relay)", f)
+		}
+	}
+	return t, nil
+}
+
+func (t CandidateTypes) String() string {
+	var names []string
+	for _, n := range candidateTypeNames {
+		if t&n.t != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// H264Profile is the H264 format a viewer offers, as the two fmtp
+// parameters cameras are picky about. Depending on its firmware, a camera
+// offered a profile or packetization mode it does not support rejects the
+// video section or answers it and never sends a track.
+type H264Profile struct {
+	// ProfileLevelID is the profile-level-id, six hex digits such as
+	// "64001f" (High, level 3.1).
+	ProfileLevelID string
+	// PacketizationMode is 0 (single NAL unit) or 1 (non-interleaved,
+	// which allows STAP-A and FU-A).
+	PacketizationMode int
+}
+
+// String returns h in the form ParseH264Profiles reads, e.g. "64001f/0".
+func (h H264Profile) String() string {
+	return fmt.Sprintf("%s/%d", h.ProfileLevelID, h.PacketizationMode)
+}
+
+// ParseH264Profiles parses a comma-separated list of profiles written as
+// PROFILE-LEVEL-ID/PACKETIZATION-MODE, e.g. "64001f/0,64001f/1,42e01f/1".
+// The mode may be left out and defaults to 0. Repeats are dropped.
+func ParseH264Profiles(s string) ([]H264Profile, error) {
+	var profiles []H264Profile
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		id, mode, hasMode := strings.Cut(f, "/")
+		h := H264Profile{ProfileLevelID: strings.ToLower(id)}
+		if b, err := hex.DecodeString(id); err != nil || len(b) != 3 {
+			return nil, fmt.Errorf("invalid H264 profile %q: profile-level-id must be six hex digits", f)
+		}
+		if hasMode {
+			n, err := strconv.Atoi(mode)
+			if err != nil || n < 0 || n > 1 {
+				return nil, fmt.Errorf("invalid H264 profile %q: packetization mode must be 0 or 1", f)
+			}
+			h.PacketizationMode = n
+		}
+		if !slices.Contains(profiles, h) {
+			profiles = append(profiles, h)
+		}
+	}
+	return profiles, nil
+}
+
+// ParseResolution parses a resolution in the form the camera expects in
+// startLive, WIDTHxHEIGHT such as "640x360".
+func ParseResolution(s string) (width, height int, err error) {
+	w, h, ok := strings.Cut(s, "x")
+	width, err1 := strconv.Atoi(w)
+	height, err2 := strconv.Atoi(h)
+	if !ok || err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid resolution %q (want WIDTHxHEIGHT)", s)
+	}
+	return width, height, nil
+}
+
+// DTLSRole selects the side of the DTLS handshake a viewer takes when
+// answering.
+type DTLSRole string
+
+const (
+	// DTLSRoleAuto lets the WebRTC stack choose, which is the client when
+	// answering.
+	DTLSRoleAuto DTLSRole = ""
+	// DTLSRoleClient sends the ClientHello (a=setup:active).
+	DTLSRoleClient DTLSRole = "client"
+	// DTLSRoleServer waits for the camera's ClientHello (a=setup:passive).
+	DTLSRoleServer DTLSRole = "server"
+)
+
+// ParseDTLSRole converts a command-line value ("auto", "client" or
+// "server") to a DTLSRole.
+func ParseDTLSRole(s string) (DTLSRole, error) {
+	switch s {
+	case "", "auto":
+		return DTLSRoleAuto, nil
+	case "client", "server":
+		return DTLSRole(s), nil
+	default:
+		return "", fmt.Errorf("invalid DTLS role %q (want auto, client or server)", s)
+	}
+}
+
+// DefaultMotionHold is how long -motion-record keeps writing after the
+// last sign of activity when nothing sets it.
+const DefaultMotionHold = 10 * time.Second
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCandidateTypes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want CandidateTypes
+		ok   bool
+	}{
+		{"host,srflx,relay", AllCandidateTypes, true},
+		{"host, srflx", CandidateHost | CandidateSrflx, true},
+		{"relay", CandidateRelay, true},
+		{"prflx", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseCandidateTypes(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("%q: expected %s (ok=%v), got %s (%v)", tt.in, tt.want, tt.ok, got, err)
+		}
+	}
+}
+
+func TestParseH264Profiles(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []H264Profile
+		wantErr bool
+	}{
+		{in: "64001f/0", want: []H264Profile{{"64001f", 0}}},
+		{in: "64001F/0, 64001f/1,42e01f", want: []H264Profile{
+			{"64001f", 0}, {"64001f", 1}, {"42e01f", 0},
+		}},
+		{in: "64001f,64001f/0", want: []H264Profile{{"64001f", 0}}},
+		{in: "", wantErr: true},
+		{in: "64001f/2", wantErr: true},
+		{in: "64001/1", wantErr: true},
+		{in: "zz001f/1", wantErr: true},
+		{in: "64001f/", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseH264Profiles(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseH264Profiles(%q): expected an error, got %v", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseH264Profiles(%q): %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseH264Profiles(%q): expected %v, got %v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestParseResolution(t *testing.T) {
+	tests := []struct {
+		in            string
+		width, height int
+		ok            bool
+	}{
+		{"640x360", 640, 360, true},
+		{"1280x720", 1280, 720, true},
+		{"640", 0, 0, false},
+		{"640x", 0, 0, false},
+		{"0x360", 0, 0, false},
+		{"640X360", 0, 0, false},
+	}
+	for _, tt := range tests {
+		w, h, err := ParseResolution(tt.in)
+		if (err == nil) != tt.ok || w != tt.width || h != tt.height {
+			t.Errorf("%q: expected %dx%d (ok=%v), got %dx%d (%v)", tt.in, tt.width, tt.height, tt.ok, w, h, err)
+		}
+	}
+}
+
+func TestParseDTLSRole(t *testing.T) {
+	for in, want := range map[string]DTLSRole{"": DTLSRoleAuto, "auto": DTLSRoleAuto, "client": DTLSRoleClient, "server": DTLSRoleServer} {
+		if got, err := ParseDTLSRole(in); err != nil || got != want {
+			t.Errorf("%q: expected %q, got %q (%v)", in, want, got, err)
+		}
+	}
+	if _, err := ParseDTLSRole("active"); err == nil {
+		t.Error("expected an error for an unknown role")
+	}
+}
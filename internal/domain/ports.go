@@ -4,7 +4,21 @@ import "io"
 
 // TicketFetcher retrieves signaling credentials from the API.
 type TicketFetcher interface {
-	FetchTicket(jwt, serialNumber string) (*Ticket, error)
+	FetchTicket(serialNumber string) (*Ticket, error)
+}
+
+// CredentialProvider supplies the JWT the API is called with. Token is
+// called for every request, so a provider backed by a keychain or secrets
+// manager can rotate the token without restarting anything.
+type CredentialProvider interface {
+	Token() (string, error)
+}
+
+// StaticToken is a CredentialProvider that always returns the same token.
+type StaticToken string
+
+func (t StaticToken) Token() (string, error) {
+	return string(t), nil
 }
 
 // Signaler manages the WebSocket signaling connection.
@@ -12,6 +26,7 @@ type Signaler interface {
 	Connect() error
 	SendJoinLive()
 	SendSDPOffer(sdp string)
+	SendSDPAnswer(sdp string)
 	SendICECandidate(sdpMid string, sdpMLineIndex int, candidate string)
 	Close()
 }
@@ -22,7 +37,9 @@ type Handler interface {
 	OnPeerIn()
 	OnPeerOut()
 	OnSDPAnswer(sdp SDPPayload)
+	OnSDPOffer(sdp SDPPayload)
 	OnRemoteICECandidate(candidate ICECandidatePayload)
+	OnError(err error)
 }
 
 // Peer manages the WebRTC peer connection.
@@ -32,6 +49,7 @@ type Peer interface {
 	SetOnICECandidate(send func(sdpMid string, sdpMLineIndex int, candidate string))
 	CreateOffer() (string, error)
 	SetRemoteDescription(sdp SDPPayload) error
+	AcceptOffer(sdp SDPPayload) (string, error)
 	AddRemoteICECandidate(candidate ICECandidatePayload) error
 	Close()
 }
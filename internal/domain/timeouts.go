@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+// Timeouts groups the time limits of a session, from start to the first
+// frame and on to the signaling keepalives. Zero leaves a limit off,
+// except for ICE, where it keeps pion's own timeout.
+type Timeouts struct {
+	// Connect bounds the time from start to the first video
+	// (-connect-timeout).
+	Connect time.Duration
+	// ICE is how long ICE may go without connectivity before the
+	// connection fails (-ice-timeout, 25s as in pion).
+	ICE time.Duration
+	// FirstFrame bounds how long -wait-keyframe waits for the first
+	// keyframe (-keyframe-timeout).
+	FirstFrame time.Duration
+	// Stall ends a session whose video stops arriving for this long
+	// after it started (-stall-timeout).
+	Stall time.Duration
+	// Write bounds sending one signaling message (-signal-write-timeout).
+	// A write that times out closes the connection.
+	Write time.Duration
+	// Handshake bounds dialing the signal server and the WebSocket
+	// opening handshake (-signal-handshake-timeout).
+	Handshake time.Duration
+	// Ping bounds sending one signaling keepalive ping, or the pong
+	// answering one of the server's (-signal-ping-timeout).
+	Ping time.Duration
+	// Read drops the signaling connection after this long without
+	// receiving anything, pings and pongs included
+	// (-signal-read-timeout).
+	Read time.Duration
+}
+
+// DefaultTimeouts returns the timeouts used when nothing overrides them,
+// both as the flag defaults and by a new signaling client.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		ICE:        25 * time.Second,
+		FirstFrame: 10 * time.Second,
+		Write:      10 * time.Second,
+		Handshake:  45 * time.Second,
+		Ping:       5 * time.Second,
+	}
+}
@@ -0,0 +1,91 @@
+// Package events emits connection lifecycle events as JSON lines, for
+// programs that orchestrate vicostream. Unlike the logs, the schema is
+// stable: fields are only ever added, and Version changes if an existing
+// field's meaning does.
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Version is the schema version carried in every event.
+const Version = 1
+
+// Type names a lifecycle event.
+type Type string
+
+// Event types, in the order a successful session emits them.
+const (
+	SessionStart  Type = "session-start" // a session began fetching its ticket
+	Authenticated Type = "authenticated" // the signaling server accepted the ticket
+	Joined        Type = "joined"        // the server answered the join request
+	PeerIn        Type = "peer-in"       // the camera joined the session
+	Connected     Type = "connected"     // the WebRTC connection is up
+	FirstFrame    Type = "first-frame"   // the first video was written
+	Stalled       Type = "stalled"       // connected, but no usable video arrived
+	PeerOut       Type = "peer-out"      // the camera left the session
+	Disconnected  Type = "disconnected"  // the WebRTC connection dropped or failed
+	Closed        Type = "closed"        // the session ended; Detail has the error, if any
+	Reconnecting  Type = "reconnecting"  // a new session starts after Detail's delay
+)
+
+// Event is one line of the event stream.
+type Event struct {
+	Version int       `json:"v"`
+	Time    time.Time `json:"time"`
+	Type    Type      `json:"type"`
+	Serial  string    `json:"serial"`
+	Session int       `json:"session"` // counts from 1 per process
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// Emitter writes events to w. It is safe for concurrent use, and a nil
+// *Emitter discards events so callers need not check.
+type Emitter struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	serial  string
+	session int
+}
+
+// NewEmitter returns an Emitter writing to w.
+func NewEmitter(w io.Writer) *Emitter {
+	return &Emitter{enc: json.NewEncoder(w)}
+}
+
+// StartSession sets the serial number and session number of the events
+// that follow and emits SessionStart.
+func (e *Emitter) StartSession(serial string, session int) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.serial, e.session = serial, session
+	e.mu.Unlock()
+	e.Emit(SessionStart, "")
+}
+
+// Emit writes an event of type t. A write error is logged and otherwise
+// ignored: a missing watcher must not stop the stream.
+func (e *Emitter) Emit(t Type, detail string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	err := e.enc.Encode(Event{
+		Version: Version,
+		Time:    time.Now(),
+		Type:    t,
+		Serial:  e.serial,
+		Session: e.session,
+		Detail:  detail,
+	})
+	if err != nil {
+		log.Printf("[events] write error: %v", err)
+	}
+}
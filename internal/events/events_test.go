@@ -0,0 +1,177 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmitter_WritesEvents(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEmitter(&buf)
+	e.StartSession("abc123", 2)
+	e.Emit(Closed, "camera left")
+
+	var got []Event
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var ev Event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("unmarshal %q: %v", sc.Text(), err)
+		}
+		got = append(got, ev)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(got))
+	}
+	for i, want := range []Event{
+		{Version: Version, Type: SessionStart, Serial: "abc123", Session: 2},
+		{Version: Version, Type: Closed, Serial: "abc123", Session: 2, Detail: "camera left"},
+	} {
+		if got[i].Time.IsZero() {
+			t.Errorf("event %d: expected a time", i)
+		}
+		got[i].Time = time.Time{}
+		if got[i] != want {
+			t.Errorf("event %d: expected %+v, got %+v", i, want, got[i])
+		}
+	}
+}
+
+func TestEmitter_NilDiscards(t *testing.T) {
+	var e *Emitter
+	e.StartSession("abc123", 1)
+	e.Emit(Connected, "")
+}
+
+func TestOpen_UnixSocketBroadcasts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	sink, err := Open("unix:" + path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer sink.Close()
+
+	var readers []*bufio.Reader
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		readers = append(readers, bufio.NewReader(conn))
+	}
+
+	// Clients are registered asynchronously; wait for both.
+	e := NewEmitter(sink)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sink.(*socketSink).joined:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 2 clients, got %d", i)
+		}
+	}
+	e.Emit(PeerOut, "")
+
+	for i, r := range readers {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("client %d: read: %v", i, err)
+		}
+		var ev Event
+		if err := json.Unmarshal(line, &ev); err != nil || ev.Type != PeerOut {
+			t.Errorf("client %d: expected a peer-out event, got %q (%v)", i, line, err)
+		}
+	}
+}
+
+// TestSocketSink_StuckClientDoesNotHoldUpOthers connects a client that
+// never reads beside one that does. The reader should get every event
+// without Write waiting on the stuck client, which is dropped once its
+// queue and socket buffers fill.
+func TestSocketSink_StuckClientDoesNotHoldUpOthers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	s, err := listen(path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer s.Close()
+
+	stuck, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer stuck.Close()
+	<-s.joined
+	reader, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer reader.Close()
+	<-s.joined
+	reader.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(reader)
+
+	// Far more than the socket buffers hold, so the stuck client's
+	// writer blocks and its queue fills.
+	const events = 1000
+	e := NewEmitter(s)
+	detail := strings.Repeat("x", 1024)
+	start := time.Now()
+	for i := 0; i < events; i++ {
+		e.Emit(Connected, detail)
+		if _, err := r.ReadBytes('\n'); err != nil {
+			t.Fatalf("event %d: read: %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= clientWriteTimeout {
+		t.Errorf("expected Write not to wait on the stuck client, took %s", elapsed)
+	}
+
+	s.mu.Lock()
+	n := len(s.clients)
+	s.mu.Unlock()
+	if n != 1 {
+		t.Errorf("expected the stuck client dropped, got %d clients", n)
+	}
+	stuck.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got, err := io.Copy(io.Discard, stuck)
+	if err != nil || got >= int64(events*len(detail)) {
+		t.Errorf("expected the stuck client disconnected short of %d events, got %d bytes (%v)", events, got, err)
+	}
+}
+
+func TestSocketSink_CloseFlushesQueuedEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	s, err := listen(path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	<-s.joined
+
+	e := NewEmitter(s)
+	e.Emit(PeerOut, "")
+	e.Emit(Closed, "done")
+	s.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 2 {
+		t.Errorf("expected both events before the disconnect, got %q", data)
+	}
+}
@@ -0,0 +1,181 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// clientWriteTimeout bounds a write to one socket client; a client
+	// that takes longer is dropped.
+	clientWriteTimeout = time.Second
+	// clientQueueLen is how many events may wait for one socket client
+	// before it is dropped as too slow.
+	clientQueueLen = 64
+)
+
+// Open returns the sink spec names:
+//
+//	fd:N       an inherited file descriptor, e.g. fd:3
+//	unix:PATH  a Unix socket listening at PATH; every connected client
+//	           receives the events emitted while it is connected
+//	PATH       a file, appended to
+func Open(spec string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasPrefix(spec, "fd:"):
+		fd, err := strconv.Atoi(strings.TrimPrefix(spec, "fd:"))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("events: invalid file descriptor in %q", spec)
+		}
+		return os.NewFile(uintptr(fd), spec), nil
+	case strings.HasPrefix(spec, "unix:"):
+		return listen(strings.TrimPrefix(spec, "unix:"))
+	case spec == "":
+		return nil, errors.New("events: empty destination")
+	default:
+		f, err := os.OpenFile(spec, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("events: %w", err)
+		}
+		return f, nil
+	}
+}
+
+// socketSink broadcasts writes to the clients of a Unix socket. Each
+// client has its own queue and writer goroutine, so a stuck watcher
+// cannot hold up the others or the session.
+type socketSink struct {
+	ln net.Listener
+	// joined receives once per accepted client, for tests.
+	joined chan struct{}
+	// writers tracks the writer goroutines, so Close can let them finish.
+	writers sync.WaitGroup
+
+	mu      sync.Mutex
+	clients map[net.Conn]chan []byte
+	closed  bool
+}
+
+func listen(path string) (*socketSink, error) {
+	// A socket left behind by an earlier run would make Listen fail.
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("events: %w", err)
+	}
+	s := &socketSink{ln: ln, joined: make(chan struct{}, 16), clients: make(map[net.Conn]chan []byte)}
+	go s.accept()
+	return s, nil
+}
+
+func (s *socketSink) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		queue := make(chan []byte, clientQueueLen)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.clients[conn] = queue
+		s.writers.Add(1)
+		s.mu.Unlock()
+		go s.serve(conn, queue)
+		select {
+		case s.joined <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// serve writes the events queued for conn until the queue is closed or a
+// write fails, then disconnects it.
+func (s *socketSink) serve(conn net.Conn, queue <-chan []byte) {
+	defer s.writers.Done()
+	defer conn.Close()
+	for p := range queue {
+		conn.SetWriteDeadline(time.Now().Add(clientWriteTimeout))
+		if _, err := conn.Write(p); err != nil {
+			log.Printf("[events] dropping client: %v", err)
+			s.mu.Lock()
+			s.drop(conn)
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// drop disconnects conn if it is still a client. s.mu must be held.
+func (s *socketSink) drop(conn net.Conn) {
+	if queue, ok := s.clients[conn]; ok {
+		delete(s.clients, conn)
+		close(queue)
+		conn.Close()
+	}
+}
+
+// Write queues p for every client, dropping those whose queue is full. It
+// never returns an error: having no watchers is normal.
+func (s *socketSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.clients) == 0 {
+		return len(p), nil
+	}
+	// The caller may reuse p; the writer goroutines share this copy.
+	p = append([]byte(nil), p...)
+	for conn, queue := range s.clients {
+		select {
+		case queue <- p:
+		default:
+			log.Printf("[events] dropping client: %d events behind", clientQueueLen)
+			s.drop(conn)
+		}
+	}
+	return len(p), nil
+}
+
+// Close stops listening and removes the socket, then gives each client up
+// to clientWriteTimeout to receive the events still queued for it before
+// disconnecting it.
+func (s *socketSink) Close() error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	s.closed = true
+	var conns []net.Conn
+	for conn, queue := range s.clients {
+		delete(s.clients, conn)
+		close(queue)
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.writers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(clientWriteTimeout):
+		for _, conn := range conns {
+			conn.Close()
+		}
+		<-done
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Debug namespaces, each enabled independently with -debug.
+const (
+	Signal      = "signal"      // every signaling frame sent and received
+	ICE         = "ice"         // pion's ICE, STUN and TURN internals
+	DTLS        = "dtls"        // pion's DTLS handshake
+	RTP         = "rtp"         // every video RTP packet read
+	DataChannel = "datachannel" // pion's SCTP and DataChannel internals
+)
+
+// Namespaces lists the debug namespaces in the order -help gives them.
+var Namespaces = []string{Signal, ICE, DTLS, RTP, DataChannel}
+
+// debugOn holds the enabled namespaces. It is read on every RTP packet, so
+// it is swapped whole rather than guarded by a lock.
+var debugOn atomic.Pointer[[]string]
+
+// ParseDebug parses a comma-separated list of namespaces, or "all".
+func ParseDebug(s string) ([]string, error) {
+	var out []string
+	for _, ns := range strings.Split(s, ",") {
+		ns = strings.ToLower(strings.TrimSpace(ns))
+		switch {
+		case ns == "":
+		case ns == "all":
+			return slices.Clone(Namespaces), nil
+		case !slices.Contains(Namespaces, ns):
+			return nil, fmt.Errorf("-debug: unknown namespace %q, want all or some of %s", ns, strings.Join(Namespaces, ","))
+		case !slices.Contains(out, ns):
+			out = append(out, ns)
+		}
+	}
+	return out, nil
+}
+
+// SetDebug enables exactly the namespaces in ns.
+func SetDebug(ns []string) {
+	ns = slices.Clone(ns)
+	debugOn.Store(&ns)
+}
+
+// DebugEnabled reports whether namespace ns is enabled.
+func DebugEnabled(ns string) bool {
+	on := debugOn.Load()
+	return on != nil && slices.Contains(*on, ns)
+}
+
+// Debugf logs like log.Printf, prefixed with "[ns] debug: ", if namespace
+// ns is enabled. Callers building costly arguments should check
+// DebugEnabled first.
+func Debugf(ns, format string, args ...any) {
+	if DebugEnabled(ns) {
+		log.Printf("["+ns+"] debug: "+format, args...)
+	}
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseDebug(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"rtp", []string{RTP}},
+		{"Signal, ice,signal", []string{Signal, ICE}},
+		{"rtp,all", Namespaces},
+	}
+	for _, tt := range tests {
+		got, err := ParseDebug(tt.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.in, tt.want, got)
+		}
+	}
+	if _, err := ParseDebug("rtp,video"); err == nil {
+		t.Error("expected an error for an unknown namespace")
+	}
+}
+
+func TestDebugf_OnlyEnabledNamespaces(t *testing.T) {
+	var buf bytes.Buffer
+	flags := log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+		SetDebug(nil)
+	}()
+
+	SetDebug([]string{RTP})
+	Debugf(RTP, "packet %d", 1)
+	Debugf(Signal, "frame %d", 2)
+	if got, want := buf.String(), "[rtp] debug: packet 1\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	SetDebug(nil)
+	Debugf(RTP, "packet %d", 3)
+	if strings.Contains(buf.String(), "packet 3") {
+		t.Error("expected nothing logged once the namespace is disabled")
+	}
+}
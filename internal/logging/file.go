@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is an io.Writer that appends to a log file and, once the
+// file grows past a size limit, renames it to <path>.1 (replacing any
+// previous one) and starts a new file.
+type RotatingFile struct {
+	path    string
+	maxSize int64
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// OpenRotatingFile opens path for appending. maxSize <= 0 disables rotation.
+func OpenRotatingFile(path string, maxSize int64) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, size, err := openLog(r.path)
+	if err != nil {
+		return err
+	}
+	r.f, r.size = f, size
+	return nil
+}
+
+func openLog(path string) (*os.File, int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, 0, fmt.Errorf("open log file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("stat log file: %w", err)
+	}
+	return f, fi.Size(), nil
+}
+
+// Write appends p, rotating first if p would take the file past its limit.
+// A single write is never split across files. If rotating fails, p still
+// goes to the file open before and the rotation error is returned; the
+// next write tries again.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rotateErr error
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		rotateErr = r.rotate()
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate renames the file and opens a new one. On failure the current
+// handle is kept, so logging carries on into it.
+func (r *RotatingFile) rotate() error {
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return fmt.Errorf("rotate log file: %w", err)
+	}
+	f, size, err := openLog(r.path)
+	if err != nil {
+		return err
+	}
+	if err := r.f.Close(); err != nil {
+		f.Close()
+		return fmt.Errorf("close log file: %w", err)
+	}
+	r.f, r.size = f, size
+	return nil
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
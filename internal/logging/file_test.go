@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile_RotatesPastMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vicostream.log")
+
+	r, err := OpenRotatingFile(path, 32)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer r.Close()
+
+	first := strings.Repeat("a", 20) + "\n"
+	second := strings.Repeat("b", 20) + "\n"
+	for _, line := range []string{first, second} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	rotated, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatalf("read rotated file: %v", err)
+	}
+	if string(rotated) != first {
+		t.Errorf("rotated file: expected %q, got %q", first, rotated)
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read current file: %v", err)
+	}
+	if string(current) != second {
+		t.Errorf("current file: expected %q, got %q", second, current)
+	}
+}
+
+func TestRotatingFile_KeepsWritingWhenRotateFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vicostream.log")
+	// A non-empty directory in the way makes the rename fail.
+	if err := os.MkdirAll(filepath.Join(path+".1", "busy"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenRotatingFile(path, 32)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer r.Close()
+
+	first := strings.Repeat("a", 20) + "\n"
+	second := strings.Repeat("b", 20) + "\n"
+	if _, err := r.Write([]byte(first)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	n, err := r.Write([]byte(second))
+	if err == nil {
+		t.Error("expected the rotation error")
+	}
+	if n != len(second) {
+		t.Errorf("expected the line written anyway, got %d of %d bytes", n, len(second))
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read current file: %v", err)
+	}
+	if string(current) != first+second {
+		t.Errorf("current file: expected %q, got %q", first+second, current)
+	}
+}
@@ -0,0 +1,150 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"vico_home/native/internal/clock"
+)
+
+// fifoAttachInterval is how often a FIFO without a reader checks for one.
+const fifoAttachInterval = 250 * time.Millisecond
+
+// FIFO writes video to a named pipe whose reader may come and go, such as
+// a separate process that consumes the stream and restarts.
+//
+// While no process has the pipe open for reading, writes are dropped:
+// they succeed without blocking and the bytes are counted in Dropped.
+// Once a reader opens the pipe, writes block like writes to any pipe, so a
+// slow reader slows the stream instead of losing video. When the reader
+// closes its end, FIFO drops writes again until another reader opens it.
+// A reader that attaches mid-stream starts with whatever NAL unit is
+// being written; decoders resynchronize at the next start code and
+// picture at the next keyframe. Video from before the reader attached is
+// not buffered for it: it could only start decoding at a keyframe anyway,
+// and a backlog would put the reader behind live.
+//
+// Named pipes are only supported on Unix; elsewhere OpenFIFO fails.
+type FIFO struct {
+	path  string
+	clock clock.Clock
+
+	mu      sync.Mutex
+	f       *os.File
+	nextTry time.Time
+	dropped uint64
+}
+
+// OpenFIFO returns a FIFO writing to path, creating the named pipe if it
+// does not exist. It fails if path exists and is not a named pipe. It does
+// not wait for a reader.
+func OpenFIFO(path string) (*FIFO, error) {
+	return openFIFO(path, clock.Real)
+}
+
+func openFIFO(path string, clk clock.Clock) (*FIFO, error) {
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := mkfifo(path); err != nil {
+			return nil, fmt.Errorf("create FIFO: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("output FIFO: %w", err)
+	} else if fi.Mode()&os.ModeNamedPipe == 0 {
+		return nil, fmt.Errorf("output FIFO: %s exists and is not a named pipe", path)
+	}
+	p := &FIFO{path: path, clock: clk}
+	p.mu.Lock()
+	if !p.attach() {
+		log.Printf("[output] no reader on %s yet, dropping video until one opens it", path)
+	}
+	p.mu.Unlock()
+	return p, nil
+}
+
+// Write writes b to the reader, or drops it if there is none.
+func (p *FIFO) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.f == nil && !p.attach() {
+		p.dropped += uint64(len(b))
+		return len(b), nil
+	}
+	n, err := p.f.Write(b)
+	if errors.Is(err, syscall.EPIPE) {
+		log.Printf("[output] reader closed %s, dropping video until one reopens it", p.path)
+		p.f.Close()
+		p.f = nil
+		p.dropped += uint64(len(b) - n)
+		return len(b), nil
+	}
+	return n, err
+}
+
+// attach opens the pipe if a reader has it open, checking at most once
+// per fifoAttachInterval. Opening a FIFO for writing without O_NONBLOCK
+// would wait for a reader; with it, the open fails with ENXIO instead.
+func (p *FIFO) attach() bool {
+	now := p.clock.Now()
+	if now.Before(p.nextTry) {
+		return false
+	}
+	f, err := os.OpenFile(p.path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		p.nextTry = now.Add(fifoAttachInterval)
+		if !errors.Is(err, syscall.ENXIO) {
+			log.Printf("[output] warning: open %s: %v", p.path, err)
+		}
+		return false
+	}
+	log.Printf("[output] reader attached to %s", p.path)
+	p.f = f
+	return true
+}
+
+// Attached reports whether a reader has the pipe open, checking for one
+// if none was. A reader that left is noticed at the next write.
+func (p *FIFO) Attached() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.f != nil || p.attach()
+}
+
+// WaitReader waits until a reader has the pipe open or ctx ends, and
+// returns ctx's error in that case.
+func (p *FIFO) WaitReader(ctx context.Context) error {
+	for !p.Attached() {
+		select {
+		case <-p.clock.After(fifoAttachInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Dropped returns the number of bytes dropped while no reader was
+// attached.
+func (p *FIFO) Dropped() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
+
+// Close closes the pipe. The named pipe itself is left in place.
+func (p *FIFO) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.f == nil {
+		return nil
+	}
+	err := p.f.Close()
+	p.f = nil
+	return err
+}
@@ -0,0 +1,121 @@
+//go:build unix
+
+package output
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+)
+
+func TestFIFO_ToleratesReaderComingAndGoing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.fifo")
+	clk := clock.NewFake(time.Now())
+	p, err := openFIFO(path, clk)
+	if err != nil {
+		t.Fatalf("open FIFO: %v", err)
+	}
+	defer p.Close()
+
+	if n, err := p.Write([]byte("a")); n != 1 || err != nil {
+		t.Fatalf("expected a write without a reader to succeed, got %d, %v", n, err)
+	}
+	if got := p.Dropped(); got != 1 {
+		t.Errorf("expected 1 byte dropped without a reader, got %d", got)
+	}
+
+	r, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatalf("open reader: %v", err)
+	}
+	clk.Advance(fifoAttachInterval)
+	if _, err := p.Write([]byte("bc")); err != nil {
+		t.Fatalf("write with a reader: %v", err)
+	}
+	buf := make([]byte, 8)
+	if n, _ := r.Read(buf); string(buf[:n]) != "bc" {
+		t.Errorf("expected the reader to get %q, got %q", "bc", buf[:n])
+	}
+
+	r.Close()
+	if n, err := p.Write([]byte("d")); n != 1 || err != nil {
+		t.Fatalf("expected a write after the reader left to succeed, got %d, %v", n, err)
+	}
+	if got := p.Dropped(); got != 2 {
+		t.Errorf("expected 2 bytes dropped, got %d", got)
+	}
+
+	// Without a reader, the pipe is checked again only after an interval.
+	p.Write([]byte("e"))
+	r, err = os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatalf("reopen reader: %v", err)
+	}
+	defer r.Close()
+	p.Write([]byte("f"))
+	clk.Advance(fifoAttachInterval)
+	p.Write([]byte("g"))
+	if n, _ := r.Read(buf); string(buf[:n]) != "g" {
+		t.Errorf("expected the new reader to get %q, got %q", "g", buf[:n])
+	}
+	if got := p.Dropped(); got != 4 {
+		t.Errorf("expected 4 bytes dropped, got %d", got)
+	}
+}
+
+func TestOpenFIFO_RefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.h264")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFIFO(path); err == nil {
+		t.Error("expected an error for a regular file")
+	}
+}
+
+var _ io.WriteCloser = (*FIFO)(nil)
+
+func TestFIFO_WaitReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "video.fifo")
+	clk := clock.NewFake(time.Now())
+	p, err := openFIFO(path, clk)
+	if err != nil {
+		t.Fatalf("open FIFO: %v", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.WaitReader(ctx) }()
+	clk.BlockUntil(1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled without a reader, got %v", err)
+	}
+
+	go func() { done <- p.WaitReader(context.Background()) }()
+	clk.BlockUntil(1)
+	r, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatalf("open reader: %v", err)
+	}
+	defer r.Close()
+	clk.Advance(fifoAttachInterval)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected the reader to end the wait, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the wait to end once a reader opened the pipe")
+	}
+	if !p.Attached() {
+		t.Error("expected the FIFO to be attached")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package output
+
+import (
+	"errors"
+	"runtime"
+)
+
+// mkfifo fails: named pipes on this platform are not files FIFO can
+// create or open.
+func mkfifo(string) error {
+	return errors.New("named pipes are not supported on " + runtime.GOOS)
+}
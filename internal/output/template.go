@@ -0,0 +1,83 @@
+// Package output names the files video is written to and writes to named
+// pipes whose reader may come and go.
+package output
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Placeholders a template may contain.
+const (
+	PlaceholderSerial = "{serial}" // camera serial number
+	PlaceholderDate   = "{date}"   // start date, 2006-01-02
+	PlaceholderTime   = "{time}"   // start time, 150405
+	PlaceholderIndex  = "{index}"  // session or segment number, from 1, zero-padded to 3 digits
+)
+
+var placeholders = []string{PlaceholderSerial, PlaceholderDate, PlaceholderTime, PlaceholderIndex}
+
+// Fields are the values substituted into a template.
+type Fields struct {
+	Serial string
+	Time   time.Time
+	Index  int
+}
+
+// Template is a validated output path template, such as
+// "recordings/{serial}/{date}_{time}.h264".
+type Template struct {
+	raw string
+}
+
+// ParseTemplate validates s. Every {...} in it must be a known
+// placeholder.
+func ParseTemplate(s string) (*Template, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty output template")
+	}
+	rest := s
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("output template %q: unterminated %q", s, rest[open:])
+		}
+		name := rest[open : open+end+1]
+		if !isPlaceholder(name) {
+			return nil, fmt.Errorf("output template %q: unknown placeholder %s (want one of %s)", s, name, strings.Join(placeholders, ", "))
+		}
+		rest = rest[open+end+1:]
+	}
+	return &Template{raw: s}, nil
+}
+
+func isPlaceholder(name string) bool {
+	for _, p := range placeholders {
+		if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Expand returns the path for f. Path separators in the serial number are
+// replaced so it cannot escape the template's directory.
+func (t *Template) Expand(f Fields) string {
+	serial := strings.NewReplacer("/", "_", `\`, "_").Replace(f.Serial)
+	return strings.NewReplacer(
+		PlaceholderSerial, serial,
+		PlaceholderDate, f.Time.Format("2006-01-02"),
+		PlaceholderTime, f.Time.Format("150405"),
+		PlaceholderIndex, fmt.Sprintf("%03d", f.Index),
+	).Replace(t.raw)
+}
+
+// String returns the template as given.
+func (t *Template) String() string {
+	return t.raw
+}
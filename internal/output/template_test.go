@@ -0,0 +1,50 @@
+package output
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemplate_Expand(t *testing.T) {
+	f := Fields{
+		Serial: "abc123",
+		Time:   time.Date(2024, 3, 9, 7, 5, 4, 0, time.UTC),
+		Index:  7,
+	}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"out.h264", "out.h264"},
+		{"{serial}.h264", "abc123.h264"},
+		{"rec/{serial}/{date}_{time}-{index}.h264", "rec/abc123/2024-03-09_070504-007.h264"},
+		{"{index}{index}", "007007"},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParseTemplate(tt.tmpl)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.tmpl, err)
+		}
+		if got := tmpl.Expand(f); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.tmpl, tt.want, got)
+		}
+	}
+}
+
+func TestTemplate_SerialCannotEscape(t *testing.T) {
+	tmpl, err := ParseTemplate("rec/{serial}.h264")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := tmpl.Expand(Fields{Serial: "../etc"}), "rec/.._etc.h264"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestParseTemplate_Rejects(t *testing.T) {
+	for _, in := range []string{"", "{camera}.h264", "{serial", "{date}{Serial}"} {
+		if _, err := ParseTemplate(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
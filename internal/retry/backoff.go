@@ -0,0 +1,50 @@
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes retry delays with the "full jitter" algorithm: the n-th
+// delay is uniformly random between zero and min(max, base*2^n). Spreading
+// retries over the whole interval keeps many clients that failed at the
+// same moment from retrying in lockstep.
+type Backoff struct {
+	base    time.Duration
+	max     time.Duration
+	attempt int
+}
+
+// NewBackoff returns a Backoff whose ceiling starts at base and doubles on
+// each attempt up to max.
+func NewBackoff(base, max time.Duration) *Backoff {
+	if max < base {
+		max = base
+	}
+	return &Backoff{base: base, max: max}
+}
+
+// Next returns the delay before the next attempt.
+func (b *Backoff) Next() time.Duration {
+	ceiling := b.max
+	if b.attempt < 62 {
+		if c := b.base << b.attempt; c > 0 && c < b.max {
+			ceiling = c
+		}
+	}
+	b.attempt++
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Attempt returns how many delays have been handed out since the last Reset.
+func (b *Backoff) Attempt() int {
+	return b.attempt
+}
+
+// Reset starts the sequence over, for use after a success.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,53 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff_StaysWithinCeiling(t *testing.T) {
+	b := NewBackoff(100*time.Millisecond, time.Second)
+
+	ceilings := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, ceiling := range ceilings {
+		if d := b.Next(); d < 0 || d > ceiling {
+			t.Errorf("attempt %d: delay %s outside [0, %s]", i, d, ceiling)
+		}
+	}
+	if b.Attempt() != len(ceilings) {
+		t.Errorf("expected %d attempts, got %d", len(ceilings), b.Attempt())
+	}
+
+	b.Reset()
+	if d := b.Next(); d > 100*time.Millisecond {
+		t.Errorf("after reset: delay %s exceeds base", d)
+	}
+}
+
+func TestBackoff_IsJittered(t *testing.T) {
+	b := NewBackoff(time.Second, time.Second)
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		seen[b.Next()] = true
+	}
+	if len(seen) < 2 {
+		t.Error("expected delays to vary")
+	}
+}
+
+func TestBackoff_LargeAttemptDoesNotOverflow(t *testing.T) {
+	b := NewBackoff(time.Second, time.Minute)
+	for i := 0; i < 100; i++ {
+		if d := b.Next(); d < 0 || d > time.Minute {
+			t.Fatalf("attempt %d: delay %s outside [0, 1m]", i, d)
+		}
+	}
+}
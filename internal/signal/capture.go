@@ -0,0 +1,169 @@
+package signal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Capture directions.
+const (
+	DirSent     = "sent"
+	DirReceived = "received"
+)
+
+// CaptureRecord is one signaling frame in a capture file, which holds one
+// JSON record per line.
+type CaptureRecord struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"direction"`
+	Frame     json.RawMessage `json:"frame"`
+	// Payload is the frame's messagePayload, base64-decoded, when it is
+	// JSON (SDP and ICE candidates).
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Recorder writes signaling frames to a capture file. It is safe for
+// concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	redact bool
+}
+
+// NewRecorder returns a Recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// NewRedactingRecorder returns a Recorder writing to w that replaces
+// credentials such as the signaling access token with RedactedValue, so
+// the file can be shared. Its captures cannot be replayed against a
+// server that checks the token.
+func NewRedactingRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w), redact: true}
+}
+
+// RedactedValue replaces credentials in a redacting Recorder's output.
+const RedactedValue = "[redacted]"
+
+// secretField matches a JSON string member holding a credential.
+var secretField = regexp.MustCompile(`"(accessToken|token|password|credential)"(\s*):(\s*)"(?:[^"\\]|\\.)*"`)
+
+// redactSecrets replaces the values of credential members in data.
+func redactSecrets(data []byte) []byte {
+	return secretField.ReplaceAll(data, []byte(`"$1"$2:$3"`+RedactedValue+`"`))
+}
+
+// Record appends a frame sent or received as data. Frames that are not
+// JSON are skipped.
+func (r *Recorder) Record(direction string, data []byte) {
+	if !json.Valid(data) {
+		return
+	}
+	if r.redact {
+		data = redactSecrets(data)
+	}
+	rec := CaptureRecord{Time: time.Now(), Direction: direction, Frame: data}
+
+	var env struct {
+		MessagePayload string `json:"messagePayload"`
+	}
+	if json.Unmarshal(data, &env) == nil && env.MessagePayload != "" {
+		if decoded, err := decodePayload(env.MessagePayload, false); err == nil && json.Valid(decoded) {
+			if r.redact {
+				decoded = redactSecrets(decoded)
+			}
+			rec.Payload = decoded
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(rec); err != nil {
+		log.Printf("[signal] capture write error: %v", err)
+	}
+}
+
+// ReadCapture parses a capture file.
+func ReadCapture(rd io.Reader) ([]CaptureRecord, error) {
+	var records []CaptureRecord
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var rec CaptureRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("capture line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read capture: %w", err)
+	}
+	return records, nil
+}
+
+// Replay dials the WebSocket at url and resends the sent frames of
+// records in order, keeping their original spacing. Frames from the
+// server are logged and, if rec is not nil, recorded. It returns once the
+// last frame is sent and linger has passed, or when ctx is done.
+func Replay(ctx context.Context, url string, records []CaptureRecord, rec *Recorder, linger time.Duration) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return fmt.Errorf("websocket dial: %w", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			log.Printf("[signal] <<< %s", string(data))
+			if rec != nil {
+				rec.Record(DirReceived, data)
+			}
+		}
+	}()
+
+	var last time.Time
+	for _, r := range records {
+		if r.Direction != DirSent {
+			continue
+		}
+		if !last.IsZero() {
+			select {
+			case <-time.After(r.Time.Sub(last)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		last = r.Time
+
+		log.Printf("[signal] >>> %s", string(r.Frame))
+		if err := conn.WriteMessage(websocket.TextMessage, r.Frame); err != nil {
+			return fmt.Errorf("websocket write: %w", err)
+		}
+		if rec != nil {
+			rec.Record(DirSent, r.Frame)
+		}
+	}
+
+	select {
+	case <-time.After(linger):
+	case <-ctx.Done():
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package signal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/domain"
+	"vico_home/native/internal/logging"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRecorder_RoundTripsWithDecodedPayload(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+
+	payload := base64.StdEncoding.EncodeToString([]byte(`{"type":"offer","sdp":"v=0"}`))
+	r.Record(DirSent, []byte(`{"method":"TRANSMIT","messageType":"SDP_OFFER","messagePayload":"`+payload+`"}`))
+	r.Record(DirReceived, []byte(`{"method":"AUTH_RESPONSE","code":0}`))
+	r.Record(DirReceived, []byte("not json"))
+
+	records, err := ReadCapture(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records (non-JSON skipped), got %d", len(records))
+	}
+	if records[0].Direction != DirSent || string(records[0].Payload) != `{"type":"offer","sdp":"v=0"}` {
+		t.Errorf("unexpected first record: %+v", records[0])
+	}
+	if records[1].Direction != DirReceived || records[1].Payload != nil {
+		t.Errorf("unexpected second record: %+v", records[1])
+	}
+}
+
+func TestReplay_ResendsSentFramesInOrder(t *testing.T) {
+	got := make(chan []byte, 10)
+	srv := newFakeSignalServer(t, websocket.Upgrader{}, func(conn *websocket.Conn, _ *http.Request) {
+		readFrames(conn, got)
+	})
+
+	start := time.Now()
+	records := []CaptureRecord{
+		{Time: start, Direction: DirSent, Frame: []byte(`{"method":"AUTH"}`)},
+		{Time: start.Add(time.Millisecond), Direction: DirReceived, Frame: []byte(`{"method":"AUTH_RESPONSE"}`)},
+		{Time: start.Add(2 * time.Millisecond), Direction: DirSent, Frame: []byte(`{"method":"JOIN_LIVE"}`)},
+	}
+
+	if err := Replay(context.Background(), srv.wsURL(), records, nil, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{`{"method":"AUTH"}`, `{"method":"JOIN_LIVE"}`} {
+		select {
+		case frame := <-got:
+			if string(frame) != want {
+				t.Errorf("expected %s, got %s", want, frame)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+}
+
+func TestRedactingRecorder_RedactsAccessToken(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRedactingRecorder(&buf)
+	r.Record(DirSent, []byte(`{"method":"AUTH","accessToken":"eyJhbGciOi.secret\"part","clientType":"viewer"}`))
+
+	out := buf.String()
+	if strings.Contains(out, "secret") {
+		t.Errorf("expected access token redacted, got %s", out)
+	}
+	records, err := ReadCapture(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `{"method":"AUTH","accessToken":"[redacted]","clientType":"viewer"}`; string(records[0].Frame) != want {
+		t.Errorf("expected %s, got %s", want, records[0].Frame)
+	}
+}
+
+func TestClient_DebugLogRedactsAccessToken(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		logging.SetDebug(nil)
+	}()
+	logging.SetDebug([]string{logging.Signal})
+
+	c := NewClient(&domain.Ticket{}, "serial", &recordingHandler{})
+	c.handleFrame([]byte(`{"method":"AUTH_RESPONSE","code":0,"accessToken":"eyJhbGciOi.secret"}`))
+
+	if out := buf.String(); strings.Contains(out, "secret") || !strings.Contains(out, RedactedValue) {
+		t.Errorf("expected the access token redacted in the debug log, got %s", out)
+	}
+}
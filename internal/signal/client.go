@@ -3,13 +3,20 @@ package signal
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"net/url"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"vico_home/native/internal/clock"
 	"vico_home/native/internal/domain"
+	"vico_home/native/internal/logging"
 
 	"github.com/gorilla/websocket"
 )
@@ -39,6 +46,18 @@ type message struct {
 	Version            string `json:"version,omitempty"`
 	Timestamp          int64  `json:"timestamp,omitempty"`
 	Reason             int    `json:"reason,omitempty"`
+	SignalServer       string `json:"signalServer,omitempty"`
+	RetryAfter         int    `json:"retryAfter,omitempty"`
+}
+
+// directives maps the server-initiated methods the client recognizes to
+// what they ask for: ErrRedirected to reconnect, possibly elsewhere, and
+// ErrServerBusy to back off first.
+var directives = map[string]error{
+	"RECONNECT":  ErrRedirected,
+	"REDIRECT":   ErrRedirected,
+	"BUSY":       ErrServerBusy,
+	"RATE_LIMIT": ErrServerBusy,
 }
 
 // Client manages the WebSocket connection to the signaling server.
@@ -47,21 +66,45 @@ type Client struct {
 	ticket    *domain.Ticket
 	serial    string
 	sessionID string
+	platform  string
 	handler   domain.Handler
+	recorders []*Recorder
+	onJoined  func(code int, msg string)
+	proxy     func(*http.Request) (*url.URL, error)
+	clock     clock.Clock
+	compress  bool
+	strict    bool
+
+	timeouts    domain.Timeouts
+	earlyPeerIn EarlyPeerIn
+
+	// joined and peerInHeld follow the AUTH, JOIN_LIVE, PEER_IN order
+	// for earlyPeerIn. Only the read loop touches them.
+	joined     bool
+	peerInHeld bool
+
+	messageBytes atomic.Int64
+	wireBytes    atomic.Int64
+	decodeErrs   decodeCounters
 
 	mu     sync.Mutex
 	closed chan struct{}
 }
 
+// DefaultPlatform starts the session ID, as in the Android app's.
+const DefaultPlatform = "Android"
+
 // NewClient creates a new signaling client.
 func NewClient(ticket *domain.Ticket, serialNumber string, handler domain.Handler) *Client {
-	sessionID := fmt.Sprintf("Android-%s-%d", ticket.ID, time.Now().UnixMilli())
 	return &Client{
 		ticket:    ticket,
 		serial:    serialNumber,
-		sessionID: sessionID,
+		platform:  DefaultPlatform,
 		handler:   handler,
+		clock:     clock.Real,
 		closed:    make(chan struct{}),
+
+		timeouts: domain.DefaultTimeouts(),
 	}
 }
 
@@ -73,13 +116,35 @@ func (c *Client) Connect() error {
 	}
 	u.Path = c.ticket.WebsocketPath
 
-	log.Printf("[signal] connecting to %s", u.String())
+	if c.sessionID == "" {
+		c.sessionID = fmt.Sprintf("%s-%s-%d", c.platform, c.ticket.ID, c.clock.Now().UnixMilli())
+	}
+	log.Printf("[signal] connecting to %s (session %s)", u.String(), c.sessionID)
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	dialer := *websocket.DefaultDialer
+	if c.proxy != nil {
+		dialer.Proxy = c.proxy
+	}
+	dialer.NetDialContext = countingDial(&c.wireBytes)
+	dialer.EnableCompression = c.compress
+	dialer.HandshakeTimeout = c.timeouts.Handshake
+	conn, resp, err := dialer.Dial(u.String(), nil)
 	if err != nil {
 		return fmt.Errorf("websocket dial: %w", err)
 	}
 	c.conn = conn
+	conn.SetPingHandler(c.handlePing)
+	conn.SetPongHandler(func(string) error {
+		c.extendReadDeadline()
+		return nil
+	})
+	if c.compress {
+		if strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate") {
+			log.Printf("[signal] permessage-deflate compression negotiated")
+		} else {
+			log.Printf("[signal] server declined compression")
+		}
+	}
 
 	c.sendAuth()
 
@@ -89,6 +154,77 @@ func (c *Client) Connect() error {
 	return nil
 }
 
+// AddRecorder captures every frame sent and received to r, in addition
+// to any recorders added before. Call it before Connect.
+func (c *Client) AddRecorder(r *Recorder) {
+	c.recorders = append(c.recorders, r)
+}
+
+// SetProxy sets the proxy chooser for the WebSocket connection, as
+// websocket.Dialer.Proxy. By default HTTPS_PROXY and friends from the
+// environment apply. Call it before Connect.
+func (c *Client) SetProxy(fn func(*http.Request) (*url.URL, error)) {
+	c.proxy = fn
+}
+
+// SetCompression asks the server for permessage-deflate, which shrinks
+// the base64 SDP frames considerably. A server that does not support it
+// simply declines. Call it before Connect.
+func (c *Client) SetCompression(on bool) {
+	c.compress = on
+}
+
+// SetStrictBase64 makes payload decoding accept only padded standard
+// base64. By default unpadded and URL-safe payloads are accepted too.
+// Call it before Connect.
+func (c *Client) SetStrictBase64(on bool) {
+	c.strict = on
+}
+
+// Traffic returns the signaling bytes exchanged so far.
+func (c *Client) Traffic() Traffic {
+	return Traffic{Messages: c.messageBytes.Load(), Wire: c.wireBytes.Load()}
+}
+
+// SetSessionID replaces the generated session ID, which is
+// "<platform>-<ticket ID>-<Unix milliseconds>", with id. Call it before
+// Connect.
+func (c *Client) SetSessionID(id string) {
+	c.sessionID = id
+}
+
+// SetPlatform sets the platform the generated session ID starts with,
+// DefaultPlatform by default. Call it before Connect.
+func (c *Client) SetPlatform(platform string) {
+	c.platform = platform
+}
+
+// SetTimeouts replaces domain.DefaultTimeouts. The client uses
+// Handshake, Write, Ping and Read; zero leaves that operation unbounded.
+// Call it before Connect.
+func (c *Client) SetTimeouts(t domain.Timeouts) {
+	c.timeouts = t
+}
+
+// SetClock replaces the clock driving the keepalive pings, for tests.
+// Call it before Connect.
+func (c *Client) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// SetOnJoined registers a callback for the server's answer to the join
+// request. A code of 0 means success. Call it before Connect.
+func (c *Client) SetOnJoined(fn func(code int, msg string)) {
+	c.onJoined = fn
+}
+
+// SetEarlyPeerIn selects the handling of a PEER_IN that arrives before
+// JOIN_LIVE succeeds. The default is EarlyPeerInQueue. Call it before
+// Connect.
+func (c *Client) SetEarlyPeerIn(mode EarlyPeerIn) {
+	c.earlyPeerIn = mode
+}
+
 // Close shuts down the WebSocket connection.
 func (c *Client) Close() {
 	select {
@@ -111,9 +247,28 @@ func (c *Client) sendJSON(msg any) {
 		log.Printf("[signal] marshal error: %v", err)
 		return
 	}
-	log.Printf("[signal] >>> %s", string(data))
+	if logging.DebugEnabled(logging.Signal) {
+		logging.Debugf(logging.Signal, ">>> %s", redactSecrets(data))
+	}
+	c.messageBytes.Add(int64(len(data)))
+	for _, r := range c.recorders {
+		r.Record(DirSent, data)
+	}
+	if c.timeouts.Write > 0 {
+		c.conn.SetWriteDeadline(c.clock.Now().Add(c.timeouts.Write))
+	}
 	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		log.Printf("[signal] write error: %v", err)
+		select {
+		case <-c.closed:
+			// Close raced with the send; the error is expected.
+		default:
+			log.Printf("[signal] write error: %v", err)
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				// The connection cannot be written to again; closing it
+				// ends the read loop, which reports the loss.
+				c.conn.Close()
+			}
+		}
 	}
 }
 
@@ -159,6 +314,27 @@ func (c *Client) SendSDPOffer(sdp string) {
 	})
 }
 
+// SendSDPAnswer sends an SDP answer via TRANSMIT, in reply to a
+// camera-initiated offer.
+func (c *Client) SendSDPAnswer(sdp string) {
+	payload := domain.SDPPayload{Type: "answer", SDP: sdp}
+	payloadJSON, _ := json.Marshal(payload)
+	encoded := base64.StdEncoding.EncodeToString(payloadJSON)
+
+	c.sendJSON(message{
+		Method:            "TRANSMIT",
+		MessageType:       "SDP_ANSWER",
+		MessagePayload:    encoded,
+		Mode:              "vicoo",
+		RecipientClientID: c.serial,
+		SenderClientID:    c.ticket.ID,
+		SessionID:         c.sessionID,
+		ViewerType:        "a4x_sdk",
+		Resolution:        "1280x720",
+		Version:           "0.0.1",
+	})
+}
+
 // SendICECandidate sends a local ICE candidate via TRANSMIT.
 func (c *Client) SendICECandidate(sdpMid string, sdpMLineIndex int, candidate string) {
 	payload := domain.ICECandidatePayload{
@@ -190,6 +366,7 @@ func (c *Client) readLoop() {
 		default:
 		}
 
+		c.extendReadDeadline()
 		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			select {
@@ -197,20 +374,34 @@ func (c *Client) readLoop() {
 				return
 			default:
 				log.Printf("[signal] read error: %v", err)
+				c.handler.OnError(fmt.Errorf("%w: %w", ErrConnectionLost, err))
 				return
 			}
 		}
 
-		log.Printf("[signal] <<< %s", string(data))
+		c.handleFrame(data)
+	}
+}
 
-		var msg message
-		if err := json.Unmarshal(data, &msg); err != nil {
-			log.Printf("[signal] unmarshal error: %v", err)
-			continue
-		}
+// handleFrame records, decodes and dispatches one frame read from the
+// WebSocket.
+func (c *Client) handleFrame(data []byte) {
+	if logging.DebugEnabled(logging.Signal) {
+		logging.Debugf(logging.Signal, "<<< %s", redactSecrets(data))
+	}
+	c.messageBytes.Add(int64(len(data)))
+	for _, r := range c.recorders {
+		r.Record(DirReceived, data)
+	}
 
-		c.dispatch(msg)
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Printf("[signal] unmarshal error: %v", err)
+		c.decodeErrs.frames.Add(1)
+		return
 	}
+
+	c.dispatch(msg)
 }
 
 func (c *Client) dispatch(msg message) {
@@ -225,44 +416,115 @@ func (c *Client) dispatch(msg message) {
 				code = *msg.Code
 			}
 			log.Printf("[signal] auth failed: code=%d msg=%s", code, msg.Message)
+			c.handler.OnError(&ResponseError{
+				Method:  msg.Method,
+				Code:    code,
+				Message: msg.Message,
+				Kind:    ErrAuthFailed,
+			})
 		}
 
 	case "JOIN_LIVE_RESPONSE":
-		log.Printf("[signal] join_live response: code=%v msg=%s", msg.Code, msg.Message)
+		code := -1
+		if msg.Code != nil {
+			code = *msg.Code
+		}
+		log.Printf("[signal] join_live response: code=%d msg=%s", code, msg.Message)
+		c.joined = code == 0
+		if c.onJoined != nil {
+			c.onJoined(code, msg.Message)
+		}
+		if c.peerInHeld {
+			c.peerInHeld = false
+			if c.joined {
+				log.Printf("[signal] delivering the peer in held until join_live succeeded")
+				c.handler.OnPeerIn()
+			}
+		}
+		if code != 0 && isViewerLimit(msg.Message) {
+			log.Printf("[signal] reading join rejection code=%d msg=%q as the viewer limit", code, msg.Message)
+			if limit := c.ticket.MaxAllocationLimit; limit > 0 {
+				log.Printf("[signal] join rejected: camera %s already has %d viewers, its limit; try again later", c.serial, limit)
+			} else {
+				log.Printf("[signal] join rejected: camera %s is at its viewer limit; try again later", c.serial)
+			}
+			c.handler.OnError(&ResponseError{
+				Method:  msg.Method,
+				Code:    code,
+				Message: msg.Message,
+				Kind:    ErrViewerLimit,
+			})
+		} else if code != 0 {
+			var kind error
+			if joinRejectedCodes[code] {
+				log.Printf("[signal] join rejected: check that camera %s belongs to the account's group %s", c.serial, c.ticket.GroupID)
+				kind = ErrJoinRejected
+			}
+			c.handler.OnError(&ResponseError{
+				Method:  msg.Method,
+				Code:    code,
+				Message: msg.Message,
+				Kind:    kind,
+			})
+		}
 
 	case "PEER_IN":
 		log.Printf("[signal] peer in: clientId=%s", msg.ClientID)
+		if msg.ClientID != "" && msg.ClientID != c.serial {
+			log.Printf("[signal] warning: peer %s is not the requested camera %s", msg.ClientID, c.serial)
+		}
+		if !c.joined {
+			switch c.earlyPeerIn {
+			case EarlyPeerInQueue:
+				log.Printf("[signal] warning: peer in before join_live succeeded; holding it until then")
+				c.peerInHeld = true
+				return
+			case EarlyPeerInDrop:
+				log.Printf("[signal] warning: peer in before join_live succeeded; dropping it")
+				return
+			}
+			log.Printf("[signal] warning: peer in before join_live succeeded")
+		}
 		c.handler.OnPeerIn()
 
 	case "PEER_OUT":
 		log.Printf("[signal] peer out: clientId=%s", msg.ClientID)
+		if c.peerInHeld {
+			log.Printf("[signal] discarding the held peer in")
+			c.peerInHeld = false
+		}
 		c.handler.OnPeerOut()
 
 	case "TRANSMIT":
 		switch msg.MessageType {
 		case "SDP_ANSWER":
-			decoded, err := base64.StdEncoding.DecodeString(msg.MessagePayload)
-			if err != nil {
-				log.Printf("[signal] decode SDP_ANSWER: %v", err)
-				return
-			}
 			var sdp domain.SDPPayload
-			if err := json.Unmarshal(decoded, &sdp); err != nil {
-				log.Printf("[signal] unmarshal SDP_ANSWER: %v", err)
+			if err := c.unmarshalPayload(msg.MessageType, msg.MessagePayload, &sdp); err != nil {
+				log.Printf("[signal] %v", err)
+				c.decodeErrs.answers.Add(1)
+				c.handler.OnError(err)
 				return
 			}
 			log.Printf("[signal] received SDP answer")
 			c.handler.OnSDPAnswer(sdp)
 
-		case "ICE_CANDIDATE":
-			decoded, err := base64.StdEncoding.DecodeString(msg.MessagePayload)
-			if err != nil {
-				log.Printf("[signal] decode ICE_CANDIDATE: %v", err)
+		case "SDP_OFFER":
+			var sdp domain.SDPPayload
+			if err := c.unmarshalPayload(msg.MessageType, msg.MessagePayload, &sdp); err != nil {
+				log.Printf("[signal] %v", err)
+				c.decodeErrs.offers.Add(1)
+				c.handler.OnError(err)
 				return
 			}
+			log.Printf("[signal] received SDP offer")
+			c.handler.OnSDPOffer(sdp)
+
+		case "ICE_CANDIDATE":
+			// One bad candidate is not fatal; the others may still connect.
 			var candidate domain.ICECandidatePayload
-			if err := json.Unmarshal(decoded, &candidate); err != nil {
-				log.Printf("[signal] unmarshal ICE_CANDIDATE: %v", err)
+			if err := c.unmarshalPayload(msg.MessageType, msg.MessagePayload, &candidate); err != nil {
+				log.Printf("[signal] dropping candidate: %v", err)
+				c.decodeErrs.candidates.Add(1)
 				return
 			}
 			log.Printf("[signal] received remote ICE candidate")
@@ -273,24 +535,143 @@ func (c *Client) dispatch(msg message) {
 		// no-op
 
 	default:
+		if kind, ok := directives[msg.Method]; ok {
+			c.handleDirective(msg, kind)
+			return
+		}
 		log.Printf("[signal] unhandled method: %s", msg.Method)
 	}
 }
 
+// viewerLimitPhrases are what servers put in a JOIN_LIVE_RESPONSE message
+// when the camera has no viewer slot left. The code that goes with them
+// is not documented and differs between servers, so only the message is
+// matched, and only on whole phrases: single words such as "limit" or
+// "max" also turn up in rejections for other reasons.
+var viewerLimitPhrases = []string{
+	"max allocation",
+	"allocation limit",
+	"viewer limit",
+	"too many viewers",
+	"too many clients",
+	"no free slot",
+}
+
+// isViewerLimit reports whether a join rejection's message says the camera
+// is at its viewer limit.
+func isViewerLimit(message string) bool {
+	message = strings.ToLower(message)
+	for _, p := range viewerLimitPhrases {
+		if strings.Contains(message, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleDirective reports a server directive to the handler, which ends
+// the session so that the reconnect loop can honor it. A redirect the
+// ticket's server may not make, see redirectAllowed, reconnects to the
+// same server.
+func (c *Client) handleDirective(msg message, kind error) {
+	e := &DirectiveError{
+		Method:     msg.Method,
+		RetryAfter: time.Duration(max(msg.RetryAfter, 0)) * time.Second,
+		Message:    msg.Message,
+		Kind:       kind,
+	}
+	if kind == ErrRedirected && msg.SignalServer != "" {
+		if err := redirectAllowed(c.ticket.SignalServer, msg.SignalServer); err != nil {
+			log.Printf("[signal] warning: ignoring %s to %q: %v", msg.Method, msg.SignalServer, err)
+		} else {
+			e.Server = msg.SignalServer
+		}
+	}
+	log.Printf("[signal] server directive: %v", e)
+	c.handler.OnError(e)
+}
+
+// redirectAllowed reports why a server at from may not redirect the client
+// to target, or nil if it may. The target must be a WebSocket URL, may not
+// downgrade wss to ws, and must be in the signaling domain of from: its
+// host or a sibling under the same parent domain, or the same address if
+// from is an IP address. Otherwise a single unchecked message could move
+// the session's credentials to any host.
+func redirectAllowed(from, target string) error {
+	t, err := url.Parse(target)
+	if err != nil || (t.Scheme != "ws" && t.Scheme != "wss") || t.Hostname() == "" {
+		return errors.New("not a ws:// or wss:// URL")
+	}
+	f, err := url.Parse(from)
+	if err != nil || f.Hostname() == "" {
+		return fmt.Errorf("the current signal server %q is not a URL", from)
+	}
+	if f.Scheme == "wss" && t.Scheme != "wss" {
+		return errors.New("it would downgrade wss to ws")
+	}
+	host, fromHost := strings.ToLower(t.Hostname()), strings.ToLower(f.Hostname())
+	if host == fromHost {
+		return nil
+	}
+	if net.ParseIP(fromHost) == nil {
+		if dot := strings.Index(fromHost, "."); dot >= 0 && strings.Count(fromHost, ".") >= 2 {
+			if parent := fromHost[dot:]; strings.HasSuffix(host, parent) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s is outside the signaling domain of %s", host, fromHost)
+}
+
+// extendReadDeadline pushes the read deadline Timeouts.Read out from now.
+func (c *Client) extendReadDeadline() {
+	if c.timeouts.Read > 0 {
+		_ = c.conn.SetReadDeadline(c.clock.Now().Add(c.timeouts.Read))
+	}
+}
+
+// controlDeadline bounds writing one ping or pong by Timeouts.Ping.
+func (c *Client) controlDeadline() time.Time {
+	if c.timeouts.Ping > 0 {
+		return c.clock.Now().Add(c.timeouts.Ping)
+	}
+	return time.Time{}
+}
+
+// handlePing answers a ping from the server, for servers that ping rather
+// than expect pings, and counts it as traffic for the read deadline. It
+// runs on the read loop, replacing the WebSocket library's default
+// handler, which answers but leaves the deadline alone.
+//
+// Our own pings keep to the ticket's interval either way: answering the
+// server does not reset pingLoop, and the server's pongs to our pings
+// extend the deadline too, so Timeouts.Read need only exceed the gap
+// between whichever side pings more often.
+func (c *Client) handlePing(data string) error {
+	c.extendReadDeadline()
+	c.mu.Lock()
+	err := c.conn.WriteControl(websocket.PongMessage, []byte(data), c.controlDeadline())
+	c.mu.Unlock()
+	if errors.Is(err, websocket.ErrCloseSent) {
+		return nil
+	}
+	return err
+}
+
 func (c *Client) pingLoop() {
-	ticker := time.NewTicker(time.Duration(c.ticket.SignalPingInterval) * time.Second)
+	ticker := c.clock.NewTicker(time.Duration(c.ticket.SignalPingInterval) * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-c.closed:
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			c.mu.Lock()
 			err := c.conn.WriteControl(
 				websocket.PingMessage,
 				[]byte{},
-				time.Now().Add(5*time.Second),
+				c.controlDeadline(),
 			)
 			c.mu.Unlock()
 			if err != nil {
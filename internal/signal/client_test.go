@@ -0,0 +1,282 @@
+package signal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+	"vico_home/native/internal/domain"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestClient_PingsEachInterval(t *testing.T) {
+	pings := make(chan struct{}, 10)
+	srv := newFakeSignalServer(t, websocket.Upgrader{}, func(conn *websocket.Conn, _ *http.Request) {
+		conn.SetPingHandler(func(string) error {
+			pings <- struct{}{}
+			return nil
+		})
+		readFrames(conn, nil)
+	})
+
+	clk := clock.NewFake(time.Now())
+	c := NewClient(srv.ticket(), "serial", nopHandler{})
+	c.SetClock(clk)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+
+	clk.BlockUntil(1)
+	for i := 0; i < 2; i++ {
+		clk.Advance(30 * time.Second)
+		select {
+		case <-pings:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected ping %d after advancing the clock", i+1)
+		}
+	}
+	select {
+	case <-pings:
+		t.Error("expected exactly one ping per interval")
+	default:
+	}
+}
+
+func TestClient_AnswersServerPings(t *testing.T) {
+	pongs := make(chan string, 10)
+	srv := newFakeSignalServer(t, websocket.Upgrader{}, func(conn *websocket.Conn, _ *http.Request) {
+		conn.SetPongHandler(func(data string) error {
+			pongs <- data
+			return nil
+		})
+		if err := conn.WriteControl(websocket.PingMessage, []byte("keepalive"), time.Now().Add(time.Second)); err != nil {
+			return
+		}
+		readFrames(conn, nil)
+	})
+
+	c := NewClient(srv.ticket(), "serial", nopHandler{})
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+
+	select {
+	case data := <-pongs:
+		if data != "keepalive" {
+			t.Errorf("expected the pong to echo %q, got %q", "keepalive", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a pong to the server's ping")
+	}
+}
+
+// TestClient_ServerPingsExtendReadDeadline has the server ping until the
+// client has answered pings for twice its read timeout, which it can only
+// do if each ping extended the deadline, then go quiet so it expires.
+func TestClient_ServerPingsExtendReadDeadline(t *testing.T) {
+	const readTimeout = 200 * time.Millisecond
+	pinged := make(chan struct{})
+	srv := newFakeSignalServer(t, websocket.Upgrader{}, func(conn *websocket.Conn, r *http.Request) {
+		pongs := make(chan struct{}, 1)
+		conn.SetPongHandler(func(string) error {
+			pongs <- struct{}{}
+			return nil
+		})
+		go readFrames(conn, nil)
+		ticker := time.NewTicker(readTimeout / 4)
+		defer ticker.Stop()
+		for i := 0; i < 8; i++ {
+			<-ticker.C
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); err != nil {
+				return
+			}
+			select {
+			case <-pongs:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		close(pinged)
+		<-r.Context().Done()
+	})
+
+	ticket := srv.ticket()
+	ticket.SignalPingInterval = 3600
+	h := errorHandler{errs: make(chan error, 1)}
+	c := NewClient(ticket, "serial", h)
+	c.SetTimeouts(domain.Timeouts{Read: readTimeout})
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+
+	select {
+	case <-pinged:
+	case err := <-h.errs:
+		t.Fatalf("expected the server's pings to keep the connection, got %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the client to answer the server's pings")
+	}
+	select {
+	case err := <-h.errs:
+		if !errors.Is(err, ErrConnectionLost) {
+			t.Errorf("expected ErrConnectionLost, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the read deadline to drop the connection once the pings stopped")
+	}
+}
+
+func TestClient_CompressionShrinksWireTraffic(t *testing.T) {
+	tests := []struct {
+		compress    bool
+		wantSmaller bool
+	}{
+		{false, false},
+		{true, true},
+	}
+	for _, tt := range tests {
+		received := make(chan []byte, 10)
+		srv := newFakeSignalServer(t, websocket.Upgrader{EnableCompression: true}, func(conn *websocket.Conn, _ *http.Request) {
+			readFrames(conn, received)
+		})
+
+		c := NewClient(srv.ticket(), "serial", nopHandler{})
+		c.SetCompression(tt.compress)
+		if err := c.Connect(); err != nil {
+			t.Fatalf("compress=%v: connect: %v", tt.compress, err)
+		}
+		c.SendSDPOffer("v=0\r\n" + strings.Repeat("a=candidate:1 1 udp 2122260223 192.168.1.2 50000 typ host\r\n", 50))
+		for i := 0; i < 2; i++ {
+			select {
+			case <-received:
+			case <-time.After(2 * time.Second):
+				t.Fatalf("compress=%v: timed out waiting for frame %d", tt.compress, i+1)
+			}
+		}
+		tr := c.Traffic()
+		c.Close()
+
+		if got := tr.Wire < tr.Messages; got != tt.wantSmaller {
+			t.Errorf("compress=%v: expected wire < messages %v, got %d wire for %d message bytes", tt.compress, tt.wantSmaller, tr.Wire, tr.Messages)
+		}
+	}
+}
+
+func TestClient_JoinRejectedReportsError(t *testing.T) {
+	joinRejectedCodes[1001] = true
+	t.Cleanup(func() { delete(joinRejectedCodes, 1001) })
+
+	tests := []struct {
+		name     string
+		code     int
+		noCode   bool
+		errs     int
+		rejected bool
+	}{
+		{"joined", 0, false, 0, false},
+		{"known rejection", 1001, false, 1, true},
+		{"unknown code", 1002, false, 1, false},
+		{"missing code", 0, true, 1, false},
+	}
+	for _, tt := range tests {
+		h := &recordingHandler{}
+		c := NewClient(&domain.Ticket{GroupID: "group"}, "serial", h)
+		msg := message{Method: "JOIN_LIVE_RESPONSE", Code: &tt.code}
+		if tt.noCode {
+			msg.Code = nil
+		}
+		c.dispatch(msg)
+		if len(h.errs) != tt.errs {
+			t.Fatalf("%s: expected %d errors, got %v", tt.name, tt.errs, h.errs)
+		}
+		if got := tt.errs == 1 && errors.Is(h.errs[0], ErrJoinRejected); got != tt.rejected {
+			t.Errorf("%s: expected rejected=%v, got errors %v", tt.name, tt.rejected, h.errs)
+		}
+	}
+}
+
+func TestClient_SessionID(t *testing.T) {
+	tests := []struct {
+		platform, override string
+		want               string
+	}{
+		{"", "", "Android-ticket-"},
+		{"iOS", "", "iOS-ticket-"},
+		{"iOS", "support-case-42", "support-case-42"},
+	}
+	for _, tt := range tests {
+		frames := make(chan []byte, 10)
+		srv := newFakeSignalServer(t, websocket.Upgrader{}, func(conn *websocket.Conn, _ *http.Request) {
+			readFrames(conn, frames)
+		})
+
+		c := NewClient(srv.ticket(), "serial", nopHandler{})
+		if tt.platform != "" {
+			c.SetPlatform(tt.platform)
+		}
+		if tt.override != "" {
+			c.SetSessionID(tt.override)
+		}
+		if err := c.Connect(); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		c.SendSDPOffer("v=0\r\n")
+		var got string
+		for got == "" {
+			select {
+			case data := <-frames:
+				var msg message
+				if err := json.Unmarshal(data, &msg); err != nil {
+					t.Fatalf("%+v: unmarshal %s: %v", tt, data, err)
+				}
+				got = msg.SessionID
+			case <-time.After(2 * time.Second):
+				t.Fatalf("%+v: timed out waiting for the offer", tt)
+			}
+		}
+		c.Close()
+
+		if !strings.HasPrefix(got, tt.want) || (tt.override != "" && got != tt.want) {
+			t.Errorf("%+v: expected session ID %q..., got %q", tt, tt.want, got)
+		}
+	}
+}
+
+func TestClient_NoErrorsLoggedAfterClose(t *testing.T) {
+	srv := newFakeSignalServer(t, websocket.Upgrader{}, func(conn *websocket.Conn, _ *http.Request) {
+		readFrames(conn, nil)
+	})
+	h := errorHandler{errs: make(chan error, 1)}
+	c := NewClient(srv.ticket(), "serial", h)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	c.Close()
+
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(prev)
+	c.SendJoinLive()
+	c.SendSDPOffer("v=0\r\n")
+	c.Close()
+
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing logged for sends after Close, got %q", buf.String())
+	}
+	select {
+	case err := <-h.errs:
+		t.Errorf("expected no error reported after Close, got %v", err)
+	default:
+	}
+}
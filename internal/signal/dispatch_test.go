@@ -0,0 +1,207 @@
+package signal
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/domain"
+)
+
+// transmit builds a TRANSMIT frame carrying payload, base64-encoded.
+func transmit(messageType, payload string) string {
+	return fmt.Sprintf(`{"method":"TRANSMIT","messageType":%q,"messagePayload":%q}`,
+		messageType, base64.StdEncoding.EncodeToString([]byte(payload)))
+}
+
+func TestClient_HandleFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   string
+		calls   []string
+		errKind error
+	}{
+		{"auth ok", `{"method":"AUTH_RESPONSE","code":0}`, []string{"auth"}, nil},
+		{"auth rejected", `{"method":"AUTH_RESPONSE","code":401,"message":"bad sign"}`, []string{"error"}, ErrAuthFailed},
+		{"auth without code", `{"method":"AUTH_RESPONSE"}`, []string{"error"}, ErrAuthFailed},
+		{"joined", `{"method":"JOIN_LIVE_RESPONSE","code":0}`, nil, nil},
+		{"join failed", `{"method":"JOIN_LIVE_RESPONSE","code":3}`, []string{"error"}, nil},
+		{"viewer limit", `{"method":"JOIN_LIVE_RESPONSE","code":7,"message":"Exceeded max allocation limit"}`, []string{"error"}, ErrViewerLimit},
+		{"viewer limit, other wording", `{"method":"JOIN_LIVE_RESPONSE","code":12,"message":"Too many viewers"}`, []string{"error"}, ErrViewerLimit},
+		{"join failed, limit in another sense", `{"method":"JOIN_LIVE_RESPONSE","code":9,"message":"rate limit exceeded"}`, []string{"error"}, nil},
+		{"join failed with a reason", `{"method":"JOIN_LIVE_RESPONSE","code":3,"message":"device not in group"}`, []string{"error"}, nil},
+		{"peer in before joining", `{"method":"PEER_IN","clientId":"serial"}`, nil, nil},
+		{"peer out", `{"method":"PEER_OUT","clientId":"serial"}`, []string{"peer-out"}, nil},
+		{"answer", transmit("SDP_ANSWER", `{"type":"answer","sdp":"v=0\r\n"}`), []string{`answer answer "v=0\r\n"`}, nil},
+		{"offer", transmit("SDP_OFFER", `{"type":"offer","sdp":"v=0\r\n"}`), []string{`offer offer "v=0\r\n"`}, nil},
+		{"candidate", transmit("ICE_CANDIDATE", `{"sdpMid":"0","sdpMLineIndex":1,"candidate":"candidate:1 1 udp 1 10.0.0.2 5000 typ host"}`),
+			[]string{`candidate 0 1 "candidate:1 1 udp 1 10.0.0.2 5000 typ host"`}, nil},
+		{"answer not base64", `{"method":"TRANSMIT","messageType":"SDP_ANSWER","messagePayload":"%%%"}`, []string{"error"}, ErrBadPayload},
+		{"answer not JSON", transmit("SDP_ANSWER", "v=0"), []string{"error"}, ErrBadPayload},
+		{"candidate not JSON", transmit("ICE_CANDIDATE", "candidate:1"), nil, nil},
+		{"unknown message type", transmit("BYE", "{}"), nil, nil},
+		{"responses", `{"method":"TRANSMIT_RESPONSE","code":0}`, nil, nil},
+		{"unknown method", `{"method":"NEW_THING"}`, nil, nil},
+		{"reconnect", `{"method":"RECONNECT"}`, []string{"error"}, ErrRedirected},
+		{"redirect", `{"method":"REDIRECT","signalServer":"wss://sig2.example.com"}`, []string{"error"}, ErrRedirected},
+		{"busy", `{"method":"BUSY","retryAfter":30}`, []string{"error"}, ErrServerBusy},
+		{"rate limit", `{"method":"RATE_LIMIT"}`, []string{"error"}, ErrServerBusy},
+		{"not JSON", `hello`, nil, nil},
+	}
+	for _, tt := range tests {
+		h := &recordingHandler{}
+		c := NewClient(&domain.Ticket{}, "serial", h)
+		c.handleFrame([]byte(tt.frame))
+
+		if !slices.Equal(h.calls, tt.calls) {
+			t.Errorf("%s: expected calls %q, got %q", tt.name, tt.calls, h.calls)
+		}
+		if tt.errKind != nil && (len(h.errs) != 1 || !errors.Is(h.errs[0], tt.errKind)) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.errKind, h.errs)
+		}
+	}
+}
+
+func TestIsViewerLimit(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected bool
+	}{
+		{"Exceeded max allocation limit", true},
+		{"VIEWER LIMIT reached", true},
+		{"too many clients", true},
+		{"no free slot on device", true},
+		{"device not in group", false},
+		{"rate limit exceeded", false},
+		{"ticket max age exceeded", false},
+		{"stream full of errors", false},
+		{"resource occupied", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isViewerLimit(tt.message); got != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.message, tt.expected, got)
+		}
+	}
+}
+
+func TestClient_EarlyPeerIn(t *testing.T) {
+	const (
+		auth    = `{"method":"AUTH_RESPONSE","code":0}`
+		joined  = `{"method":"JOIN_LIVE_RESPONSE","code":0}`
+		refused = `{"method":"JOIN_LIVE_RESPONSE","code":3}`
+		peerIn  = `{"method":"PEER_IN","clientId":"serial"}`
+		peerOut = `{"method":"PEER_OUT","clientId":"serial"}`
+	)
+	tests := []struct {
+		name   string
+		mode   EarlyPeerIn
+		frames []string
+		calls  []string
+	}{
+		{"in order", EarlyPeerInQueue, []string{auth, joined, peerIn}, []string{"auth", "peer-in"}},
+		{"queued until joined", EarlyPeerInQueue, []string{auth, peerIn, joined}, []string{"auth", "peer-in"}},
+		{"queued before auth", EarlyPeerInQueue, []string{peerIn, auth, joined}, []string{"auth", "peer-in"}},
+		{"queued then peer out", EarlyPeerInQueue, []string{auth, peerIn, peerOut, joined}, []string{"auth", "peer-out"}},
+		{"queued then join refused", EarlyPeerInQueue, []string{auth, peerIn, refused}, []string{"auth", "error"}},
+		{"dropped", EarlyPeerInDrop, []string{auth, peerIn, joined}, []string{"auth"}},
+		{"dropped, then in order", EarlyPeerInDrop, []string{auth, peerIn, joined, peerIn}, []string{"auth", "peer-in"}},
+		{"delivered", EarlyPeerInDeliver, []string{auth, peerIn, joined}, []string{"auth", "peer-in"}},
+	}
+	for _, tt := range tests {
+		h := &recordingHandler{}
+		c := NewClient(&domain.Ticket{}, "serial", h)
+		c.SetEarlyPeerIn(tt.mode)
+		for _, f := range tt.frames {
+			c.handleFrame([]byte(f))
+		}
+		if !slices.Equal(h.calls, tt.calls) {
+			t.Errorf("%s: expected calls %q, got %q", tt.name, tt.calls, h.calls)
+		}
+	}
+}
+
+func TestParseEarlyPeerIn(t *testing.T) {
+	for in, want := range map[string]EarlyPeerIn{"": EarlyPeerInQueue, "queue": EarlyPeerInQueue, "drop": EarlyPeerInDrop, "deliver": EarlyPeerInDeliver} {
+		if got, err := ParseEarlyPeerIn(in); err != nil || got != want {
+			t.Errorf("%q: expected %q, got %q (%v)", in, want, got, err)
+		}
+	}
+	if _, err := ParseEarlyPeerIn("reject"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestClient_HandleFrameCountsAndRecords(t *testing.T) {
+	c := NewClient(&domain.Ticket{}, "serial", &recordingHandler{})
+	frame := `{"method":"PEER_IN"}`
+	c.handleFrame([]byte(frame))
+	c.handleFrame([]byte("garbage"))
+
+	if got, want := c.Traffic().Messages, int64(len(frame)+len("garbage")); got != want {
+		t.Errorf("expected %d message bytes, got %d", want, got)
+	}
+	if got := c.DecodeErrors().Frames; got != 1 {
+		t.Errorf("expected 1 malformed frame counted, got %d", got)
+	}
+}
+
+func TestClient_Directives(t *testing.T) {
+	tests := []struct {
+		frame      string
+		server     string
+		retryAfter time.Duration
+	}{
+		{`{"method":"REDIRECT","signalServer":"wss://sig2.example.com"}`, "wss://sig2.example.com", 0},
+		{`{"method":"REDIRECT","signalServer":"https://sig2.example.com"}`, "", 0},
+		{`{"method":"REDIRECT","signalServer":"wss://"}`, "", 0},
+		{`{"method":"REDIRECT","signalServer":"ws://sig2.example.com"}`, "", 0},
+		{`{"method":"REDIRECT","signalServer":"wss://sig.attacker.net"}`, "", 0},
+		{`{"method":"RECONNECT"}`, "", 0},
+		{`{"method":"BUSY","retryAfter":30}`, "", 30 * time.Second},
+		{`{"method":"RATE_LIMIT","retryAfter":-5}`, "", 0},
+	}
+	for _, tt := range tests {
+		h := &recordingHandler{}
+		c := NewClient(&domain.Ticket{SignalServer: "wss://sig1.example.com"}, "serial", h)
+		c.handleFrame([]byte(tt.frame))
+
+		if len(h.errs) != 1 {
+			t.Fatalf("%s: expected one error, got %v", tt.frame, h.errs)
+		}
+		if got := RedirectTarget(h.errs[0]); got != tt.server {
+			t.Errorf("%s: expected redirect to %q, got %q", tt.frame, tt.server, got)
+		}
+		if got := RetryAfter(h.errs[0]); got != tt.retryAfter {
+			t.Errorf("%s: expected retry after %s, got %s", tt.frame, tt.retryAfter, got)
+		}
+	}
+}
+
+func TestRedirectAllowed(t *testing.T) {
+	tests := []struct {
+		from, target string
+		allowed      bool
+	}{
+		{"wss://sig1.example.com", "wss://sig1.example.com:8443", true},
+		{"wss://sig1.example.com", "wss://sig2.eu.example.com", true},
+		{"wss://sig1.example.com", "wss://SIG2.EXAMPLE.COM", true},
+		{"ws://sig1.example.com", "wss://sig2.example.com", true},
+		{"wss://sig1.example.com", "ws://sig2.example.com", false},
+		{"wss://sig1.example.com", "wss://example.com.attacker.net", false},
+		{"wss://sig1.example.com", "wss://notexample.com", false},
+		{"wss://example.com", "wss://sig.example.com", false},
+		{"ws://10.0.0.9:8080", "ws://10.0.0.9:9090", true},
+		{"ws://10.0.0.9:8080", "ws://10.0.0.10:8080", false},
+		{"", "wss://sig2.example.com", false},
+	}
+	for _, tt := range tests {
+		err := redirectAllowed(tt.from, tt.target)
+		if got := err == nil; got != tt.allowed {
+			t.Errorf("%s to %s: expected allowed=%v, got %v", tt.from, tt.target, tt.allowed, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package signal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Error categories reported to Handler.OnError. Use errors.Is to test for them.
+var (
+	// ErrAuthFailed means the signaling server rejected the AUTH message.
+	ErrAuthFailed = errors.New("signaling auth failed")
+	// ErrJoinRejected means the server refused to join the camera's
+	// session with a code known to be final, such as for a serial number
+	// outside the device group the ticket belongs to. No code is known to
+	// mean that yet (see joinRejectedCodes), so nothing returns it.
+	ErrJoinRejected = errors.New("signaling join rejected")
+	// ErrViewerLimit means the server refused to join because the camera
+	// already streams to as many viewers as it allows, the ticket's
+	// MaxAllocationLimit. A later attempt may find a free slot.
+	ErrViewerLimit = errors.New("camera is at its viewer limit")
+	// ErrConnectionLost means the WebSocket closed without Close being called.
+	ErrConnectionLost = errors.New("signaling connection lost")
+	// ErrBadPayload means an SDP frame from the camera could not be
+	// decoded, so the media session cannot be set up.
+	ErrBadPayload = errors.New("undecodable signaling payload")
+	// ErrRedirected means the server asked the client to reconnect,
+	// possibly to another server. DirectiveError.Server says which.
+	ErrRedirected = errors.New("signaling server requested a reconnect")
+	// ErrServerBusy means the server asked the client to back off before
+	// reconnecting. DirectiveError.RetryAfter says how long, if it said.
+	ErrServerBusy = errors.New("signaling server busy")
+)
+
+// joinRejectedCodes are the JOIN_LIVE_RESPONSE codes known to refuse the
+// join for good, reported as ErrJoinRejected. The codes are undocumented
+// and only confirmed ones belong here; any other code, or a response
+// without one, is reported without a category, so it stays retryable.
+var joinRejectedCodes = map[int]bool{}
+
+// ResponseError is a failed *_RESPONSE message from the signaling server.
+// Kind holds the matching category error and is what errors.Is compares
+// against, or nil if the code has no known category.
+type ResponseError struct {
+	Method  string
+	Code    int
+	Message string
+	Kind    error
+}
+
+func (e *ResponseError) Error() string {
+	if e.Kind == nil {
+		return fmt.Sprintf("%s failed (code=%d msg=%s)", e.Method, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s: %s (code=%d msg=%s)", e.Kind, e.Method, e.Code, e.Message)
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.Kind
+}
+
+// DirectiveError is a server-initiated directive to reconnect or back off.
+// Kind is ErrRedirected or ErrServerBusy and is what errors.Is compares
+// against.
+type DirectiveError struct {
+	Method string
+	// Server is the signal server to reconnect to, or empty to reconnect
+	// to the same one.
+	Server string
+	// RetryAfter is the wait the server asked for, or zero.
+	RetryAfter time.Duration
+	Message    string
+	Kind       error
+}
+
+func (e *DirectiveError) Error() string {
+	switch {
+	case e.Server != "":
+		return fmt.Sprintf("%s: %s to %s (msg=%s)", e.Kind, e.Method, e.Server, e.Message)
+	case e.RetryAfter > 0:
+		return fmt.Sprintf("%s: %s for %s (msg=%s)", e.Kind, e.Method, e.RetryAfter, e.Message)
+	}
+	return fmt.Sprintf("%s: %s (msg=%s)", e.Kind, e.Method, e.Message)
+}
+
+func (e *DirectiveError) Unwrap() error {
+	return e.Kind
+}
+
+// RedirectTarget returns the signal server a redirect directive in err's
+// chain points at, or "" if there is none.
+func RedirectTarget(err error) string {
+	var e *DirectiveError
+	if errors.As(err, &e) && errors.Is(e.Kind, ErrRedirected) {
+		return e.Server
+	}
+	return ""
+}
+
+// RetryAfter returns the back-off a directive in err's chain asked for,
+// or zero.
+func RetryAfter(err error) time.Duration {
+	var e *DirectiveError
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+	return 0
+}
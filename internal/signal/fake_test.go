@@ -0,0 +1,104 @@
+package signal
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"vico_home/native/internal/domain"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeSignalServer is a local WebSocket server standing in for the
+// signaling server. serve runs for each connection once upgraded; the
+// connection is closed when it returns.
+type fakeSignalServer struct {
+	*httptest.Server
+}
+
+// newFakeSignalServer starts a fakeSignalServer, closed when the test
+// ends.
+func newFakeSignalServer(t *testing.T, upgrader websocket.Upgrader, serve func(conn *websocket.Conn, r *http.Request)) *fakeSignalServer {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn, r)
+	}))
+	t.Cleanup(srv.Close)
+	return &fakeSignalServer{srv}
+}
+
+// wsURL returns the server's ws:// URL.
+func (s *fakeSignalServer) wsURL() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+// ticket returns a ticket pointing at the server, pinging every 30s.
+func (s *fakeSignalServer) ticket() *domain.Ticket {
+	return &domain.Ticket{ID: "ticket", SignalServer: s.wsURL(), SignalPingInterval: 30}
+}
+
+// readFrames sends each frame read from conn to frames until the
+// connection fails, so it also answers the client's control frames.
+func readFrames(conn *websocket.Conn, frames chan<- []byte) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if frames != nil {
+			frames <- data
+		}
+	}
+}
+
+// nopHandler ignores every signaling event.
+type nopHandler struct{}
+
+func (nopHandler) OnAuthSuccess()                                  {}
+func (nopHandler) OnPeerIn()                                       {}
+func (nopHandler) OnPeerOut()                                      {}
+func (nopHandler) OnSDPAnswer(domain.SDPPayload)                   {}
+func (nopHandler) OnSDPOffer(domain.SDPPayload)                    {}
+func (nopHandler) OnRemoteICECandidate(domain.ICECandidatePayload) {}
+func (nopHandler) OnError(error)                                   {}
+
+// errorHandler reports each error from the client on errs, for clients
+// whose read loop calls it from its own goroutine.
+type errorHandler struct {
+	nopHandler
+	errs chan error
+}
+
+func (h errorHandler) OnError(err error) { h.errs <- err }
+
+// recordingHandler records each handler call as a short description, for
+// frames dispatched on the test's goroutine.
+type recordingHandler struct {
+	calls []string
+	errs  []error
+}
+
+func (h *recordingHandler) OnAuthSuccess() { h.calls = append(h.calls, "auth") }
+func (h *recordingHandler) OnPeerIn()      { h.calls = append(h.calls, "peer-in") }
+func (h *recordingHandler) OnPeerOut()     { h.calls = append(h.calls, "peer-out") }
+func (h *recordingHandler) OnSDPAnswer(sdp domain.SDPPayload) {
+	h.calls = append(h.calls, fmt.Sprintf("answer %s %q", sdp.Type, sdp.SDP))
+}
+func (h *recordingHandler) OnSDPOffer(sdp domain.SDPPayload) {
+	h.calls = append(h.calls, fmt.Sprintf("offer %s %q", sdp.Type, sdp.SDP))
+}
+func (h *recordingHandler) OnRemoteICECandidate(c domain.ICECandidatePayload) {
+	h.calls = append(h.calls, fmt.Sprintf("candidate %s %d %q", c.SDPMid, c.SDPMLineIndex, c.Candidate))
+}
+func (h *recordingHandler) OnError(err error) {
+	h.calls = append(h.calls, "error")
+	h.errs = append(h.errs, err)
+}
@@ -0,0 +1,34 @@
+package signal
+
+import "fmt"
+
+// EarlyPeerIn selects what the client does with a PEER_IN that arrives
+// before the server accepted JOIN_LIVE. The protocol orders AUTH, then
+// JOIN_LIVE, then PEER_IN, but a racy server may announce the camera
+// first, and offering to a session not yet joined fails.
+type EarlyPeerIn string
+
+const (
+	// EarlyPeerInQueue holds the PEER_IN and delivers it once JOIN_LIVE
+	// succeeds. A PEER_OUT or failed join in between discards it.
+	EarlyPeerInQueue EarlyPeerIn = ""
+	// EarlyPeerInDrop discards the PEER_IN, for servers that announce the
+	// camera again after the join.
+	EarlyPeerInDrop EarlyPeerIn = "drop"
+	// EarlyPeerInDeliver delivers the PEER_IN at once, for servers that
+	// never answer JOIN_LIVE.
+	EarlyPeerInDeliver EarlyPeerIn = "deliver"
+)
+
+// ParseEarlyPeerIn converts a command-line value ("queue", "drop" or
+// "deliver") to an EarlyPeerIn.
+func ParseEarlyPeerIn(s string) (EarlyPeerIn, error) {
+	switch s {
+	case "", "queue":
+		return EarlyPeerInQueue, nil
+	case "drop", "deliver":
+		return EarlyPeerIn(s), nil
+	default:
+		return "", fmt.Errorf("invalid early PEER_IN handling %q (want queue, drop or deliver)", s)
+	}
+}
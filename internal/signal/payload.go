@@ -0,0 +1,78 @@
+package signal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// payloadEncodings are tried in order by tolerant decoding. Some camera
+// firmwares send URL-safe base64 or leave out the padding.
+var payloadEncodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.RawStdEncoding,
+	base64.URLEncoding,
+	base64.RawURLEncoding,
+}
+
+// DecodeErrors counts signaling frames dropped because they could not be
+// decoded, by kind. Frames are frames that were not JSON at all. A bad
+// offer or answer is also reported to Handler.OnError, as the session
+// cannot be set up without it; a bad candidate only costs that candidate.
+type DecodeErrors struct {
+	Frames     int64
+	Offers     int64
+	Answers    int64
+	Candidates int64
+}
+
+// Total is the number of frames dropped.
+func (d DecodeErrors) Total() int64 {
+	return d.Frames + d.Offers + d.Answers + d.Candidates
+}
+
+type decodeCounters struct {
+	frames, offers, answers, candidates atomic.Int64
+}
+
+// DecodeErrors returns the signaling frames dropped so far.
+func (c *Client) DecodeErrors() DecodeErrors {
+	return DecodeErrors{
+		Frames:     c.decodeErrs.frames.Load(),
+		Offers:     c.decodeErrs.offers.Load(),
+		Answers:    c.decodeErrs.answers.Load(),
+		Candidates: c.decodeErrs.candidates.Load(),
+	}
+}
+
+// decodePayload decodes a TRANSMIT messagePayload. Strict accepts only
+// padded standard base64, as the app sends.
+func decodePayload(s string, strict bool) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err == nil || strict {
+		return decoded, err
+	}
+	for _, enc := range payloadEncodings[1:] {
+		if decoded, err := enc.DecodeString(s); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, err
+}
+
+// unmarshalPayload decodes a TRANSMIT messagePayload of the given type
+// into v. Failures wrap ErrBadPayload.
+func (c *Client) unmarshalPayload(messageType, payload string, v any) error {
+	decoded, err := decodePayload(payload, c.strict)
+	if err != nil {
+		if c.strict {
+			return fmt.Errorf("%w: %s is not standard padded base64 (%v); drop -strict-base64 to accept unpadded and URL-safe payloads", ErrBadPayload, messageType, err)
+		}
+		return fmt.Errorf("%w: %s is not base64 in any known variant: %v", ErrBadPayload, messageType, err)
+	}
+	if err := json.Unmarshal(decoded, v); err != nil {
+		return fmt.Errorf("%w: %s does not hold JSON: %v", ErrBadPayload, messageType, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package signal
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"vico_home/native/internal/domain"
+)
+
+func TestDecodePayload_Variants(t *testing.T) {
+	// This encodes to '/' and needs padding, so every variant differs.
+	plain := `{"sdp":"??>"}`
+	tests := []struct {
+		name      string
+		enc       *base64.Encoding
+		strictErr bool
+	}{
+		{"standard", base64.StdEncoding, false},
+		{"unpadded", base64.RawStdEncoding, true},
+		{"url-safe", base64.URLEncoding, true},
+		{"url-safe unpadded", base64.RawURLEncoding, true},
+	}
+	for _, tt := range tests {
+		encoded := tt.enc.EncodeToString([]byte(plain))
+		got, err := decodePayload(encoded, false)
+		if err != nil || string(got) != plain {
+			t.Errorf("%s: expected %q, got %q (err %v)", tt.name, plain, got, err)
+		}
+		if _, err := decodePayload(encoded, true); (err != nil) != tt.strictErr {
+			t.Errorf("%s: strict: expected error %v, got %v", tt.name, tt.strictErr, err)
+		}
+	}
+}
+
+func TestClient_BadSDPPayloadReportsError(t *testing.T) {
+	h := &recordingHandler{}
+	c := NewClient(&domain.Ticket{}, "serial", h)
+	c.dispatch(message{Method: "TRANSMIT", MessageType: "SDP_ANSWER", MessagePayload: "not base64!"})
+	if len(h.errs) != 1 || !errors.Is(h.errs[0], ErrBadPayload) {
+		t.Fatalf("expected one ErrBadPayload, got %v", h.errs)
+	}
+
+	h.errs = nil
+	c.dispatch(message{Method: "TRANSMIT", MessageType: "ICE_CANDIDATE", MessagePayload: "not base64!"})
+	if len(h.errs) != 0 {
+		t.Errorf("expected a bad candidate to be dropped, got %v", h.errs)
+	}
+
+	want := DecodeErrors{Answers: 1, Candidates: 1}
+	if got := c.DecodeErrors(); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,55 @@
+package signal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/signal/signaltest"
+)
+
+// joiningHandler joins the live session once authenticated, as the
+// viewer does, and reports authentications and errors on channels since
+// the read loop calls it from its own goroutine.
+type joiningHandler struct {
+	errorHandler
+	client *Client
+	auths  chan struct{}
+}
+
+func newJoiningHandler() *joiningHandler {
+	return &joiningHandler{errorHandler: errorHandler{errs: make(chan error, 10)}, auths: make(chan struct{}, 10)}
+}
+
+func (h *joiningHandler) OnAuthSuccess() {
+	h.client.SendJoinLive()
+	h.auths <- struct{}{}
+}
+
+// TestClient_ReportsDroppedConnection drops the connection after the join
+// and checks that the loss is reported as ErrConnectionLost, which the
+// reconnect loop in cmd/vicostream redials on.
+func TestClient_ReportsDroppedConnection(t *testing.T) {
+	srv := signaltest.NewServer(true)
+	defer srv.Close()
+
+	h := newJoiningHandler()
+	h.client = NewClient(srv.Ticket(), "serial", h)
+	if err := h.client.Connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer h.client.Close()
+	select {
+	case <-h.auths:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the authentication")
+	}
+	select {
+	case err := <-h.errs:
+		if !errors.Is(err, ErrConnectionLost) {
+			t.Fatalf("expected ErrConnectionLost, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the dropped connection to be reported")
+	}
+}
@@ -0,0 +1,107 @@
+// Package signaltest provides a local signaling server for tests of the
+// signaling client and of the code that drives it.
+package signaltest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"vico_home/native/internal/domain"
+
+	"github.com/gorilla/websocket"
+)
+
+// frame holds the fields of a signaling message the server reads or
+// writes.
+type frame struct {
+	Method      string `json:"method"`
+	Code        *int   `json:"code,omitempty"`
+	AccessToken string `json:"accessToken,omitempty"`
+}
+
+// Server is a local signaling server that answers AUTH and JOIN_LIVE with
+// success and records the methods each connection sent. With
+// dropAfterJoin it closes the first connection once the join is answered,
+// as a server restart or a network change would.
+type Server struct {
+	*httptest.Server
+	dropAfterJoin bool
+
+	mu    sync.Mutex
+	conns [][]string
+	seen  chan struct{}
+}
+
+// NewServer starts a Server. Close it when done.
+func NewServer(dropAfterJoin bool) *Server {
+	s := &Server{dropAfterJoin: dropAfterJoin, seen: make(chan struct{}, 100)}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.mu.Lock()
+		index := len(s.conns)
+		s.conns = append(s.conns, nil)
+		s.mu.Unlock()
+
+		ok := 0
+		for {
+			var msg frame
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns[index] = append(s.conns[index], msg.Method+" "+msg.AccessToken)
+			s.mu.Unlock()
+			select {
+			case s.seen <- struct{}{}:
+			default:
+			}
+
+			switch msg.Method {
+			case "AUTH":
+				conn.WriteJSON(frame{Method: "AUTH_RESPONSE", Code: &ok})
+			case "JOIN_LIVE":
+				conn.WriteJSON(frame{Method: "JOIN_LIVE_RESPONSE", Code: &ok})
+				if s.dropAfterJoin && index == 0 {
+					return
+				}
+			}
+		}
+	}))
+	return s
+}
+
+// Ticket returns a ticket pointing at the server, with access token
+// "token".
+func (s *Server) Ticket() *domain.Ticket {
+	return &domain.Ticket{
+		ID:                 "ticket",
+		AccessToken:        "token",
+		SignalServer:       "ws" + strings.TrimPrefix(s.URL, "http"),
+		SignalPingInterval: 30,
+	}
+}
+
+// Methods returns what each connection has sent so far, in order, as
+// "METHOD accessToken".
+func (s *Server) Methods() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([][]string, len(s.conns))
+	for i, c := range s.conns {
+		out[i] = append([]string(nil), c...)
+	}
+	return out
+}
+
+// Seen receives after each message the server reads, so a test can wait
+// for Methods to change instead of polling.
+func (s *Server) Seen() <-chan struct{} {
+	return s.seen
+}
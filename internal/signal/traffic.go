@@ -0,0 +1,46 @@
+package signal
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+)
+
+// Traffic counts signaling bytes in both directions: Messages is the size
+// of the JSON frames, Wire what crossed the TCP connection, including the
+// WebSocket and TLS framing and the HTTP upgrade. With compression
+// negotiated, Wire is usually well below Messages.
+type Traffic struct {
+	Messages int64
+	Wire     int64
+}
+
+// countingConn counts the bytes read from and written to a net.Conn.
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// countingDial dials like net.Dialer and adds the connection's traffic to n.
+func countingDial(n *atomic.Int64) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return countingConn{Conn: conn, n: n}, nil
+	}
+}
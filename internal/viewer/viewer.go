@@ -2,28 +2,102 @@ package viewer
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 
 	"vico_home/native/internal/domain"
 )
 
+// Role decides which side of the session sends the SDP offer.
+type Role string
+
+const (
+	// RoleOfferer sends an offer when the camera joins and expects an answer.
+	RoleOfferer Role = "offer"
+	// RoleAnswerer waits for the camera to send an offer and answers it.
+	RoleAnswerer Role = "answer"
+	// RoleAuto offers like RoleOfferer, but if the camera sends an offer of
+	// its own the viewer abandons its offer and answers instead.
+	RoleAuto Role = "auto"
+)
+
+// ParseRole converts a role name to a Role.
+func ParseRole(s string) (Role, error) {
+	switch r := Role(s); r {
+	case RoleOfferer, RoleAnswerer, RoleAuto:
+		return r, nil
+	}
+	return "", fmt.Errorf("unknown SDP role %q (want offer, answer or auto)", s)
+}
+
+// iceQueueSize bounds the remote ICE candidates waiting to be added. The
+// camera sends a handful; more than this means something is wrong.
+const iceQueueSize = 64
+
 // Viewer coordinates the signaling and WebRTC flows.
 // It implements domain.Handler.
 type Viewer struct {
-	peer   domain.Peer
 	signal domain.Signaler
-	cancel context.CancelFunc
+	cancel context.CancelCauseFunc
+	role   Role
+
+	// peerMu guards peer, which Restart replaces while the signaling and
+	// candidate goroutines use it.
+	peerMu sync.Mutex
+	peer   domain.Peer
+
+	// Remote ICE candidates are added in arrival order by one worker,
+	// which AddRemoteICECandidate blocks until the remote description is
+	// set. candMu guards candidates against Close.
+	candMu     sync.Mutex
+	candidates chan domain.ICECandidatePayload
+	closed     bool
+	// candStats counts the candidates and keeps the peer's errors, for
+	// the session summary. It is guarded by candMu.
+	candStats CandidateStats
+	// candidateDone is called after the worker adds or rejects each
+	// candidate; replaced in tests.
+	candidateDone func()
+
+	// answered is set once the viewer answered a camera offer; the camera
+	// is then the side that offers.
+	answered atomic.Bool
 }
 
 // New creates a Viewer with the given peer and context cancel function.
+// Errors that end the session are passed to cancel as the cause.
 // Call SetSignaler before use to complete the circular dependency.
-func New(peer domain.Peer, cancel context.CancelFunc) *Viewer {
+func New(peer domain.Peer, cancel context.CancelCauseFunc) *Viewer {
 	return &Viewer{
-		peer:   peer,
-		cancel: cancel,
+		peer:          peer,
+		cancel:        cancel,
+		role:          RoleAuto,
+		candidateDone: func() {},
 	}
 }
 
+// Close stops adding remote ICE candidates. Candidates still queued are
+// dropped.
+func (v *Viewer) Close() {
+	v.candMu.Lock()
+	defer v.candMu.Unlock()
+	if v.closed {
+		return
+	}
+	v.closed = true
+	if v.candidates != nil {
+		close(v.candidates)
+	}
+}
+
+// SetRole sets which side sends the SDP offer. The default is RoleAuto.
+func (v *Viewer) SetRole(r Role) {
+	v.role = r
+}
+
 // SetSignaler injects the signaler after construction to resolve the
 // circular dependency (Viewer needs Signaler, Signal needs Handler).
 func (v *Viewer) SetSignaler(s domain.Signaler) {
@@ -36,9 +110,13 @@ func (v *Viewer) OnAuthSuccess() {
 }
 
 func (v *Viewer) OnPeerIn() {
+	if v.role == RoleAnswerer {
+		log.Printf("[viewer] camera peer in, waiting for its offer")
+		return
+	}
 	log.Printf("[viewer] camera peer in, creating offer")
 
-	sdp, err := v.peer.CreateOffer()
+	sdp, err := v.currentPeer().CreateOffer()
 	if err != nil {
 		log.Fatalf("[viewer] create offer: %v", err)
 	}
@@ -47,19 +125,146 @@ func (v *Viewer) OnPeerIn() {
 
 func (v *Viewer) OnPeerOut() {
 	log.Printf("[viewer] camera peer out, shutting down")
-	v.cancel()
+	v.cancel(nil)
 }
 
 func (v *Viewer) OnSDPAnswer(sdp domain.SDPPayload) {
-	if err := v.peer.SetRemoteDescription(sdp); err != nil {
-		log.Printf("[viewer] set remote description: %v", err)
+	if err := v.currentPeer().SetRemoteDescription(sdp); err != nil {
+		log.Printf("[viewer] set remote description, shutting down: %v", err)
+		v.cancel(err)
+	}
+}
+
+func (v *Viewer) OnSDPOffer(sdp domain.SDPPayload) {
+	if v.role == RoleOfferer {
+		log.Printf("[viewer] ignoring camera SDP offer: role is %s", v.role)
+		return
+	}
+
+	log.Printf("[viewer] camera sent an offer, answering")
+	answer, err := v.currentPeer().AcceptOffer(sdp)
+	if err != nil {
+		log.Printf("[viewer] accept offer: %v", err)
+		return
+	}
+	v.answered.Store(true)
+	v.signal.SendSDPAnswer(answer)
+}
+
+// Renegotiate sends a new offer after the peer's transceivers changed
+// mid-session. In a session the camera offered, the viewer does not offer
+// and the change waits for the camera's next offer.
+func (v *Viewer) Renegotiate() {
+	if v.role == RoleAnswerer || v.answered.Load() {
+		log.Printf("[viewer] renegotiation needed, but the camera offers in this session; waiting for its offer")
+		return
+	}
+	log.Printf("[viewer] renegotiating, sending a new offer")
+	sdp, err := v.currentPeer().CreateOffer()
+	if err != nil {
+		log.Printf("[viewer] warning: create renegotiation offer: %v", err)
+		return
 	}
+	v.signal.SendSDPOffer(sdp)
 }
 
+// OnRemoteICECandidate queues candidate to be added once the remote
+// description is set. It does not block the signaling read loop, which
+// still has to deliver that description.
 func (v *Viewer) OnRemoteICECandidate(candidate domain.ICECandidatePayload) {
-	go func() {
-		if err := v.peer.AddRemoteICECandidate(candidate); err != nil {
-			log.Printf("[viewer] add remote ICE candidate: %v", err)
+	v.candMu.Lock()
+	defer v.candMu.Unlock()
+	if v.closed {
+		return
+	}
+	if v.candidates == nil {
+		v.candidates = make(chan domain.ICECandidatePayload, iceQueueSize)
+		go v.addCandidates(v.candidates)
+	}
+	select {
+	case v.candidates <- candidate:
+	default:
+		v.candStats.Dropped++
+		log.Printf("[viewer] warning: %d remote ICE candidates pending, dropping %s", iceQueueSize, candidate.Candidate)
+	}
+}
+
+// addCandidates adds the remote candidates from queue in order until
+// Close. A candidate the peer rejects is logged, counted and skipped, and
+// its error kept for RemoteCandidates.
+func (v *Viewer) addCandidates(queue <-chan domain.ICECandidatePayload) {
+	for candidate := range queue {
+		err := v.currentPeer().AddRemoteICECandidate(candidate)
+		if err != nil && v.isClosed() {
+			return
+		}
+		v.candMu.Lock()
+		if err != nil {
+			v.candStats.Rejected++
+			v.candStats.Err = errors.Join(v.candStats.Err, fmt.Errorf("candidate %q: %w", candidate.Candidate, err))
+		} else {
+			v.candStats.Added++
+		}
+		v.candMu.Unlock()
+		if err != nil {
+			log.Printf("[viewer] add remote ICE candidate %q: %v", candidate.Candidate, err)
 		}
-	}()
+		v.candidateDone()
+	}
+}
+
+// CandidateStats counts the camera's ICE candidates by what became of
+// them.
+type CandidateStats struct {
+	Added    int64
+	Rejected int64 // by the peer
+	Dropped  int64 // with iceQueueSize candidates already waiting
+	// Err joins the peer's errors for the rejected candidates.
+	Err error
+}
+
+// RemoteCandidates reports what became of the camera's ICE candidates so
+// far. With every candidate rejected or dropped the connection cannot
+// come up over them.
+func (v *Viewer) RemoteCandidates() CandidateStats {
+	v.candMu.Lock()
+	defer v.candMu.Unlock()
+	return v.candStats
+}
+
+// Restart replaces the peer, after the previous one failed to get video,
+// and joins the live session again over the same signaling session. The
+// offer from the new peer follows the camera's next PEER_IN, as at the
+// start, since the camera only takes an offer for a connection it has
+// announced. It reports false, leaving the peer as it is, in a session
+// the camera offers: the camera then picks the codecs and a new offer
+// from this side would not change them.
+func (v *Viewer) Restart(peer domain.Peer) bool {
+	if v.role == RoleAnswerer || v.answered.Load() {
+		return false
+	}
+	v.peerMu.Lock()
+	v.peer = peer
+	v.peerMu.Unlock()
+
+	log.Printf("[viewer] restarting with a new peer connection, joining again for the camera's peer in")
+	v.signal.SendJoinLive()
+	return true
+}
+
+func (v *Viewer) currentPeer() domain.Peer {
+	v.peerMu.Lock()
+	defer v.peerMu.Unlock()
+	return v.peer
+}
+
+func (v *Viewer) isClosed() bool {
+	v.candMu.Lock()
+	defer v.candMu.Unlock()
+	return v.closed
+}
+
+func (v *Viewer) OnError(err error) {
+	log.Printf("[viewer] signaling error, shutting down: %v", err)
+	v.cancel(err)
 }
@@ -2,7 +2,10 @@ package viewer
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +16,7 @@ import (
 type mockSignaler struct {
 	joinLiveCalled    bool
 	sdpOfferSent      string
+	sdpAnswerSent     string
 	iceCandidateSent  bool
 	closeCalled       bool
 }
@@ -20,6 +24,7 @@ type mockSignaler struct {
 func (m *mockSignaler) Connect() error                                                  { return nil }
 func (m *mockSignaler) SendJoinLive()                                                   { m.joinLiveCalled = true }
 func (m *mockSignaler) SendSDPOffer(sdp string)                                         { m.sdpOfferSent = sdp }
+func (m *mockSignaler) SendSDPAnswer(sdp string)                                        { m.sdpAnswerSent = sdp }
 func (m *mockSignaler) SendICECandidate(sdpMid string, sdpMLineIndex int, candidate string) {
 	m.iceCandidateSent = true
 }
@@ -30,6 +35,12 @@ type mockPeer struct {
 	offerSDP         string
 	remoteDescSet    bool
 	iceCandidateAdded bool
+	offerAccepted     string
+	answerSDP         string
+	candidateCh       chan string   // receives each added candidate, if set
+	candidateGate     chan struct{} // AddRemoteICECandidate waits for it, if set
+	candidateWaiting  chan struct{} // receives as AddRemoteICECandidate starts waiting at candidateGate, if set
+	rejectCandidate   string        // AddRemoteICECandidate fails for it, if set
 }
 
 func (m *mockPeer) AddTransceivers() error               { return nil }
@@ -40,15 +51,34 @@ func (m *mockPeer) SetRemoteDescription(sdp domain.SDPPayload) error {
 	m.remoteDescSet = true
 	return nil
 }
+func (m *mockPeer) AcceptOffer(sdp domain.SDPPayload) (string, error) {
+	m.offerAccepted = sdp.SDP
+	return m.answerSDP, nil
+}
 func (m *mockPeer) AddRemoteICECandidate(candidate domain.ICECandidatePayload) error {
+	if m.candidateGate != nil {
+		if m.candidateWaiting != nil {
+			select {
+			case m.candidateWaiting <- struct{}{}:
+			default:
+			}
+		}
+		<-m.candidateGate
+	}
+	if candidate.Candidate == m.rejectCandidate {
+		return errors.New("invalid candidate")
+	}
 	m.iceCandidateAdded = true
+	if m.candidateCh != nil {
+		m.candidateCh <- candidate.Candidate
+	}
 	return nil
 }
 func (m *mockPeer) Close() {}
 
 func TestOnAuthSuccess_SendsJoinLive(t *testing.T) {
-	_, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
 
 	sig := &mockSignaler{}
 	peer := &mockPeer{}
@@ -63,8 +93,8 @@ func TestOnAuthSuccess_SendsJoinLive(t *testing.T) {
 }
 
 func TestOnPeerIn_CreatesOfferAndSends(t *testing.T) {
-	_, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
 
 	sig := &mockSignaler{}
 	peer := &mockPeer{offerSDP: "v=0\r\ntest-sdp"}
@@ -79,7 +109,7 @@ func TestOnPeerIn_CreatesOfferAndSends(t *testing.T) {
 }
 
 func TestOnPeerOut_CancelsContext(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancelCause(context.Background())
 	peer := &mockPeer{}
 	v := New(peer, cancel)
 	v.SetSignaler(&mockSignaler{})
@@ -95,8 +125,8 @@ func TestOnPeerOut_CancelsContext(t *testing.T) {
 }
 
 func TestOnSDPAnswer_SetsRemoteDescription(t *testing.T) {
-	_, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
 
 	peer := &mockPeer{}
 	v := New(peer, cancel)
@@ -110,10 +140,10 @@ func TestOnSDPAnswer_SetsRemoteDescription(t *testing.T) {
 }
 
 func TestOnRemoteICECandidate_AddsCandidate(t *testing.T) {
-	_, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
 
-	peer := &mockPeer{}
+	peer := &mockPeer{candidateCh: make(chan string, 1)}
 	v := New(peer, cancel)
 	v.SetSignaler(&mockSignaler{})
 
@@ -122,10 +152,241 @@ func TestOnRemoteICECandidate_AddsCandidate(t *testing.T) {
 		Candidate: "candidate:123",
 	})
 
-	// Give the goroutine time to execute
-	time.Sleep(50 * time.Millisecond)
+	// The candidate is added from a goroutine; wait for it.
+	select {
+	case <-peer.candidateCh:
+	case <-time.After(time.Second):
+	}
 
 	if !peer.iceCandidateAdded {
 		t.Error("expected AddRemoteICECandidate to be called")
 	}
 }
+
+func TestOnRemoteICECandidate_AddsInOrderOnceUnblocked(t *testing.T) {
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	peer := &mockPeer{candidateCh: make(chan string, 10), candidateGate: make(chan struct{})}
+	v := New(peer, cancel)
+	defer v.Close()
+	v.SetSignaler(&mockSignaler{})
+
+	want := []string{"candidate:1", "candidate:2", "candidate:3"}
+	for _, c := range want {
+		v.OnRemoteICECandidate(domain.ICECandidatePayload{SDPMid: "0", Candidate: c})
+	}
+	// The remote description arrives after the candidates.
+	close(peer.candidateGate)
+
+	for _, c := range want {
+		select {
+		case got := <-peer.candidateCh:
+			if got != c {
+				t.Errorf("expected %s, got %s", c, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", c)
+		}
+	}
+}
+
+func TestOnRemoteICECandidate_IgnoredAfterClose(t *testing.T) {
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	peer := &mockPeer{}
+	v := New(peer, cancel)
+	v.SetSignaler(&mockSignaler{})
+	v.Close()
+
+	v.OnRemoteICECandidate(domain.ICECandidatePayload{SDPMid: "0", Candidate: "candidate:1"})
+	if v.candidates != nil {
+		t.Error("expected no candidate queue after Close")
+	}
+}
+
+func TestOnRemoteICECandidate_CountsRejected(t *testing.T) {
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	peer := &mockPeer{rejectCandidate: "candidate:bad"}
+	v := New(peer, cancel)
+	defer v.Close()
+	v.SetSignaler(&mockSignaler{})
+	done := make(chan struct{}, 10)
+	v.candidateDone = func() { done <- struct{}{} }
+
+	for _, c := range []string{"candidate:bad", "candidate:1", "candidate:2"} {
+		v.OnRemoteICECandidate(domain.ICECandidatePayload{SDPMid: "0", Candidate: c})
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the candidates")
+		}
+	}
+	c := v.RemoteCandidates()
+	if c.Added != 2 || c.Rejected != 1 || c.Dropped != 0 {
+		t.Fatalf("expected 2 added and 1 rejected, got %+v", c)
+	}
+	if c.Err == nil || !strings.Contains(c.Err.Error(), "candidate:bad") {
+		t.Errorf("expected the rejection error for candidate:bad, got %v", c.Err)
+	}
+}
+
+func TestOnRemoteICECandidate_CountsDroppedPastQueue(t *testing.T) {
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	gate, waiting := make(chan struct{}), make(chan struct{}, 1)
+	peer := &mockPeer{candidateGate: gate, candidateWaiting: waiting}
+	v := New(peer, cancel)
+	defer v.Close()
+	v.SetSignaler(&mockSignaler{})
+	done := make(chan struct{}, iceQueueSize+2)
+	v.candidateDone = func() { done <- struct{}{} }
+
+	// The first candidate holds the worker at the gate, so the queue fills
+	// with the next iceQueueSize and the two after that are dropped.
+	v.OnRemoteICECandidate(domain.ICECandidatePayload{Candidate: "candidate:0"})
+	select {
+	case <-waiting:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the worker to take the first candidate")
+	}
+	for i := 1; i <= iceQueueSize+2; i++ {
+		v.OnRemoteICECandidate(domain.ICECandidatePayload{Candidate: fmt.Sprintf("candidate:%d", i)})
+	}
+	close(gate)
+	for i := 0; i <= iceQueueSize; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for candidate %d", i)
+		}
+	}
+	if c := v.RemoteCandidates(); c.Added != iceQueueSize+1 || c.Dropped != 2 {
+		t.Errorf("expected %d added and 2 dropped, got %+v", iceQueueSize+1, c)
+	}
+}
+
+func TestOnError_CancelsWithCause(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	v := New(&mockPeer{}, cancel)
+	v.SetSignaler(&mockSignaler{})
+
+	errAuth := errors.New("auth failed")
+	v.OnError(errAuth)
+
+	if !errors.Is(context.Cause(ctx), errAuth) {
+		t.Errorf("expected cause %v, got %v", errAuth, context.Cause(ctx))
+	}
+}
+
+func TestOnSDPOffer_AnswersCameraOffer(t *testing.T) {
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	sig := &mockSignaler{}
+	peer := &mockPeer{answerSDP: "v=0\r\nanswer-sdp"}
+	v := New(peer, cancel)
+	v.SetSignaler(sig)
+
+	v.OnSDPOffer(domain.SDPPayload{Type: "offer", SDP: "v=0\r\noffer-sdp"})
+
+	if peer.offerAccepted != "v=0\r\noffer-sdp" {
+		t.Errorf("expected camera offer to be accepted, got %q", peer.offerAccepted)
+	}
+	if sig.sdpAnswerSent != "v=0\r\nanswer-sdp" {
+		t.Errorf("expected answer to be sent, got %q", sig.sdpAnswerSent)
+	}
+}
+
+func TestRoleAnswerer_WaitsForCameraOffer(t *testing.T) {
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	sig := &mockSignaler{}
+	v := New(&mockPeer{offerSDP: "v=0\r\ntest-sdp"}, cancel)
+	v.SetSignaler(sig)
+	v.SetRole(RoleAnswerer)
+
+	v.OnPeerIn()
+
+	if sig.sdpOfferSent != "" {
+		t.Errorf("expected no offer from answerer, got %q", sig.sdpOfferSent)
+	}
+}
+
+func TestRoleOfferer_IgnoresCameraOffer(t *testing.T) {
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	sig := &mockSignaler{}
+	peer := &mockPeer{}
+	v := New(peer, cancel)
+	v.SetSignaler(sig)
+	v.SetRole(RoleOfferer)
+
+	v.OnSDPOffer(domain.SDPPayload{Type: "offer", SDP: "v=0"})
+
+	if peer.offerAccepted != "" || sig.sdpAnswerSent != "" {
+		t.Error("expected offerer to ignore the camera offer")
+	}
+}
+
+func TestRenegotiate_OffersUnlessCameraOffered(t *testing.T) {
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	sig := &mockSignaler{}
+	peer := &mockPeer{offerSDP: "v=0\r\nrenegotiated"}
+	v := New(peer, cancel)
+	v.SetSignaler(sig)
+
+	v.Renegotiate()
+	if sig.sdpOfferSent != "v=0\r\nrenegotiated" {
+		t.Errorf("expected a new offer, got %q", sig.sdpOfferSent)
+	}
+
+	sig.sdpOfferSent = ""
+	v.OnSDPOffer(domain.SDPPayload{Type: "offer", SDP: "v=0"})
+	v.Renegotiate()
+	if sig.sdpOfferSent != "" {
+		t.Errorf("expected no offer after answering the camera, got %q", sig.sdpOfferSent)
+	}
+}
+
+func TestRestart_RejoinsThenOffersFromNewPeer(t *testing.T) {
+	_, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	sig := &mockSignaler{}
+	first := &mockPeer{offerSDP: "v=0\r\nfirst"}
+	v := New(first, cancel)
+	v.SetSignaler(sig)
+	v.OnPeerIn()
+
+	second := &mockPeer{offerSDP: "v=0\r\nsecond"}
+	if !v.Restart(second) {
+		t.Fatal("expected the offering viewer to restart")
+	}
+	if !sig.joinLiveCalled || sig.sdpOfferSent != "v=0\r\nfirst" {
+		t.Errorf("expected a new join and no offer before the camera's peer in, got join %v, offer %q", sig.joinLiveCalled, sig.sdpOfferSent)
+	}
+	v.OnPeerIn()
+	if sig.sdpOfferSent != "v=0\r\nsecond" {
+		t.Errorf("expected an offer from the new peer, got %q", sig.sdpOfferSent)
+	}
+	v.OnSDPAnswer(domain.SDPPayload{Type: "answer", SDP: "v=0"})
+	if first.remoteDescSet || !second.remoteDescSet {
+		t.Error("expected the answer applied to the new peer only")
+	}
+
+	v.OnSDPOffer(domain.SDPPayload{Type: "offer", SDP: "v=0"})
+	if v.Restart(&mockPeer{}) {
+		t.Error("expected no restart after answering the camera")
+	}
+}
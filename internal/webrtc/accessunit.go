@@ -0,0 +1,75 @@
+package webrtc
+
+// AccessUnit is the NAL units making up one coded picture, with the RTP
+// timestamp they share. PTS is that timestamp on the receiver's zero-based,
+// wrap-corrected 90 kHz timeline, for muxers that need monotonic times; it
+// is set by the receiver, not by the assembler.
+type AccessUnit struct {
+	Timestamp uint32
+	PTS       uint64
+	NALUs     [][]byte
+}
+
+// accessUnitDelimiter is an AUD NAL unit with primary_pic_type 7, which
+// allows any slice type, followed by the RBSP stop bit.
+var accessUnitDelimiter = []byte{naluTypeAUD, 0xf0}
+
+// withAUD returns nalus, the start of an access unit, with an access unit
+// delimiter in front unless it already has one. An end-of-sequence NAL
+// unit at the start belongs to the previous access unit and stays ahead
+// of the delimiter.
+func withAUD(nalus [][]byte) [][]byte {
+	i := 0
+	if len(nalus) > 0 && nalus[0][0]&0x1f == naluTypeEndOfSequence {
+		i = 1
+	}
+	if i < len(nalus) && nalus[i][0]&0x1f == naluTypeAUD {
+		return nalus
+	}
+	out := make([][]byte, 0, len(nalus)+1)
+	out = append(out, nalus[:i]...)
+	out = append(out, accessUnitDelimiter)
+	return append(out, nalus[i:]...)
+}
+
+// auAssembler groups depacketized NAL units into access units. The RTP
+// marker bit, which the sender sets on the last packet of a picture, ends
+// an access unit immediately. If the marker is lost, a change of RTP
+// timestamp ends it instead, one packet later.
+type auAssembler struct {
+	cur    AccessUnit
+	active bool
+}
+
+// Push adds the NAL units from one RTP packet and returns the access units
+// it completed, oldest first.
+func (a *auAssembler) Push(timestamp uint32, marker bool, nalus [][]byte) []AccessUnit {
+	var done []AccessUnit
+
+	if a.active && timestamp != a.cur.Timestamp {
+		done = append(done, a.flush()...)
+	}
+
+	if len(nalus) > 0 {
+		if !a.active {
+			a.cur.Timestamp = timestamp
+			a.active = true
+		}
+		a.cur.NALUs = append(a.cur.NALUs, nalus...)
+	}
+
+	if marker {
+		done = append(done, a.flush()...)
+	}
+	return done
+}
+
+func (a *auAssembler) flush() []AccessUnit {
+	if !a.active {
+		return nil
+	}
+	au := a.cur
+	a.cur = AccessUnit{}
+	a.active = false
+	return []AccessUnit{au}
+}
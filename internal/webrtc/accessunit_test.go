@@ -0,0 +1,115 @@
+package webrtc
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestAUAssembler_MarkerEndsAccessUnit(t *testing.T) {
+	a := &auAssembler{}
+
+	if aus := a.Push(1000, false, [][]byte{{0x67}, {0x68}}); aus != nil {
+		t.Fatalf("expected no access unit before marker, got %d", len(aus))
+	}
+	aus := a.Push(1000, true, [][]byte{{0x65}})
+	if len(aus) != 1 {
+		t.Fatalf("expected 1 access unit on marker, got %d", len(aus))
+	}
+	if aus[0].Timestamp != 1000 || len(aus[0].NALUs) != 3 {
+		t.Errorf("unexpected access unit: ts=%d nalus=%d", aus[0].Timestamp, len(aus[0].NALUs))
+	}
+}
+
+func TestAUAssembler_TimestampChangeEndsAccessUnit(t *testing.T) {
+	a := &auAssembler{}
+
+	// Marker bit lost on the last packet of the first picture.
+	a.Push(1000, false, [][]byte{{0x41}})
+	aus := a.Push(4000, false, [][]byte{{0x41}})
+	if len(aus) != 1 {
+		t.Fatalf("expected 1 access unit on timestamp change, got %d", len(aus))
+	}
+	if aus[0].Timestamp != 1000 {
+		t.Errorf("expected completed access unit ts=1000, got %d", aus[0].Timestamp)
+	}
+
+	aus = a.Push(4000, true, nil)
+	if len(aus) != 1 || aus[0].Timestamp != 4000 || len(aus[0].NALUs) != 1 {
+		t.Fatalf("expected second access unit on marker, got %+v", aus)
+	}
+}
+
+func TestAUAssembler_EmptyMarkerPacket(t *testing.T) {
+	a := &auAssembler{}
+
+	// A marker packet whose NAL units were all dropped emits nothing.
+	if aus := a.Push(1000, true, nil); aus != nil {
+		t.Errorf("expected no access unit, got %d", len(aus))
+	}
+}
+
+func TestWithAUD_AfterEndOfSequence(t *testing.T) {
+	eos := []byte{0x0a}
+	idr := []byte{0x65, 0x88}
+	got := withAUD([][]byte{eos, idr})
+	if len(got) != 3 || got[0][0] != 0x0a || got[1][0] != 0x09 || got[2][0] != 0x65 {
+		t.Errorf("expected EOS, AUD, IDR, got %x", got)
+	}
+}
+
+func TestVideoReceiver_InsertsAUD(t *testing.T) {
+	aud := []byte{0x09, 0xf0}
+	sps := []byte{0x67, 0x42, 0x00, 0x1f}
+	idr := []byte{0x65, 0x88, 0x84}
+	slice := []byte{0x41, 0x9a, 0x02}
+	type packet struct {
+		ts     uint32
+		marker bool
+		nalu   []byte
+	}
+	tests := []struct {
+		name       string
+		lowLatency bool
+		packets    []packet
+		want       []byte
+	}{
+		{"before each access unit", false,
+			[]packet{{3000, false, sps}, {3000, true, idr}, {6000, true, slice}},
+			annexB(aud, sps, idr, aud, slice)},
+		{"not twice", false,
+			[]packet{{3000, false, aud}, {3000, true, idr}, {6000, true, slice}},
+			annexB(aud, idr, aud, slice)},
+		{"low latency, on a new timestamp", true,
+			[]packet{{3000, false, sps}, {3000, true, idr}, {6000, true, slice}},
+			annexB(aud, sps, idr, aud, slice)},
+	}
+	for _, tt := range tests {
+		_, v := newTestReceiver(t, Options{InsertAUD: true, LowLatency: tt.lowLatency})
+		out := captureOutput(v)
+		for i, pkt := range tt.packets {
+			v.Handle(uint16(i), pkt.ts, pkt.marker, pkt.nalu)
+		}
+		if !bytes.Equal(out.Bytes(), tt.want) {
+			t.Errorf("%s: expected % x, got % x", tt.name, tt.want, out.Bytes())
+		}
+	}
+}
+
+func TestVideoReceiver_AccessUnitPTSAcrossWrap(t *testing.T) {
+	const frame = 3000
+	p, v := newTestReceiver(t, Options{})
+	captureOutput(v)
+	var got []uint64
+	p.SetOnAccessUnit(func(au AccessUnit) { got = append(got, au.PTS) })
+	idr := []byte{0x65, 0x88, 0x84}
+	for i, ts := range []uint32{1<<32 - 2*frame, 1<<32 - frame, 0, frame} {
+		v.Handle(uint16(i), ts, true, idr)
+	}
+	if want := []uint64{0, frame, 2 * frame, 3 * frame}; !slices.Equal(got, want) {
+		t.Errorf("expected PTS %v, got %v", want, got)
+	}
+	if want := timelineDuration(3 * frame); p.Stats().MediaTime != want {
+		t.Errorf("expected media time %s, got %s", want, p.Stats().MediaTime)
+	}
+}
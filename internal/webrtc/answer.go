@@ -0,0 +1,64 @@
+package webrtc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidateAnswer checks that an SDP answer lets the camera send H264
+// video: a video section with a non-zero port, a direction that includes
+// sending, and an H264 payload type among those it lists. A camera that
+// declines video still completes ICE and DTLS, so without this check the
+// session connects and then stays silent. Errors wrap ErrAnswerRejected.
+func ValidateAnswer(sdp string) error {
+	var (
+		found     bool
+		port      string
+		payloads  []string
+		direction = "sendrecv"
+		h264      = map[string]bool{}
+	)
+	inVideo := false
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "m="):
+			if found {
+				inVideo = false
+				continue
+			}
+			// m=video <port> <proto> <fmt> ...
+			fields := strings.Fields(strings.TrimPrefix(line, "m="))
+			inVideo = len(fields) >= 3 && fields[0] == "video"
+			if inVideo {
+				found = true
+				port = fields[1]
+				payloads = fields[3:]
+			}
+		case !inVideo:
+		case line == "a=sendrecv", line == "a=sendonly", line == "a=recvonly", line == "a=inactive":
+			direction = strings.TrimPrefix(line, "a=")
+		case strings.HasPrefix(line, "a=rtpmap:"):
+			// a=rtpmap:<pt> <encoding>/<clock rate>
+			pt, encoding, _ := strings.Cut(strings.TrimPrefix(line, "a=rtpmap:"), " ")
+			if strings.HasPrefix(strings.ToUpper(encoding), "H264/") {
+				h264[pt] = true
+			}
+		}
+	}
+
+	switch {
+	case !found:
+		return fmt.Errorf("%w: the answer has no video section", ErrAnswerRejected)
+	case port == "0":
+		return fmt.Errorf("%w: the camera rejected the video section (port 0)", ErrAnswerRejected)
+	case direction == "inactive" || direction == "recvonly":
+		return fmt.Errorf("%w: the camera answered video as %s, so it will not send any", ErrAnswerRejected, direction)
+	}
+	for _, pt := range payloads {
+		if h264[pt] {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no H264 payload among video formats %s", ErrAnswerRejected, strings.Join(payloads, " "))
+}
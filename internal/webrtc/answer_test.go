@@ -0,0 +1,34 @@
+package webrtc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateAnswer(t *testing.T) {
+	const audio = "m=audio 9 UDP/TLS/RTP/SAVPF 0\r\na=rtpmap:0 PCMU/8000\r\na=sendonly\r\n"
+	tests := []struct {
+		name string
+		sdp  string
+		ok   bool
+	}{
+		{"h264 sendonly", "v=0\r\n" + audio + "m=video 9 UDP/TLS/RTP/SAVPF 96\r\na=sendonly\r\na=rtpmap:96 H264/90000\r\n", true},
+		{"default direction", "v=0\r\nm=video 9 UDP/TLS/RTP/SAVPF 121\r\na=rtpmap:121 H264/90000\r\n", true},
+		{"audio only", "v=0\r\n" + audio, false},
+		{"port 0", "v=0\r\nm=video 0 UDP/TLS/RTP/SAVPF 96\r\na=rtpmap:96 H264/90000\r\n", false},
+		{"inactive", "v=0\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\na=inactive\r\na=rtpmap:96 H264/90000\r\n", false},
+		{"recvonly", "v=0\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\na=recvonly\r\na=rtpmap:96 H264/90000\r\n", false},
+		{"vp8 only", "v=0\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\na=sendonly\r\na=rtpmap:96 VP8/90000\r\n", false},
+		{"audio direction ignored", "v=0\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\na=rtpmap:96 H264/90000\r\n" +
+			"m=audio 9 UDP/TLS/RTP/SAVPF 0\r\na=inactive\r\n", true},
+	}
+	for _, tt := range tests {
+		err := ValidateAnswer(tt.sdp)
+		if tt.ok && err != nil {
+			t.Errorf("%s: expected valid, got %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrAnswerRejected) {
+			t.Errorf("%s: expected ErrAnswerRejected, got %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package webrtc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+// AudioInfo describes the negotiated audio stream.
+type AudioInfo struct {
+	MimeType    string
+	PayloadType uint8
+	ClockRate   uint32
+	Channels    uint16
+	// Supported is false for codecs the audio path cannot handle. Their
+	// packets are still read so the connection stays healthy.
+	Supported bool
+}
+
+// String formats the codec as e.g. "audio/PCMU pt=0 8000Hz".
+func (a AudioInfo) String() string {
+	if a.MimeType == "" {
+		return "-"
+	}
+	s := fmt.Sprintf("%s pt=%d %dHz", a.MimeType, a.PayloadType, a.ClockRate)
+	if a.Channels > 1 {
+		s += fmt.Sprintf(" %dch", a.Channels)
+	}
+	if !a.Supported {
+		s += " (unsupported)"
+	}
+	return s
+}
+
+// supportedAudioCodecs are the audio codecs with a handler. PCMU is the
+// only one registered with the media engine; others can still show up if
+// a camera ignores the negotiated payload types.
+var supportedAudioCodecs = []string{pion.MimeTypePCMU}
+
+// audioCodecSupported reports whether mimeType has a handler. MIME types
+// are compared case-insensitively, as SDP allows either case.
+func audioCodecSupported(mimeType string) bool {
+	for _, c := range supportedAudioCodecs {
+		if strings.EqualFold(mimeType, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// readAudioTrack records the audio codec and reads track until it ends.
+// There is no audio output yet, so every codec is drained; an unsupported
+// one is logged so it is known before audio output relies on it.
+func (p *Peer) readAudioTrack(track *pion.TrackRemote) {
+	codec := track.Codec()
+	info := AudioInfo{
+		MimeType:    codec.MimeType,
+		PayloadType: uint8(codec.PayloadType),
+		ClockRate:   codec.ClockRate,
+		Channels:    codec.Channels,
+		Supported:   audioCodecSupported(codec.MimeType),
+	}
+	p.updateStats(func(s *Stats) { s.Audio = info })
+	if info.Supported {
+		log.Printf("[webrtc] negotiated audio: %s", info)
+	} else {
+		log.Printf("[webrtc] warning: camera sends unsupported audio codec %s; audio is discarded", info)
+	}
+	drainTrack(track)
+}
@@ -0,0 +1,38 @@
+package webrtc
+
+import "testing"
+
+func TestAudioCodecSupported(t *testing.T) {
+	tests := []struct {
+		mime string
+		want bool
+	}{
+		{"audio/PCMU", true},
+		{"audio/pcmu", true},
+		{"audio/PCMA", false},
+		{"audio/opus", false},
+		{"audio/mpeg4-generic", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := audioCodecSupported(tt.mime); got != tt.want {
+			t.Errorf("%q: expected %v, got %v", tt.mime, tt.want, got)
+		}
+	}
+}
+
+func TestAudioInfo_String(t *testing.T) {
+	tests := []struct {
+		info AudioInfo
+		want string
+	}{
+		{AudioInfo{}, "-"},
+		{AudioInfo{MimeType: "audio/PCMU", ClockRate: 8000, Channels: 1, Supported: true}, "audio/PCMU pt=0 8000Hz"},
+		{AudioInfo{MimeType: "audio/opus", PayloadType: 111, ClockRate: 48000, Channels: 2}, "audio/opus pt=111 48000Hz 2ch (unsupported)"},
+	}
+	for _, tt := range tests {
+		if got := tt.info.String(); got != tt.want {
+			t.Errorf("expected %q, got %q", tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package webrtc
+
+import "time"
+
+// Windows the bitrate is reported over.
+const (
+	BitrateShortWindow = time.Second
+	BitrateLongWindow  = 10 * time.Second
+)
+
+// Bitrate is the video payload rate in bits per second over the last
+// BitrateShortWindow (Current) and BitrateLongWindow (Average). Shortly
+// after the stream starts, both cover only the time since then.
+type Bitrate struct {
+	Current float64
+	Average float64
+}
+
+// bitrateBucket is the resolution of a bitrateMeter.
+const bitrateBucket = 100 * time.Millisecond
+
+const bitrateBuckets = int(BitrateLongWindow / bitrateBucket)
+
+// bitrateMeter sums payload bytes into a ring of fixed time buckets
+// spanning BitrateLongWindow. Each slot remembers which bucket it holds,
+// so stale slots are recognised without clearing the ring.
+type bitrateMeter struct {
+	bytes [bitrateBuckets]uint64
+	slot  [bitrateBuckets]int64
+	first time.Time
+}
+
+func (m *bitrateMeter) add(now time.Time, n int) {
+	if m.first.IsZero() {
+		m.first = now
+	}
+	b := now.UnixNano() / int64(bitrateBucket)
+	i := b % int64(bitrateBuckets)
+	if m.slot[i] != b {
+		m.slot[i], m.bytes[i] = b, 0
+	}
+	m.bytes[i] += uint64(n)
+}
+
+// rate returns the bits per second received in the window ending at now.
+func (m *bitrateMeter) rate(now time.Time, window time.Duration) float64 {
+	if m.first.IsZero() {
+		return 0
+	}
+	cur := now.UnixNano() / int64(bitrateBucket)
+	buckets := int64(window / bitrateBucket)
+	var total uint64
+	for b := cur - buckets + 1; b <= cur; b++ {
+		if i := b % int64(bitrateBuckets); m.slot[i] == b {
+			total += m.bytes[i]
+		}
+	}
+	// The current bucket is only partly over.
+	span := time.Duration(buckets-1)*bitrateBucket + time.Duration(now.UnixNano()%int64(bitrateBucket))
+	if since := now.Sub(m.first); since < span {
+		span = since
+	}
+	if span < bitrateBucket {
+		span = bitrateBucket
+	}
+	return float64(total) * 8 / span.Seconds()
+}
+
+func (m *bitrateMeter) bitrate(now time.Time) Bitrate {
+	return Bitrate{Current: m.rate(now, BitrateShortWindow), Average: m.rate(now, BitrateLongWindow)}
+}
@@ -0,0 +1,46 @@
+package webrtc
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBitrateMeter_SlidingWindows(t *testing.T) {
+	var m bitrateMeter
+	start := time.Unix(1000, 0)
+
+	// 20s at 125 kB/s (1 Mbit/s), then 1s at 250 kB/s.
+	now := start
+	for ; now.Before(start.Add(20 * time.Second)); now = now.Add(10 * time.Millisecond) {
+		m.add(now, 1250)
+	}
+	for end := now.Add(time.Second); now.Before(end); now = now.Add(10 * time.Millisecond) {
+		m.add(now, 2500)
+	}
+
+	b := m.bitrate(now)
+	if math.Abs(b.Current-2e6) > 0.1e6 {
+		t.Errorf("expected current bitrate near 2 Mbit/s, got %.0f", b.Current)
+	}
+	if math.Abs(b.Average-1.1e6) > 0.1e6 {
+		t.Errorf("expected 10s average near 1.1 Mbit/s, got %.0f", b.Average)
+	}
+
+	// After the stream stops, both windows drain.
+	if b := m.bitrate(now.Add(11 * time.Second)); b.Current != 0 || b.Average != 0 {
+		t.Errorf("expected zero bitrate after 11s of silence, got %+v", b)
+	}
+}
+
+func TestBitrateMeter_ShortStream(t *testing.T) {
+	var m bitrateMeter
+	start := time.Unix(1000, 0)
+	for now := start; now.Before(start.Add(2 * time.Second)); now = now.Add(10 * time.Millisecond) {
+		m.add(now, 1250)
+	}
+	// Only 2s of data: the average covers those, not the full window.
+	if b := m.bitrate(start.Add(2 * time.Second)); math.Abs(b.Average-1e6) > 0.1e6 {
+		t.Errorf("expected average near 1 Mbit/s, got %.0f", b.Average)
+	}
+}
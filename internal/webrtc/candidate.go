@@ -0,0 +1,95 @@
+package webrtc
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Candidate is an ICE candidate attribute split into its fields, as in
+// RFC 8839 section 5.1.
+type Candidate struct {
+	Foundation string
+	Component  uint16
+	Protocol   string // "udp" or "tcp", lower-cased
+	Priority   uint32
+	// Address is an IP address, or an mDNS name ending in ".local" for a
+	// host candidate whose address is kept private.
+	Address string
+	Port    uint16
+	Type    string // "host", "srflx", "prflx" or "relay"
+	// RelatedAddress and RelatedPort are the base of a reflexive or relay
+	// candidate, if given.
+	RelatedAddress string
+	RelatedPort    uint16
+}
+
+// ParseCandidate parses an ICE candidate string, with or without the
+// "candidate:" or "a=candidate:" prefix. Extension attributes after the
+// related address, such as tcptype or generation, are ignored.
+func ParseCandidate(s string) (Candidate, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "a=")
+	s = strings.TrimPrefix(s, "candidate:")
+	fields := strings.Fields(s)
+	if len(fields) < 8 || fields[6] != "typ" {
+		return Candidate{}, fmt.Errorf("ICE candidate %q: want foundation component protocol priority address port typ type", s)
+	}
+	c := Candidate{
+		Foundation: fields[0],
+		Protocol:   strings.ToLower(fields[2]),
+		Address:    fields[4],
+		Type:       fields[7],
+	}
+	component, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return Candidate{}, fmt.Errorf("ICE candidate %q: component: %w", s, err)
+	}
+	c.Component = uint16(component)
+	priority, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return Candidate{}, fmt.Errorf("ICE candidate %q: priority: %w", s, err)
+	}
+	c.Priority = uint32(priority)
+	if c.Port, err = parsePort(fields[5]); err != nil {
+		return Candidate{}, fmt.Errorf("ICE candidate %q: port: %w", s, err)
+	}
+	for i := 8; i+1 < len(fields); i += 2 {
+		switch fields[i] {
+		case "raddr":
+			c.RelatedAddress = fields[i+1]
+		case "rport":
+			if c.RelatedPort, err = parsePort(fields[i+1]); err != nil {
+				return Candidate{}, fmt.Errorf("ICE candidate %q: rport: %w", s, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+func parsePort(s string) (uint16, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	return uint16(port), err
+}
+
+// isLoopbackAddress reports whether addr is a loopback address, including
+// IPv4-mapped ones, which the camera can never reach. mDNS names are not.
+func isLoopbackAddress(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	return err == nil && ip.Unmap().IsLoopback()
+}
+
+// String summarizes the candidate for logs, e.g. "srflx udp
+// 203.0.113.7:50000 via 192.168.1.2:50000".
+func (c Candidate) String() string {
+	s := fmt.Sprintf("%s %s %s", c.Type, c.Protocol, hostPort(c.Address, c.Port))
+	if c.RelatedAddress != "" {
+		s += " via " + hostPort(c.RelatedAddress, c.RelatedPort)
+	}
+	return s
+}
+
+func hostPort(addr string, port uint16) string {
+	return net.JoinHostPort(addr, strconv.Itoa(int(port)))
+}
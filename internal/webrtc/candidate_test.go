@@ -0,0 +1,91 @@
+package webrtc
+
+import "testing"
+
+func TestParseCandidate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Candidate
+	}{
+		{"candidate:2130706431 1 udp 2130706431 192.168.1.23 50123 typ host",
+			Candidate{Foundation: "2130706431", Component: 1, Protocol: "udp", Priority: 2130706431, Address: "192.168.1.23", Port: 50123, Type: "host"}},
+		{"a=candidate:842163049 1 UDP 1677729535 203.0.113.7 61234 typ srflx raddr 192.168.1.23 rport 50123 generation 0",
+			Candidate{Foundation: "842163049", Component: 1, Protocol: "udp", Priority: 1677729535, Address: "203.0.113.7", Port: 61234, Type: "srflx",
+				RelatedAddress: "192.168.1.23", RelatedPort: 50123}},
+		{"candidate:1 1 udp 16777215 198.51.100.4 3478 typ relay raddr 203.0.113.7 rport 61234",
+			Candidate{Foundation: "1", Component: 1, Protocol: "udp", Priority: 16777215, Address: "198.51.100.4", Port: 3478, Type: "relay",
+				RelatedAddress: "203.0.113.7", RelatedPort: 61234}},
+		{"candidate:3 1 tcp 1518280447 2001:db8::1 9 typ host tcptype active",
+			Candidate{Foundation: "3", Component: 1, Protocol: "tcp", Priority: 1518280447, Address: "2001:db8::1", Port: 9, Type: "host"}},
+		{"candidate:4 1 udp 2113937151 4b1c2a3e-5f6d-4e8a-9b0c-1d2e3f4a5b6c.local 54321 typ host",
+			Candidate{Foundation: "4", Component: 1, Protocol: "udp", Priority: 2113937151, Address: "4b1c2a3e-5f6d-4e8a-9b0c-1d2e3f4a5b6c.local", Port: 54321, Type: "host"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseCandidate(tt.in)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestParseCandidate_Rejects(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"candidate:1 1 udp 2130706431 192.168.1.23 50123",
+		"candidate:1 1 udp 2130706431 192.168.1.23 50123 type host",
+		"candidate:1 x udp 2130706431 192.168.1.23 50123 typ host",
+		"candidate:1 1 udp 99999999999 192.168.1.23 50123 typ host",
+		"candidate:1 1 udp 2130706431 192.168.1.23 70000 typ host",
+		"candidate:1 1 udp 1677729535 203.0.113.7 61234 typ srflx raddr 192.168.1.23 rport port",
+	} {
+		if _, err := ParseCandidate(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestIsLoopbackAddress(t *testing.T) {
+	tests := []struct {
+		addr     string
+		loopback bool
+	}{
+		{"127.0.0.1", true},
+		{"127.0.1.1", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"169.254.10.20", false},
+		{"fe80::1c2b:3aff:fe4d:5e6f", false},
+		{"192.168.1.23", false},
+		{"2001:db8::1", false},
+		{"host.local", false},
+	}
+	for _, tt := range tests {
+		if got := isLoopbackAddress(tt.addr); got != tt.loopback {
+			t.Errorf("%s: expected loopback %v, got %v", tt.addr, tt.loopback, got)
+		}
+	}
+}
+
+func TestCandidate_String(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"candidate:1 1 udp 2130706431 192.168.1.23 50123 typ host", "host udp 192.168.1.23:50123"},
+		{"candidate:3 1 tcp 1518280447 2001:db8::1 9 typ host tcptype active", "host tcp [2001:db8::1]:9"},
+		{"candidate:2 1 udp 1677729535 203.0.113.7 61234 typ srflx raddr 192.168.1.23 rport 50123",
+			"srflx udp 203.0.113.7:61234 via 192.168.1.23:50123"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCandidate(tt.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.in, err)
+		}
+		if got := c.String(); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
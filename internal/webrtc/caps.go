@@ -0,0 +1,95 @@
+package webrtc
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+)
+
+// Codec is a codec a peer offers, as it appears in the SDP.
+type Codec struct {
+	Kind        string // "audio" or "video"
+	PayloadType uint8
+	Name        string // e.g. "H264/90000"
+	Fmtp        string
+	Feedback    []string
+}
+
+// Capabilities is what a peer built with some Options registers.
+type Capabilities struct {
+	Codecs       []Codec
+	Extensions   []string // RTP header extension URIs
+	Interceptors []string
+}
+
+// ReadCapabilities builds a peer with opts, without connecting, and reports
+// the codecs and header extensions its offer carries and the interceptors
+// it registers.
+func ReadCapabilities(opts Options) (Capabilities, error) {
+	p, err := NewPeer(nil, "caps", opts)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	defer p.Close()
+	if err := p.AddTransceivers(); err != nil {
+		return Capabilities{}, err
+	}
+	offer, err := p.pc.CreateOffer(nil)
+	if err != nil {
+		return Capabilities{}, fmt.Errorf("create offer: %w", err)
+	}
+	var sd sdp.SessionDescription
+	if err := sd.Unmarshal([]byte(offer.SDP)); err != nil {
+		return Capabilities{}, fmt.Errorf("parse offer: %w", err)
+	}
+
+	caps := Capabilities{Interceptors: p.interceptors}
+	seen := map[string]bool{}
+	for _, md := range sd.MediaDescriptions {
+		kind := md.MediaName.Media
+		if kind != "audio" && kind != "video" {
+			continue
+		}
+		for _, f := range md.MediaName.Formats {
+			pt, err := strconv.ParseUint(f, 10, 8)
+			if err != nil || seen[kind+f] {
+				continue
+			}
+			seen[kind+f] = true
+			c, err := sd.GetCodecForPayloadType(uint8(pt))
+			if err != nil {
+				continue
+			}
+			var feedback []string
+			for _, fb := range c.RTCPFeedback {
+				feedback = append(feedback, strings.TrimSpace(fb))
+			}
+			name := fmt.Sprintf("%s/%d", c.Name, c.ClockRate)
+			if c.EncodingParameters != "" {
+				name += "/" + c.EncodingParameters
+			}
+			caps.Codecs = append(caps.Codecs, Codec{
+				Kind:        kind,
+				PayloadType: c.PayloadType,
+				Name:        name,
+				Fmtp:        c.Fmtp,
+				Feedback:    feedback,
+			})
+		}
+		for _, a := range md.Attributes {
+			if a.Key != "extmap" {
+				continue
+			}
+			// a=extmap:<id> <uri>
+			if _, uri, ok := strings.Cut(a.Value, " "); ok && !slices.Contains(caps.Extensions, uri) {
+				caps.Extensions = append(caps.Extensions, uri)
+			}
+		}
+	}
+	// Pion registers extensions from a map, so their order varies.
+	slices.Sort(caps.Extensions)
+	return caps, nil
+}
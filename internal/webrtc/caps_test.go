@@ -0,0 +1,51 @@
+package webrtc
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadCapabilities(t *testing.T) {
+	tests := []struct {
+		opts      Options
+		wantPCMU  bool
+		wantNACK  bool
+		wantNames int
+	}{
+		{Options{}, true, true, 5},
+		{Options{NoAudio: true}, false, true, 5},
+		{Options{NACK: NACKNoResponder}, true, true, 4},
+		{Options{NACK: NACKOff}, true, false, 3},
+	}
+	for _, tt := range tests {
+		caps, err := ReadCapabilities(tt.opts)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.opts, err)
+		}
+		var h264, pcmu *Codec
+		for i, c := range caps.Codecs {
+			switch c.Name {
+			case "H264/90000":
+				h264 = &caps.Codecs[i]
+			case "PCMU/8000/1":
+				pcmu = &caps.Codecs[i]
+			}
+		}
+		if h264 == nil || !strings.Contains(h264.Fmtp, "packetization-mode=0") {
+			t.Fatalf("%+v: expected H264 with its fmtp, got %+v", tt.opts, caps.Codecs)
+		}
+		if got := pcmu != nil; got != tt.wantPCMU {
+			t.Errorf("%+v: expected PCMU %v, got %v", tt.opts, tt.wantPCMU, got)
+		}
+		if got := slices.Contains(h264.Feedback, "nack"); got != tt.wantNACK {
+			t.Errorf("%+v: expected nack feedback %v, got %v", tt.opts, tt.wantNACK, h264.Feedback)
+		}
+		if !slices.Contains(h264.Feedback, "nack pli") {
+			t.Errorf("%+v: expected PLI feedback, got %v", tt.opts, h264.Feedback)
+		}
+		if len(caps.Interceptors) != tt.wantNames {
+			t.Errorf("%+v: expected %d interceptors, got %v", tt.opts, tt.wantNames, caps.Interceptors)
+		}
+	}
+}
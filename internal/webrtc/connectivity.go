@@ -0,0 +1,181 @@
+package webrtc
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+// CandidateCounts counts ICE candidates by type ("host", "srflx", "prflx"
+// or "relay").
+type CandidateCounts map[string]int
+
+// Total returns the number of candidates of any type.
+func (c CandidateCounts) Total() int {
+	n := 0
+	for _, v := range c {
+		n += v
+	}
+	return n
+}
+
+// String lists the counts from the most to the least direct type, e.g.
+// "2 host, 1 srflx", or "none".
+func (c CandidateCounts) String() string {
+	types := make([]string, 0, len(c))
+	for typ := range c {
+		types = append(types, typ)
+	}
+	order := []string{"host", "srflx", "prflx", "relay"}
+	slices.SortFunc(types, func(a, b string) int {
+		ia, ib := slices.Index(order, a), slices.Index(order, b)
+		if ia < 0 {
+			ia = len(order)
+		}
+		if ib < 0 {
+			ib = len(order)
+		}
+		if ia != ib {
+			return ia - ib
+		}
+		return strings.Compare(a, b)
+	})
+	parts := make([]string, 0, len(types))
+	for _, typ := range types {
+		parts = append(parts, fmt.Sprintf("%d %s", c[typ], typ))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ConnectivityReport is how far a peer's ICE got, for troubleshooting a
+// session that never connected.
+type ConnectivityReport struct {
+	// Connected is whether the peer connection ever reached connected.
+	Connected bool
+	// RemoteDescription is whether the camera's offer or answer was
+	// applied, without which ICE does not start.
+	RemoteDescription bool
+	// Gathered counts the local candidates found, Sent those sent to the
+	// camera after filtering and Received the camera's the peer took,
+	// trickled or in its SDP.
+	Gathered CandidateCounts
+	Sent     CandidateCounts
+	Received CandidateCounts
+	// ICEState is the furthest ICE state reached, and ICEFinal the one
+	// at the time of the report.
+	ICEState string
+	ICEFinal string
+	// Pairs and PairsSucceeded count the candidate pairs checked.
+	Pairs          int
+	PairsSucceeded int
+	// SelectedPair describes the pair in use, or is empty.
+	SelectedPair string
+}
+
+// connectivity is what ConnectivityReport needs that pion does not
+// keep, under the peer's statsMu.
+type connectivity struct {
+	gathered, sent, received CandidateCounts
+	iceReached               pion.ICEConnectionState
+	connected                bool
+}
+
+// iceProgress orders the ICE states a successful connection passes
+// through.
+var iceProgress = []pion.ICEConnectionState{
+	pion.ICEConnectionStateNew,
+	pion.ICEConnectionStateChecking,
+	pion.ICEConnectionStateConnected,
+	pion.ICEConnectionStateCompleted,
+}
+
+// reachICEState records state if it is further along than any before.
+func (c *connectivity) reachICEState(state pion.ICEConnectionState) {
+	if slices.Index(iceProgress, state) > slices.Index(iceProgress, c.iceReached) {
+		c.iceReached = state
+	}
+}
+
+// countCandidate adds the candidate string s to counts by its type.
+func countCandidate(counts CandidateCounts, s string) {
+	typ := "unparsed"
+	if c, err := ParseCandidate(s); err == nil {
+		typ = c.Type
+	}
+	counts[typ]++
+}
+
+// countSDPCandidates adds the a=candidate lines of sdp to counts, for
+// cameras that put their candidates in the SDP instead of trickling them.
+func countSDPCandidates(counts CandidateCounts, sdp string) {
+	for _, line := range strings.Split(sdp, "\n") {
+		if c, ok := strings.CutPrefix(strings.TrimSpace(line), "a="); ok && strings.HasPrefix(c, "candidate:") {
+			countCandidate(counts, c)
+		}
+	}
+}
+
+// ConnectivityReport returns how far ICE got. Call it before Close.
+func (p *Peer) ConnectivityReport() ConnectivityReport {
+	p.statsMu.Lock()
+	r := ConnectivityReport{
+		Connected: p.ice.connected,
+		Gathered:  maps.Clone(p.ice.gathered),
+		Sent:      maps.Clone(p.ice.sent),
+		Received:  maps.Clone(p.ice.received),
+		ICEState:  p.ice.iceReached.String(),
+		ICEFinal:  p.stats.ICEState,
+	}
+	p.statsMu.Unlock()
+	if r.ICEFinal == "" {
+		r.ICEFinal = r.ICEState
+	}
+
+	select {
+	case <-p.remoteDescSet:
+		r.RemoteDescription = true
+	default:
+	}
+	for _, st := range p.pcStats() {
+		if cp, ok := st.(pion.ICECandidatePairStats); ok {
+			r.Pairs++
+			if cp.State == pion.StatsICECandidatePairStateSucceeded {
+				r.PairsSucceeded++
+			}
+		}
+	}
+	if pair, err := p.pc.SCTP().Transport().ICETransport().GetSelectedCandidatePair(); err == nil && pair != nil {
+		r.SelectedPair = fmt.Sprintf("%s %s %s:%d to %s %s %s:%d",
+			pair.Local.Typ, pair.Local.Protocol, pair.Local.Address, pair.Local.Port,
+			pair.Remote.Typ, pair.Remote.Protocol, pair.Remote.Address, pair.Remote.Port)
+	}
+	return r
+}
+
+// LikelyCause guesses why a peer that never connected failed, from the
+// first missing step, or returns "" if it connected or nothing stands out.
+func (r ConnectivityReport) LikelyCause() string {
+	switch {
+	case r.Connected:
+		return ""
+	case !r.RemoteDescription:
+		return "the camera never answered the offer, so ICE did not start; check that it is online and awake"
+	case r.Gathered.Total() == 0:
+		return "no local candidates were gathered; check the network interfaces and -udp-port-range"
+	case r.Sent.Total() == 0:
+		return "every local candidate was filtered out; check -ice-candidates"
+	case r.Received.Total() == 0:
+		return "the camera sent no ICE candidates"
+	case r.Gathered["srflx"] == 0 && r.Gathered["relay"] == 0:
+		return "only host candidates were gathered, so only a camera on the same network can connect; check the STUN and TURN servers with -ice-test"
+	case r.PairsSucceeded == 0:
+		return "no connectivity check succeeded; a firewall or NAT is likely blocking UDP between the two sides, which a TURN server over TCP or TLS may get through (-ice-server)"
+	}
+	return ""
+}
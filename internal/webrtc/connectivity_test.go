@@ -0,0 +1,112 @@
+package webrtc
+
+import (
+	"strings"
+	"testing"
+
+	"vico_home/native/internal/domain"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+func TestCandidateCounts_String(t *testing.T) {
+	tests := []struct {
+		counts CandidateCounts
+		want   string
+	}{
+		{nil, "none"},
+		{CandidateCounts{"relay": 1, "host": 2, "srflx": 1}, "2 host, 1 srflx, 1 relay"},
+		{CandidateCounts{"unparsed": 1, "prflx": 3}, "3 prflx, 1 unparsed"},
+	}
+	for _, tt := range tests {
+		if got := tt.counts.String(); got != tt.want {
+			t.Errorf("%v: expected %q, got %q", map[string]int(tt.counts), tt.want, got)
+		}
+	}
+}
+
+func TestConnectivity_CountsAndFurthestState(t *testing.T) {
+	c := connectivity{received: CandidateCounts{}, iceReached: pion.ICEConnectionStateNew}
+	countCandidate(c.received, "candidate:1 1 udp 2130706431 192.168.1.23 50123 typ host")
+	countCandidate(c.received, "candidate:2 1 udp 1677729535 203.0.113.7 61234 typ srflx raddr 192.168.1.23 rport 50123")
+	countCandidate(c.received, "garbage")
+	if got, want := c.received.String(), "1 host, 1 srflx, 1 unparsed"; got != want {
+		t.Errorf("expected received %q, got %q", want, got)
+	}
+
+	for _, state := range []pion.ICEConnectionState{
+		pion.ICEConnectionStateChecking, pion.ICEConnectionStateFailed, pion.ICEConnectionStateClosed,
+	} {
+		c.reachICEState(state)
+	}
+	if c.iceReached != pion.ICEConnectionStateChecking {
+		t.Errorf("expected checking as the furthest state, got %s", c.iceReached)
+	}
+}
+
+func TestConnectivityReport_LikelyCause(t *testing.T) {
+	host := CandidateCounts{"host": 2}
+	all := CandidateCounts{"host": 2, "srflx": 1}
+	tests := []struct {
+		name string
+		r    ConnectivityReport
+		want string
+	}{
+		{"connected", ConnectivityReport{Connected: true}, ""},
+		{"no answer", ConnectivityReport{}, "the camera never answered"},
+		{"nothing gathered", ConnectivityReport{RemoteDescription: true}, "no local candidates"},
+		{"all filtered", ConnectivityReport{RemoteDescription: true, Gathered: all}, "every local candidate was filtered"},
+		{"camera silent", ConnectivityReport{RemoteDescription: true, Gathered: all, Sent: all}, "the camera sent no ICE candidates"},
+		{"host only", ConnectivityReport{RemoteDescription: true, Gathered: host, Sent: host, Received: all}, "only host candidates"},
+		{"checks failed", ConnectivityReport{RemoteDescription: true, Gathered: all, Sent: all, Received: all, Pairs: 4}, "no connectivity check succeeded"},
+		{"unclear", ConnectivityReport{RemoteDescription: true, Gathered: all, Sent: all, Received: all, Pairs: 4, PairsSucceeded: 1}, ""},
+	}
+	for _, tt := range tests {
+		got := tt.r.LikelyCause()
+		if (tt.want == "") != (got == "") || !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: expected a cause starting %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestPeer_ConnectivityReportBeforeNegotiation(t *testing.T) {
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+
+	r := p.ConnectivityReport()
+	if r.Connected || r.RemoteDescription || r.ICEState != "new" || r.ICEFinal != "new" || r.Gathered.Total() != 0 {
+		t.Errorf("expected an unconnected report in the new state, got %+v", r)
+	}
+}
+
+func TestPeer_CountsCandidatesInSDPAndOnlyAddedTrickled(t *testing.T) {
+	camera, err := pion.NewPeerConnection(pion.Configuration{})
+	if err != nil {
+		t.Fatalf("create camera peer connection: %v", err)
+	}
+	defer camera.Close()
+	if _, err := camera.AddTransceiverFromKind(pion.RTPCodecTypeVideo, pion.RTPTransceiverInit{Direction: pion.RTPTransceiverDirectionSendonly}); err != nil {
+		t.Fatalf("camera: add video: %v", err)
+	}
+	offer, err := camera.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("camera: create offer: %v", err)
+	}
+	sdp := offer.SDP +
+		"a=candidate:1 1 udp 2130706431 192.168.1.23 50123 typ host\r\n" +
+		"a=candidate:2 1 udp 1677729535 203.0.113.7 61234 typ srflx raddr 192.168.1.23 rport 50123\r\n"
+
+	p := newTestPeer(t, Options{})
+	if _, err := p.AcceptOffer(domain.SDPPayload{Type: "offer", SDP: sdp}); err != nil {
+		t.Fatalf("accept offer: %v", err)
+	}
+	if err := p.AddRemoteICECandidate(domain.ICECandidatePayload{Candidate: "candidate:3 1 udp 1 bogus"}); err == nil {
+		t.Fatal("expected a malformed candidate rejected")
+	}
+	if got, want := p.ConnectivityReport().Received.String(), "1 host, 1 srflx"; got != want {
+		t.Errorf("expected received %q, got %q", want, got)
+	}
+}
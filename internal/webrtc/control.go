@@ -0,0 +1,108 @@
+package webrtc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ControlMessage is a message from the camera on the control DataChannel,
+// such as the acknowledgement of startLive or an unsolicited status or
+// error report. The camera's fields are not documented; the common ones
+// are decoded and everything else is left in Data and Raw. Firmware
+// differs in whether it sends requestID and result as numbers or
+// strings, so either is accepted.
+type ControlMessage struct {
+	Action    string          `json:"action"`
+	RequestID string          `json:"requestID"`
+	Result    int             `json:"result"`
+	Msg       string          `json:"msg"`
+	Data      json.RawMessage `json:"data"`
+
+	// Raw is the message exactly as received.
+	Raw []byte `json:"-"`
+	// StartLive is set by the peer when the message answers the main
+	// stream's startLive: its request ID matches, or the camera echoes no
+	// ID and the action is startLive.
+	StartLive bool `json:"-"`
+}
+
+// UnmarshalJSON decodes m, taking requestID and result as either JSON
+// numbers or strings.
+func (m *ControlMessage) UnmarshalJSON(data []byte) error {
+	type plain ControlMessage
+	var v struct {
+		*plain
+		RequestID json.RawMessage `json:"requestID"`
+		Result    json.RawMessage `json:"result"`
+	}
+	v.plain = (*plain)(m)
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	id, err := unquote(v.RequestID)
+	if err != nil {
+		return fmt.Errorf("requestID: %w", err)
+	}
+	m.RequestID = id
+	result, err := unquote(v.Result)
+	if err != nil {
+		return fmt.Errorf("result: %w", err)
+	}
+	if result != "" {
+		if m.Result, err = strconv.Atoi(result); err != nil {
+			return fmt.Errorf("result: %w", err)
+		}
+	}
+	return nil
+}
+
+// unquote returns the text of a JSON string or number, and "" for a
+// missing field or null.
+func unquote(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", nil
+	}
+	if raw[0] == '"' {
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return "", err
+	}
+	return n.String(), nil
+}
+
+// Failed reports whether the camera marked the message as an error.
+func (m ControlMessage) Failed() bool {
+	return m.Result != 0
+}
+
+// String formats the message for logs, e.g. "startLive result=-1 (busy)".
+func (m ControlMessage) String() string {
+	if m.Action == "" {
+		return string(m.Raw)
+	}
+	s := fmt.Sprintf("%s result=%d", m.Action, m.Result)
+	if m.Msg != "" {
+		s += " (" + m.Msg + ")"
+	}
+	return s
+}
+
+// ParseControlMessage decodes a DataChannel message. On error the
+// returned message still carries Raw, so callers can pass on messages
+// that are not the expected JSON.
+func ParseControlMessage(data []byte) (ControlMessage, error) {
+	var m ControlMessage
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		m = ControlMessage{}
+		err = fmt.Errorf("decode control message: %w", err)
+	}
+	m.Raw = append([]byte(nil), data...)
+	return m, err
+}
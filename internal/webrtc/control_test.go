@@ -0,0 +1,118 @@
+package webrtc
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+)
+
+func TestParseControlMessage_DecodesKnownFields(t *testing.T) {
+	raw := []byte(`{"action":"startLive","requestID":"1700000000000","result":-1,"msg":"busy","data":{"battery":80}}`)
+
+	m, err := ParseControlMessage(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.Action != "startLive" || m.RequestID != "1700000000000" || m.Result != -1 || m.Msg != "busy" {
+		t.Errorf("unexpected fields: %+v", m)
+	}
+	if !m.Failed() {
+		t.Error("expected a non-zero result to count as failed")
+	}
+	if string(m.Data) != `{"battery":80}` {
+		t.Errorf("expected data to be kept verbatim, got %s", m.Data)
+	}
+	if !bytes.Equal(m.Raw, raw) {
+		t.Errorf("expected raw message to be kept, got %s", m.Raw)
+	}
+}
+
+func TestParseControlMessage_NumbersOrStrings(t *testing.T) {
+	tests := []struct {
+		raw     string
+		wantID  string
+		wantRes int
+		wantErr bool
+	}{
+		{`{"action":"startLive","requestID":"1700000000000","result":"-1"}`, "1700000000000", -1, false},
+		{`{"action":"startLive","requestID":1700000000000,"result":0}`, "1700000000000", 0, false},
+		{`{"action":"startLive","requestID":null}`, "", 0, false},
+		{`{"action":"startLive","result":"busy"}`, "", 0, true},
+		{`{"action":"startLive","requestID":true}`, "", 0, true},
+	}
+	for _, tt := range tests {
+		m, err := ParseControlMessage([]byte(tt.raw))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tt.raw, tt.wantErr, err)
+			continue
+		}
+		if m.RequestID != tt.wantID || m.Result != tt.wantRes {
+			t.Errorf("%s: expected requestID %q and result %d, got %q and %d", tt.raw, tt.wantID, tt.wantRes, m.RequestID, m.Result)
+		}
+		if !tt.wantErr && m.Action != "startLive" {
+			t.Errorf("%s: expected the action to be decoded too, got %q", tt.raw, m.Action)
+		}
+	}
+}
+
+func TestParseControlMessage_KeepsRawOnInvalidJSON(t *testing.T) {
+	raw := []byte("pong")
+
+	m, err := ParseControlMessage(raw)
+	if err == nil {
+		t.Fatal("expected an error for non-JSON input")
+	}
+	if !bytes.Equal(m.Raw, raw) || m.Action != "" {
+		t.Errorf("expected only Raw to be set, got %+v", m)
+	}
+	if m.String() != "pong" {
+		t.Errorf("expected String to fall back to the raw text, got %q", m.String())
+	}
+}
+
+func TestNextRequestID_DistinctWithinOneMillisecond(t *testing.T) {
+	p := newTestPeer(t, Options{})
+	now := time.Unix(1700000000, 0)
+	p.SetClock(clock.NewFake(now))
+
+	first, second := p.nextRequestID(), p.nextRequestID()
+	if first != now.UnixMilli() {
+		t.Errorf("expected the first ID to be the time, %d, got %d", now.UnixMilli(), first)
+	}
+	if second <= first {
+		t.Errorf("expected a second ID after %d, got %d", first, second)
+	}
+}
+
+func TestHandleControlMessage_KeepsPreviewReplies(t *testing.T) {
+	p := newTestPeer(t, Options{})
+	p.previewRequestID.Store(1700000000001)
+	var got []string
+	p.SetOnControlMessage(func(m ControlMessage) { got = append(got, m.RequestID) })
+
+	p.handleControlMessage([]byte(`{"action":"startLive","requestID":"1700000000000","result":0}`))
+	p.handleControlMessage([]byte(`{"action":"startLive","requestID":"1700000000001","result":-1}`))
+
+	if len(got) != 1 || got[0] != "1700000000000" {
+		t.Errorf("expected only the main startLive reply to be delivered, got %v", got)
+	}
+}
+
+func TestHandleControlMessage_MarksStartLiveReply(t *testing.T) {
+	p := newTestPeer(t, Options{})
+	p.mainRequestID.Store(1700000000000)
+	var got []bool
+	p.SetOnControlMessage(func(m ControlMessage) { got = append(got, m.StartLive) })
+
+	p.handleControlMessage([]byte(`{"action":"startLive","requestID":1700000000000,"result":"-1"}`))
+	p.handleControlMessage([]byte(`{"action":"startLive","requestID":"1699999999999","result":-1}`))
+	p.handleControlMessage([]byte(`{"action":"startLive","result":-1}`))
+	p.handleControlMessage([]byte(`{"action":"getStatus","result":0}`))
+
+	if want := []bool{true, false, true, false}; !slices.Equal(got, want) {
+		t.Errorf("expected StartLive %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,48 @@
+package webrtc
+
+import (
+	"log"
+
+	pionlog "github.com/pion/logging"
+
+	"vico_home/native/internal/logging"
+)
+
+// pionScopes maps each debug namespace to the pion logger scopes it
+// raises to debug level.
+var pionScopes = map[string][]string{
+	logging.ICE:         {"ice", "agent", "mdns", "turn", "turnc", "tcp-packet-conn"},
+	logging.DTLS:        {"dtls", "DTLSTransport", "srtp"},
+	logging.DataChannel: {"sctp", "datachannel"},
+}
+
+// logWriter hands pion's log lines to the standard logger, so they land
+// on stderr or -log-file instead of pion's default stdout, which may be
+// the video stream.
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	log.Print(string(p))
+	return len(p), nil
+}
+
+// pionLoggerFactory returns the logger factory for pion, writing through
+// logWriter at warning level and raising the scopes of the enabled debug
+// namespaces to debug. It is always installed: pion's own default writes
+// to stdout.
+func pionLoggerFactory() pionlog.LoggerFactory {
+	levels := make(map[string]pionlog.LogLevel)
+	for ns, scopes := range pionScopes {
+		if !logging.DebugEnabled(ns) {
+			continue
+		}
+		for _, scope := range scopes {
+			levels[scope] = pionlog.LogLevelDebug
+		}
+	}
+	return &pionlog.DefaultLoggerFactory{
+		Writer:          logWriter{},
+		DefaultLogLevel: pionlog.LogLevelWarn,
+		ScopeLevels:     levels,
+	}
+}
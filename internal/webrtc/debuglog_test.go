@@ -0,0 +1,35 @@
+package webrtc
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"vico_home/native/internal/logging"
+)
+
+func TestPionLoggerFactory_WarnsThroughLogByDefault(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		logging.SetDebug(nil)
+	}()
+
+	logging.SetDebug(nil)
+	ice := pionLoggerFactory().NewLogger("ice")
+	ice.Warn("warning 1")
+	ice.Debug("debug 1")
+	if got := buf.String(); !strings.Contains(got, "warning 1") || strings.Contains(got, "debug 1") {
+		t.Errorf("expected only the warning logged, got %q", got)
+	}
+
+	logging.SetDebug([]string{logging.ICE})
+	pionLoggerFactory().NewLogger("ice").Debug("debug 2")
+	pionLoggerFactory().NewLogger("dtls").Debug("debug 3")
+	if got := buf.String(); !strings.Contains(got, "debug 2") || strings.Contains(got, "debug 3") {
+		t.Errorf("expected debug logged for the enabled namespace only, got %q", got)
+	}
+}
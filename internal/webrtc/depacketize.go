@@ -1,5 +1,11 @@
 package webrtc
 
+import "bytes"
+
+// DefaultMaxReassemblySize is the default cap on a NAL unit reassembled from
+// FU-A fragments. It is far above any real 1080p IDR slice.
+const DefaultMaxReassemblySize = 4 << 20
+
 // H264Depacketizer extracts NAL units from RTP H264 payloads.
 // It maintains instance state for FU-A fragment reassembly,
 // preventing corruption when multiple streams are active.
@@ -7,20 +13,60 @@ type H264Depacketizer struct {
 	fuaBuf      []byte
 	fuaStarted  bool
 	expectedSeq uint16
+	maxSize     int
+	stats       DepacketizerStats
+}
+
+// DepacketizerStats counts what the depacketizer has seen and produced.
+type DepacketizerStats struct {
+	Packets      uint64 // payloads passed to Depacketize
+	NALUs        uint64 // NAL units returned
+	FUACompleted uint64 // FU-A chains reassembled into a NAL unit
+	FUADropped   uint64 // FU-A chains abandoned due to a sequence gap
+	FUAOrphans   uint64 // FU-A fragments received without a start fragment
+	FUAOversize  uint64 // FU-A chains abandoned for exceeding the size cap
+	ForbiddenBit uint64 // NAL headers with the forbidden zero bit set
+	InvalidType  uint64 // NAL headers with type 0 or reserved type 30/31
+	Unsupported  uint64 // packets of a valid but unhandled type (STAP-B, MTAP, FU-B)
 }
 
 // NewH264Depacketizer creates a new depacketizer with its own reassembly buffer.
 func NewH264Depacketizer() *H264Depacketizer {
-	return &H264Depacketizer{}
+	return &H264Depacketizer{maxSize: DefaultMaxReassemblySize}
+}
+
+// SetMaxReassemblySize caps the size of a NAL unit reassembled from FU-A
+// fragments. A chain that grows past n bytes is dropped. n <= 0 restores
+// the default.
+func (d *H264Depacketizer) SetMaxReassemblySize(n int) {
+	if n <= 0 {
+		n = DefaultMaxReassemblySize
+	}
+	d.maxSize = n
+}
+
+// Stats returns a snapshot of the depacketizer counters.
+func (d *H264Depacketizer) Stats() DepacketizerStats {
+	return d.stats
 }
 
 // Depacketize extracts NAL units from an RTP H264 payload.
 // Handles single NAL, STAP-A, and FU-A packet types.
 func (d *H264Depacketizer) Depacketize(sequenceNumber uint16, payload []byte) [][]byte {
+	nalus := d.depacketize(sequenceNumber, payload)
+	d.stats.Packets++
+	d.stats.NALUs += uint64(len(nalus))
+	return nalus
+}
+
+func (d *H264Depacketizer) depacketize(sequenceNumber uint16, payload []byte) [][]byte {
 	if len(payload) < 1 {
 		return nil
 	}
 
+	if !d.validHeader(payload[0]) {
+		return nil
+	}
 	naluType := payload[0] & 0x1f
 
 	switch {
@@ -34,10 +80,27 @@ func (d *H264Depacketizer) Depacketize(sequenceNumber uint16, payload []byte) []
 		return d.depacketizeFUA(sequenceNumber, payload)
 
 	default:
+		d.stats.Unsupported++
 		return nil
 	}
 }
 
+// validHeader reports whether a NAL (or payload) header byte is usable,
+// counting the reason if not. A set forbidden zero bit (bit 7) signals a
+// bit error; type 0 is unspecified and 30/31 are reserved.
+func (d *H264Depacketizer) validHeader(header byte) bool {
+	if header&0x80 != 0 {
+		d.stats.ForbiddenBit++
+		return false
+	}
+	switch header & 0x1f {
+	case 0, 30, 31:
+		d.stats.InvalidType++
+		return false
+	}
+	return true
+}
+
 func (d *H264Depacketizer) depacketizeSTAPA(payload []byte) [][]byte {
 	var nalus [][]byte
 	offset := 1 // skip STAP-A header byte
@@ -51,8 +114,18 @@ func (d *H264Depacketizer) depacketizeSTAPA(payload []byte) [][]byte {
 		if offset+size > len(payload) {
 			break
 		}
-		nalus = append(nalus, payload[offset:offset+size])
+		nalu := payload[offset : offset+size]
 		offset += size
+		if !d.validHeader(nalu[0]) {
+			continue
+		}
+		// Aggregated NAL units must themselves be single NAL types; a
+		// nested STAP or FU would reach the output as an unknown type.
+		if nalu[0]&0x1f > 23 {
+			d.stats.InvalidType++
+			continue
+		}
+		nalus = append(nalus, nalu)
 	}
 	return nalus
 }
@@ -69,42 +142,105 @@ func (d *H264Depacketizer) depacketizeFUA(sequenceNumber uint16, payload []byte)
 	naluType := fuHeader & 0x1f
 
 	if start {
+		// A new start while a chain is in progress means its end was lost.
+		if d.fuaStarted {
+			d.resetFUA()
+			d.stats.FUADropped++
+		}
+		// The fragmented NAL's type must itself be a single NAL type.
+		if naluType == 0 || naluType > 23 {
+			d.stats.InvalidType++
+			return nil
+		}
+
 		// Reconstruct NAL header: F+NRI from FU indicator + type from FU header
 		d.fuaBuf = []byte{fnri | naluType}
 		d.fuaStarted = true
 		d.expectedSeq = sequenceNumber + 1
-		d.fuaBuf = append(d.fuaBuf, payload[2:]...)
+		if !d.appendFUA(payload[2:]) {
+			return nil
+		}
 
+		// A start fragment with the end bit also set is a complete NAL
+		// in a single packet.
 		if end {
-			nalu := d.fuaBuf
-			d.fuaBuf = nil
-			d.fuaStarted = false
-			return [][]byte{nalu}
+			return d.finishFUA()
 		}
 		return nil
 	}
 
 	// Drop orphan middle/end fragments.
 	if !d.fuaStarted {
+		d.stats.FUAOrphans++
 		return nil
 	}
 
 	// Sequence discontinuity means a missing/reordered fragment. Drop this NAL.
+	// expectedSeq is computed in uint16, so it wraps from 65535 to 0 exactly
+	// as RTP sequence numbers do and a chain spanning the wrap is contiguous.
 	if sequenceNumber != d.expectedSeq {
-		d.fuaBuf = nil
-		d.fuaStarted = false
+		d.resetFUA()
+		d.stats.FUADropped++
 		return nil
 	}
 
 	d.expectedSeq = sequenceNumber + 1
-	d.fuaBuf = append(d.fuaBuf, payload[2:]...)
+	if !d.appendFUA(payload[2:]) {
+		return nil
+	}
 
 	if end {
-		nalu := d.fuaBuf
-		d.fuaBuf = nil
-		d.fuaStarted = false
-		return [][]byte{nalu}
+		return d.finishFUA()
 	}
 
 	return nil
 }
+
+// appendFUA adds fragment data to the reassembly buffer. If that would
+// exceed the size cap the chain is dropped and appendFUA returns false.
+func (d *H264Depacketizer) appendFUA(data []byte) bool {
+	if len(d.fuaBuf)+len(data) > d.maxSize {
+		d.resetFUA()
+		d.stats.FUAOversize++
+		return false
+	}
+	d.fuaBuf = append(d.fuaBuf, data...)
+	return true
+}
+
+// finishFUA returns the reassembled NAL and clears the reassembly state.
+func (d *H264Depacketizer) finishFUA() [][]byte {
+	nalu := d.fuaBuf
+	d.resetFUA()
+	d.stats.FUACompleted++
+	return [][]byte{nalu}
+}
+
+func (d *H264Depacketizer) resetFUA() {
+	d.fuaBuf = nil
+	d.fuaStarted = false
+}
+
+// Packet is the part of an RTP packet the depacketizer consumes.
+type Packet struct {
+	SequenceNumber uint16
+	Payload        []byte
+}
+
+// DepacketizeAnnexB runs packets through a new depacketizer and returns the
+// resulting NAL units as an Annex-B byte stream, framed the same way as the
+// video written by Peer. It is useful for checking the depacketizer against
+// reference captures.
+func DepacketizeAnnexB(packets []Packet) []byte {
+	d := NewH264Depacketizer()
+	var out bytes.Buffer
+	for _, pkt := range packets {
+		for _, nalu := range d.Depacketize(pkt.SequenceNumber, pkt.Payload) {
+			if len(nalu) == 0 {
+				continue
+			}
+			AnnexB{}.WriteNALU(&out, nalu, false)
+		}
+	}
+	return out.Bytes()
+}
@@ -151,3 +151,199 @@ func TestDepacketize_STAPAIgnoresZeroSizeNALU(t *testing.T) {
 		t.Fatalf("expected 0 NALUs, got %d", len(nalus))
 	}
 }
+
+func TestDepacketize_FUASinglePacketStartEnd(t *testing.T) {
+	d := NewH264Depacketizer()
+
+	// FU header with both start and end bits set: 0x80 | 0x40 | type=5 = 0xC5
+	pkt := []byte{0x7C, 0xC5, 0x01, 0x02}
+	nalus := d.Depacketize(100, pkt)
+	if len(nalus) != 1 {
+		t.Fatalf("expected 1 NALU, got %d", len(nalus))
+	}
+	expected := []byte{0x65, 0x01, 0x02}
+	if !bytes.Equal(nalus[0], expected) {
+		t.Errorf("expected %v, got %v", expected, nalus[0])
+	}
+
+	if d.fuaStarted || d.fuaBuf != nil {
+		t.Errorf("expected clean FU-A state, got started=%v buf=%v", d.fuaStarted, d.fuaBuf)
+	}
+	stats := d.Stats()
+	if stats.FUACompleted != 1 || stats.NALUs != 1 || stats.FUADropped != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// A following end fragment is an orphan, not a continuation.
+	if got := d.Depacketize(101, []byte{0x7C, 0x45, 0x03}); got != nil {
+		t.Fatalf("expected orphan end fragment to be dropped, got %d NALUs", len(got))
+	}
+	if d.Stats().FUAOrphans != 1 {
+		t.Errorf("expected 1 orphan, got %d", d.Stats().FUAOrphans)
+	}
+}
+
+func TestDepacketize_DropsMalformedHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		check   func(DepacketizerStats) uint64
+	}{
+		{"forbidden bit", []byte{0xE5, 0x01, 0x02}, func(s DepacketizerStats) uint64 { return s.ForbiddenBit }},
+		{"type 0", []byte{0x60, 0x01}, func(s DepacketizerStats) uint64 { return s.InvalidType }},
+		{"reserved type 30", []byte{0x7E, 0x01}, func(s DepacketizerStats) uint64 { return s.InvalidType }},
+		{"reserved type 31", []byte{0x7F, 0x01}, func(s DepacketizerStats) uint64 { return s.InvalidType }},
+		{"FU-A with forbidden bit", []byte{0xFC, 0x85, 0x01}, func(s DepacketizerStats) uint64 { return s.ForbiddenBit }},
+		{"FU-A fragmenting type 0", []byte{0x7C, 0xC0, 0x01}, func(s DepacketizerStats) uint64 { return s.InvalidType }},
+		{"STAP-A nesting a STAP-A", []byte{0x18, 0x00, 0x02, 0x38, 0x01}, func(s DepacketizerStats) uint64 { return s.InvalidType }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewH264Depacketizer()
+			if nalus := d.Depacketize(100, tt.payload); nalus != nil {
+				t.Fatalf("expected payload to be dropped, got %d NALUs", len(nalus))
+			}
+			if got := tt.check(d.Stats()); got != 1 {
+				t.Errorf("expected counter to be 1, got %d (stats %+v)", got, d.Stats())
+			}
+		})
+	}
+}
+
+func TestDepacketize_STAPASkipsForbiddenBitNALU(t *testing.T) {
+	d := NewH264Depacketizer()
+
+	good := []byte{0x68, 0xCC}
+	payload := []byte{0x18, 0x00, 0x02, 0xE7, 0xAA, 0x00, 0x02}
+	payload = append(payload, good...)
+
+	nalus := d.Depacketize(100, payload)
+	if len(nalus) != 1 || !bytes.Equal(nalus[0], good) {
+		t.Fatalf("expected only the valid NALU, got %v", nalus)
+	}
+	if d.Stats().ForbiddenBit != 1 {
+		t.Errorf("expected 1 forbidden bit drop, got %d", d.Stats().ForbiddenBit)
+	}
+}
+
+func TestDepacketize_FUAReassemblyIsBounded(t *testing.T) {
+	d := NewH264Depacketizer()
+	d.SetMaxReassemblySize(1024)
+
+	fragment := bytes.Repeat([]byte{0xAB}, 100)
+	seq := uint16(100)
+	d.Depacketize(seq, append([]byte{0x7C, 0x85}, fragment...))
+
+	// Keep sending middle fragments without ever ending the chain.
+	for i := 0; i < 1000; i++ {
+		seq++
+		if nalus := d.Depacketize(seq, append([]byte{0x7C, 0x05}, fragment...)); nalus != nil {
+			t.Fatalf("expected no NALU from middle fragment, got %d", len(nalus))
+		}
+		if len(d.fuaBuf) > 1024 {
+			t.Fatalf("reassembly buffer grew to %d bytes", len(d.fuaBuf))
+		}
+	}
+
+	stats := d.Stats()
+	if stats.FUAOversize != 1 {
+		t.Errorf("expected 1 oversize drop, got %d", stats.FUAOversize)
+	}
+	if d.fuaStarted {
+		t.Error("expected FU-A state to be reset after oversize drop")
+	}
+
+	// A fresh chain within the cap still reassembles.
+	nalus := d.Depacketize(seq+1, []byte{0x7C, 0xC5, 0x01})
+	if len(nalus) != 1 {
+		t.Fatalf("expected 1 NALU after reset, got %d", len(nalus))
+	}
+}
+
+func TestDepacketize_FUAAcrossSequenceWrap(t *testing.T) {
+	startPkt := []byte{0x7C, 0x85, 0x01, 0x02}
+	midPkt := []byte{0x7C, 0x05, 0x03, 0x04}
+	endPkt := []byte{0x7C, 0x45, 0x05, 0x06}
+	expected := []byte{0x65, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+
+	// Every position of the 65535→0 wrap within a three-fragment chain.
+	for _, first := range []uint16{65533, 65534, 65535} {
+		d := NewH264Depacketizer()
+		d.Depacketize(first, startPkt)
+		d.Depacketize(first+1, midPkt)
+		nalus := d.Depacketize(first+2, endPkt)
+		if len(nalus) != 1 || !bytes.Equal(nalus[0], expected) {
+			t.Errorf("chain starting at %d: expected %v, got %v", first, expected, nalus)
+		}
+		if s := d.Stats(); s.FUADropped != 0 || s.FUACompleted != 1 {
+			t.Errorf("chain starting at %d: expected 1 completed and 0 dropped, got %+v", first, s)
+		}
+	}
+}
+
+func TestDepacketize_FUAGapAcrossSequenceWrap(t *testing.T) {
+	d := NewH264Depacketizer()
+
+	startPkt := []byte{0x7C, 0x85, 0x01, 0x02}
+	endPkt := []byte{0x7C, 0x45, 0x05, 0x06}
+
+	// Sequence 0 is lost between 65535 and 1.
+	d.Depacketize(65535, startPkt)
+	if got := d.Depacketize(1, endPkt); got != nil {
+		t.Fatalf("expected nil after a gap across the wrap, got %d NALUs", len(got))
+	}
+	if s := d.Stats(); s.FUADropped != 1 {
+		t.Errorf("expected 1 dropped chain, got %d", s.FUADropped)
+	}
+}
+
+// FuzzDepacketize feeds a run of packets through one depacketizer. The
+// input is split into packets of a two-byte sequence number, a length byte
+// and that many payload bytes.
+func FuzzDepacketize(f *testing.F) {
+	packet := func(seq uint16, payload ...byte) []byte {
+		return append([]byte{byte(seq >> 8), byte(seq), byte(len(payload))}, payload...)
+	}
+	join := func(pkts ...[]byte) []byte { return bytes.Join(pkts, nil) }
+	f.Add(packet(100, 0x65, 0x01, 0x02, 0x03))
+	f.Add(packet(100, 0x18, 0x00, 0x03, 0x67, 0xAA, 0xBB, 0x00, 0x02, 0x68, 0xCC))
+	f.Add(packet(100, 0x18, 0x00, 0x02, 0xE7, 0xAA, 0x00, 0x09, 0x68))
+	f.Add(join(packet(65535, 0x7C, 0x85, 0x01), packet(0, 0x7C, 0x05, 0x02), packet(1, 0x7C, 0x45, 0x03)))
+	f.Add(join(packet(10, 0x7C, 0x85, 0x01), packet(12, 0x7C, 0x45, 0x02), packet(13, 0x7C, 0x45, 0x03)))
+	f.Add(join(packet(10, 0x7C, 0x85, 0x01), packet(11, 0x7C, 0x85, 0x02), packet(12, 0x7C, 0xC5)))
+
+	const maxSize = 1024
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d := NewH264Depacketizer()
+		d.SetMaxReassemblySize(maxSize)
+		var packets, nalus uint64
+		for len(data) >= 3 {
+			seq := uint16(data[0])<<8 | uint16(data[1])
+			n := min(int(data[2]), len(data)-3)
+			payload := data[3 : 3+n]
+			data = data[3+n:]
+
+			out := d.Depacketize(seq, payload)
+			packets++
+			nalus += uint64(len(out))
+			for _, nalu := range out {
+				if len(nalu) == 0 {
+					t.Fatalf("seq %d: empty NALU from %x", seq, payload)
+				}
+				if len(nalu) > max(maxSize, len(payload)) {
+					t.Fatalf("seq %d: %d-byte NALU exceeds the %d-byte cap", seq, len(nalu), maxSize)
+				}
+				if h := nalu[0]; h&0x80 != 0 || h&0x1f == 0 || h&0x1f > 23 {
+					t.Fatalf("seq %d: NALU header %#x is not a single NAL unit type", seq, h)
+				}
+			}
+			if d.fuaStarted != (d.fuaBuf != nil) || len(d.fuaBuf) > maxSize {
+				t.Fatalf("seq %d: inconsistent FU-A state: started %v with %d buffered bytes", seq, d.fuaStarted, len(d.fuaBuf))
+			}
+		}
+		if s := d.Stats(); s.Packets != packets || s.NALUs != nalus {
+			t.Fatalf("expected %d packets and %d NALUs counted, got %+v", packets, nalus, s)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package webrtc
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/pion/transport/v3"
+	"github.com/pion/transport/v3/stdnet"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// dscpNet is the network Pion opens its UDP sockets through when
+// Options.DSCP is set. Each socket is marked so the packets sent on it
+// carry the DSCP value, for networks that prioritize marked traffic.
+// Marking is best effort: where the OS refuses it, for example Windows
+// without a QoS policy, a warning is logged once and the packets go out
+// unmarked.
+type dscpNet struct {
+	transport.Net
+	dscp     int
+	warnOnce sync.Once
+}
+
+func newDSCPNet(dscp int) (*dscpNet, error) {
+	n, err := stdnet.NewNet()
+	if err != nil {
+		return nil, fmt.Errorf("create network: %w", err)
+	}
+	log.Printf("[webrtc] marking media packets with DSCP %d", dscp)
+	return &dscpNet{Net: n, dscp: dscp}, nil
+}
+
+func (n *dscpNet) ListenPacket(network, address string) (net.PacketConn, error) {
+	c, err := n.Net.ListenPacket(network, address)
+	if err == nil {
+		n.mark(c)
+	}
+	return c, err
+}
+
+func (n *dscpNet) ListenUDP(network string, laddr *net.UDPAddr) (transport.UDPConn, error) {
+	c, err := n.Net.ListenUDP(network, laddr)
+	if err == nil {
+		n.mark(c)
+	}
+	return c, err
+}
+
+func (n *dscpNet) DialUDP(network string, laddr, raddr *net.UDPAddr) (transport.UDPConn, error) {
+	c, err := n.Net.DialUDP(network, laddr, raddr)
+	if err == nil {
+		n.mark(c)
+	}
+	return c, err
+}
+
+// mark sets the DSCP bits, the upper six of the IPv4 TOS and the IPv6
+// traffic class, on c.
+func (n *dscpNet) mark(c net.PacketConn) {
+	tos := n.dscp << 2
+	addr, _ := c.LocalAddr().(*net.UDPAddr)
+	var err error
+	switch {
+	case addr != nil && addr.IP.To4() != nil:
+		err = ipv4.NewPacketConn(c).SetTOS(tos)
+	case addr != nil && !addr.IP.IsUnspecified():
+		err = ipv6.NewPacketConn(c).SetTrafficClass(tos)
+	default:
+		// A dual-stack socket sends both kinds; one succeeding will do.
+		err4 := ipv4.NewPacketConn(c).SetTOS(tos)
+		if err6 := ipv6.NewPacketConn(c).SetTrafficClass(tos); err4 != nil && err6 != nil {
+			err = err4
+		}
+	}
+	if err != nil {
+		n.warnOnce.Do(func() {
+			log.Printf("[webrtc] warning: cannot mark media packets with DSCP %d: %v; sending them unmarked", n.dscp, err)
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package webrtc
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/ipv4"
+)
+
+func TestDSCPNet_MarksUDPSockets(t *testing.T) {
+	n, err := newDSCPNet(46)
+	if err != nil {
+		t.Fatalf("create network: %v", err)
+	}
+	c, err := n.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer c.Close()
+
+	tos, err := ipv4.NewPacketConn(c).TOS()
+	if err != nil {
+		t.Skipf("reading the TOS is not supported here: %v", err)
+	}
+	if tos != 46<<2 {
+		t.Errorf("expected TOS %#x, got %#x", 46<<2, tos)
+	}
+}
@@ -0,0 +1,131 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+)
+
+// Reasons a DroppedPacket records.
+const (
+	DropSequenceGap     = "sequence-gap"     // packets missing before this one
+	DropFUAGap          = "fua-gap"          // an FU-A chain abandoned because a fragment is missing
+	DropFUAOrphan       = "fua-orphan"       // an FU-A fragment without its start fragment
+	DropFUAOversize     = "fua-oversize"     // an FU-A chain over the reassembly cap
+	DropForbiddenBit    = "forbidden-bit"    // a NAL header with the forbidden zero bit set
+	DropInvalidType     = "invalid-type"     // a NAL header with type 0, 30 or 31, or nested aggregation
+	DropUnsupportedType = "unsupported-type" // STAP-B, MTAP or FU-B, which the camera should not send
+	DropOversizeNALU    = "oversize-nalu"    // a NAL unit over Options.MaxNALUSize
+)
+
+// DroppedPacket describes one video RTP packet the depacketizer discarded
+// all or part of, or a gap in the sequence numbers before one, in an
+// error dump holding one JSON record per line. When an FU-A chain is
+// abandoned, each of its fragments gets a record. For oversize-nalu the
+// payload is the NAL unit dropped and the sequence number that of the
+// packet that completed it.
+type DroppedPacket struct {
+	Time         time.Time `json:"time"`
+	Sequence     uint16    `json:"seq"`
+	RTPTimestamp uint32    `json:"rtpTimestamp"`
+	Reason       string    `json:"reason"`
+	// Lost is the number of packets missing before Sequence, for a
+	// sequence gap.
+	Lost uint64 `json:"lost,omitempty"`
+	Size int    `json:"size"`
+	// Payload is the raw RTP payload, base64 in the JSON, left out for a
+	// sequence gap, where the packet itself was fine.
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// errorDumper writes a DroppedPacket per discarded packet. It is used from
+// the video read loop only, and writes nothing while the stream is clean.
+type errorDumper struct {
+	enc    *json.Encoder
+	failed bool // stop after the first write error
+	// chain holds the fragments of the FU-A chain in progress, so they
+	// can be dumped if it is abandoned.
+	chain []DroppedPacket
+}
+
+func newErrorDumper(w io.Writer) *errorDumper {
+	return &errorDumper{enc: json.NewEncoder(w)}
+}
+
+// dropReasons lists the reasons the depacketizer's counters went up from
+// before to after, in DepacketizerStats order.
+func dropReasons(before, after DepacketizerStats) []string {
+	var reasons []string
+	for _, c := range []struct {
+		before, after uint64
+		reason        string
+	}{
+		{before.FUADropped, after.FUADropped, DropFUAGap},
+		{before.FUAOrphans, after.FUAOrphans, DropFUAOrphan},
+		{before.FUAOversize, after.FUAOversize, DropFUAOversize},
+		{before.ForbiddenBit, after.ForbiddenBit, DropForbiddenBit},
+		{before.InvalidType, after.InvalidType, DropInvalidType},
+		{before.Unsupported, after.Unsupported, DropUnsupportedType},
+	} {
+		if c.after > c.before {
+			reasons = append(reasons, c.reason)
+		}
+	}
+	return reasons
+}
+
+// Dump records packet seq if lost packets preceded it or if depacketizing
+// it moved the counters from before to after. An FU-A chain abandoned at
+// seq is recorded fragment by fragment, and seq with it unless it starts
+// the next chain.
+func (d *errorDumper) Dump(now time.Time, seq uint16, timestamp uint32, lost uint64, before, after DepacketizerStats, payload []byte) {
+	if lost > 0 {
+		d.write(DroppedPacket{Time: now, Sequence: seq, RTPTimestamp: timestamp, Reason: DropSequenceGap, Lost: lost, Size: len(payload)})
+	}
+	fua := len(payload) >= 2 && payload[0]&0x1f == 28
+	start, end := fua && payload[1]&0x80 != 0, fua && payload[1]&0x40 != 0
+	reasons := dropReasons(before, after)
+	for _, reason := range reasons {
+		if reason == DropFUAGap {
+			for _, f := range d.chain {
+				d.write(f)
+			}
+			d.chain = nil
+			if start {
+				continue
+			}
+		}
+		d.write(DroppedPacket{Time: now, Sequence: seq, RTPTimestamp: timestamp, Reason: reason, Size: len(payload), Payload: payload})
+	}
+
+	// Follow the chain the depacketizer is reassembling: a clean start
+	// begins one, and a clean fragment while one is open extends it.
+	rec := DroppedPacket{Time: now, Sequence: seq, RTPTimestamp: timestamp, Reason: DropFUAGap, Size: len(payload)}
+	switch clean := len(reasons) == 0 || len(reasons) == 1 && reasons[0] == DropFUAGap && start; {
+	case !fua || !clean || end:
+		d.chain = nil
+	case start:
+		rec.Payload = append([]byte(nil), payload...)
+		d.chain = append(d.chain[:0], rec)
+	case d.chain != nil:
+		rec.Payload = append([]byte(nil), payload...)
+		d.chain = append(d.chain, rec)
+	}
+}
+
+// DumpNALU records nalu, from the access unit at timestamp completed by
+// packet seq, as dropped for reason.
+func (d *errorDumper) DumpNALU(now time.Time, seq uint16, timestamp uint32, reason string, nalu []byte) {
+	d.write(DroppedPacket{Time: now, Sequence: seq, RTPTimestamp: timestamp, Reason: reason, Size: len(nalu), Payload: nalu})
+}
+
+func (d *errorDumper) write(r DroppedPacket) {
+	if d.failed {
+		return
+	}
+	if err := d.enc.Encode(r); err != nil {
+		log.Printf("[webrtc] error dump write error, disabling it: %v", err)
+		d.failed = true
+	}
+}
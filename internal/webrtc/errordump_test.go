@@ -0,0 +1,70 @@
+package webrtc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func TestVideoReceiver_DumpsDroppedPackets(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{ErrorDump: &buf, MaxNALUSize: 4})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	v := p.newVideoReceiver(90000, io.Discard, false, func() {})
+	defer v.Close()
+
+	packets := []struct {
+		seq     uint16
+		payload []byte
+	}{
+		{0, []byte{0x65, 0x88, 0x84}},       // clean
+		{1, []byte{0xe5, 0x88}},             // forbidden bit
+		{5, []byte{0x7c, 0x05, 0x01}},       // after a gap of 3, a middle fragment
+		{6, []byte{0x7c, 0x85, 0x02}},       // FU-A start
+		{8, []byte{0x7c, 0x45, 0x03}},       // its end, after a gap of 1
+		{9, []byte{0x19, 0x00, 0x01, 0x41}}, // STAP-B
+		{10, []byte{0x7c, 0x85, 0x04}},      // FU-A start
+		{11, []byte{0x7c, 0x85, 0x05}},      // another start, abandoning it
+		{12, []byte{0x7c, 0x45, 0x06}},      // its end, completing the chain
+		{13, []byte{0x41, 1, 2, 3, 4}},      // a NAL unit over MaxNALUSize
+	}
+	for _, pkt := range packets {
+		v.Handle(pkt.seq, 3000, true, pkt.payload)
+	}
+
+	want := []DroppedPacket{
+		{Sequence: 1, Reason: DropForbiddenBit, Size: 2, Payload: []byte{0xe5, 0x88}},
+		{Sequence: 5, Reason: DropSequenceGap, Lost: 3, Size: 3},
+		{Sequence: 5, Reason: DropFUAOrphan, Size: 3, Payload: []byte{0x7c, 0x05, 0x01}},
+		{Sequence: 8, Reason: DropSequenceGap, Lost: 1, Size: 3},
+		{Sequence: 6, Reason: DropFUAGap, Size: 3, Payload: []byte{0x7c, 0x85, 0x02}},
+		{Sequence: 8, Reason: DropFUAGap, Size: 3, Payload: []byte{0x7c, 0x45, 0x03}},
+		{Sequence: 9, Reason: DropUnsupportedType, Size: 4, Payload: []byte{0x19, 0x00, 0x01, 0x41}},
+		{Sequence: 10, Reason: DropFUAGap, Size: 3, Payload: []byte{0x7c, 0x85, 0x04}},
+		{Sequence: 13, Reason: DropOversizeNALU, Size: 5, Payload: []byte{0x41, 1, 2, 3, 4}},
+	}
+	sc := bufio.NewScanner(&buf)
+	var got []DroppedPacket
+	for sc.Scan() {
+		var rec DroppedPacket
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("unmarshal %q: %v", sc.Text(), err)
+		}
+		got = append(got, rec)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d records, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		w, g := want[i], got[i]
+		if g.Sequence != w.Sequence || g.Reason != w.Reason || g.Lost != w.Lost || g.Size != w.Size ||
+			!bytes.Equal(g.Payload, w.Payload) || g.RTPTimestamp != 3000 || g.Time.IsZero() {
+			t.Errorf("record %d: expected %+v, got %+v", i, w, g)
+		}
+	}
+}
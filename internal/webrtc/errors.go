@@ -0,0 +1,31 @@
+package webrtc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrMediaStall is reported through the error callback when the camera is
+// connected but usable video does not arrive in time. Use errors.Is to
+// test for it.
+var ErrMediaStall = errors.New("media stalled")
+
+// ErrResolutionMismatch is reported through the error callback when
+// Options.StrictResolution is set and the camera's SPS describes a
+// different picture size than the one requested.
+var ErrResolutionMismatch = errors.New("resolution differs from requested")
+
+// ErrDataChannelTimeout is reported through the error callback when the
+// connection is up but the control DataChannel did not open within
+// DataChannelOptions.OpenTimeout and FailIfNotOpen is set.
+var ErrDataChannelTimeout = errors.New("data channel did not open")
+
+// ErrNoTrack is reported through the error callback when the connection
+// is up but the camera sent no video track within Options.TrackTimeout
+// and Options.FailWithoutTrack is set. It wraps ErrMediaStall.
+var ErrNoTrack = fmt.Errorf("%w: no video track", ErrMediaStall)
+
+// ErrAnswerRejected is returned by SetRemoteDescription, with
+// Options.ValidateAnswer set, when the camera's answer declines to send
+// H264 video. It wraps ErrMediaStall.
+var ErrAnswerRejected = fmt.Errorf("%w: camera declined video", ErrMediaStall)
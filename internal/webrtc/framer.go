@@ -0,0 +1,73 @@
+package webrtc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Framer writes NAL units to a byte stream in one of the H264 framings.
+type Framer interface {
+	// WriteNALU writes one NAL unit. auStart marks the first NAL unit of
+	// an access unit.
+	WriteNALU(w io.Writer, nalu []byte, auStart bool) error
+}
+
+var (
+	longStartCode  = []byte{0x00, 0x00, 0x00, 0x01}
+	shortStartCode = longStartCode[1:]
+)
+
+// AnnexB frames NAL units with start codes, as raw .h264 streams and
+// MPEG-TS carry them. Every NAL unit gets the 4-byte start code unless
+// ShortStartCodes is set, in which case only the first NAL unit of an
+// access unit and parameter sets do, as H.264 Annex B requires, and the
+// rest get the 3-byte form.
+type AnnexB struct {
+	ShortStartCodes bool
+}
+
+func (f AnnexB) WriteNALU(w io.Writer, nalu []byte, auStart bool) error {
+	sc := longStartCode
+	if f.ShortStartCodes && !auStart && len(nalu) > 0 {
+		switch nalu[0] & 0x1f {
+		case naluTypeSPS, naluTypePPS:
+		default:
+			sc = shortStartCode
+		}
+	}
+	if _, err := w.Write(sc); err != nil {
+		return err
+	}
+	_, err := w.Write(nalu)
+	return err
+}
+
+// AVCC frames NAL units with a big-endian length prefix, as MP4 and
+// Matroska store them. LengthSize is the prefix size in bytes: 1, 2 or 4,
+// where 0 means 4.
+type AVCC struct {
+	LengthSize int
+}
+
+func (f AVCC) WriteNALU(w io.Writer, nalu []byte, auStart bool) error {
+	var prefix [4]byte
+	switch size := f.LengthSize; {
+	case size == 0 || size == 4:
+		binary.BigEndian.PutUint32(prefix[:], uint32(len(nalu)))
+		f.LengthSize = 4
+	case size == 2 && len(nalu) <= 0xffff:
+		binary.BigEndian.PutUint16(prefix[:], uint16(len(nalu)))
+	case size == 1 && len(nalu) <= 0xff:
+		prefix[0] = byte(len(nalu))
+	case size == 1 || size == 2:
+		return fmt.Errorf("%d-byte NAL unit does not fit a %d-byte AVCC length", len(nalu), size)
+	default:
+		return fmt.Errorf("invalid AVCC length size %d", size)
+	}
+	if _, err := w.Write(prefix[:f.LengthSize]); err != nil {
+		return err
+	}
+	_, err := w.Write(nalu)
+	return err
+}
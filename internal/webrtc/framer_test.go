@@ -0,0 +1,94 @@
+package webrtc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFramers(t *testing.T) {
+	sps := []byte{0x67, 0x42}
+	idr := []byte{0x65, 0x88, 0x84}
+	slice := []byte{0x41, 0x9a}
+	type nalu struct {
+		data    []byte
+		auStart bool
+	}
+	aus := []nalu{{sps, true}, {idr, false}, {slice, true}, {slice, false}}
+	tests := []struct {
+		name   string
+		framer Framer
+		want   []byte
+	}{
+		{"annex-b", AnnexB{}, []byte{
+			0, 0, 0, 1, 0x67, 0x42,
+			0, 0, 0, 1, 0x65, 0x88, 0x84,
+			0, 0, 0, 1, 0x41, 0x9a,
+			0, 0, 0, 1, 0x41, 0x9a,
+		}},
+		{"annex-b short", AnnexB{ShortStartCodes: true}, []byte{
+			0, 0, 0, 1, 0x67, 0x42,
+			0, 0, 1, 0x65, 0x88, 0x84,
+			0, 0, 0, 1, 0x41, 0x9a,
+			0, 0, 1, 0x41, 0x9a,
+		}},
+		{"avcc", AVCC{}, []byte{
+			0, 0, 0, 2, 0x67, 0x42,
+			0, 0, 0, 3, 0x65, 0x88, 0x84,
+			0, 0, 0, 2, 0x41, 0x9a,
+			0, 0, 0, 2, 0x41, 0x9a,
+		}},
+		{"avcc 2-byte", AVCC{LengthSize: 2}, []byte{
+			0, 2, 0x67, 0x42,
+			0, 3, 0x65, 0x88, 0x84,
+			0, 2, 0x41, 0x9a,
+			0, 2, 0x41, 0x9a,
+		}},
+		{"avcc 1-byte", AVCC{LengthSize: 1}, []byte{
+			2, 0x67, 0x42,
+			3, 0x65, 0x88, 0x84,
+			2, 0x41, 0x9a,
+			2, 0x41, 0x9a,
+		}},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		for _, n := range aus {
+			if err := tt.framer.WriteNALU(&b, n.data, n.auStart); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		if !bytes.Equal(b.Bytes(), tt.want) {
+			t.Errorf("%s: expected % x, got % x", tt.name, tt.want, b.Bytes())
+		}
+	}
+}
+
+func TestAVCC_RejectsNALUTooLongForLength(t *testing.T) {
+	tests := []struct {
+		framer AVCC
+		size   int
+	}{
+		{AVCC{LengthSize: 1}, 256},
+		{AVCC{LengthSize: 2}, 65536},
+		{AVCC{LengthSize: 3}, 1},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := tt.framer.WriteNALU(&b, make([]byte, tt.size), true); err == nil || b.Len() != 0 {
+			t.Errorf("%+v with %d bytes: expected an error and no output, got %v and %d bytes", tt.framer, tt.size, err, b.Len())
+		}
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) { return 0, errors.New("closed") }
+
+func TestFramers_ReportWriteErrors(t *testing.T) {
+	for _, f := range []Framer{AnnexB{}, AVCC{}} {
+		if err := f.WriteNALU(failWriter{}, []byte{0x65}, true); err == nil {
+			t.Errorf("%T: expected the write error", f)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package webrtc
+
+import (
+	"fmt"
+
+	"vico_home/native/internal/domain"
+)
+
+// DefaultH264Profile is the format offered when Options.H264Profile is
+// zero: High level 3.1 in single NAL unit mode.
+var DefaultH264Profile = domain.H264Profile{ProfileLevelID: "64001f", PacketizationMode: 0}
+
+// fmtpLine returns the SDP fmtp parameters offering h.
+func fmtpLine(h domain.H264Profile) string {
+	return fmt.Sprintf("level-asymmetry-allowed=1;packetization-mode=%d;profile-level-id=%s", h.PacketizationMode, h.ProfileLevelID)
+}
@@ -0,0 +1,14 @@
+package webrtc
+
+import (
+	"testing"
+
+	"vico_home/native/internal/domain"
+)
+
+func TestH264Profile_FmtpLine(t *testing.T) {
+	want := "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f"
+	if got := fmtpLine(domain.H264Profile{ProfileLevelID: "42e01f", PacketizationMode: 1}); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,137 @@
+package webrtc
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"vico_home/native/internal/domain"
+
+	"github.com/pion/stun/v3"
+	"github.com/pion/turn/v4"
+)
+
+// ICECheckResult is the outcome of checking one STUN or TURN server.
+type ICECheckResult struct {
+	URL  string
+	Kind string // "stun" or "turn"
+	// Addr is the server-reflexive address (STUN) or relayed address (TURN)
+	// the server handed out.
+	Addr string
+	// RTT is the round trip of one binding request, taken after a TURN
+	// allocation so the authentication exchanges are not counted.
+	RTT time.Duration
+	Err error
+}
+
+// CheckICEServer verifies that an ICE server from the ticket is usable. A
+// STUN server must answer a binding request; a TURN server must grant an
+// allocation with the ticket's credentials, then answer one. The whole
+// check is bounded by timeout.
+func CheckICEServer(s domain.ICEServer, timeout time.Duration) ICECheckResult {
+	res := ICECheckResult{URL: s.URL}
+
+	uri, err := stun.ParseURI(s.URL)
+	if err != nil {
+		res.Err = fmt.Errorf("parse url: %w", err)
+		return res
+	}
+	res.Kind = uri.Scheme.String()
+	isTURN := uri.Scheme == stun.SchemeTypeTURN || uri.Scheme == stun.SchemeTypeTURNS
+	addr := net.JoinHostPort(uri.Host, strconv.Itoa(uri.Port))
+
+	conn, err := dialICEServer(uri, addr, timeout)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer conn.Close()
+
+	cfg := &turn.ClientConfig{
+		STUNServerAddr: addr,
+		Conn:           conn,
+	}
+	if isTURN {
+		cfg.TURNServerAddr = addr
+		cfg.Username = s.Username
+		cfg.Password = s.Credential
+	}
+	client, err := turn.NewClient(cfg)
+	if err != nil {
+		res.Err = fmt.Errorf("create client: %w", err)
+		return res
+	}
+	defer client.Close()
+	if err := client.Listen(); err != nil {
+		res.Err = fmt.Errorf("listen: %w", err)
+		return res
+	}
+
+	type outcome struct {
+		addr net.Addr
+		rtt  time.Duration
+		err  error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		var o outcome
+		if isTURN {
+			relay, err := client.Allocate()
+			if err != nil {
+				done <- outcome{err: err}
+				return
+			}
+			defer relay.Close()
+			o.addr = relay.LocalAddr()
+		}
+		start := time.Now()
+		mapped, err := client.SendBindingRequest()
+		o.rtt = time.Since(start)
+		if err != nil {
+			done <- outcome{err: fmt.Errorf("binding request: %w", err)}
+			return
+		}
+		if o.addr == nil {
+			o.addr = mapped
+		}
+		done <- o
+	}()
+
+	select {
+	case o := <-done:
+		if o.err != nil {
+			res.Err = o.err
+			return res
+		}
+		res.Addr, res.RTT = o.addr.String(), o.rtt
+	case <-time.After(timeout):
+		res.Err = errors.New("timed out")
+	}
+	return res
+}
+
+func dialICEServer(uri *stun.URI, addr string, timeout time.Duration) (net.PacketConn, error) {
+	if uri.Proto != stun.ProtoTypeTCP {
+		conn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		if err != nil {
+			return nil, fmt.Errorf("listen udp: %w", err)
+		}
+		return conn, nil
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if uri.Scheme == stun.SchemeTypeTURNS || uri.Scheme == stun.SchemeTypeSTUNS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: uri.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dial tcp: %w", err)
+	}
+	return turn.NewSTUNConn(conn), nil
+}
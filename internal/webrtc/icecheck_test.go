@@ -0,0 +1,97 @@
+package webrtc
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/domain"
+
+	pionlog "github.com/pion/logging"
+	"github.com/pion/turn/v4"
+)
+
+// startTURNServer runs a TURN server on localhost over UDP and TCP that
+// accepts user alice with password s3cret, and returns its two ports.
+func startTURNServer(t *testing.T) (udpPort, tcpPort int) {
+	t.Helper()
+	udp, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	tcp, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen tcp: %v", err)
+	}
+	relay := &turn.RelayAddressGeneratorStatic{RelayAddress: net.ParseIP("127.0.0.1"), Address: "127.0.0.1"}
+	key := turn.GenerateAuthKey("alice", "test", "s3cret")
+	// The server logs each failed allocation, which the test makes on purpose.
+	quiet := pionlog.NewDefaultLoggerFactory()
+	quiet.DefaultLogLevel = pionlog.LogLevelDisabled
+	srv, err := turn.NewServer(turn.ServerConfig{
+		Realm:         "test",
+		LoggerFactory: quiet,
+		AuthHandler: func(username, realm string, _ net.Addr) ([]byte, bool) {
+			return key, username == "alice"
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{PacketConn: udp, RelayAddressGenerator: relay}},
+		ListenerConfigs:   []turn.ListenerConfig{{Listener: tcp, RelayAddressGenerator: relay}},
+	})
+	if err != nil {
+		t.Fatalf("start turn server: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return udp.LocalAddr().(*net.UDPAddr).Port, tcp.Addr().(*net.TCPAddr).Port
+}
+
+func TestCheckICEServer(t *testing.T) {
+	udpPort, tcpPort := startTURNServer(t)
+	// A port nothing answers on: bound, then closed.
+	idle, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	idlePort := idle.LocalAddr().(*net.UDPAddr).Port
+	idle.Close()
+
+	url := func(scheme string, port int, query string) string {
+		return scheme + ":127.0.0.1:" + strconv.Itoa(port) + query
+	}
+	tests := []struct {
+		name   string
+		server domain.ICEServer
+		kind   string
+		addr   string // prefix of the address handed out
+		errSub string
+	}{
+		{"stun", domain.ICEServer{URL: url("stun", udpPort, "")}, "stun", "127.0.0.1:", ""},
+		{"turn udp", domain.ICEServer{URL: url("turn", udpPort, "?transport=udp"), Username: "alice", Credential: "s3cret"}, "turn", "127.0.0.1:", ""},
+		{"turn tcp", domain.ICEServer{URL: url("turn", tcpPort, "?transport=tcp"), Username: "alice", Credential: "s3cret"}, "turn", "127.0.0.1:", ""},
+		{"wrong password", domain.ICEServer{URL: url("turn", udpPort, "?transport=udp"), Username: "alice", Credential: "guess"}, "turn", "", "Allocate"},
+		{"unknown user", domain.ICEServer{URL: url("turn", udpPort, "?transport=udp"), Username: "bob", Credential: "s3cret"}, "turn", "", "Allocate"},
+		{"no answer", domain.ICEServer{URL: url("stun", idlePort, "")}, "stun", "", "timed out"},
+		{"tcp refused", domain.ICEServer{URL: url("turn", idlePort, "?transport=tcp"), Username: "alice", Credential: "s3cret"}, "turn", "", "dial tcp"},
+		{"bad url", domain.ICEServer{URL: "http://127.0.0.1"}, "", "", "parse url"},
+	}
+	for _, tt := range tests {
+		res := CheckICEServer(tt.server, 500*time.Millisecond)
+		if res.URL != tt.server.URL || res.Kind != tt.kind {
+			t.Errorf("%s: expected %s server %s, got %s server %s", tt.name, tt.kind, tt.server.URL, res.Kind, res.URL)
+		}
+		if tt.errSub != "" {
+			if res.Err == nil || !strings.Contains(res.Err.Error(), tt.errSub) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.errSub, res.Err)
+			}
+			continue
+		}
+		if res.Err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, res.Err)
+			continue
+		}
+		if !strings.HasPrefix(res.Addr, tt.addr) || res.RTT <= 0 || res.RTT > 500*time.Millisecond {
+			t.Errorf("%s: expected an address %s* and a binding RTT, got %q in %s", tt.name, tt.addr, res.Addr, res.RTT)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package webrtc
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"vico_home/native/internal/domain"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+// candidateAllowed reports whether local candidates of type typ may be
+// sent under t. The zero set allows every type, and peer-reflexive
+// candidates, which are learned from checks rather than gathered, are
+// always allowed.
+func candidateAllowed(t domain.CandidateTypes, typ pion.ICECandidateType) bool {
+	switch {
+	case t == 0:
+		return true
+	case typ == pion.ICECandidateTypeHost:
+		return t&domain.CandidateHost != 0
+	case typ == pion.ICECandidateTypeSrflx:
+		return t&domain.CandidateSrflx != 0
+	case typ == pion.ICECandidateTypeRelay:
+		return t&domain.CandidateRelay != 0
+	}
+	return true
+}
+
+// filterICEServers drops the servers that would only gather candidate
+// types t leaves out: STUN servers without srflx and TURN servers without
+// relay. Skipping them saves the requests, notably the TURN allocation.
+func filterICEServers(servers []domain.ICEServer, t domain.CandidateTypes) []domain.ICEServer {
+	if t == 0 {
+		return servers
+	}
+	var kept []domain.ICEServer
+	for _, s := range servers {
+		turn := strings.HasPrefix(s.URL, "turn:") || strings.HasPrefix(s.URL, "turns:")
+		if (turn && t&domain.CandidateRelay == 0) || (!turn && t&domain.CandidateSrflx == 0) {
+			log.Printf("[webrtc] not using ICE server %s: candidate types are %s", s.URL, t)
+			continue
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// relayFallback holds back local relay candidates until the connection
+// has failed to come up over the other types for Options.RelayFallback.
+// Gathering still happens up front, so the TURN allocation is ready when
+// the fallback fires.
+type relayFallback struct {
+	timeout time.Duration
+
+	mu       sync.Mutex
+	started  bool
+	released bool
+	held     []heldCandidate
+}
+
+type heldCandidate struct {
+	sdpMid        string
+	sdpMLineIndex int
+	candidate     string
+}
+
+// hold keeps a relay candidate back and reports true, or reports false if
+// the fallback already fired and the candidate should be sent.
+func (r *relayFallback) hold(c heldCandidate) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.released {
+		return false
+	}
+	r.held = append(r.held, c)
+	return true
+}
+
+// start begins the fallback timeout when the first candidate of any type
+// is gathered, which is about when connectivity checks can begin. After
+// the timeout, unless the peer is connected, the held candidates are sent.
+func (r *relayFallback) start(p *Peer, send func(sdpMid string, sdpMLineIndex int, candidate string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started {
+		return
+	}
+	r.started = true
+	timeout := p.clock.After(r.timeout)
+	go func() {
+		select {
+		case <-timeout:
+		case <-p.closed:
+			return
+		}
+		if p.closing() {
+			return
+		}
+		r.mu.Lock()
+		held := r.held
+		r.held, r.released = nil, true
+		r.mu.Unlock()
+
+		switch p.pc.ICEConnectionState() {
+		case pion.ICEConnectionStateConnected, pion.ICEConnectionStateCompleted:
+			log.Printf("[webrtc] connected without relay; not sending %d relay candidates", len(held))
+			return
+		}
+		log.Printf("[webrtc] not connected after %s, adding %d relay candidates", r.timeout, len(held))
+		for _, c := range held {
+			send(c.sdpMid, c.sdpMLineIndex, c.candidate)
+		}
+	}()
+}
+
+// logSelectedPair logs how long the peer took to connect and over which
+// candidate types, for comparing candidate policies.
+func (p *Peer) logSelectedPair() {
+	pair, err := p.pc.SCTP().Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil {
+		return
+	}
+	log.Printf("[webrtc] connected %s after creating the peer, over %s (local) to %s (remote) candidates",
+		p.clock.Now().Sub(p.created).Round(time.Millisecond), pair.Local.Typ, pair.Remote.Typ)
+}
@@ -0,0 +1,104 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+	"vico_home/native/internal/domain"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+func TestCandidateTypes_Allows(t *testing.T) {
+	direct := domain.CandidateHost | domain.CandidateSrflx
+	tests := []struct {
+		set  domain.CandidateTypes
+		typ  pion.ICECandidateType
+		want bool
+	}{
+		{0, pion.ICECandidateTypeRelay, true},
+		{direct, pion.ICECandidateTypeHost, true},
+		{direct, pion.ICECandidateTypeRelay, false},
+		{domain.CandidateRelay, pion.ICECandidateTypeHost, false},
+		{domain.CandidateRelay, pion.ICECandidateTypePrflx, true},
+	}
+	for _, tt := range tests {
+		if got := candidateAllowed(tt.set, tt.typ); got != tt.want {
+			t.Errorf("%s allows %s: expected %v, got %v", tt.set, tt.typ, tt.want, got)
+		}
+	}
+}
+
+func TestFilterICEServers(t *testing.T) {
+	servers := []domain.ICEServer{
+		{URL: "stun:stun.example.com:3478"},
+		{URL: "turn:turn.example.com:3478"},
+		{URL: "turns:turn.example.com:5349"},
+	}
+	tests := []struct {
+		set  domain.CandidateTypes
+		want int
+	}{
+		{0, 3},
+		{domain.AllCandidateTypes, 3},
+		{domain.CandidateHost | domain.CandidateSrflx, 1},
+		{domain.CandidateHost | domain.CandidateRelay, 2},
+		{domain.CandidateHost, 0},
+	}
+	for _, tt := range tests {
+		if got := filterICEServers(servers, tt.set); len(got) != tt.want {
+			t.Errorf("%s: expected %d servers, got %v", tt.set, tt.want, got)
+		}
+	}
+}
+
+func TestRelayFallback_SendsHeldCandidatesWhenNotConnected(t *testing.T) {
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{RelayFallback: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	p.SetClock(clk)
+
+	sent := make(chan string, 4)
+	send := func(_ string, _ int, candidate string) { sent <- candidate }
+	// A relay candidate gathered first starts the timeout too.
+	p.relay.start(p, send)
+	if !p.relay.hold(heldCandidate{candidate: "relay-1"}) {
+		t.Fatal("expected the relay candidate to be held before the fallback")
+	}
+	clk.Advance(time.Second)
+	select {
+	case c := <-sent:
+		t.Fatalf("expected nothing sent before the fallback, got %s", c)
+	default:
+	}
+	clk.Advance(time.Second)
+	select {
+	case c := <-sent:
+		if c != "relay-1" {
+			t.Errorf("expected relay-1, got %s", c)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the held candidate to be sent after the fallback")
+	}
+	if p.relay.hold(heldCandidate{candidate: "relay-2"}) {
+		t.Error("expected relay candidates after the fallback to be sent directly")
+	}
+}
+
+func TestRelayFallback_NotUsedWithRelayOnly(t *testing.T) {
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{ICECandidates: domain.CandidateRelay, RelayFallback: time.Second})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	if p.relay != nil {
+		t.Error("expected no relay fallback when relay is the only candidate type")
+	}
+	if got := p.pc.GetConfiguration().ICETransportPolicy; got != pion.ICETransportPolicyRelay {
+		t.Errorf("expected ICE transport policy relay, got %s", got)
+	}
+}
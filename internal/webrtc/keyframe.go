@@ -0,0 +1,55 @@
+package webrtc
+
+// H264 NAL unit types used by the output path.
+const (
+	naluTypeIDR = 5
+	naluTypeSEI = 6
+	naluTypeSPS = 7
+	naluTypePPS = 8
+	naluTypeAUD = 9
+
+	naluTypeEndOfSequence = 10
+)
+
+// endOfSequence is an end-of-sequence NAL unit. A decoder that meets one
+// expects the next picture to be an IDR, which makes it a clean seam
+// between two sessions' video in one output.
+var endOfSequence = []byte{naluTypeEndOfSequence}
+
+// keyframeGate holds back NAL units until the stream reaches a cleanly
+// decodable starting point: an IDR slice with SPS and PPS available.
+type keyframeGate struct {
+	open bool
+	sps  []byte
+	pps  []byte
+	// seam writes endOfSequence before the SPS when the gate opens.
+	seam bool
+}
+
+// Filter returns the NAL units to write for nalu. Until the gate opens,
+// parameter sets are cached and everything else is dropped. The first IDR
+// seen with both parameter sets cached is emitted as SPS, PPS, IDR and the
+// gate stays open from then on.
+func (g *keyframeGate) Filter(nalu []byte) [][]byte {
+	if g.open {
+		return [][]byte{nalu}
+	}
+
+	switch nalu[0] & 0x1f {
+	case naluTypeSPS:
+		g.sps = append([]byte(nil), nalu...)
+	case naluTypePPS:
+		g.pps = append([]byte(nil), nalu...)
+	case naluTypeIDR:
+		if g.sps != nil && g.pps != nil {
+			g.open = true
+			out := [][]byte{g.sps, g.pps, nalu}
+			if g.seam {
+				out = append([][]byte{endOfSequence}, out...)
+			}
+			g.sps, g.pps = nil, nil
+			return out
+		}
+	}
+	return nil
+}
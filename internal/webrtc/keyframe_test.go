@@ -0,0 +1,101 @@
+package webrtc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+)
+
+func TestKeyframeGate_DropsUntilIDRWithParameterSets(t *testing.T) {
+	g := &keyframeGate{}
+
+	sps := []byte{0x67, 0x64, 0x00, 0x1f}
+	pps := []byte{0x68, 0xee}
+	idr := []byte{0x65, 0x88}
+	nonIDR := []byte{0x41, 0x9a}
+
+	// P-slice and an IDR without parameter sets are dropped.
+	if out := g.Filter(nonIDR); out != nil {
+		t.Fatalf("expected non-IDR to be dropped, got %d NALUs", len(out))
+	}
+	if out := g.Filter(idr); out != nil {
+		t.Fatalf("expected IDR without SPS/PPS to be dropped, got %d NALUs", len(out))
+	}
+
+	// Parameter sets are cached, not emitted.
+	if out := g.Filter(sps); out != nil {
+		t.Fatalf("expected SPS to be held, got %d NALUs", len(out))
+	}
+	if out := g.Filter(pps); out != nil {
+		t.Fatalf("expected PPS to be held, got %d NALUs", len(out))
+	}
+
+	out := g.Filter(idr)
+	if len(out) != 3 {
+		t.Fatalf("expected SPS, PPS, IDR, got %d NALUs", len(out))
+	}
+	for i, want := range [][]byte{sps, pps, idr} {
+		if !bytes.Equal(out[i], want) {
+			t.Errorf("NALU %d: expected %v, got %v", i, want, out[i])
+		}
+	}
+
+	// Once open, everything passes through unchanged.
+	out = g.Filter(nonIDR)
+	if len(out) != 1 || !bytes.Equal(out[0], nonIDR) {
+		t.Errorf("expected non-IDR to pass after keyframe, got %v", out)
+	}
+}
+
+func TestKeyframeGate_SeamMarksEndOfSequence(t *testing.T) {
+	g := &keyframeGate{seam: true}
+	sps := []byte{0x67, 0x64, 0x00, 0x1f}
+	pps := []byte{0x68, 0xee}
+	idr := []byte{0x65, 0x88}
+
+	g.Filter(sps)
+	g.Filter(pps)
+	out := g.Filter(idr)
+	if len(out) != 4 {
+		t.Fatalf("expected end of sequence, SPS, PPS, IDR, got %d NALUs", len(out))
+	}
+	if out[0][0]&0x1f != naluTypeEndOfSequence {
+		t.Errorf("expected end of sequence first, got type %d", out[0][0]&0x1f)
+	}
+	if out := g.Filter(idr); len(out) != 1 {
+		t.Errorf("expected the marker only once, got %d NALUs for the next IDR", len(out))
+	}
+}
+
+func TestVideoReceiver_KeyframeIntervalRequestsWhenNoneArrive(t *testing.T) {
+	p := newTestPeer(t, Options{KeyframeInterval: 2 * time.Second})
+	clk := clock.NewFake(time.Now())
+	p.SetClock(clk)
+
+	requested := make(chan struct{}, 1)
+	v := p.newVideoReceiver(90000, io.Discard, false, func() {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+	})
+	defer v.Close()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	select {
+	case <-requested:
+		t.Fatal("expected no keyframe request before the interval")
+	default:
+	}
+
+	clk.Advance(time.Second)
+	select {
+	case <-requested:
+	case <-time.After(time.Second):
+		t.Fatal("expected a keyframe request when no keyframe arrived")
+	}
+}
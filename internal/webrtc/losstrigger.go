@@ -0,0 +1,56 @@
+package webrtc
+
+import "time"
+
+// LossRecoveryOptions requests a keyframe once packet loss is heavy enough
+// to corrupt the picture until the next one, rather than on every loss as
+// KeyframeOnLoss does.
+type LossRecoveryOptions struct {
+	// Threshold is the number of lost packets within Window that triggers
+	// a keyframe request. Zero disables loss recovery.
+	Threshold int
+	Window    time.Duration
+	// Cooldown is the minimum time between loss-triggered requests, which
+	// gives the camera time to answer the previous one.
+	Cooldown time.Duration
+}
+
+// lossTrigger counts lost packets over a sliding window and reports when
+// they reach the threshold, at most once per cooldown.
+type lossTrigger struct {
+	opts   LossRecoveryOptions
+	losses []lossEvent
+	total  int // sum of losses[].n
+	last   time.Time
+}
+
+type lossEvent struct {
+	at time.Time
+	n  int
+}
+
+func newLossTrigger(opts LossRecoveryOptions) *lossTrigger {
+	return &lossTrigger{opts: opts}
+}
+
+// Lost records n packets lost at now and reports whether to request a
+// keyframe.
+func (l *lossTrigger) Lost(now time.Time, n uint64) bool {
+	cutoff := now.Add(-l.opts.Window)
+	i := 0
+	for ; i < len(l.losses) && !l.losses[i].at.After(cutoff); i++ {
+		l.total -= l.losses[i].n
+	}
+	l.losses = l.losses[i:]
+	// A gap can be huge after a stall; cap it so the sum cannot overflow.
+	c := int(min(n, uint64(l.opts.Threshold)))
+	l.losses = append(l.losses, lossEvent{now, c})
+	l.total += c
+
+	if l.total < l.opts.Threshold || (!l.last.IsZero() && now.Sub(l.last) < l.opts.Cooldown) {
+		return false
+	}
+	l.last = now
+	l.losses, l.total = l.losses[:0], 0
+	return true
+}
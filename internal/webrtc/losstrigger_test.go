@@ -0,0 +1,89 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+)
+
+func TestLossTrigger(t *testing.T) {
+	type loss struct {
+		at   time.Duration
+		n    uint64
+		want bool
+	}
+	opts := LossRecoveryOptions{Threshold: 5, Window: time.Second, Cooldown: 2 * time.Second}
+	tests := []struct {
+		name   string
+		losses []loss
+	}{
+		{"below threshold", []loss{{0, 2, false}, {100 * time.Millisecond, 2, false}}},
+		{"reaches threshold", []loss{{0, 2, false}, {100 * time.Millisecond, 3, true}}},
+		{"one large gap", []loss{{0, 40000, true}}},
+		{"spread beyond the window", []loss{{0, 3, false}, {1500 * time.Millisecond, 3, false}}},
+		{"cooldown", []loss{{0, 5, true}, {1500 * time.Millisecond, 5, false}, {2100 * time.Millisecond, 1, true}}},
+	}
+	start := time.Now()
+	for _, tt := range tests {
+		l := newLossTrigger(opts)
+		for i, loss := range tt.losses {
+			if got := l.Lost(start.Add(loss.at), loss.n); got != loss.want {
+				t.Errorf("%s: loss %d: expected %v, got %v", tt.name, i, loss.want, got)
+			}
+		}
+	}
+}
+
+func TestVideoReceiver_RecoversFromHeavyLoss(t *testing.T) {
+	p, v := newTestReceiver(t, Options{
+		LossRecovery: LossRecoveryOptions{Threshold: 3, Window: time.Second, Cooldown: time.Second},
+	})
+	clk := clock.NewFake(time.Now())
+	p.SetClock(clk)
+	// Loss requests keyframes from Handle, so nothing else calls this.
+	requests := 0
+	v.requestKeyframe = func() { requests++ }
+	slice := []byte{0x41, 0x9a, 0x02}
+	idr := []byte{0x65, 0x88, 0x84}
+
+	// Two single losses stay under the threshold; the third reaches it.
+	for i, seq := range []uint16{0, 2, 4} {
+		v.Handle(seq, uint32(i)*3000, true, slice)
+		clk.Advance(100 * time.Millisecond)
+	}
+	if requests != 0 || p.Stats().Recovering {
+		t.Fatalf("expected no request for two lost packets, got %d", requests)
+	}
+	v.Handle(6, 9000, true, slice)
+	if requests != 1 || !p.Stats().Recovering {
+		t.Fatalf("expected a request and the recovering state after three lost packets, got %d requests, recovering %v",
+			requests, p.Stats().Recovering)
+	}
+	v.Handle(7, 12000, true, idr)
+	if p.Stats().Recovering {
+		t.Error("expected the keyframe to end the recovering state")
+	}
+}
+
+func TestVideoReceiver_ReorderingCountsEachGapOnce(t *testing.T) {
+	p, v := newTestReceiver(t, Options{
+		LossRecovery: LossRecoveryOptions{Threshold: 3, Window: time.Second, Cooldown: time.Second},
+	})
+	clk := clock.NewFake(time.Now())
+	p.SetClock(clk)
+	requests := 0
+	v.requestKeyframe = func() { requests++ }
+	slice := []byte{0x41, 0x9a, 0x02}
+
+	// Two packets arrive one late. Each swap is a gap of one when it
+	// opens, two in all, under the threshold; a late packet rewinding the
+	// last sequence number would count the next gap twice and reach it.
+	for i, seq := range []uint16{0, 2, 1, 4, 3, 5} {
+		v.Handle(seq, uint32(i)*3000, true, slice)
+		clk.Advance(10 * time.Millisecond)
+	}
+	if requests != 0 || p.Stats().Recovering {
+		t.Errorf("expected reordering alone not to trigger recovery, got %d requests", requests)
+	}
+}
@@ -0,0 +1,214 @@
+package webrtc
+
+import (
+	"log"
+	"time"
+
+	"vico_home/native/internal/domain"
+)
+
+// MotionOptions writes the main video only while the stream suggests
+// activity in the picture, to save storage on mostly static scenes.
+//
+// It is not motion detection: nothing is decoded. Two signs of activity
+// are read from the H264 stream itself. A frame much larger than the
+// recent average means more of the picture changed, and a keyframe well
+// before the camera's usual interval is often one it forced on motion.
+// Both have false positives and negatives. Noise in low light, rain, a
+// swaying tree or a camera switching to night mode grow frames too; slow
+// movement in a small part of the picture may not grow them at all; a
+// keyframe requested here after packet loss, or by -keyframe-interval,
+// looks like a forced one; and a camera that encodes at a constant
+// bitrate keeps frame sizes flat whatever happens. Sustained activity
+// also raises the average it is compared with, so a long one may stop
+// being noticed until it settles.
+type MotionOptions struct {
+	// Sensitivity, if positive, enables motion recording: a frame counts
+	// as activity when it is this many times the average of recent
+	// non-keyframes, e.g. 2. Lower is more sensitive.
+	Sensitivity float64
+	// Hold keeps writing for this long after the last sign of activity.
+	// Zero uses domain.DefaultMotionHold.
+	Hold time.Duration
+}
+
+const (
+	// motionWarmup is the number of frames averaged before a frame size
+	// can count as activity.
+	motionWarmup = 30
+	// motionAverageWeight is the weight of each new frame in the running
+	// average of frame sizes.
+	motionAverageWeight = 1.0 / 64
+	// motionEarlyKeyframe is the fraction of the usual keyframe interval
+	// below which a keyframe counts as forced.
+	motionEarlyKeyframe = 0.5
+	// motionBufferLimit caps the GOP held back while quiet. A longer GOP
+	// is dropped, so activity in it is written from the next keyframe.
+	motionBufferLimit = 16 << 20
+)
+
+// motionRecorder sits in front of a receiver's write function and passes
+// video through only while recording. While quiet it holds back the GOP
+// since the last keyframe, so a recording starts at that keyframe and the
+// output stays decodable; it also gives a few seconds before the activity.
+// A recording ends at the first keyframe after Hold passes quietly.
+type motionRecorder struct {
+	opts      MotionOptions
+	now       func() time.Time
+	write     func(nalus [][]byte, auStart bool) writeResult
+	wroteHeld func(n int)
+
+	recording  bool
+	lastActive time.Time
+
+	// Held back while quiet: the batches since the last keyframe, or since
+	// the start of the frame containing it.
+	held       []naluBatch
+	heldBytes  int
+	frameStart int  // index in held of the current frame's first batch
+	keyframe   bool // held starts at a keyframe
+
+	// The current frame's size so far and whether it counted already.
+	frameBytes  int
+	frameActive bool
+	frameIDR    bool
+
+	avgSize     float64
+	frames      int
+	lastIDR     time.Time
+	idrInterval time.Duration // running average, 0 until two are seen
+}
+
+// newMotionRecorder returns a recorder passing video on to write. When a
+// recording starts, wroteHeld is told how many access units held back
+// from earlier calls were written with the current one.
+func newMotionRecorder(opts MotionOptions, now func() time.Time, write func(nalus [][]byte, auStart bool) writeResult, wroteHeld func(n int)) *motionRecorder {
+	if opts.Hold <= 0 {
+		opts.Hold = domain.DefaultMotionHold
+	}
+	return &motionRecorder{opts: opts, now: now, write: write, wroteHeld: wroteHeld}
+}
+
+// Write takes the place of the receiver's write function. It reports
+// withheld for video it holds back or drops while quiet.
+func (m *motionRecorder) Write(nalus [][]byte, auStart bool) writeResult {
+	now := m.now()
+	if auStart {
+		m.endFrame()
+		m.frameStart = len(m.held)
+	}
+	idr, _, _ := classifyFrame(nalus)
+	active := false
+	if idr && !m.frameIDR {
+		m.frameIDR = true
+		active = m.keyframeActive(now)
+	}
+	for _, nalu := range nalus {
+		m.frameBytes += len(nalu)
+	}
+	if !m.frameIDR && !m.frameActive && m.frames >= motionWarmup &&
+		float64(m.frameBytes) > m.opts.Sensitivity*m.avgSize {
+		m.frameActive = true
+		active = true
+	}
+	if active {
+		m.lastActive = now
+	}
+
+	if m.recording && idr && now.Sub(m.lastActive) >= m.opts.Hold {
+		m.recording = false
+		log.Printf("[webrtc] motion: quiet for %s, pausing the recording", m.opts.Hold)
+	}
+	if m.recording {
+		return m.write(nalus, auStart)
+	}
+
+	if idr {
+		// A new GOP: what was held before it is no longer needed.
+		m.held = append(m.held[:0], m.held[m.frameStart:]...)
+		m.heldBytes = 0
+		for _, b := range m.held {
+			m.heldBytes += batchBytes(b)
+		}
+		m.frameStart = 0
+		m.keyframe = true
+	}
+	if m.keyframe {
+		m.held = append(m.held, naluBatch{nalus, auStart})
+		m.heldBytes += batchBytes(m.held[len(m.held)-1])
+	}
+	if m.heldBytes > motionBufferLimit {
+		m.held, m.heldBytes, m.frameStart, m.keyframe = m.held[:0], 0, 0, false
+	}
+	// Activity since the GOP began, perhaps while it was held back in
+	// full, starts the recording as well.
+	if !m.keyframe || m.lastActive.IsZero() || now.Sub(m.lastActive) >= m.opts.Hold {
+		return withheld
+	}
+
+	log.Printf("[webrtc] motion: activity, recording from the last keyframe")
+	m.recording = true
+	held := m.held
+	m.held, m.heldBytes, m.frameStart, m.keyframe = nil, 0, 0, false
+	// The last batch held is this call's own.
+	for i, b := range held {
+		if m.write(b.nalus, b.auStart) == writeFailed {
+			m.wroteHeld(accessUnits(held[:i]))
+			return writeFailed
+		}
+	}
+	m.wroteHeld(accessUnits(held[:len(held)-1]))
+	return written
+}
+
+// accessUnits counts the batches that start an access unit, which under
+// LowLatency is one of several per picture.
+func accessUnits(batches []naluBatch) int {
+	n := 0
+	for _, b := range batches {
+		if b.auStart {
+			n++
+		}
+	}
+	return n
+}
+
+// keyframeActive records a keyframe at now and reports whether it came
+// early enough to count as forced.
+func (m *motionRecorder) keyframeActive(now time.Time) bool {
+	defer func() { m.lastIDR = now }()
+	if m.lastIDR.IsZero() {
+		return false
+	}
+	interval := now.Sub(m.lastIDR)
+	if m.idrInterval == 0 {
+		m.idrInterval = interval
+		return false
+	}
+	early := float64(interval) < motionEarlyKeyframe*float64(m.idrInterval)
+	if !early {
+		// Forced keyframes are left out of the usual interval.
+		m.idrInterval += (interval - m.idrInterval) / 4
+	}
+	return early
+}
+
+// endFrame folds the finished frame into the size average. Keyframes are
+// left out: they are always large.
+func (m *motionRecorder) endFrame() {
+	if m.frameBytes > 0 && !m.frameIDR {
+		// A plain mean until there are enough frames for the running one.
+		m.frames++
+		weight := max(1/float64(m.frames), motionAverageWeight)
+		m.avgSize += (float64(m.frameBytes) - m.avgSize) * weight
+	}
+	m.frameBytes, m.frameActive, m.frameIDR = 0, false, false
+}
+
+func batchBytes(b naluBatch) int {
+	n := 0
+	for _, nalu := range b.nalus {
+		n += len(nalu)
+	}
+	return n
+}
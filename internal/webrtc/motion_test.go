@@ -0,0 +1,156 @@
+package webrtc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// motionStream feeds a motionRecorder at 10 frames a second with a
+// keyframe every 20 frames and records what it writes.
+type motionStream struct {
+	t       *testing.T
+	now     time.Time
+	rec     *motionRecorder
+	frame   int
+	written []int // frame numbers written, in order
+	counted int   // frames reported written, by Write or wroteHeld
+}
+
+func newMotionStream(t *testing.T, opts MotionOptions) *motionStream {
+	s := &motionStream{t: t, now: time.Unix(1700000000, 0)}
+	s.rec = newMotionRecorder(opts, func() time.Time { return s.now }, func(nalus [][]byte, auStart bool) writeResult {
+		if !auStart {
+			t.Errorf("expected whole access units, got a continuation")
+		}
+		s.written = append(s.written, int(nalus[len(nalus)-1][1]))
+		return written
+	}, func(n int) { s.counted += n })
+	return s
+}
+
+// next feeds one frame of size bytes, a keyframe if idr.
+func (s *motionStream) next(idr bool, size int) {
+	s.t.Helper()
+	body := append([]byte{0x41, byte(s.frame)}, bytes.Repeat([]byte{0x5a}, size)...)
+	au := [][]byte{body}
+	if idr {
+		body[0] = 0x65
+		au = [][]byte{{0x67, 0x64, 0x00, 0x1f}, {0x68, 0xeb}, body}
+	}
+	switch s.rec.Write(au, true) {
+	case writeFailed:
+		s.t.Fatalf("frame %d: write failed", s.frame)
+	case written:
+		s.counted++
+	}
+	s.frame++
+	s.now = s.now.Add(100 * time.Millisecond)
+}
+
+// gop feeds frames up to the next regular keyframe, with a P-frame of
+// size big at index spike (relative to the GOP) if spike >= 0.
+func (s *motionStream) gop(spike, big int) {
+	for i := 0; i < 20; i++ {
+		size := 100
+		if i == spike {
+			size = big
+		}
+		s.next(i == 0, size)
+	}
+}
+
+func TestMotionRecorder_RecordsFromKeyframeOnLargeFrame(t *testing.T) {
+	s := newMotionStream(t, MotionOptions{Sensitivity: 2, Hold: 3 * time.Second})
+	s.gop(-1, 0)
+	s.gop(-1, 0)
+	if len(s.written) != 0 {
+		t.Fatalf("expected nothing written while quiet, got frames %v", s.written)
+	}
+
+	s.gop(5, 500) // frames 40 to 59, the spike at 45
+	if len(s.written) != 20 || s.written[0] != 40 || s.written[19] != 59 {
+		t.Fatalf("expected frames 40 to 59 written from their keyframe, got %v", s.written)
+	}
+	if s.counted != len(s.written) {
+		t.Errorf("expected the %d frames written counted, got %d", len(s.written), s.counted)
+	}
+
+	// Quiet: the recording holds 3s after the spike, then ends at the
+	// keyframe after that, frame 80.
+	s.gop(-1, 0)
+	s.gop(-1, 0)
+	s.gop(-1, 0)
+	if got := s.written[len(s.written)-1]; got != 79 {
+		t.Errorf("expected the recording to end before keyframe 80, last written %d", got)
+	}
+}
+
+func TestMotionRecorder_EarlyKeyframeIsActivity(t *testing.T) {
+	s := newMotionStream(t, MotionOptions{Sensitivity: 2, Hold: time.Second})
+	s.gop(-1, 0)
+	s.gop(-1, 0)
+	s.gop(-1, 0) // frames 0 to 59; the keyframe interval is 2s
+	for i := 0; i < 5; i++ {
+		s.next(i == 0, 100)
+	}
+	s.next(true, 1000) // frame 65, 0.5s after keyframe 60
+	if len(s.written) != 1 || s.written[0] != 65 {
+		t.Fatalf("expected the recording to start at the early keyframe, got %v", s.written)
+	}
+}
+
+func TestMotionRecorder_IgnoresSizeDuringWarmup(t *testing.T) {
+	s := newMotionStream(t, MotionOptions{Sensitivity: 2})
+	s.next(true, 1000)
+	s.next(false, 100)
+	s.next(false, 5000)
+	if len(s.written) != 0 || s.counted != 0 {
+		t.Errorf("expected nothing written or counted before the average settles, got %v and %d", s.written, s.counted)
+	}
+}
+
+func TestVideoReceiver_MotionWithheldVideoIsNotCounted(t *testing.T) {
+	p, v := newTestReceiver(t, Options{Motion: MotionOptions{Sensitivity: 2}})
+	firstFrame := false
+	p.SetOnFirstFrame(func() { firstFrame = true })
+	for i := 0; i < 10; i++ {
+		v.Handle(uint16(i), uint32(i)*9000, true, []byte{0x41, 0x9a, byte(i)})
+	}
+	if s := p.Stats(); s.AccessUnits != 0 || s.MediaTime != 0 || firstFrame {
+		t.Errorf("expected nothing counted while quiet, got %d access units, %s, first frame %v", s.AccessUnits, s.MediaTime, firstFrame)
+	}
+}
+
+func TestMotionRecorder_CountsHeldAccessUnitsNotBatches(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	batches, counted := 0, 0
+	rec := newMotionRecorder(MotionOptions{Sensitivity: 2}, func() time.Time { return now },
+		func([][]byte, bool) writeResult { batches++; return written },
+		func(n int) { counted += n })
+	// Each picture arrives as two batches, as under LowLatency.
+	picture := func(header byte, size int) writeResult {
+		half := bytes.Repeat([]byte{0x5a}, size/2)
+		rec.Write([][]byte{append([]byte{header}, half...)}, true)
+		now = now.Add(100 * time.Millisecond)
+		return rec.Write([][]byte{append([]byte{header}, half...)}, false)
+	}
+	picture(0x65, 1000)
+	for i := 0; i < motionWarmup; i++ {
+		picture(0x41, 100)
+	}
+	if batches != 0 {
+		t.Fatalf("expected nothing written while quiet, got %d batches", batches)
+	}
+
+	picture(0x41, 1000)
+	// The keyframe and the warmup pictures were held, two batches each;
+	// the spike's first batch started the recording and is the peer's to
+	// count.
+	if want := 1 + motionWarmup; counted != want {
+		t.Errorf("expected %d held access units counted, got %d", want, counted)
+	}
+	if want := 2 + 2*motionWarmup + 2; batches != want {
+		t.Errorf("expected %d batches written, got %d", want, batches)
+	}
+}
@@ -0,0 +1,79 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+)
+
+// NALURecord describes one depacketized NAL unit in a NALU log, which
+// holds one JSON record per line.
+type NALURecord struct {
+	Time         time.Time `json:"time"`
+	Sequence     uint16    `json:"seq"`          // RTP sequence number of the completing packet
+	RTPTimestamp uint32    `json:"rtpTimestamp"` // shared by the NAL units of one picture
+	Type         uint8     `json:"type"`
+	Name         string    `json:"name"`
+	RefIDC       uint8     `json:"refIdc"`
+	Size         int       `json:"size"`
+	Keyframe     bool      `json:"keyframe"` // an IDR slice
+}
+
+// naluTypeNames names the H.264 NAL unit types a camera sends.
+var naluTypeNames = map[uint8]string{
+	1:  "non-IDR",
+	2:  "partition A",
+	3:  "partition B",
+	4:  "partition C",
+	5:  "IDR",
+	6:  "SEI",
+	7:  "SPS",
+	8:  "PPS",
+	9:  "AUD",
+	10: "end of sequence",
+	11: "end of stream",
+	12: "filler",
+}
+
+// naluLogger writes a NALURecord per NAL unit. It is used from the video
+// read loop only.
+type naluLogger struct {
+	enc    *json.Encoder
+	failed bool // stop after the first write error
+}
+
+func newNALULogger(w io.Writer) *naluLogger {
+	return &naluLogger{enc: json.NewEncoder(w)}
+}
+
+// Log records the NAL units depacketized from the packet seq.
+func (l *naluLogger) Log(now time.Time, seq uint16, timestamp uint32, nalus [][]byte) {
+	for _, nalu := range nalus {
+		if l.failed {
+			return
+		}
+		if len(nalu) == 0 {
+			continue
+		}
+		typ := nalu[0] & 0x1f
+		name, ok := naluTypeNames[typ]
+		if !ok {
+			name = "unknown"
+		}
+		err := l.enc.Encode(NALURecord{
+			Time:         now,
+			Sequence:     seq,
+			RTPTimestamp: timestamp,
+			Type:         typ,
+			Name:         name,
+			RefIDC:       nalu[0] >> 5 & 0x03,
+			Size:         len(nalu),
+			Keyframe:     typ == naluTypeIDR,
+		})
+		if err != nil {
+			log.Printf("[webrtc] NALU log write error, disabling it: %v", err)
+			l.failed = true
+		}
+	}
+}
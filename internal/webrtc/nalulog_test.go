@@ -0,0 +1,52 @@
+package webrtc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestNALULogger_WritesRecordPerNALU(t *testing.T) {
+	var buf bytes.Buffer
+	l := newNALULogger(&buf)
+
+	now := time.Unix(1700000000, 0).UTC()
+	l.Log(now, 7, 90000, [][]byte{
+		{0x67, 0x42, 0x00, 0x1f},
+		{0x68, 0xce},
+		{0x65, 0x88, 0x84},
+		{},
+	})
+	l.Log(now, 8, 93000, [][]byte{{0x01, 0x9e}})
+
+	want := []NALURecord{
+		{Time: now, Sequence: 7, RTPTimestamp: 90000, Type: 7, Name: "SPS", RefIDC: 3, Size: 4},
+		{Time: now, Sequence: 7, RTPTimestamp: 90000, Type: 8, Name: "PPS", RefIDC: 3, Size: 2},
+		{Time: now, Sequence: 7, RTPTimestamp: 90000, Type: 5, Name: "IDR", RefIDC: 3, Size: 3, Keyframe: true},
+		{Time: now, Sequence: 8, RTPTimestamp: 93000, Type: 1, Name: "non-IDR", RefIDC: 0, Size: 2},
+	}
+
+	sc := bufio.NewScanner(&buf)
+	var got []NALURecord
+	for sc.Scan() {
+		var rec NALURecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("unmarshal %q: %v", sc.Text(), err)
+		}
+		got = append(got, rec)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) {
+			t.Errorf("record %d: expected time %v, got %v", i, want[i].Time, got[i].Time)
+		}
+		got[i].Time = want[i].Time
+		if got[i] != want[i] {
+			t.Errorf("record %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
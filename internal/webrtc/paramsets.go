@@ -0,0 +1,48 @@
+package webrtc
+
+import (
+	"bytes"
+	"time"
+)
+
+// paramSetDedup drops an SPS or PPS identical to the last one of its type
+// written within window. Cameras that aggregate SPS and PPS in a STAP-A
+// and also send them on their own, or the keyframe gate re-injecting its
+// cached copies, otherwise repeat them back to back. Once window has
+// passed an unchanged parameter set is written again, so a window shorter
+// than the keyframe interval still leaves them in front of every keyframe
+// for decoders that need it.
+type paramSetDedup struct {
+	window time.Duration
+	sps    paramSetSeen
+	pps    paramSetSeen
+}
+
+type paramSetSeen struct {
+	data []byte
+	at   time.Time
+}
+
+// Filter returns nalus without the repeated parameter sets. It reuses the
+// backing array of nalus.
+func (d *paramSetDedup) Filter(now time.Time, nalus [][]byte) [][]byte {
+	out := nalus[:0]
+	for _, nalu := range nalus {
+		var seen *paramSetSeen
+		switch nalu[0] & 0x1f {
+		case naluTypeSPS:
+			seen = &d.sps
+		case naluTypePPS:
+			seen = &d.pps
+		}
+		if seen != nil {
+			if bytes.Equal(nalu, seen.data) && now.Sub(seen.at) < d.window {
+				continue
+			}
+			seen.data = append(seen.data[:0], nalu...)
+			seen.at = now
+		}
+		out = append(out, nalu)
+	}
+	return out
+}
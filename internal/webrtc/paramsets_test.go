@@ -0,0 +1,37 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParamSetDedup(t *testing.T) {
+	sps := []byte{0x67, 0x64, 0x00, 0x1f}
+	sps2 := []byte{0x67, 0x64, 0x00, 0x28}
+	pps := []byte{0x68, 0xee}
+	idr := []byte{0x65, 0x88}
+
+	d := &paramSetDedup{window: time.Second}
+	t0 := time.Unix(0, 0)
+
+	tests := []struct {
+		name  string
+		at    time.Duration
+		in    [][]byte
+		wantN int
+	}{
+		{"first keyframe", 0, [][]byte{sps, pps, idr}, 3},
+		{"repeat within window", 10 * time.Millisecond, [][]byte{sps, pps, sps, pps, idr}, 1},
+		{"changed SPS", 20 * time.Millisecond, [][]byte{sps2, pps, idr}, 2},
+		{"repeat after window", 2 * time.Second, [][]byte{sps2, pps, idr}, 3},
+	}
+	for _, tt := range tests {
+		out := d.Filter(t0.Add(tt.at), append([][]byte(nil), tt.in...))
+		if len(out) != tt.wantN {
+			t.Errorf("%s: expected %d NALUs, got %d", tt.name, tt.wantN, len(out))
+		}
+		if last := out[len(out)-1]; last[0] != idr[0] {
+			t.Errorf("%s: expected IDR last, got type %d", tt.name, last[0]&0x1f)
+		}
+	}
+}
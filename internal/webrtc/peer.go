@@ -1,39 +1,365 @@
 package webrtc
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"slices"
 	"strconv"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"vico_home/native/internal/clock"
 	"vico_home/native/internal/domain"
+	"vico_home/native/internal/logging"
 
 	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/nack"
+	"github.com/pion/rtcp"
+	"github.com/pion/transport/v3"
 	pion "github.com/pion/webrtc/v4"
 )
 
+// Options tunes the peer's media handling. The zero value writes every
+// NAL unit as soon as it is depacketized.
+type Options struct {
+	// WaitKeyframe discards NAL units until the first IDR slice with SPS
+	// and PPS, so the output starts at a decodable point.
+	WaitKeyframe bool
+	// Resume means the output already holds video from an earlier
+	// session, as after a reconnect. The main stream then waits for a
+	// keyframe, requested at once, as with WaitKeyframe, and writes an
+	// end-of-sequence NAL unit before it to mark the seam.
+	Resume bool
+	// Timeouts supplies the peer's time limits. FirstFrame reports an
+	// error if WaitKeyframe is set and no keyframe arrives within it of
+	// connecting, whether or not a video track has arrived by then, Stall
+	// reports ErrMediaStall when video stops arriving after it started,
+	// and ICE replaces pion's 25s failed timeout. Zero leaves each off.
+	Timeouts domain.Timeouts
+	// TrackTimeout, if positive, logs a diagnostic when the connection is
+	// up but no video track has arrived this long after. It does not apply
+	// with ControlOnly.
+	TrackTimeout time.Duration
+	// FailWithoutTrack also reports ErrNoTrack through the error callback
+	// when TrackTimeout passes without a video track.
+	FailWithoutTrack bool
+	// ValidateAnswer checks the camera's SDP answer with ValidateAnswer
+	// before applying it, so a session without video fails at once.
+	ValidateAnswer bool
+	// H264Profile is the H264 format offered. Zero offers
+	// DefaultH264Profile.
+	H264Profile domain.H264Profile
+	// MaxReassemblySize caps NAL units reassembled from FU-A fragments.
+	// Zero uses DefaultMaxReassemblySize.
+	MaxReassemblySize int
+	// MaxNALUSize, if positive, drops any NAL unit larger than this
+	// before it is written, counting it in Stats.OversizeNALUs, as a
+	// guard against depacketizer bugs writing garbage. A dropped IDR is
+	// followed by a keyframe request. Set it at most MaxReassemblySize,
+	// which already bounds fragmented units.
+	MaxNALUSize int
+	// LowLatency trades robustness for freshness: NAL units are written as
+	// each packet arrives instead of per access unit, a slow output drops
+	// the oldest pending video instead of stalling, and packet loss
+	// triggers an immediate keyframe request. There is no jitter buffer
+	// to turn off: packets are depacketized in arrival order either way.
+	LowLatency bool
+	// KeyframeInterval, if positive, requests a keyframe whenever none
+	// has arrived for this long, for cameras that otherwise send one only
+	// at the start. Cameras that send keyframes more often never see a
+	// request.
+	KeyframeInterval time.Duration
+	// KeyframeOnLoss requests a keyframe as soon as packet loss is seen,
+	// as LowLatency does, without LowLatency's other trade-offs.
+	KeyframeOnLoss bool
+	// LossRecovery requests a keyframe when loss within a window reaches
+	// a threshold; see LossRecoveryOptions.
+	LossRecovery LossRecoveryOptions
+	// ICECandidateInterval spaces out sending local ICE candidates so a
+	// burst from gathering does not flood the signaling server. Zero sends
+	// each candidate as soon as it is gathered.
+	ICECandidateInterval time.Duration
+	// ICECandidates limits the local candidate types gathered and sent;
+	// zero sends all of them. A connection that cannot come up over the
+	// types left out fails.
+	ICECandidates domain.CandidateTypes
+	// RelayFallback, if positive, holds back relay candidates until the
+	// connection has not come up over host and srflx candidates for this
+	// long after the first candidate was gathered. Direct paths connect
+	// faster when the camera does not also try its relay pairs. It is
+	// ignored when ICECandidates allows relay candidates only.
+	RelayFallback time.Duration
+	// Resolution is requested for the main stream, e.g. "1920x1080".
+	// Empty uses DefaultResolution.
+	Resolution string
+	// Size is the stream size named in startLive alongside Resolution,
+	// e.g. "medium". Empty uses DefaultSize.
+	Size string
+	// StrictResolution reports ErrResolutionMismatch when the stream's
+	// SPS does not match Resolution. Without it a mismatch is logged.
+	StrictResolution bool
+	// NoAudio leaves audio out of the session: no audio transceiver is
+	// offered and an audio m-line in a camera's offer is rejected.
+	NoAudio bool
+	// ControlOnly skips the startLive command when the DataChannel opens,
+	// for sessions that only exchange control messages.
+	ControlOnly bool
+	// DataChannel configures the control channel the startLive command
+	// is sent on.
+	DataChannel DataChannelOptions
+	// AnsweringDTLSRole forces the DTLS role taken when answering the
+	// camera's offer, for firmwares that fail the handshake otherwise. As
+	// the offerer the peer offers a=setup:actpass, the camera's answer
+	// picks the role and this is unused.
+	AnsweringDTLSRole domain.DTLSRole
+	// NACK selects which NACK interceptors are registered; the zero value
+	// registers both, like Pion's defaults.
+	NACK NACKMode
+	// DTLSKeyLog, if set, receives the DTLS session secrets in NSS key log
+	// format, for decrypting a packet capture. It defeats the encryption
+	// of the session for anyone holding the file.
+	DTLSKeyLog io.Writer
+	// DropFrames is the fraction, from 0 to 1, of frames between keyframes
+	// to leave out of the output, for viewers or links that cannot keep
+	// up. Keyframes are always written. See frameThinner for how this
+	// affects the picture.
+	DropFrames float64
+	// Motion, if its Sensitivity is set, writes the main video only while
+	// frame sizes and keyframes suggest activity; see MotionOptions.
+	Motion MotionOptions
+	// UDPPortMin and UDPPortMax, if set, limit the local UDP ports ICE
+	// gathers candidates on, for firewalls that only open a known range.
+	UDPPortMin, UDPPortMax uint16
+	// DSCP, if positive, marks the media UDP packets with this DSCP
+	// value, e.g. 46 (EF), on a best-effort basis; see dscpNet.
+	DSCP int
+	// network, if set, replaces the host network pion gathers on and
+	// sends through, so tests can connect peers over pion's virtual
+	// network; see vnet_test.go.
+	network transport.Net
+	// StripNALUTypes lists NAL unit types dropped after depacketization,
+	// for decoders that choke on SEI, delimiters or filler data.
+	StripNALUTypes []uint8
+	// InsertAUD writes an access unit delimiter at the start of each
+	// access unit that lacks one, for parsers that rely on them to find
+	// picture boundaries.
+	InsertAUD bool
+	// Timestamps writes an SEI NAL unit with the picture's wall-clock
+	// capture time at the start of each access unit; see
+	// ParseTimestampSEI. The time comes from the camera's RTCP sender
+	// reports, or the arrival time until the first one.
+	Timestamps bool
+	// NALULog, if set, receives a JSON line per depacketized NAL unit
+	// with its type, size and RTP timestamp; see NALURecord.
+	NALULog io.Writer
+	// ErrorDump, if set, receives a JSON line per main-stream RTP packet
+	// the depacketizer discards and per sequence gap, with the raw
+	// payload and the reason; see DroppedPacket.
+	ErrorDump io.Writer
+	// DedupParameterSets, if positive, drops an SPS or PPS identical to
+	// the last one written less than this long ago; see paramSetDedup.
+	// Zero writes every parameter set the camera sends.
+	DedupParameterSets time.Duration
+	// Preview requests a second, lower-resolution video stream; see
+	// PreviewOptions.
+	Preview PreviewOptions
+	// VideoTrack, if set, selects the main video track by its track ID,
+	// RID or SSRC, for cameras that send more than one track on the main
+	// stream. Empty takes the first. Either way only one track is read
+	// per output; the others are discarded.
+	VideoTrack string
+}
+
+// PreviewOptions configures a secondary video stream, such as a live
+// thumbnail, received alongside the main one. The camera is asked for it
+// with a second startLive on an extra video transceiver, with size
+// "small". That value is a guess, not documented protocol: firmwares with
+// a single encoder may ignore it, reject it, which is logged and leaves
+// the session running, or serve it by switching the main stream to the
+// smaller size.
+type PreviewOptions struct {
+	// Out receives the preview as an H264 Annex B stream. Nil disables
+	// the preview.
+	Out io.Writer
+	// Resolution is requested for the preview, e.g. "640x360".
+	Resolution string
+}
+
+// previewWait is how long after the main video starts a missing preview
+// stream is reported.
+const previewWait = 10 * time.Second
+
+// DataChannelOptions configures the control DataChannel. The zero value
+// creates an ordered, reliable channel labelled with the serial number,
+// which is what the app does; some camera firmwares expect otherwise.
+type DataChannelOptions struct {
+	// Label names the channel. Empty uses the serial number.
+	Label string
+	// Unordered allows messages to be delivered out of order.
+	Unordered bool
+	// MaxRetransmits, if set, makes the channel partially reliable with
+	// at most this many retransmissions per message.
+	MaxRetransmits *uint16
+	// Protocol is the subprotocol announced for the channel.
+	Protocol string
+	// OpenTimeout, if positive, logs a diagnostic when the connection is
+	// up but the channel has not opened this long after, since without it
+	// startLive is never sent and no media starts.
+	OpenTimeout time.Duration
+	// FailIfNotOpen also reports ErrDataChannelTimeout through the error
+	// callback when OpenTimeout passes, so the session can be retried.
+	FailIfNotOpen bool
+}
+
+// NACKMode selects the NACK handling of the peer. The generator asks the
+// camera to retransmit lost video packets; the responder answers NACKs for
+// media we send, which a receive-only viewer never does. Some firmwares
+// misbehave on either, so both can be turned off for interop testing.
+type NACKMode string
+
+const (
+	// NACKOn registers the generator and the responder.
+	NACKOn NACKMode = ""
+	// NACKNoResponder registers only the generator.
+	NACKNoResponder NACKMode = "no-responder"
+	// NACKOff registers neither and does not offer NACK feedback. Lost
+	// packets are then only recovered by the next keyframe.
+	NACKOff NACKMode = "off"
+)
+
+// ParseNACKMode converts a command-line value ("on", "no-responder" or
+// "off") to a NACKMode.
+func ParseNACKMode(s string) (NACKMode, error) {
+	switch s {
+	case "", "on":
+		return NACKOn, nil
+	case "no-responder", "off":
+		return NACKMode(s), nil
+	default:
+		return "", fmt.Errorf("invalid NACK mode %q (want on, no-responder or off)", s)
+	}
+}
+
+// init returns the Pion settings for o, or nil for the defaults.
+func (o DataChannelOptions) init() *pion.DataChannelInit {
+	if !o.Unordered && o.MaxRetransmits == nil && o.Protocol == "" {
+		return nil
+	}
+	ordered := !o.Unordered
+	init := &pion.DataChannelInit{Ordered: &ordered, MaxRetransmits: o.MaxRetransmits}
+	if o.Protocol != "" {
+		init.Protocol = &o.Protocol
+	}
+	return init
+}
+
+// lowLatencyQueueSize is the number of packets' worth of NAL units held
+// for a slow output in low-latency mode before the oldest are dropped.
+const lowLatencyQueueSize = 64
+
+// keyframeRequestInterval limits how often loss triggers a PLI.
+const keyframeRequestInterval = 500 * time.Millisecond
+
+// pion's ICE disconnected timeout and keepalive interval, kept when
+// Options.Timeouts.ICE replaces its failed timeout.
+const (
+	iceDisconnectedTimeout = 5 * time.Second
+	iceKeepaliveInterval   = 2 * time.Second
+)
+
 // Peer wraps a Pion PeerConnection and DataChannel.
 type Peer struct {
 	pc            *pion.PeerConnection
 	dc            *pion.DataChannel
 	serialNumber  string
+	opts          Options
+	interceptors  []string // names of the interceptors registered, as reported by ReadCapabilities
 	remoteDescSet chan struct{}
+	remoteSetOnce sync.Once
+
+	// The callbacks are set before the connection is established and
+	// only read afterwards, from Pion's goroutines.
+	onError       func(error)
+	onControl     func(ControlMessage)
+	onControlOpen func()
+	onState       func(state string)
+	onFirstFrame  func()
+	onAccessUnit  func(AccessUnit)
+	naluProcessor func(nalu []byte) []byte
+
+	// out and previewOut serialize NAL unit writes to each output with
+	// Shutdown, so both always end on a NAL boundary and a blocked preview
+	// reader does not hold up the main video.
+	out, previewOut videoOutput
+
+	// lastKeyframeRequest and lastPreviewKeyframeRequest are the
+	// UnixNano times of the last PLI for each stream, so keyframes can be
+	// requested from any goroutine.
+	lastKeyframeRequest        atomic.Int64
+	lastPreviewKeyframeRequest atomic.Int64
+	previewSeen                atomic.Bool
+	videoSeen                  atomic.Bool
+	keyframeSeen               atomic.Bool // the main stream's keyframe wait has opened
+	watchTrackOnce             sync.Once
+	watchKeyframeOnce          sync.Once
+	watchDataChannelOnce       sync.Once
+
+	// lastRequestID is the last request ID sent on the control channel,
+	// and mainRequestID and previewRequestID those of the two streams'
+	// startLive, 0 if none.
+	lastRequestID    atomic.Int64
+	mainRequestID    atomic.Int64
+	previewRequestID atomic.Int64
+
+	// negotiated is set once the first offer/answer exchange completed;
+	// only changes after that need renegotiating.
+	negotiated atomic.Bool
+
+	// relay holds back relay candidates under Options.RelayFallback; nil
+	// without it. created is when NewPeer ran, for the time to connect.
+	relay   *relayFallback
+	created time.Time
+
+	clock clock.Clock
+
+	// statsMu guards stats, previewStats and ice, which the track goroutines
+	// update while Stats may be called from anywhere.
+	statsMu      sync.Mutex
+	stats        Stats
+	previewStats Stats
+	ice          connectivity
+	// bitrate and previewBitrate meter each stream's payload, also under
+	// statsMu.
+	bitrate        bitrateMeter
+	previewBitrate bitrateMeter
+	// rtt caches the round trip time for Stats between refreshes.
+	// pcStats is pc.GetStats, replaced in tests.
+	rtt     rttCache
+	pcStats func() pion.StatsReport
+
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 // NewPeer creates a PeerConnection with minimal codec registration and a DataChannel.
-func NewPeer(iceServers []domain.ICEServer, serialNumber string) (*Peer, error) {
+func NewPeer(iceServers []domain.ICEServer, serialNumber string, opts Options) (*Peer, error) {
 	m := &pion.MediaEngine{}
 
+	if opts.H264Profile == (domain.H264Profile{}) {
+		opts.H264Profile = DefaultH264Profile
+	}
 	h264Codec := pion.RTPCodecParameters{
 		RTPCodecCapability: pion.RTPCodecCapability{
 			MimeType:    pion.MimeTypeH264,
 			ClockRate:   90000,
-			SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=64001f",
+			SDPFmtpLine: fmtpLine(opts.H264Profile),
 		},
-		PayloadType: 121,
+		PayloadType: h264PayloadType,
 	}
 	if err := m.RegisterCodec(h264Codec, pion.RTPCodecTypeVideo); err != nil {
 		return nil, fmt.Errorf("register H264: %w", err)
@@ -47,22 +373,67 @@ func NewPeer(iceServers []domain.ICEServer, serialNumber string) (*Peer, error)
 		},
 		PayloadType: 0,
 	}
-	if err := m.RegisterCodec(pcmuCodec, pion.RTPCodecTypeAudio); err != nil {
-		return nil, fmt.Errorf("register PCMU: %w", err)
+	if !opts.NoAudio {
+		if err := m.RegisterCodec(pcmuCodec, pion.RTPCodecTypeAudio); err != nil {
+			return nil, fmt.Errorf("register PCMU: %w", err)
+		}
 	}
 
 	i := &interceptor.Registry{}
-	if err := pion.RegisterDefaultInterceptors(m, i); err != nil {
-		return nil, fmt.Errorf("register default interceptors: %w", err)
+	interceptors, err := registerInterceptors(m, i, opts.NACK)
+	if err != nil {
+		return nil, fmt.Errorf("register interceptors: %w", err)
 	}
 
+	// With relay the only type allowed there is nothing to fall back from.
+	relayFallbackOn := opts.RelayFallback > 0 && (opts.ICECandidates == 0 || opts.ICECandidates&domain.CandidateRelay != 0 && opts.ICECandidates != domain.CandidateRelay)
+
+	se := pion.SettingEngine{}
+	switch opts.AnsweringDTLSRole {
+	case domain.DTLSRoleClient:
+		err = se.SetAnsweringDTLSRole(pion.DTLSRoleClient)
+	case domain.DTLSRoleServer:
+		err = se.SetAnsweringDTLSRole(pion.DTLSRoleServer)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("DTLS role: %w", err)
+	}
+	if opts.DTLSKeyLog != nil {
+		se.SetDTLSKeyLogWriter(opts.DTLSKeyLog)
+	}
+	if opts.Timeouts.ICE > 0 {
+		se.SetICETimeouts(min(iceDisconnectedTimeout, opts.Timeouts.ICE), opts.Timeouts.ICE, iceKeepaliveInterval)
+	}
+	if opts.UDPPortMax > 0 {
+		if err := se.SetEphemeralUDPPortRange(opts.UDPPortMin, opts.UDPPortMax); err != nil {
+			return nil, fmt.Errorf("UDP port range: %w", err)
+		}
+	}
+	if opts.DSCP > 0 {
+		n, err := newDSCPNet(opts.DSCP)
+		if err != nil {
+			return nil, err
+		}
+		se.SetNet(n)
+	}
+	if opts.network != nil {
+		se.SetNet(opts.network)
+	}
+	if relayFallbackOn {
+		// Also keep pion from nominating a relay pair it finds on its own
+		// (from the camera's relay candidates) before the fallback is due.
+		se.SetRelayAcceptanceMinWait(opts.RelayFallback)
+	}
+	se.LoggerFactory = pionLoggerFactory()
+
 	api := pion.NewAPI(
 		pion.WithMediaEngine(m),
 		pion.WithInterceptorRegistry(i),
+		pion.WithSettingEngine(se),
 	)
 
 	var servers []pion.ICEServer
-	for _, s := range iceServers {
+	for _, s := range filterICEServers(iceServers, opts.ICECandidates) {
 		servers = append(servers, pion.ICEServer{
 			URLs:       []string{s.URL},
 			Username:   s.Username,
@@ -70,15 +441,26 @@ func NewPeer(iceServers []domain.ICEServer, serialNumber string) (*Peer, error)
 		})
 	}
 
+	// pion can only restrict gathering to relay candidates; the other
+	// sets are enforced when sending local candidates.
+	policy := pion.ICETransportPolicyAll
+	if opts.ICECandidates == domain.CandidateRelay {
+		policy = pion.ICETransportPolicyRelay
+	}
 	pc, err := api.NewPeerConnection(pion.Configuration{
-		ICEServers:   servers,
-		BundlePolicy: pion.BundlePolicyMaxBundle,
+		ICEServers:         servers,
+		ICETransportPolicy: policy,
+		BundlePolicy:       pion.BundlePolicyMaxBundle,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("create peer connection: %w", err)
 	}
 
-	dc, err := pc.CreateDataChannel(serialNumber, nil)
+	label := opts.DataChannel.Label
+	if label == "" {
+		label = serialNumber
+	}
+	dc, err := pc.CreateDataChannel(label, opts.DataChannel.init())
 	if err != nil {
 		pc.Close()
 		return nil, fmt.Errorf("create data channel: %w", err)
@@ -88,103 +470,787 @@ func NewPeer(iceServers []domain.ICEServer, serialNumber string) (*Peer, error)
 		pc:            pc,
 		dc:            dc,
 		serialNumber:  serialNumber,
+		opts:          opts,
+		interceptors:  interceptors,
 		remoteDescSet: make(chan struct{}),
+		onError:       func(error) {},
+		onControl:     func(ControlMessage) {},
+		onControlOpen: func() {},
+		onState:       func(string) {},
+		onFirstFrame:  func() {},
+		onAccessUnit:  func(AccessUnit) {},
+		ice:           connectivity{gathered: CandidateCounts{}, sent: CandidateCounts{}, received: CandidateCounts{}, iceReached: pion.ICEConnectionStateNew},
+		clock:         clock.Real,
+		closed:        make(chan struct{}),
+	}
+	p.created = p.clock.Now()
+	p.pcStats = pc.GetStats
+	if relayFallbackOn {
+		p.relay = &relayFallback{timeout: opts.RelayFallback}
 	}
 
 	dc.OnOpen(func() {
 		log.Printf("[webrtc] data channel opened")
-		p.sendStartLive()
-	})
-	dc.OnMessage(func(msg pion.DataChannelMessage) {
-		log.Printf("[webrtc] data channel message: %s", string(msg.Data))
+		p.updateStats(func(s *Stats) { s.DataChannelState = dc.ReadyState().String() })
+		if !p.opts.ControlOnly {
+			p.mainRequestID.Store(p.sendStartLive(p.mainSize(), p.mainResolution()))
+			if p.opts.Preview.Out != nil {
+				p.previewRequestID.Store(p.sendStartLive(previewSize, p.opts.Preview.Resolution))
+			}
+		}
+		p.onControlOpen()
 	})
+	dc.OnMessage(func(msg pion.DataChannelMessage) { p.handleControlMessage(msg.Data) })
 	dc.OnClose(func() {
 		log.Printf("[webrtc] data channel closed")
+		p.updateStats(func(s *Stats) { s.DataChannelState = dc.ReadyState().String() })
 	})
 
 	pc.OnICEConnectionStateChange(func(state pion.ICEConnectionState) {
 		log.Printf("[webrtc] ICE connection state: %s", state.String())
+		p.updateStats(func(s *Stats) {
+			s.ICEState = state.String()
+			p.ice.reachICEState(state)
+		})
 	})
 	pc.OnConnectionStateChange(func(state pion.PeerConnectionState) {
 		log.Printf("[webrtc] peer connection state: %s", state.String())
+		p.updateStats(func(s *Stats) {
+			s.ConnectionState = state.String()
+			p.ice.connected = p.ice.connected || state == pion.PeerConnectionStateConnected
+		})
+		if state == pion.PeerConnectionStateConnected {
+			p.logSelectedPair()
+		}
+		if state == pion.PeerConnectionStateConnected && p.opts.TrackTimeout > 0 {
+			p.watchTrackOnce.Do(func() { go p.watchTrack() })
+		}
+		if state == pion.PeerConnectionStateConnected && p.opts.WaitKeyframe && p.opts.Timeouts.FirstFrame > 0 {
+			p.watchKeyframeOnce.Do(func() { go p.watchKeyframe() })
+		}
+		if state == pion.PeerConnectionStateConnected && p.opts.DataChannel.OpenTimeout > 0 {
+			p.watchDataChannelOnce.Do(func() { go p.watchDataChannel() })
+		}
+		p.onState(state.String())
 	})
 
 	return p, nil
 }
 
-// AddTransceivers adds audio (sendrecv) and video (recvonly) transceivers.
+// registerInterceptors registers what pion.RegisterDefaultInterceptors
+// does, with the NACK interceptors chosen by mode, and returns the names
+// of the interceptors it added.
+func registerInterceptors(m *pion.MediaEngine, i *interceptor.Registry, mode NACKMode) ([]string, error) {
+	var names []string
+	switch mode {
+	case NACKOn:
+		if err := pion.ConfigureNack(m, i); err != nil {
+			return nil, err
+		}
+		names = append(names, "NACK generator", "NACK responder")
+	case NACKNoResponder:
+		generator, err := nack.NewGeneratorInterceptor()
+		if err != nil {
+			return nil, err
+		}
+		m.RegisterFeedback(pion.RTCPFeedback{Type: "nack"}, pion.RTPCodecTypeVideo)
+		m.RegisterFeedback(pion.RTCPFeedback{Type: "nack", Parameter: "pli"}, pion.RTPCodecTypeVideo)
+		i.Add(generator)
+		names = append(names, "NACK generator")
+	case NACKOff:
+		// Keyframe requests still need PLI feedback negotiated.
+		m.RegisterFeedback(pion.RTCPFeedback{Type: "nack", Parameter: "pli"}, pion.RTPCodecTypeVideo)
+	}
+	if err := pion.ConfigureRTCPReports(i); err != nil {
+		return nil, err
+	}
+	names = append(names, "RTCP receiver reports", "RTCP sender reports")
+	if err := pion.ConfigureSimulcastExtensionHeaders(m); err != nil {
+		return nil, err
+	}
+	if err := pion.ConfigureTWCCSender(m, i); err != nil {
+		return nil, err
+	}
+	return append(names, "TWCC feedback"), nil
+}
+
+// AddTransceivers adds audio (sendrecv, unless NoAudio) and video (recvonly)
+// transceivers.
 func (p *Peer) AddTransceivers() error {
-	_, err := p.pc.AddTransceiverFromKind(pion.RTPCodecTypeAudio, pion.RTPTransceiverInit{
-		Direction: pion.RTPTransceiverDirectionSendrecv,
-	})
-	if err != nil {
-		return fmt.Errorf("add audio transceiver: %w", err)
+	if !p.opts.NoAudio {
+		_, err := p.pc.AddTransceiverFromKind(pion.RTPCodecTypeAudio, pion.RTPTransceiverInit{
+			Direction: pion.RTPTransceiverDirectionSendrecv,
+		})
+		if err != nil {
+			return fmt.Errorf("add audio transceiver: %w", err)
+		}
 	}
 
-	_, err = p.pc.AddTransceiverFromKind(pion.RTPCodecTypeVideo, pion.RTPTransceiverInit{
+	_, err := p.pc.AddTransceiverFromKind(pion.RTPCodecTypeVideo, pion.RTPTransceiverInit{
 		Direction: pion.RTPTransceiverDirectionRecvonly,
 	})
 	if err != nil {
 		return fmt.Errorf("add video transceiver: %w", err)
 	}
 
+	if p.opts.Preview.Out != nil {
+		_, err = p.pc.AddTransceiverFromKind(pion.RTPCodecTypeVideo, pion.RTPTransceiverInit{
+			Direction: pion.RTPTransceiverDirectionRecvonly,
+		})
+		if err != nil {
+			return fmt.Errorf("add preview transceiver: %w", err)
+		}
+	}
+
 	return nil
 }
 
-// SetOnTrack sets up the track handler. Video H264 is written to videoOut, audio is drained.
+// SetOnError registers the callback for errors that end the media session,
+// such as a keyframe timeout. Call it before the connection is established.
+func (p *Peer) SetOnError(fn func(err error)) {
+	p.onError = fn
+}
+
+// SetOnControlMessage registers the callback for messages the camera
+// sends on the control DataChannel. Messages that are not valid JSON are
+// delivered with only Raw set. The reply to the main stream's startLive
+// has StartLive set. Replies to the preview's startLive are not
+// delivered: the peer logs a rejection and keeps the main stream. Call it
+// before the connection is established.
+func (p *Peer) SetOnControlMessage(fn func(msg ControlMessage)) {
+	p.onControl = fn
+}
+
+// SetOnControlOpen registers a callback run once the control DataChannel
+// is open and commands can be sent with SendControl.
+func (p *Peer) SetOnControlOpen(fn func()) {
+	p.onControlOpen = fn
+}
+
+// SetOnConnectionState registers a callback for peer connection state
+// changes, with the state as Pion names it ("connected", "failed", ...).
+// Call it before the connection is established.
+func (p *Peer) SetOnConnectionState(fn func(state string)) {
+	p.onState = fn
+}
+
+// SetOnFirstFrame registers a callback run once, when the first access
+// unit of the main video stream has been written. Call it before the
+// connection is established.
+func (p *Peer) SetOnFirstFrame(fn func()) {
+	p.onFirstFrame = fn
+}
+
+// SetOnAccessUnit registers a callback run for each access unit of the
+// main video stream written to the output, with its PTS set and the NAL
+// units as written. Under Options.LowLatency it runs once per packet, and
+// the parts of one picture share a PTS. au.NALUs is only valid during the
+// call. Call it before the connection is established.
+func (p *Peer) SetOnAccessUnit(fn func(au AccessUnit)) {
+	p.onAccessUnit = fn
+}
+
+// SetNALUProcessor registers fn to see each NAL unit of the main video
+// stream as it leaves the depacketizer, after Options.StripNALUTypes.
+// fn returns the NAL unit to use in its place, which may be nalu
+// modified in place or a new slice, or nil to drop it. What it returns
+// is what the size limit, the keyframe wait, keyframe tracking and the
+// first-frame callback see. nalu is only valid during the call. Call it
+// before the connection is established.
+func (p *Peer) SetNALUProcessor(fn func(nalu []byte) []byte) {
+	p.naluProcessor = fn
+}
+
+// SetClock replaces the clock used for packet times and keyframe
+// requests, for tests. Call it before the connection is established.
+func (p *Peer) SetClock(clk clock.Clock) {
+	p.clock = clk
+}
+
+// SetOnTrack sets up the track handler. Video H264 is written to videoOut, audio is drained
+// and its codec checked; see readAudioTrack.
+// With Options.Preview set, the second video stream is written to the
+// preview output instead.
 func (p *Peer) SetOnTrack(videoOut io.Writer) {
 	p.pc.OnTrack(func(track *pion.TrackRemote, receiver *pion.RTPReceiver) {
 		codec := track.Codec()
 		log.Printf("[webrtc] got track: kind=%s codec=%s pt=%d", track.Kind(), codec.MimeType, codec.PayloadType)
 
 		if track.Kind() == pion.RTPCodecTypeVideo {
-			go p.readVideoTrack(track, videoOut)
+			// Two tracks on one stream, as with simulcast or a camera
+			// that sends main and sub stream on one m-line, would
+			// interleave two H264 streams in one output.
+			switch idx := p.videoIndex(receiver); {
+			case idx == 0 && !matchTrack(p.opts.VideoTrack, track.ID(), track.RID(), uint32(track.SSRC())):
+				log.Printf("[webrtc] ignoring video track %s (ssrc=%d rid=%q): not the selected track %s",
+					track.ID(), track.SSRC(), track.RID(), p.opts.VideoTrack)
+				go drainTrack(track)
+			case idx == 0 && p.videoSeen.CompareAndSwap(false, true):
+				go p.readVideoTrack(track, receiver, videoOut, false)
+			case idx == 1 && p.opts.Preview.Out != nil && p.previewSeen.CompareAndSwap(false, true):
+				go p.readVideoTrack(track, receiver, p.opts.Preview.Out, true)
+			case idx == 0 || (idx == 1 && p.opts.Preview.Out != nil):
+				log.Printf("[webrtc] ignoring another video track %s (ssrc=%d rid=%q) on a stream already being written",
+					track.ID(), track.SSRC(), track.RID())
+				go drainTrack(track)
+			default:
+				log.Printf("[webrtc] ignoring extra video track")
+				go drainTrack(track)
+			}
 		} else {
-			go func() {
-				buf := make([]byte, 1500)
-				for {
-					_, _, err := track.Read(buf)
-					if err != nil {
-						return
-					}
-				}
-			}()
+			go p.readAudioTrack(track)
 		}
 	})
 }
 
-func (p *Peer) readVideoTrack(track *pion.TrackRemote, w io.Writer) {
-	log.Printf("[webrtc] reading H264 video track")
+// videoIndex returns the position of receiver among the video
+// transceivers in m-line order, or -1. Tracks fire in the order their
+// first packet arrives, so this is what tells main and preview apart.
+func (p *Peer) videoIndex(receiver *pion.RTPReceiver) int {
+	idx := 0
+	for _, t := range p.pc.GetTransceivers() {
+		if t.Kind() != pion.RTPCodecTypeVideo {
+			continue
+		}
+		if t.Receiver() == receiver {
+			return idx
+		}
+		idx++
+	}
+	return -1
+}
 
-	startCode := []byte{0x00, 0x00, 0x00, 0x01}
-	depack := NewH264Depacketizer()
+// matchTrack reports whether a track with the given ID, RID and SSRC is
+// the one want selects; an empty want selects any.
+func matchTrack(want, id, rid string, ssrc uint32) bool {
+	return want == "" || want == id || (rid != "" && want == rid) || want == strconv.FormatUint(uint64(ssrc), 10)
+}
+
+// drainTrack reads and discards track until it ends.
+func drainTrack(track *pion.TrackRemote) {
+	buf := make([]byte, 1500)
+	for {
+		if _, _, err := track.Read(buf); err != nil {
+			return
+		}
+	}
+}
+
+// readVideoTrack writes track to w until either fails. The preview
+// stream keeps its own stats and, if w fails, is discarded without ending
+// the session.
+func (p *Peer) readVideoTrack(track *pion.TrackRemote, receiver *pion.RTPReceiver, w io.Writer, preview bool) {
+	name, lastPLI := "video", &p.lastKeyframeRequest
+	if preview {
+		name, lastPLI = "preview", &p.lastPreviewKeyframeRequest
+	}
+	log.Printf("[webrtc] reading H264 %s track", name)
+
+	codec := track.Codec()
+	info := VideoInfo{
+		MimeType:    codec.MimeType,
+		PayloadType: uint8(codec.PayloadType),
+		FmtpLine:    codec.SDPFmtpLine,
+		ClockRate:   codec.ClockRate,
+	}
+	log.Printf("[webrtc] negotiated %s: %s", name, info)
+
+	v := p.newVideoReceiver(codec.ClockRate, w, preview, func() { p.requestKeyframe(track, lastPLI) })
+	defer v.Close()
+	v.update(func(s *Stats) { s.Video = info })
+	if v.wallClock != nil {
+		go readSenderReports(receiver, track, v.wallClock, name)
+	}
+
+	if !preview && p.opts.Preview.Out != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go p.watchPreview(done)
+	}
 
 	for {
 		pkt, _, err := track.ReadRTP()
 		if err != nil {
-			log.Printf("[webrtc] video track read error: %v", err)
+			if p.closing() {
+				// Close ended the track; nothing unexpected happened.
+				logging.Debugf(logging.RTP, "%s track ended by Close: %v", name, err)
+				return
+			}
+			log.Printf("[webrtc] %s track read error: %v", name, err)
+			return
+		}
+		if !v.Handle(pkt.SequenceNumber, pkt.Timestamp, pkt.Marker, pkt.Payload) {
+			if preview {
+				log.Printf("[webrtc] preview output closed, discarding the preview stream")
+				drainTrack(track)
+			}
 			return
 		}
+	}
+}
+
+// videoReceiver turns video RTP payloads into access units written to the
+// output and keeps the peer's video stats current. Handle must be called
+// from a single goroutine; the peer's Stats may be read concurrently.
+type videoReceiver struct {
+	p               *Peer
+	name            string // "video" or "preview", for logs
+	preview         bool
+	wroteFrame      bool
+	lastIDR         atomic.Int64 // UnixNano of the last IDR slice received
+	lastPacket      atomic.Int64 // UnixNano of the last packet received, for the stall watch
+	update          func(fn func(s *Stats))
+	meter           *bitrateMeter // guarded by the peer's statsMu, like update
+	depack          *H264Depacketizer
+	gate            *keyframeGate
+	keyframeSeen    atomic.Bool
+	assembler       auAssembler
+	thinner         *frameThinner
+	dedup           *paramSetDedup
+	naluLog         *naluLogger
+	errDump         *errorDumper
+	jitter          *jitterEstimator
+	loss            *lossTrigger // nil unless Options.LossRecovery is set
+	recovering      bool         // a loss-triggered request awaits its keyframe
+	timeline        *rtpTimeline
+	wallClock       *wallClock // nil unless Options.Timestamps is set
+	lastSPS         []byte
+	lastSeq         uint16
+	wroteAU         bool
+	lastWrittenTS   uint32 // RTP timestamp of the last access unit written
+	first           bool
+	write           func(nalus [][]byte, auStart bool) writeResult // auStart: nalus begin an access unit
+	requestKeyframe func()
+	stop            []func()
+}
+
+// newVideoReceiver returns a receiver writing to w. A preview receiver
+// updates the preview stats and ignores the options that only make sense
+// for the main stream: the keyframe timeout, -drop-frames and the NALU log.
+func (p *Peer) newVideoReceiver(clockRate uint32, w io.Writer, preview bool, requestKeyframe func()) *videoReceiver {
+	v := &videoReceiver{
+		p:               p,
+		name:            "video",
+		update:          p.updateStats,
+		meter:           &p.bitrate,
+		depack:          NewH264Depacketizer(),
+		jitter:          newJitterEstimator(clockRate),
+		timeline:        newRTPTimeline(clockRate),
+		first:           true,
+		requestKeyframe: requestKeyframe,
+	}
+	v.depack.SetMaxReassemblySize(p.opts.MaxReassemblySize)
+	if preview {
+		v.name, v.update, v.meter, v.preview = "preview", p.updatePreviewStats, &p.previewBitrate, true
+	}
+	if p.opts.LossRecovery.Threshold > 0 {
+		v.loss = newLossTrigger(p.opts.LossRecovery)
+	}
+	if p.opts.Timestamps {
+		v.wallClock = newWallClock(clockRate)
+	}
+	if p.opts.DedupParameterSets > 0 {
+		v.dedup = &paramSetDedup{window: p.opts.DedupParameterSets}
+	}
+	if p.opts.NALULog != nil && !preview {
+		v.naluLog = newNALULogger(p.opts.NALULog)
+	}
+	if p.opts.ErrorDump != nil && !preview {
+		v.errDump = newErrorDumper(p.opts.ErrorDump)
+	}
+	if p.opts.DropFrames > 0 && !preview {
+		v.thinner = newFrameThinner(p.opts.DropFrames)
+		log.Printf("[webrtc] dropping %.0f%% of frames between keyframes", 100*p.opts.DropFrames)
+	}
+
+	if p.opts.Resume && !preview {
+		v.gate = &keyframeGate{seam: true}
+		log.Printf("[webrtc] resuming earlier output: waiting for keyframe before writing %s", v.name)
+	}
+	if p.opts.WaitKeyframe && v.gate == nil {
+		v.gate = &keyframeGate{}
+		log.Printf("[webrtc] waiting for keyframe before writing %s", v.name)
+	}
+
+	if p.opts.KeyframeInterval > 0 {
+		v.lastIDR.Store(p.clock.Now().UnixNano())
+		v.stop = append(v.stop, v.requestKeyframesEvery(p.opts.KeyframeInterval))
+	}
+	if p.opts.Timeouts.Stall > 0 && !preview {
+		v.stop = append(v.stop, v.watchStall(p.opts.Timeouts.Stall))
+	}
+
+	framer, out := AnnexB{}, &p.out
+	if preview {
+		out = &p.previewOut
+	}
+	v.write = func(nalus [][]byte, auStart bool) writeResult {
+		if !out.write(w, framer, nalus, auStart) {
+			return writeFailed
+		}
+		return written
+	}
+	if p.opts.LowLatency {
+		queue := newDropOldestQueue(lowLatencyQueueSize)
+		v.stop = append(v.stop, queue.Close)
+		// failed passes a write error from the writer back to the read
+		// loop, which ends the track at its next write as it would have
+		// written itself.
+		var failed atomic.Bool
+		go func() {
+			for b := range queue.C() {
+				if !out.write(w, framer, b.nalus, b.auStart) {
+					failed.Store(true)
+					return
+				}
+			}
+		}()
+		v.write = func(nalus [][]byte, auStart bool) writeResult {
+			if failed.Load() {
+				return writeFailed
+			}
+			if dropped := queue.Push(naluBatch{nalus, auStart}); dropped > 0 {
+				log.Printf("[webrtc] %s output too slow, dropped %d queued packets", v.name, dropped)
+				v.requestKeyframe()
+			}
+			return written
+		}
+	}
+	if p.opts.Motion.Sensitivity > 0 && !preview {
+		wroteHeld := func(n int) { v.update(func(s *Stats) { s.AccessUnits += uint64(n) }) }
+		v.write = newMotionRecorder(p.opts.Motion, func() time.Time { return p.clock.Now() }, v.write, wroteHeld).Write
+		log.Printf("[webrtc] motion recording: writing video only while frames grow %gx or keyframes come early", p.opts.Motion.Sensitivity)
+	}
+	return v
+}
+
+// Handle processes one RTP packet. It returns false once the output no
+// longer accepts video.
+func (v *videoReceiver) Handle(seq uint16, timestamp uint32, marker bool, payload []byte) bool {
+	p := v.p
+
+	var lost uint64
+	if !v.first {
+		lost = seqGap(v.lastSeq, seq)
+	}
+	if (p.opts.LowLatency || p.opts.KeyframeOnLoss) && lost > 0 {
+		v.requestKeyframe()
+	}
+	if v.first && v.gate != nil && v.gate.seam {
+		v.requestKeyframe()
+	}
+	// A late packet must not move lastSeq back, or the packets between it
+	// and the newest would count as lost a second time.
+	if v.first || seqNewer(seq, v.lastSeq) {
+		v.lastSeq = seq
+	}
+	v.first = false
+
+	now := p.clock.Now()
+	if lost > 0 && v.loss != nil && v.loss.Lost(now, lost) {
+		log.Printf("[webrtc] %s: %d or more packets lost within %s, requesting a keyframe to recover",
+			v.name, p.opts.LossRecovery.Threshold, p.opts.LossRecovery.Window)
+		v.recovering = true
+		v.update(func(s *Stats) { s.Recovering = true })
+		v.requestKeyframe()
+	}
+	v.lastPacket.Store(now.UnixNano())
+	v.jitter.Update(timestamp, now)
+	before := v.depack.Stats()
+	nalus := v.depack.Depacketize(seq, payload)
+	if v.errDump != nil {
+		v.errDump.Dump(now, seq, timestamp, lost, before, v.depack.Stats(), payload)
+	}
+	if logging.DebugEnabled(logging.RTP) {
+		logging.Debugf(logging.RTP, "%s: seq=%d ts=%d marker=%t %d bytes, %d lost before, %d NAL units",
+			v.name, seq, timestamp, marker, len(payload), lost, len(nalus))
+	}
+	if v.naluLog != nil {
+		v.naluLog.Log(now, seq, timestamp, nalus)
+	}
+	v.update(func(s *Stats) {
+		s.VideoPackets++
+		s.VideoBytes += uint64(len(payload))
+		v.meter.add(now, len(payload))
+		s.PacketsLost += lost
+		s.LastPacket = now
+		s.Jitter = v.jitter.Jitter()
+		s.Depacketizer = v.depack.Stats()
+	})
+
+	var aus []AccessUnit
+	if p.opts.LowLatency {
+		aus = []AccessUnit{{Timestamp: timestamp, NALUs: nalus}}
+	} else {
+		aus = v.assembler.Push(timestamp, marker, nalus)
+	}
+
+	for _, au := range aus {
+		au.PTS = v.timeline.Normalize(au.Timestamp)
+		var out [][]byte
+		for _, nalu := range au.NALUs {
+			if len(nalu) == 0 || slices.Contains(p.opts.StripNALUTypes, nalu[0]&0x1f) {
+				continue
+			}
+			if p.naluProcessor != nil && !v.preview {
+				if nalu = p.naluProcessor(nalu); len(nalu) == 0 {
+					continue
+				}
+			}
+			if p.opts.MaxNALUSize > 0 && len(nalu) > p.opts.MaxNALUSize {
+				log.Printf("[webrtc] warning: dropping a %d-byte %s NAL unit of type %d, over the %d-byte limit",
+					len(nalu), v.name, nalu[0]&0x1f, p.opts.MaxNALUSize)
+				v.update(func(s *Stats) { s.OversizeNALUs++ })
+				if v.errDump != nil {
+					v.errDump.DumpNALU(now, seq, au.Timestamp, DropOversizeNALU, nalu)
+				}
+				if nalu[0]&0x1f == naluTypeIDR {
+					v.requestKeyframe()
+				}
+				continue
+			}
+			if nalu[0]&0x1f == naluTypeIDR {
+				v.lastIDR.Store(now.UnixNano())
+				if v.recovering {
+					v.recovering = false
+					v.update(func(s *Stats) { s.Recovering = false })
+					log.Printf("[webrtc] %s: keyframe received, recovered from loss", v.name)
+				}
+			}
+			if nalu[0]&0x1f == naluTypeSPS && !bytes.Equal(nalu, v.lastSPS) {
+				v.lastSPS = append(v.lastSPS[:0], nalu...)
+				v.applySPS(nalu)
+			}
+			if v.gate == nil {
+				out = append(out, nalu)
+				continue
+			}
+			out = append(out, v.gate.Filter(nalu)...)
+			if v.gate.open && !v.keyframeSeen.Load() {
+				v.keyframeSeen.Store(true)
+				if !v.preview {
+					p.keyframeSeen.Store(true)
+				}
+				log.Printf("[webrtc] keyframe received, writing %s", v.name)
+			}
+		}
 
-		nalus := depack.Depacketize(pkt.SequenceNumber, pkt.Payload)
-		for _, nalu := range nalus {
-			if len(nalu) == 0 {
+		if len(out) == 0 {
+			continue
+		}
+		if v.thinner != nil && !v.thinner.Keep(AccessUnit{Timestamp: au.Timestamp, PTS: au.PTS, NALUs: out}) {
+			v.update(func(s *Stats) { s.FramesDropped++ })
+			continue
+		}
+		if v.dedup != nil {
+			if out = v.dedup.Filter(now, out); len(out) == 0 {
 				continue
 			}
-			if _, err := w.Write(startCode); err != nil {
-				log.Printf("[webrtc] video write start code error: %v", err)
+		}
+		// Under LowLatency an access unit is written a packet at a time, so
+		// a new one is one with a new timestamp.
+		auStart := !v.wroteAU || au.Timestamp != v.lastWrittenTS
+		if p.opts.InsertAUD && auStart {
+			out = withAUD(out)
+		}
+		if v.wallClock != nil && auStart {
+			out = withTimestampSEI(out, timestampSEI(v.wallClock.Time(au.Timestamp, now)))
+		}
+		result := v.write(out, auStart)
+		if result == writeFailed {
+			return false
+		}
+		v.wroteAU, v.lastWrittenTS = true, au.Timestamp
+		if result == withheld {
+			continue
+		}
+		v.update(func(s *Stats) {
+			s.AccessUnits++
+			s.MediaTime = timelineDuration(au.PTS)
+		})
+		if !v.preview {
+			p.onAccessUnit(AccessUnit{Timestamp: au.Timestamp, PTS: au.PTS, NALUs: out})
+		}
+		if !v.wroteFrame && !v.preview {
+			v.wroteFrame = true
+			p.onFirstFrame()
+		}
+	}
+	return true
+}
+
+// requestKeyframesEvery checks each interval whether a keyframe arrived
+// within it and requests one if not. It returns a function that stops the
+// checks.
+func (v *videoReceiver) requestKeyframesEvery(interval time.Duration) func() {
+	clk := v.p.clock
+	ticker := clk.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C():
+				if clk.Now().Sub(time.Unix(0, v.lastIDR.Load())) >= interval {
+					log.Printf("[webrtc] no %s keyframe for %s", v.name, interval)
+					v.requestKeyframe()
+				}
+			case <-done:
 				return
 			}
-			if _, err := w.Write(nalu); err != nil {
-				log.Printf("[webrtc] video write nalu error: %v", err)
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// watchStall reports ErrMediaStall once video that has started arriving
+// stops for timeout, and returns a function that stops the watch.
+func (v *videoReceiver) watchStall(timeout time.Duration) func() {
+	clk := v.p.clock
+	ticker := clk.NewTicker(max(timeout/4, time.Millisecond))
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C():
+				last := v.lastPacket.Load()
+				if last != 0 && clk.Now().Sub(time.Unix(0, last)) >= timeout {
+					v.p.onError(fmt.Errorf("%w: no %s for %s", ErrMediaStall, v.name, timeout))
+					return
+				}
+			case <-done:
 				return
 			}
 		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// Close stops the keyframe timers and the low-latency writer.
+func (v *videoReceiver) Close() {
+	for _, fn := range v.stop {
+		fn()
 	}
 }
 
+// requestKeyframe sends a Picture Loss Indication for track, at most once
+// per keyframeRequestInterval as tracked by lastPLI.
+func (p *Peer) requestKeyframe(track *pion.TrackRemote, lastPLI *atomic.Int64) {
+	if p.closing() {
+		return
+	}
+	last, now := lastPLI.Load(), p.clock.Now().UnixNano()
+	if now-last < int64(keyframeRequestInterval) || !lastPLI.CompareAndSwap(last, now) {
+		return
+	}
+
+	log.Printf("[webrtc] requesting keyframe")
+	err := p.pc.WriteRTCP([]rtcp.Packet{
+		&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())},
+	})
+	if err != nil && !p.closing() {
+		log.Printf("[webrtc] keyframe request error: %v", err)
+	}
+}
+
+// applySPS records the picture size and frame rate from a new or changed
+// SPS. A parse failure is logged and leaves the previous values in place.
+func (v *videoReceiver) applySPS(nalu []byte) {
+	sps, err := ParseSPS(nalu)
+	if err != nil {
+		log.Printf("[webrtc] ignoring %s SPS: %v", v.name, err)
+		return
+	}
+	var info VideoInfo
+	v.update(func(s *Stats) {
+		s.Video.Width = sps.Width
+		s.Video.Height = sps.Height
+		s.Video.FrameRate = sps.FrameRate
+		info = s.Video
+	})
+	log.Printf("[webrtc] %s resolution: %s (profile %d, level %d)", v.name, info.Resolution(), sps.ProfileIDC, sps.LevelIDC)
+	v.checkResolution(sps.Width, sps.Height)
+}
+
+// writeResult is what a receiver's write function did with a batch of NAL
+// units.
+type writeResult int
+
+const (
+	// written: the batch went to the output, or its queue.
+	written writeResult = iota
+	// withheld: the batch was held back or dropped on purpose, as motion
+	// recording does while the picture is quiet, and is not counted.
+	withheld
+	// writeFailed: the output no longer accepts video; the track ends.
+	writeFailed
+)
+
+// videoOutput guards writes to one video output against Shutdown.
+type videoOutput struct {
+	mu      sync.Mutex
+	stopped bool
+}
+
+// write writes each NAL unit framed by f; auStart marks nalus as the start
+// of an access unit. It returns false if writing failed or the peer is
+// shutting down.
+func (o *videoOutput) write(w io.Writer, f Framer, nalus [][]byte, auStart bool) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.stopped {
+		return false
+	}
+	for i, n := range nalus {
+		if err := f.WriteNALU(w, n, auStart && i == 0); err != nil {
+			log.Printf("[webrtc] video write error: %v", err)
+			return false
+		}
+	}
+	return true
+}
+
+// stop waits for a write in progress and fails those after it.
+func (o *videoOutput) stop() {
+	o.mu.Lock()
+	o.stopped = true
+	o.mu.Unlock()
+}
+
+// SetOnNegotiationNeeded registers the callback run when transceivers
+// change after the first offer/answer exchange, so the session has to be
+// renegotiated with a new offer. Pion's own negotiation-needed event for
+// the transceivers added before the first offer is not passed on. Call
+// it before the first offer or answer.
+func (p *Peer) SetOnNegotiationNeeded(fn func()) {
+	p.pc.OnNegotiationNeeded(func() {
+		if !p.negotiated.Load() || p.closing() {
+			return
+		}
+		log.Printf("[webrtc] transceivers changed, renegotiation needed")
+		fn()
+	})
+}
+
 // SetOnICECandidate registers the callback for locally discovered ICE candidates.
+// If Options.ICECandidateInterval is set, candidates are queued and sent
+// no more often than that interval.
 func (p *Peer) SetOnICECandidate(send func(sdpMid string, sdpMLineIndex int, candidate string)) {
+	countSent := send
+	send = func(sdpMid string, sdpMLineIndex int, candidate string) {
+		p.updateStats(func(*Stats) { countCandidate(p.ice.sent, candidate) })
+		countSent(sdpMid, sdpMLineIndex, candidate)
+	}
+	if p.opts.ICECandidateInterval > 0 {
+		send = p.paceCandidates(send)
+	}
+
 	p.pc.OnICECandidate(func(c *pion.ICECandidate) {
 		if c == nil {
 			log.Printf("[webrtc] ICE gathering complete")
@@ -192,8 +1258,9 @@ func (p *Peer) SetOnICECandidate(send func(sdpMid string, sdpMLineIndex int, can
 		}
 
 		candidateStr := c.ToJSON().Candidate
-		if isLoopback(candidateStr) {
-			log.Printf("[webrtc] filtering loopback ICE candidate")
+		p.updateStats(func(*Stats) { p.ice.gathered[c.Typ.String()]++ })
+		if isLoopbackAddress(c.Address) {
+			log.Printf("[webrtc] filtering loopback ICE candidate: %s %s %s", c.Typ, c.Protocol, hostPort(c.Address, c.Port))
 			return
 		}
 
@@ -206,11 +1273,62 @@ func (p *Peer) SetOnICECandidate(send func(sdpMid string, sdpMLineIndex int, can
 			sdpMLineIndex = int(*c.ToJSON().SDPMLineIndex)
 		}
 
+		if !candidateAllowed(p.opts.ICECandidates, c.Typ) {
+			log.Printf("[webrtc] not sending %s ICE candidate: candidate types are %s", c.Typ, p.opts.ICECandidates)
+			return
+		}
+		if p.relay != nil {
+			p.relay.start(p, send)
+			if c.Typ == pion.ICECandidateTypeRelay && p.relay.hold(heldCandidate{sdpMid, sdpMLineIndex, candidateStr}) {
+				log.Printf("[webrtc] holding back relay ICE candidate: %s", candidateStr)
+				return
+			}
+		}
+
 		log.Printf("[webrtc] local ICE candidate: %s", candidateStr)
 		send(sdpMid, sdpMLineIndex, candidateStr)
 	})
 }
 
+// paceCandidates wraps send so that calls return immediately and the
+// candidates are sent in order, at most one per ICECandidateInterval.
+func (p *Peer) paceCandidates(send func(sdpMid string, sdpMLineIndex int, candidate string)) func(string, int, string) {
+	type pending struct {
+		sdpMid        string
+		sdpMLineIndex int
+		candidate     string
+	}
+	queue := make(chan pending, 64)
+
+	go func() {
+		var last time.Time
+		for {
+			var c pending
+			select {
+			case c = <-queue:
+			case <-p.closed:
+				return
+			}
+			if wait := p.opts.ICECandidateInterval - time.Since(last); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-p.closed:
+					return
+				}
+			}
+			send(c.sdpMid, c.sdpMLineIndex, c.candidate)
+			last = time.Now()
+		}
+	}()
+
+	return func(sdpMid string, sdpMLineIndex int, candidate string) {
+		select {
+		case queue <- pending{sdpMid, sdpMLineIndex, candidate}:
+		case <-p.closed:
+		}
+	}
+}
+
 // CreateOffer creates an SDP offer and sets it as the local description.
 func (p *Peer) CreateOffer() (string, error) {
 	offer, err := p.pc.CreateOffer(nil)
@@ -233,19 +1351,99 @@ func (p *Peer) SetRemoteDescription(sdp domain.SDPPayload) error {
 		SDP:  sdp.SDP,
 	}
 
+	if p.opts.ValidateAnswer {
+		if err := ValidateAnswer(sdp.SDP); err != nil {
+			for _, line := range mediaSummary(sdp.SDP) {
+				log.Printf("[webrtc]   camera: %s", line)
+			}
+			return err
+		}
+	}
 	if err := p.pc.SetRemoteDescription(answer); err != nil {
 		return fmt.Errorf("set remote description: %w", err)
 	}
 
 	log.Printf("[webrtc] remote SDP answer set")
-	close(p.remoteDescSet)
+	p.updateStats(func(*Stats) { countSDPCandidates(p.ice.received, sdp.SDP) })
+	p.logNegotiatedVideo()
+	p.remoteSetOnce.Do(func() { close(p.remoteDescSet) })
+	p.negotiated.Store(true)
 	return nil
 }
 
+// h264PayloadType is the payload type H264 is offered with. Pion matches
+// the camera's codecs by MIME type and parameters, not payload type, so a
+// camera that picks its own payload type for H264 is still received.
+const h264PayloadType = 121
+
+// logNegotiatedVideo logs the video codec agreed with the camera. If there
+// is none, the camera will send no usable video even though signaling
+// succeeded, so that is logged as a warning.
+func (p *Peer) logNegotiatedVideo() {
+	for _, t := range p.pc.GetTransceivers() {
+		if t.Kind() != pion.RTPCodecTypeVideo || t.Receiver() == nil {
+			continue
+		}
+		codecs := t.Receiver().GetParameters().Codecs
+		if len(codecs) == 0 {
+			log.Printf("[webrtc] warning: camera accepted no H264 format we offer; no video will arrive")
+			return
+		}
+		c := codecs[0]
+		if c.PayloadType != h264PayloadType {
+			log.Printf("[webrtc] negotiated video: %s pt=%d (offered pt=%d) %s", c.MimeType, c.PayloadType, h264PayloadType, c.SDPFmtpLine)
+		} else {
+			log.Printf("[webrtc] negotiated video: %s pt=%d %s", c.MimeType, c.PayloadType, c.SDPFmtpLine)
+		}
+		return
+	}
+}
+
+// AcceptOffer handles a camera-initiated offer: it sets the offer as the
+// remote description, creates an answer, sets it as the local description
+// and returns the answer SDP. A local offer that is still awaiting an
+// answer is rolled back first, so the camera's offer wins.
+func (p *Peer) AcceptOffer(sdp domain.SDPPayload) (string, error) {
+	if p.pc.SignalingState() == pion.SignalingStateHaveLocalOffer {
+		log.Printf("[webrtc] rolling back local offer in favor of camera offer")
+		if err := p.pc.SetLocalDescription(pion.SessionDescription{Type: pion.SDPTypeRollback}); err != nil {
+			return "", fmt.Errorf("roll back local offer: %w", err)
+		}
+	}
+
+	offer := pion.SessionDescription{
+		Type: pion.SDPTypeOffer,
+		SDP:  sdp.SDP,
+	}
+	if err := p.pc.SetRemoteDescription(offer); err != nil {
+		return "", fmt.Errorf("set remote description: %w", err)
+	}
+	log.Printf("[webrtc] remote SDP offer set")
+	p.updateStats(func(*Stats) { countSDPCandidates(p.ice.received, sdp.SDP) })
+	p.remoteSetOnce.Do(func() { close(p.remoteDescSet) })
+
+	answer, err := p.pc.CreateAnswer(nil)
+	if err != nil {
+		return "", fmt.Errorf("create answer: %w", err)
+	}
+	if err := p.pc.SetLocalDescription(answer); err != nil {
+		return "", fmt.Errorf("set local description: %w", err)
+	}
+
+	log.Printf("[webrtc] local SDP answer set")
+	p.logNegotiatedVideo()
+	p.negotiated.Store(true)
+	return answer.SDP, nil
+}
+
 // AddRemoteICECandidate waits for the remote description to be set, then adds the candidate.
+// It fails if the peer is closed first.
 func (p *Peer) AddRemoteICECandidate(candidate domain.ICECandidatePayload) error {
-	<-p.remoteDescSet
-
+	select {
+	case <-p.remoteDescSet:
+	case <-p.closed:
+		return fmt.Errorf("add ice candidate: peer closed")
+	}
 	sdpMLineIndex := uint16(candidate.SDPMLineIndex)
 	init := pion.ICECandidateInit{
 		Candidate:     candidate.Candidate,
@@ -256,8 +1454,13 @@ func (p *Peer) AddRemoteICECandidate(candidate domain.ICECandidatePayload) error
 	if err := p.pc.AddICECandidate(init); err != nil {
 		return fmt.Errorf("add ice candidate: %w", err)
 	}
+	p.updateStats(func(*Stats) { countCandidate(p.ice.received, candidate.Candidate) })
 
-	log.Printf("[webrtc] added remote ICE candidate")
+	if parsed, err := ParseCandidate(candidate.Candidate); err == nil {
+		log.Printf("[webrtc] added remote ICE candidate: %s", parsed)
+	} else {
+		log.Printf("[webrtc] added remote ICE candidate")
+	}
 	return nil
 }
 
@@ -271,26 +1474,144 @@ type startLiveCommand struct {
 	Resolution   string `json:"resolution"`
 }
 
-func (p *Peer) sendStartLive() {
-	ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+// handleControlMessage logs a DataChannel message and passes it to the
+// control callback, except replies to the preview's startLive.
+func (p *Peer) handleControlMessage(data []byte) {
+	m, err := ParseControlMessage(data)
+	if err != nil {
+		log.Printf("[webrtc] data channel message: %s (%v)", string(data), err)
+	} else {
+		log.Printf("[webrtc] data channel message: %s", m)
+	}
+	if id := p.previewRequestID.Load(); id != 0 && m.RequestID == strconv.FormatInt(id, 10) {
+		if m.Failed() {
+			log.Printf("[webrtc] warning: camera rejected the preview stream (%s); continuing with the main stream only", m)
+		}
+		return
+	}
+	if id := p.mainRequestID.Load(); id != 0 {
+		m.StartLive = m.RequestID == strconv.FormatInt(id, 10) || m.RequestID == "" && m.Action == "startLive"
+	}
+	p.onControl(m)
+}
+
+// nextRequestID returns a request ID for a control command: the current
+// time in milliseconds, moved past the last ID so commands sent in the
+// same millisecond do not share one and their replies can be told apart.
+func (p *Peer) nextRequestID() int64 {
+	now := p.clock.Now().UnixMilli()
+	for {
+		last := p.lastRequestID.Load()
+		id := max(now, last+1)
+		if p.lastRequestID.CompareAndSwap(last, id) {
+			return id
+		}
+	}
+}
+
+// sendStartLive sends startLive for one stream and returns its request ID.
+func (p *Peer) sendStartLive(size, resolution string) int64 {
+	id := p.nextRequestID()
+	ts := strconv.FormatInt(id, 10)
 	cmd := startLiveCommand{
 		Action:       "startLive",
 		RequestID:    ts,
 		ConnectionID: "",
 		TimeStamp:    ts,
-		Size:         "medium",
-		Resolution:   "1280x720",
+		Size:         size,
+		Resolution:   resolution,
 	}
 
 	data, _ := json.Marshal(cmd)
 	log.Printf("[webrtc] sending startLive: %s", string(data))
-	if err := p.dc.SendText(string(data)); err != nil {
+	if err := p.dc.SendText(string(data)); err != nil && !p.closing() {
 		log.Printf("[webrtc] sendStartLive error: %v", err)
 	}
+	return id
+}
+
+// controlCommand is a JSON command with no parameters beyond the action.
+type controlCommand struct {
+	Action    string `json:"action"`
+	RequestID string `json:"requestID"`
+	TimeStamp string `json:"timeStamp"`
+}
+
+// NewRequestID returns a request ID for SendControl, distinct from those
+// of the other commands the peer sends.
+func (p *Peer) NewRequestID() string {
+	return strconv.FormatInt(p.nextRequestID(), 10)
+}
+
+// SendControl sends action over the control DataChannel with requestID,
+// which the camera is expected to echo in its reply. Take the ID from
+// NewRequestID and record it before sending, as the reply can arrive
+// before SendControl returns.
+func (p *Peer) SendControl(action, requestID string) error {
+	if p.dc.ReadyState() != pion.DataChannelStateOpen {
+		return fmt.Errorf("send %s: data channel is not open", action)
+	}
+	data, _ := json.Marshal(controlCommand{Action: action, RequestID: requestID, TimeStamp: requestID})
+	log.Printf("[webrtc] sending %s: %s", action, string(data))
+	if err := p.dc.SendText(string(data)); err != nil {
+		return fmt.Errorf("send %s: %w", action, err)
+	}
+	return nil
+}
+
+// stopLiveCommand is the JSON command sent over the DataChannel to stop live streaming.
+type stopLiveCommand struct {
+	Action       string `json:"action"`
+	RequestID    string `json:"requestID"`
+	ConnectionID string `json:"connectionID"`
+	TimeStamp    string `json:"timeStamp"`
+}
+
+func (p *Peer) sendStopLive() {
+	if p.dc == nil || p.dc.ReadyState() != pion.DataChannelStateOpen {
+		return
+	}
+
+	ts := strconv.FormatInt(p.nextRequestID(), 10)
+	cmd := stopLiveCommand{
+		Action:       "stopLive",
+		RequestID:    ts,
+		ConnectionID: "",
+		TimeStamp:    ts,
+	}
+
+	data, _ := json.Marshal(cmd)
+	log.Printf("[webrtc] sending stopLive: %s", string(data))
+	if err := p.dc.SendText(string(data)); err != nil && !p.closing() {
+		log.Printf("[webrtc] sendStopLive error: %v", err)
+	}
+}
+
+// Shutdown asks the camera to stop streaming and stops writing video once
+// any in-progress NAL unit write has completed, so the output is not left
+// with a truncated NAL unit. It returns ctx.Err() if the pending write does
+// not finish in time. Call Close afterwards to release the connection.
+func (p *Peer) Shutdown(ctx context.Context) error {
+	p.sendStopLive()
+
+	done := make(chan struct{})
+	go func() {
+		p.out.stop()
+		p.previewOut.stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Close shuts down the DataChannel and PeerConnection.
 func (p *Peer) Close() {
+	p.closeOnce.Do(func() { close(p.closed) })
 	if p.dc != nil {
 		p.dc.Close()
 	}
@@ -299,6 +1620,13 @@ func (p *Peer) Close() {
 	}
 }
 
-func isLoopback(candidate string) bool {
-	return strings.Contains(candidate, "127.0.0.1") || strings.Contains(candidate, "::1 ")
+// closing reports whether Close has been called. Errors from the read
+// loops and pending sends after that are expected and not logged.
+func (p *Peer) closing() bool {
+	select {
+	case <-p.closed:
+		return true
+	default:
+		return false
+	}
 }
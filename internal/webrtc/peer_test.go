@@ -0,0 +1,621 @@
+package webrtc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/domain"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+const testSerial = "0123456789abcdef0123456789abcdef"
+
+// newTestPeer returns a peer with opts, closed when the test ends.
+func newTestPeer(t *testing.T, opts Options) *Peer {
+	t.Helper()
+	p, err := NewPeer(nil, testSerial, opts)
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+// newTestReceiver returns a peer with opts and a receiver for its main
+// video writing to io.Discard, both closed when the test ends. Use
+// captureOutput to see what it writes.
+func newTestReceiver(t *testing.T, opts Options) (*Peer, *videoReceiver) {
+	t.Helper()
+	p := newTestPeer(t, opts)
+	v := p.newVideoReceiver(90000, io.Discard, false, func() {})
+	t.Cleanup(v.Close)
+	return p, v
+}
+
+// captureOutput replaces the output of v with a buffer written in Annex B
+// as each write happens, also under LowLatency, where the real output is
+// written from another goroutine.
+func captureOutput(v *videoReceiver) *bytes.Buffer {
+	var out bytes.Buffer
+	v.write = func(nalus [][]byte, _ bool) writeResult {
+		out.Write(annexB(nalus...))
+		return written
+	}
+	return &out
+}
+
+// annexB frames nalus with 4-byte start codes, as the output does.
+func annexB(nalus ...[]byte) []byte {
+	var b []byte
+	for _, n := range nalus {
+		b = append(append(b, 0, 0, 0, 1), n...)
+	}
+	return b
+}
+
+func TestNewPeer_NACKModeInOffer(t *testing.T) {
+	tests := []struct {
+		mode                         NACKMode
+		wantNACK                     bool
+		wantGenerator, wantResponder bool
+	}{
+		{NACKOn, true, true, true},
+		{NACKNoResponder, true, true, false},
+		{NACKOff, false, false, false},
+	}
+	for _, tt := range tests {
+		p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{NACK: tt.mode})
+		if err != nil {
+			t.Fatalf("%q: create peer: %v", tt.mode, err)
+		}
+		if err := p.AddTransceivers(); err != nil {
+			t.Fatalf("%q: add transceivers: %v", tt.mode, err)
+		}
+		sdp, err := p.CreateOffer()
+		p.Close()
+		if err != nil {
+			t.Fatalf("%q: create offer: %v", tt.mode, err)
+		}
+
+		// NACKOn and NACKNoResponder offer the same feedback and differ
+		// only in whether lost packets the camera reports are resent.
+		if got := slices.Contains(p.interceptors, "NACK generator"); got != tt.wantGenerator {
+			t.Errorf("%q: expected NACK generator registered=%v, got interceptors %q", tt.mode, tt.wantGenerator, p.interceptors)
+		}
+		if got := slices.Contains(p.interceptors, "NACK responder"); got != tt.wantResponder {
+			t.Errorf("%q: expected NACK responder registered=%v, got interceptors %q", tt.mode, tt.wantResponder, p.interceptors)
+		}
+
+		if got := strings.Contains(sdp, "a=rtcp-fb:121 nack \r\n"); got != tt.wantNACK {
+			t.Errorf("%q: expected NACK feedback offered=%v, got %v", tt.mode, tt.wantNACK, got)
+		}
+		if !strings.Contains(sdp, "a=rtcp-fb:121 nack pli") {
+			t.Errorf("%q: expected PLI feedback offered", tt.mode)
+		}
+	}
+}
+
+func TestParseNACKMode(t *testing.T) {
+	for in, want := range map[string]NACKMode{"": NACKOn, "on": NACKOn, "no-responder": NACKNoResponder, "off": NACKOff} {
+		if got, err := ParseNACKMode(in); err != nil || got != want {
+			t.Errorf("%q: expected %q, got %q (%v)", in, want, got, err)
+		}
+	}
+	if _, err := ParseNACKMode("responder"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+// captureLog sends the log package's output to a buffer until the test
+// ends, then restores it.
+func captureLog(t *testing.T) *syncBuffer {
+	t.Helper()
+	var buf syncBuffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+	return &buf
+}
+
+func TestPeer_NoErrorsLoggedAfterClose(t *testing.T) {
+	p := newTestPeer(t, Options{})
+	p.Close()
+	buf := captureLog(t)
+
+	p.requestKeyframe(nil, &p.lastKeyframeRequest)
+	p.sendStopLive()
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Errorf("expected Shutdown after Close to succeed, got %v", err)
+	}
+	p.Close()
+	// Close's own state change may be logged; nothing should be an error.
+	if out := buf.Bytes(); bytes.Contains(out, []byte("error")) {
+		t.Errorf("expected no errors logged after Close, got %q", out)
+	}
+}
+
+func TestVideoReceiver_LowLatencyWriteErrorEndsTrack(t *testing.T) {
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{LowLatency: true})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	v := p.newVideoReceiver(90000, failWriter{}, false, func() {})
+	defer v.Close()
+
+	// The writer fails in its own goroutine; the read loop sees the error
+	// at a later packet.
+	packets := loadPackets(t, "testdata/golden.rtp")
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; time.Now().Before(deadline); i++ {
+		pkt := packets[i%len(packets)]
+		if !v.Handle(uint16(i), uint32(i)*3000, true, pkt.Payload) {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("expected Handle to report the failed write")
+}
+
+func TestVideoReceiver_BlockedPreviewDoesNotHoldMainVideo(t *testing.T) {
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	var buf bytes.Buffer
+	v := p.newVideoReceiver(90000, &buf, false, func() {})
+	defer v.Close()
+
+	// As if a preview write were stuck on a reader that stopped reading.
+	p.previewOut.mu.Lock()
+	defer p.previewOut.mu.Unlock()
+	results := make(chan writeResult, 1)
+	go func() { results <- v.write([][]byte{{0x65, 0x88}}, true) }()
+	select {
+	case r := <-results:
+		if r != written || buf.Len() == 0 {
+			t.Errorf("expected the main video written, got %v and %d bytes", r, buf.Len())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("main video write blocked behind the preview")
+	}
+}
+
+func TestNewPeer_NoAudioOffersVideoOnly(t *testing.T) {
+	tests := []struct {
+		noAudio   bool
+		wantAudio bool
+	}{
+		{false, true},
+		{true, false},
+	}
+	for _, tt := range tests {
+		p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{NoAudio: tt.noAudio})
+		if err != nil {
+			t.Fatalf("noAudio=%v: create peer: %v", tt.noAudio, err)
+		}
+		if err := p.AddTransceivers(); err != nil {
+			t.Fatalf("noAudio=%v: add transceivers: %v", tt.noAudio, err)
+		}
+		sdp, err := p.CreateOffer()
+		p.Close()
+		if err != nil {
+			t.Fatalf("noAudio=%v: create offer: %v", tt.noAudio, err)
+		}
+		if got := strings.Contains(sdp, "m=audio"); got != tt.wantAudio {
+			t.Errorf("noAudio=%v: expected audio m-line %v, got %v", tt.noAudio, tt.wantAudio, got)
+		}
+		if !strings.Contains(sdp, "m=video") {
+			t.Errorf("noAudio=%v: expected a video m-line", tt.noAudio)
+		}
+	}
+}
+
+// TestPeer_AnswerTakesDTLSRole checks that AnsweringDTLSRole sets the
+// a=setup of the answer to a camera's offer.
+func TestPeer_AnswerTakesDTLSRole(t *testing.T) {
+	tests := []struct {
+		role domain.DTLSRole
+		want string
+	}{
+		{domain.DTLSRoleAuto, "a=setup:active"},
+		{domain.DTLSRoleClient, "a=setup:active"},
+		{domain.DTLSRoleServer, "a=setup:passive"},
+	}
+	for _, tt := range tests {
+		camera, err := pion.NewPeerConnection(pion.Configuration{})
+		if err != nil {
+			t.Fatalf("create camera peer connection: %v", err)
+		}
+		if _, err := camera.AddTransceiverFromKind(pion.RTPCodecTypeVideo, pion.RTPTransceiverInit{Direction: pion.RTPTransceiverDirectionSendonly}); err != nil {
+			t.Fatalf("camera: add video: %v", err)
+		}
+		offer, err := camera.CreateOffer(nil)
+		camera.Close()
+		if err != nil {
+			t.Fatalf("camera: create offer: %v", err)
+		}
+
+		p := newTestPeer(t, Options{AnsweringDTLSRole: tt.role})
+		answer, err := p.AcceptOffer(domain.SDPPayload{Type: "offer", SDP: offer.SDP})
+		if err != nil {
+			t.Fatalf("role %q: accept offer: %v", tt.role, err)
+		}
+		if !strings.Contains(answer, tt.want) {
+			t.Errorf("role %q: expected %s in the answer, got:\n%s", tt.role, tt.want, answer)
+		}
+	}
+}
+
+// TestPeer_AcceptsAnswerWithOtherPayloadType checks that a camera may
+// answer with its own payload type for H264.
+func TestPeer_AcceptsAnswerWithOtherPayloadType(t *testing.T) {
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	if err := p.AddTransceivers(); err != nil {
+		t.Fatalf("add transceivers: %v", err)
+	}
+	offer, err := p.CreateOffer()
+	if err != nil {
+		t.Fatalf("create offer: %v", err)
+	}
+
+	camera, err := pion.NewPeerConnection(pion.Configuration{})
+	if err != nil {
+		t.Fatalf("create camera peer: %v", err)
+	}
+	defer camera.Close()
+	if err := camera.SetRemoteDescription(pion.SessionDescription{Type: pion.SDPTypeOffer, SDP: offer}); err != nil {
+		t.Fatalf("camera set offer: %v", err)
+	}
+	answer, err := camera.CreateAnswer(nil)
+	if err != nil {
+		t.Fatalf("camera create answer: %v", err)
+	}
+	sdp := strings.NewReplacer(
+		"SAVPF 121", "SAVPF 96",
+		"a=rtpmap:121 ", "a=rtpmap:96 ",
+		"a=fmtp:121 ", "a=fmtp:96 ",
+		"a=rtcp-fb:121 ", "a=rtcp-fb:96 ",
+	).Replace(answer.SDP)
+
+	if err := p.SetRemoteDescription(domain.SDPPayload{Type: "answer", SDP: sdp}); err != nil {
+		t.Fatalf("set answer: %v", err)
+	}
+	for _, tr := range p.pc.GetTransceivers() {
+		if tr.Kind() != pion.RTPCodecTypeVideo {
+			continue
+		}
+		codecs := tr.Receiver().GetParameters().Codecs
+		if len(codecs) == 0 || codecs[0].PayloadType != 96 {
+			t.Errorf("expected H264 negotiated with pt 96, got %v", codecs)
+		}
+	}
+}
+
+func TestNewPeer_OffersH264Profile(t *testing.T) {
+	for _, profile := range []domain.H264Profile{{}, {ProfileLevelID: "42e01f", PacketizationMode: 1}} {
+		p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{H264Profile: profile})
+		if err != nil {
+			t.Fatalf("create peer: %v", err)
+		}
+		if err := p.AddTransceivers(); err != nil {
+			t.Fatalf("add transceivers: %v", err)
+		}
+		sdp, err := p.CreateOffer()
+		p.Close()
+		if err != nil {
+			t.Fatalf("create offer: %v", err)
+		}
+		want := profile
+		if want == (domain.H264Profile{}) {
+			want = DefaultH264Profile
+		}
+		if !strings.Contains(sdp, fmtpLine(want)) {
+			t.Errorf("profile %v: expected %q in the offer", profile, fmtpLine(want))
+		}
+	}
+}
+
+func TestPeer_ValidateAnswer(t *testing.T) {
+	tests := []struct {
+		name    string
+		rewrite func(string) string
+		ok      bool
+	}{
+		{"as answered", func(s string) string { return s }, true},
+		{"video rejected", func(s string) string { return strings.Replace(s, "m=video 9 ", "m=video 0 ", 1) }, false},
+	}
+	for _, tt := range tests {
+		p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{ValidateAnswer: true})
+		if err != nil {
+			t.Fatalf("create peer: %v", err)
+		}
+		if err := p.AddTransceivers(); err != nil {
+			t.Fatalf("add transceivers: %v", err)
+		}
+		offer, err := p.CreateOffer()
+		if err != nil {
+			t.Fatalf("create offer: %v", err)
+		}
+		camera, err := pion.NewPeerConnection(pion.Configuration{})
+		if err != nil {
+			t.Fatalf("create camera peer: %v", err)
+		}
+		if err := camera.SetRemoteDescription(pion.SessionDescription{Type: pion.SDPTypeOffer, SDP: offer}); err != nil {
+			t.Fatalf("camera set offer: %v", err)
+		}
+		answer, err := camera.CreateAnswer(nil)
+		if err != nil {
+			t.Fatalf("camera create answer: %v", err)
+		}
+
+		err = p.SetRemoteDescription(domain.SDPPayload{Type: "answer", SDP: tt.rewrite(answer.SDP)})
+		if tt.ok && err != nil {
+			t.Errorf("%s: expected answer accepted, got %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrAnswerRejected) {
+			t.Errorf("%s: expected ErrAnswerRejected, got %v", tt.name, err)
+		}
+		camera.Close()
+		p.Close()
+	}
+}
+
+func TestPeer_NegotiationNeededAfterFirstExchange(t *testing.T) {
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	needed := make(chan struct{}, 4)
+	p.SetOnNegotiationNeeded(func() { needed <- struct{}{} })
+	if err := p.AddTransceivers(); err != nil {
+		t.Fatalf("add transceivers: %v", err)
+	}
+	// The offer and answer carry all candidates, so the two connect and
+	// Pion's operations queue, which delivers the event, is not held up
+	// by a connection that never comes up.
+	gathered := pion.GatheringCompletePromise(p.pc)
+	if _, err := p.CreateOffer(); err != nil {
+		t.Fatalf("create offer: %v", err)
+	}
+	<-gathered
+	offer := p.pc.LocalDescription().SDP
+	camera, err := pion.NewPeerConnection(pion.Configuration{})
+	if err != nil {
+		t.Fatalf("create camera peer: %v", err)
+	}
+	defer camera.Close()
+	if err := camera.SetRemoteDescription(pion.SessionDescription{Type: pion.SDPTypeOffer, SDP: offer}); err != nil {
+		t.Fatalf("camera set offer: %v", err)
+	}
+	answer, err := camera.CreateAnswer(nil)
+	if err != nil {
+		t.Fatalf("camera create answer: %v", err)
+	}
+	gathered = pion.GatheringCompletePromise(camera)
+	if err := camera.SetLocalDescription(answer); err != nil {
+		t.Fatalf("camera set answer: %v", err)
+	}
+	<-gathered
+	if err := p.SetRemoteDescription(domain.SDPPayload{Type: "answer", SDP: camera.LocalDescription().SDP}); err != nil {
+		t.Fatalf("set answer: %v", err)
+	}
+	select {
+	case <-needed:
+		t.Fatal("expected no renegotiation for the initial transceivers")
+	default:
+	}
+
+	if _, err := p.pc.AddTransceiverFromKind(pion.RTPCodecTypeAudio, pion.RTPTransceiverInit{Direction: pion.RTPTransceiverDirectionSendrecv}); err != nil {
+		t.Fatalf("add transceiver: %v", err)
+	}
+	select {
+	case <-needed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected renegotiation after adding a transceiver")
+	}
+}
+
+func TestMatchTrack(t *testing.T) {
+	tests := []struct {
+		want, id, rid string
+		ssrc          uint32
+		match         bool
+	}{
+		{"", "video0", "", 1234, true},
+		{"video0", "video0", "", 1234, true},
+		{"video1", "video0", "", 1234, false},
+		{"h", "video0", "h", 1234, true},
+		{"1234", "video0", "", 1234, true},
+		{"4321", "video0", "", 1234, false},
+	}
+	for _, tt := range tests {
+		if got := matchTrack(tt.want, tt.id, tt.rid, tt.ssrc); got != tt.match {
+			t.Errorf("%q against id=%s rid=%q ssrc=%d: expected %v, got %v", tt.want, tt.id, tt.rid, tt.ssrc, tt.match, got)
+		}
+	}
+}
+
+func TestVideoReceiver_StripsNALUTypes(t *testing.T) {
+	_, v := newTestReceiver(t, Options{StripNALUTypes: []uint8{6, 9}})
+	out := captureOutput(v)
+	aud := []byte{0x09, 0xf0}
+	sei := []byte{0x06, 0x05, 0x01, 0x00}
+	slice := []byte{0x41, 0x9a, 0x02}
+	for i, nalu := range [][]byte{aud, sei, slice} {
+		v.Handle(uint16(i), 3000, i == 2, nalu)
+	}
+
+	want := append([]byte{0, 0, 0, 1}, slice...)
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("expected only the slice, got % x", out.Bytes())
+	}
+}
+
+func TestVideoReceiver_NALUProcessor(t *testing.T) {
+	p, v := newTestReceiver(t, Options{})
+	out := captureOutput(v)
+	// Drop SEI and mark each slice, as a watermark would.
+	var seen []byte
+	p.SetNALUProcessor(func(nalu []byte) []byte {
+		seen = append(seen, nalu[0]&0x1f)
+		switch nalu[0] & 0x1f {
+		case 6:
+			return nil
+		case 1:
+			return append(append([]byte(nil), nalu...), 0xff)
+		}
+		return nalu
+	})
+	v.Handle(0, 3000, false, []byte{0x06, 0x05, 0x01})
+	v.Handle(1, 3000, true, []byte{0x65, 0x88})
+	v.Handle(2, 6000, true, []byte{0x06, 0x05, 0x02})
+	v.Handle(3, 9000, true, []byte{0x41, 0x9a})
+
+	want := []byte{0, 0, 0, 1, 0x65, 0x88, 0, 0, 0, 1, 0x41, 0x9a, 0xff}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("expected % x, got % x", want, out.Bytes())
+	}
+	if !bytes.Equal(seen, []byte{6, 5, 6, 1}) {
+		t.Errorf("expected the processor to see NAL unit types [6 5 6 1], got %v", seen)
+	}
+	if got := p.Stats().AccessUnits; got != 2 {
+		t.Errorf("expected the access unit left empty not to count, got %d access units", got)
+	}
+}
+
+// TestVideoReceiver_NALUProcessorRunsBeforeKeyframeWait drops keyframes in
+// the processor: the keyframe wait should stay closed and no first frame
+// be reported until one is let through.
+func TestVideoReceiver_NALUProcessorRunsBeforeKeyframeWait(t *testing.T) {
+	p, v := newTestReceiver(t, Options{WaitKeyframe: true})
+	out := captureOutput(v)
+	firstFrame := false
+	p.SetOnFirstFrame(func() { firstFrame = true })
+	dropIDR := true
+	p.SetNALUProcessor(func(nalu []byte) []byte {
+		if dropIDR && nalu[0]&0x1f == naluTypeIDR {
+			return nil
+		}
+		return nalu
+	})
+	sps, pps, idr := []byte{0x67, 0x42, 0x00, 0x1f}, []byte{0x68, 0xce}, []byte{0x65, 0x88}
+	v.Handle(0, 3000, false, sps)
+	v.Handle(1, 3000, false, pps)
+	v.Handle(2, 3000, true, idr)
+	if out.Len() != 0 || firstFrame || v.keyframeSeen.Load() {
+		t.Fatalf("expected a dropped keyframe not to open the wait, got % x written, first frame %v", out.Bytes(), firstFrame)
+	}
+
+	dropIDR = false
+	v.Handle(3, 6000, false, sps)
+	v.Handle(4, 6000, false, pps)
+	v.Handle(5, 6000, true, idr)
+	if want := annexB(sps, pps, idr); !bytes.Equal(out.Bytes(), want) || !firstFrame {
+		t.Errorf("expected % x written and a first frame, got % x, first frame %v", want, out.Bytes(), firstFrame)
+	}
+}
+
+func TestVideoReceiver_DropsOversizeNALUs(t *testing.T) {
+	p, v := newTestReceiver(t, Options{MaxNALUSize: 4})
+	out := captureOutput(v)
+	requests := 0
+	v.requestKeyframe = func() { requests++ }
+	v.Handle(0, 3000, true, []byte{0x65, 0x88, 0x84, 0x21})
+	v.Handle(1, 6000, true, []byte{0x41, 0x9a, 0x02, 0x03, 0x04})
+	v.Handle(2, 9000, true, []byte{0x41, 0x9a})
+	if requests != 0 {
+		t.Errorf("expected no keyframe request for a dropped P-frame, got %d", requests)
+	}
+	v.Handle(3, 12000, true, []byte{0x65, 0x88, 0x84, 0x21, 0x22})
+	if requests != 1 {
+		t.Errorf("expected a keyframe request for a dropped IDR, got %d", requests)
+	}
+
+	want := []byte{0, 0, 0, 1, 0x65, 0x88, 0x84, 0x21, 0, 0, 0, 1, 0x41, 0x9a}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("expected % x, got % x", want, out.Bytes())
+	}
+	if got := p.Stats().OversizeNALUs; got != 2 {
+		t.Errorf("expected 2 oversize NAL units counted, got %d", got)
+	}
+}
+
+// stuckWriter blocks each Write until release is closed, as an output
+// whose reader has stopped reading does.
+type stuckWriter struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (w *stuckWriter) Write(p []byte) (int, error) {
+	select {
+	case w.entered <- struct{}{}:
+	default:
+	}
+	<-w.release
+	return len(p), nil
+}
+
+func TestPeer_Shutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		stuck   func(p *Peer) *videoOutput // the output with a write in progress, if any
+		finish  bool                       // whether that write completes before Shutdown
+		wantErr error
+	}{
+		{"idle", nil, false, nil},
+		{"main write completes", func(p *Peer) *videoOutput { return &p.out }, true, nil},
+		{"main write stuck", func(p *Peer) *videoOutput { return &p.out }, false, context.DeadlineExceeded},
+		{"preview write stuck", func(p *Peer) *videoOutput { return &p.previewOut }, false, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		p := newTestPeer(t, Options{})
+		w := &stuckWriter{entered: make(chan struct{}, 1), release: make(chan struct{})}
+		wrote := make(chan bool, 1)
+		if tt.stuck != nil {
+			out := tt.stuck(p)
+			go func() { wrote <- out.write(w, AnnexB{}, [][]byte{{0x65, 0x88}}, true) }()
+			<-w.entered
+			if tt.finish {
+				close(w.release)
+				<-wrote
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err := p.Shutdown(ctx)
+		cancel()
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if tt.stuck != nil && !tt.finish {
+			close(w.release)
+			if !<-wrote {
+				t.Errorf("%s: expected the write in progress to complete", tt.name)
+			}
+			if err := p.Shutdown(context.Background()); err != nil {
+				t.Errorf("%s: expected a second Shutdown to succeed once the write completed, got %v", tt.name, err)
+			}
+		}
+		for _, out := range []*videoOutput{&p.out, &p.previewOut} {
+			if out.write(io.Discard, AnnexB{}, [][]byte{{0x41}}, true) {
+				t.Errorf("%s: expected writes after Shutdown to fail", tt.name)
+			}
+		}
+	}
+}
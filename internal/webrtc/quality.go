@@ -0,0 +1,99 @@
+package webrtc
+
+import "time"
+
+// Quality is a coarse connection quality rating.
+type Quality int
+
+const (
+	QualityUnknown Quality = iota // no video in the interval
+	QualityGood
+	QualityFair
+	QualityPoor
+)
+
+func (q Quality) String() string {
+	switch q {
+	case QualityGood:
+		return "good"
+	case QualityFair:
+		return "fair"
+	case QualityPoor:
+		return "poor"
+	default:
+		return "unknown"
+	}
+}
+
+// QualityThresholds are the limits at which each input makes the rating
+// fair or poor. Loss is in percent of expected packets.
+type QualityThresholds struct {
+	LossFair, LossPoor     float64
+	JitterFair, JitterPoor time.Duration
+	RTTFair, RTTPoor       time.Duration
+}
+
+// DefaultQualityThresholds suit live viewing: under 1% loss, 30ms jitter
+// and 150ms RTT is good, above 5%, 100ms or 400ms is poor.
+var DefaultQualityThresholds = QualityThresholds{
+	LossFair: 1, LossPoor: 5,
+	JitterFair: 30 * time.Millisecond, JitterPoor: 100 * time.Millisecond,
+	RTTFair: 150 * time.Millisecond, RTTPoor: 400 * time.Millisecond,
+}
+
+// ClassifyQuality rates the interval between two stats snapshots by its
+// packet loss and the current jitter and RTT. The worst input decides; an
+// RTT of zero (not yet measured) is ignored.
+func ClassifyQuality(prev, cur Stats, th QualityThresholds) Quality {
+	received := cur.VideoPackets - prev.VideoPackets
+	lost := cur.PacketsLost - prev.PacketsLost
+	if received == 0 {
+		return QualityUnknown
+	}
+	loss := 100 * float64(lost) / float64(received+lost)
+
+	switch {
+	case loss >= th.LossPoor, cur.Jitter >= th.JitterPoor, cur.RTT > 0 && cur.RTT >= th.RTTPoor:
+		return QualityPoor
+	case loss >= th.LossFair, cur.Jitter >= th.JitterFair, cur.RTT > 0 && cur.RTT >= th.RTTFair:
+		return QualityFair
+	default:
+		return QualityGood
+	}
+}
+
+// jitterEstimator computes the RFC 3550 interarrival jitter of an RTP
+// stream: a running average of how much packet spacing on arrival differs
+// from their spacing in RTP time.
+type jitterEstimator struct {
+	clockRate   float64
+	started     bool
+	lastTS      uint32
+	lastArrival time.Time
+	jitter      float64 // in RTP timestamp units
+}
+
+func newJitterEstimator(clockRate uint32) *jitterEstimator {
+	if clockRate == 0 {
+		clockRate = 90000
+	}
+	return &jitterEstimator{clockRate: float64(clockRate)}
+}
+
+// Update adds a packet with RTP timestamp ts that arrived at arrival.
+func (j *jitterEstimator) Update(ts uint32, arrival time.Time) {
+	if j.started {
+		d := arrival.Sub(j.lastArrival).Seconds()*j.clockRate - float64(int32(ts-j.lastTS))
+		if d < 0 {
+			d = -d
+		}
+		j.jitter += (d - j.jitter) / 16
+	}
+	j.started = true
+	j.lastTS, j.lastArrival = ts, arrival
+}
+
+// Jitter returns the current estimate.
+func (j *jitterEstimator) Jitter() time.Duration {
+	return time.Duration(j.jitter / j.clockRate * float64(time.Second))
+}
@@ -0,0 +1,82 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClassifyQuality(t *testing.T) {
+	th := DefaultQualityThresholds
+	tests := []struct {
+		name   string
+		lost   uint64 // of 1000 expected packets
+		jitter time.Duration
+		rtt    time.Duration
+		want   Quality
+	}{
+		{"clean", 0, 5 * time.Millisecond, 40 * time.Millisecond, QualityGood},
+		{"rtt unknown", 0, 5 * time.Millisecond, 0, QualityGood},
+		{"some loss", 20, 5 * time.Millisecond, 40 * time.Millisecond, QualityFair},
+		{"heavy loss", 80, 5 * time.Millisecond, 40 * time.Millisecond, QualityPoor},
+		{"jittery", 0, 50 * time.Millisecond, 40 * time.Millisecond, QualityFair},
+		{"slow path", 0, 5 * time.Millisecond, 500 * time.Millisecond, QualityPoor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := Stats{VideoPackets: 5000, PacketsLost: 10}
+			cur := Stats{
+				VideoPackets: prev.VideoPackets + 1000 - tt.lost,
+				PacketsLost:  prev.PacketsLost + tt.lost,
+				Jitter:       tt.jitter,
+				RTT:          tt.rtt,
+			}
+			if got := ClassifyQuality(prev, cur, th); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestClassifyQuality_NoVideoIsUnknown(t *testing.T) {
+	s := Stats{VideoPackets: 100}
+	if got := ClassifyQuality(s, s, DefaultQualityThresholds); got != QualityUnknown {
+		t.Errorf("expected unknown for an interval without packets, got %s", got)
+	}
+}
+
+func TestJitterEstimator(t *testing.T) {
+	base := time.Unix(0, 0)
+
+	// Packets 20ms apart in both RTP and arrival time have no jitter.
+	j := newJitterEstimator(90000)
+	for i := 0; i < 50; i++ {
+		j.Update(uint32(i*1800), base.Add(time.Duration(i)*20*time.Millisecond))
+	}
+	if got := j.Jitter(); got != 0 {
+		t.Errorf("expected zero jitter for evenly spaced packets, got %s", got)
+	}
+
+	// Arrival alternating 10ms early and late converges towards the 20ms
+	// transit difference between consecutive packets.
+	j = newJitterEstimator(90000)
+	for i := 0; i < 500; i++ {
+		offset := 10 * time.Millisecond
+		if i%2 == 1 {
+			offset = -offset
+		}
+		j.Update(uint32(i*1800), base.Add(time.Duration(i)*20*time.Millisecond+offset))
+	}
+	if got := j.Jitter(); got < 19*time.Millisecond || got > 21*time.Millisecond {
+		t.Errorf("expected jitter near 20ms, got %s", got)
+	}
+}
+
+func TestJitterEstimator_TimestampWrap(t *testing.T) {
+	base := time.Unix(0, 0)
+	j := newJitterEstimator(90000)
+	j.Update(0xffffffff-899, base)
+	j.Update(900, base.Add(20*time.Millisecond))
+	if got := j.Jitter(); got != 0 {
+		t.Errorf("expected zero jitter across the timestamp wrap, got %s", got)
+	}
+}
@@ -0,0 +1,48 @@
+package webrtc
+
+// naluBatch is NAL units written together; auStart marks a batch that
+// begins an access unit.
+type naluBatch struct {
+	nalus   [][]byte
+	auStart bool
+}
+
+// dropOldestQueue is a bounded FIFO of NAL unit batches between the RTP
+// read loop and the output writer. Push never blocks: when the queue is
+// full the oldest batch is discarded to make room, so a slow consumer sees
+// the freshest video rather than an ever-growing delay.
+type dropOldestQueue struct {
+	ch chan naluBatch
+}
+
+func newDropOldestQueue(size int) *dropOldestQueue {
+	return &dropOldestQueue{ch: make(chan naluBatch, size)}
+}
+
+// Push enqueues b and returns how many older batches were discarded to
+// make room. It must only be called from one goroutine.
+func (q *dropOldestQueue) Push(b naluBatch) int {
+	dropped := 0
+	for {
+		select {
+		case q.ch <- b:
+			return dropped
+		default:
+		}
+		select {
+		case <-q.ch:
+			dropped++
+		default:
+		}
+	}
+}
+
+// Close ends the queue; the consumer drains what is left and stops.
+func (q *dropOldestQueue) Close() {
+	close(q.ch)
+}
+
+// C returns the channel the consumer reads batches from.
+func (q *dropOldestQueue) C() <-chan naluBatch {
+	return q.ch
+}
@@ -0,0 +1,25 @@
+package webrtc
+
+import "testing"
+
+func TestDropOldestQueue_DropsOldestWhenFull(t *testing.T) {
+	q := newDropOldestQueue(2)
+
+	for i := byte(0); i < 2; i++ {
+		if dropped := q.Push(naluBatch{nalus: [][]byte{{i}}}); dropped != 0 {
+			t.Fatalf("push %d: expected no drops, got %d", i, dropped)
+		}
+	}
+	if dropped := q.Push(naluBatch{nalus: [][]byte{{2}}}); dropped != 1 {
+		t.Fatalf("expected 1 drop when full, got %d", dropped)
+	}
+	q.Close()
+
+	var got []byte
+	for b := range q.C() {
+		got = append(got, b.nalus[0][0])
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("expected the two newest batches [1 2], got %v", got)
+	}
+}
@@ -0,0 +1,69 @@
+package webrtc
+
+import (
+	"fmt"
+	"log"
+
+	"vico_home/native/internal/domain"
+)
+
+// DefaultResolution is requested for the main stream when
+// Options.Resolution is empty.
+const DefaultResolution = "1280x720"
+
+// DefaultSize is the stream size named in the main stream's startLive
+// when Options.Size is empty. The app asks for "medium"; the preview is
+// always "small".
+const DefaultSize = "medium"
+
+const previewSize = "small"
+
+// resolutionTolerance is how many pixels each dimension may differ from
+// the request and still match: one macroblock, as encoders round the
+// coded size and not every camera crops it back.
+const resolutionTolerance = 16
+
+func (p *Peer) mainSize() string {
+	if p.opts.Size != "" {
+		return p.opts.Size
+	}
+	return DefaultSize
+}
+
+func (p *Peer) mainResolution() string {
+	if p.opts.Resolution != "" {
+		return p.opts.Resolution
+	}
+	return DefaultResolution
+}
+
+// checkResolution compares the size from a new SPS with the one requested
+// for the stream. A mismatch is logged and, for the main stream with
+// StrictResolution, reported as ErrResolutionMismatch.
+func (v *videoReceiver) checkResolution(width, height int) {
+	requested := v.p.mainResolution()
+	if v.preview {
+		requested = v.p.opts.Preview.Resolution
+	}
+	wantW, wantH, err := domain.ParseResolution(requested)
+	if err != nil || resolutionMatches(width, height, wantW, wantH) {
+		return
+	}
+	msg := fmt.Sprintf("camera sends %s at %dx%d, not the requested %s", v.name, width, height, requested)
+	if v.preview || !v.p.opts.StrictResolution {
+		log.Printf("[webrtc] warning: %s", msg)
+		return
+	}
+	v.p.onError(fmt.Errorf("%w: %s", ErrResolutionMismatch, msg))
+}
+
+func resolutionMatches(width, height, wantW, wantH int) bool {
+	return abs(width-wantW) <= resolutionTolerance && abs(height-wantH) <= resolutionTolerance
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
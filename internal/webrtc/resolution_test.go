@@ -0,0 +1,51 @@
+package webrtc
+
+import (
+	"errors"
+	"testing"
+
+	"vico_home/native/internal/domain"
+)
+
+func TestResolutionMatches(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          string
+		match         bool
+	}{
+		{1920, 1080, "1920x1080", true},
+		{1920, 1088, "1920x1080", true}, // uncropped coded size
+		{1280, 720, "1920x1080", false},
+		{640, 360, "640x360", true},
+	}
+	for _, tt := range tests {
+		w, h, err := domain.ParseResolution(tt.want)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.want, err)
+		}
+		if got := resolutionMatches(tt.width, tt.height, w, h); got != tt.match {
+			t.Errorf("%dx%d vs %s: expected match=%v, got %v", tt.width, tt.height, tt.want, tt.match, got)
+		}
+	}
+}
+
+func TestCheckResolution_StrictReportsMismatch(t *testing.T) {
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{Resolution: "1920x1080", StrictResolution: true})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	var got error
+	p.SetOnError(func(err error) { got = err })
+
+	v := p.newVideoReceiver(90000, nil, false, func() {})
+	defer v.Close()
+	v.checkResolution(1920, 1088)
+	if got != nil {
+		t.Fatalf("expected no error within tolerance, got %v", got)
+	}
+	v.checkResolution(1280, 720)
+	if !errors.Is(got, ErrResolutionMismatch) {
+		t.Errorf("expected ErrResolutionMismatch, got %v", got)
+	}
+}
@@ -0,0 +1,258 @@
+package webrtc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SPSInfo holds the stream properties decoded from an H264 sequence
+// parameter set.
+type SPSInfo struct {
+	ProfileIDC uint8
+	LevelIDC   uint8
+	Width      int
+	Height     int
+	FrameRate  float64 // 0 when the SPS carries no VUI timing info
+}
+
+var errSPSTruncated = errors.New("sps: truncated")
+
+// ParseSPS decodes the picture size (after cropping) and, when present,
+// the VUI frame rate from an SPS NAL unit, header byte included.
+func ParseSPS(nal []byte) (SPSInfo, error) {
+	var info SPSInfo
+	if len(nal) < 4 {
+		return info, errSPSTruncated
+	}
+	if t := nal[0] & 0x1f; t != naluTypeSPS {
+		return info, fmt.Errorf("sps: NAL type %d is not an SPS", t)
+	}
+
+	r := &bitReader{data: unescapeRBSP(nal[1:])}
+	info.ProfileIDC = uint8(r.u(8))
+	r.u(8) // constraint flags and reserved bits
+	info.LevelIDC = uint8(r.u(8))
+	r.ue() // seq_parameter_set_id
+
+	chromaFormatIDC := uint64(1)
+	separateColourPlane := false
+	switch info.ProfileIDC {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormatIDC = r.ue()
+		if chromaFormatIDC == 3 {
+			separateColourPlane = r.flag()
+		}
+		r.ue()   // bit_depth_luma_minus8
+		r.ue()   // bit_depth_chroma_minus8
+		r.flag() // qpprime_y_zero_transform_bypass_flag
+
+		// seq_scaling_matrix_present_flag
+		if r.flag() {
+			lists := 8
+			if chromaFormatIDC == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if !r.flag() {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				r.skipScalingList(size)
+			}
+		}
+	}
+
+	r.ue() // log2_max_frame_num_minus4
+
+	// pic_order_cnt_type
+	switch r.ue() {
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.flag() // delta_pic_order_always_zero_flag
+		r.se()   // offset_for_non_ref_pic
+		r.se()   // offset_for_top_to_bottom_field
+		n := r.ue()
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			r.se() // offset_for_ref_frame
+		}
+	}
+	r.ue()   // max_num_ref_frames
+	r.flag() // gaps_in_frame_num_value_allowed_flag
+
+	widthMBs := r.ue() + 1
+	heightMapUnits := r.ue() + 1
+	frameMBsOnly := r.flag()
+	if !frameMBsOnly {
+		r.flag() // mb_adaptive_frame_field_flag
+	}
+	r.flag() // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom uint64
+	if r.flag() { // frame_cropping_flag
+		cropLeft, cropRight, cropTop, cropBottom = r.ue(), r.ue(), r.ue(), r.ue()
+	}
+	vuiPresent := r.flag()
+	if r.err != nil {
+		return info, r.err
+	}
+
+	fieldFactor := uint64(2)
+	if frameMBsOnly {
+		fieldFactor = 1
+	}
+	cropUnitX, cropUnitY := uint64(1), fieldFactor
+	if !separateColourPlane && chromaFormatIDC != 0 {
+		subWidthC, subHeightC := uint64(2), uint64(1)
+		switch chromaFormatIDC {
+		case 1:
+			subHeightC = 2
+		case 3:
+			subWidthC = 1
+		}
+		cropUnitX = subWidthC
+		cropUnitY = subHeightC * fieldFactor
+	}
+
+	width := widthMBs * 16
+	height := fieldFactor * heightMapUnits * 16
+	cropX := cropUnitX * (cropLeft + cropRight)
+	cropY := cropUnitY * (cropTop + cropBottom)
+	if cropX >= width || cropY >= height {
+		return info, fmt.Errorf("sps: cropping exceeds %dx%d picture", width, height)
+	}
+	info.Width = int(width - cropX)
+	info.Height = int(height - cropY)
+
+	if vuiPresent {
+		info.FrameRate = r.vuiFrameRate()
+		if r.err != nil {
+			return info, r.err
+		}
+	}
+	return info, nil
+}
+
+// vuiFrameRate walks the VUI up to timing_info and returns
+// time_scale / (2 * num_units_in_tick), or 0 if timing info is absent.
+func (r *bitReader) vuiFrameRate() float64 {
+	if r.flag() { // aspect_ratio_info_present_flag
+		if r.u(8) == 255 { // aspect_ratio_idc == Extended_SAR
+			r.u(16) // sar_width
+			r.u(16) // sar_height
+		}
+	}
+	if r.flag() { // overscan_info_present_flag
+		r.flag() // overscan_appropriate_flag
+	}
+	if r.flag() { // video_signal_type_present_flag
+		r.u(3)   // video_format
+		r.flag() // video_full_range_flag
+
+		// colour_description_present_flag
+		if r.flag() {
+			r.u(24) // colour_primaries, transfer_characteristics, matrix_coefficients
+		}
+	}
+	if r.flag() { // chroma_loc_info_present_flag
+		r.ue()
+		r.ue()
+	}
+	if !r.flag() { // timing_info_present_flag
+		return 0
+	}
+	numUnitsInTick := r.u(32)
+	timeScale := r.u(32)
+	if r.err != nil || numUnitsInTick == 0 {
+		return 0
+	}
+	return float64(timeScale) / float64(2*numUnitsInTick)
+}
+
+// unescapeRBSP removes emulation prevention bytes (the 0x03 in 00 00 03).
+func unescapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 0x03 {
+			zeros = 0
+			continue
+		}
+		out = append(out, c)
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// bitReader reads big-endian bit fields and Exp-Golomb codes. The first
+// read past the end sets err; later reads return 0.
+type bitReader struct {
+	data []byte
+	pos  int // bit offset
+	err  error
+}
+
+func (r *bitReader) u(n int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos+n > len(r.data)*8 {
+		r.err = errSPSTruncated
+		return 0
+	}
+	var v uint64
+	for i := 0; i < n; i++ {
+		bit := r.data[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) flag() bool {
+	return r.u(1) == 1
+}
+
+// ue reads an unsigned Exp-Golomb code.
+func (r *bitReader) ue() uint64 {
+	zeros := 0
+	for r.u(1) == 0 {
+		if r.err != nil {
+			return 0
+		}
+		zeros++
+		if zeros > 31 {
+			r.err = errors.New("sps: invalid Exp-Golomb code")
+			return 0
+		}
+	}
+	return 1<<zeros - 1 + r.u(zeros)
+}
+
+// se reads a signed Exp-Golomb code.
+func (r *bitReader) se() int64 {
+	k := r.ue()
+	if k%2 == 1 {
+		return int64(k+1) / 2
+	}
+	return -int64(k / 2)
+}
+
+func (r *bitReader) skipScalingList(size int) {
+	last, next := int64(8), int64(8)
+	for i := 0; i < size && r.err == nil; i++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
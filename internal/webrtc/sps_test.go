@@ -0,0 +1,77 @@
+package webrtc
+
+import "testing"
+
+func TestParseSPS_KnownStreams(t *testing.T) {
+	tests := []struct {
+		name string
+		sps  []byte
+		want SPSInfo
+	}{
+		{
+			// Baseline, 80x45 MBs, VUI with extended SAR, colour
+			// description and 30 fps timing (contains emulation prevention).
+			name: "720p baseline 30fps",
+			sps: []byte{
+				0x67, 0x42, 0x00, 0x1f, 0x96, 0x54, 0x02, 0x80, 0x2d, 0xdf,
+				0xf8, 0x00, 0x08, 0x00, 0x0b, 0x50, 0x10, 0x10, 0x14, 0x00,
+				0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf2, 0x08,
+			},
+			want: SPSInfo{ProfileIDC: 66, LevelIDC: 31, Width: 1280, Height: 720, FrameRate: 30},
+		},
+		{
+			// High, 120x68 MBs cropped by 8 rows, a scaling list, 15 fps.
+			name: "1080p high cropped",
+			sps: []byte{
+				0x67, 0x64, 0x00, 0x28, 0xad, 0x84, 0x3f, 0xff, 0x80, 0x2c,
+				0xa8, 0x07, 0x80, 0x22, 0x7e, 0x5f, 0xfc, 0x00, 0x04, 0x00,
+				0x05, 0xa8, 0x08, 0x08, 0x0a, 0x00, 0x00, 0x07, 0xd0, 0x00,
+				0x00, 0xea, 0x61, 0x04,
+			},
+			want: SPSInfo{ProfileIDC: 100, LevelIDC: 40, Width: 1920, Height: 1080, FrameRate: 15},
+		},
+		{
+			// Main, field coding (frame_mbs_only=0), pic_order_cnt_type 1, no VUI.
+			name: "576i main",
+			sps:  []byte{0x67, 0x4d, 0x00, 0x1e, 0x95, 0x0a, 0x99, 0x9a, 0x02, 0xd0, 0x91, 0x20},
+			want: SPSInfo{ProfileIDC: 77, LevelIDC: 30, Width: 720, Height: 576},
+		},
+		{
+			// High, field coding, 34 map units cropped by 8 frame rows.
+			name: "1080i high cropped",
+			sps:  []byte{0x67, 0x64, 0x00, 0x28, 0xac, 0x2c, 0xa8, 0x07, 0x80, 0x44, 0x7d, 0xa0},
+			want: SPSInfo{ProfileIDC: 100, LevelIDC: 40, Width: 1920, Height: 1080},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSPS(tt.sps)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseSPS_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		nal  []byte
+	}{
+		{"empty", nil},
+		{"not an SPS", []byte{0x68, 0xee, 0x3c, 0x80}},
+		{"truncated", []byte{0x67, 0x64, 0x00, 0x28, 0xac}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSPS(tt.nal); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
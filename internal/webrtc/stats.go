@@ -0,0 +1,184 @@
+package webrtc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+// VideoInfo describes the negotiated video stream. Codec fields are known
+// once the track arrives; picture fields once an SPS has been parsed.
+type VideoInfo struct {
+	MimeType    string
+	PayloadType uint8
+	FmtpLine    string
+	ClockRate   uint32
+
+	Width     int
+	Height    int
+	FrameRate float64 // from SPS VUI timing, 0 if the camera omits it
+}
+
+// String formats the codec as e.g. "video/H264 pt=121 (profile-level-id=...)".
+func (v VideoInfo) String() string {
+	if v.MimeType == "" {
+		return "-"
+	}
+	s := fmt.Sprintf("%s pt=%d", v.MimeType, v.PayloadType)
+	if v.FmtpLine != "" {
+		s += " (" + v.FmtpLine + ")"
+	}
+	return s
+}
+
+// Resolution formats the picture size as e.g. "1920x1080@15fps", or "-"
+// before an SPS has been seen.
+func (v VideoInfo) Resolution() string {
+	if v.Width == 0 {
+		return "-"
+	}
+	s := fmt.Sprintf("%dx%d", v.Width, v.Height)
+	if v.FrameRate > 0 {
+		s += fmt.Sprintf("@%.4gfps", v.FrameRate)
+	}
+	return s
+}
+
+// Stats is a snapshot of a peer's connection state and video counters.
+type Stats struct {
+	ConnectionState  string
+	ICEState         string
+	DataChannelState string // control channel ready state, empty until it opens
+	Video            VideoInfo
+	Audio            AudioInfo
+
+	VideoPackets  uint64        // RTP packets read from the video track
+	VideoBytes    uint64        // RTP payload bytes read from the video track
+	PacketsLost   uint64        // packets missing from the RTP sequence
+	AccessUnits   uint64        // access units written to the output
+	FramesDropped uint64        // access units left out by Options.DropFrames
+	OversizeNALUs uint64        // NAL units dropped for exceeding Options.MaxNALUSize
+	MediaTime     time.Duration // timestamp of the last access unit written, from the first
+	LastPacket    time.Time
+	Recovering    bool    // waiting for a keyframe requested by Options.LossRecovery
+	Bitrate       Bitrate // over sliding windows, as of the snapshot
+
+	Jitter time.Duration // RFC 3550 interarrival jitter of the video stream
+	RTT    time.Duration // round trip time of the selected ICE pair, 0 if unknown
+
+	Depacketizer DepacketizerStats
+}
+
+// Plus returns s with the counters of earlier, the stats of a peer that
+// s's peer replaced, added in, so a session's summary covers every peer
+// connection it tried. The states, media info, times and rates stay s's.
+func (s Stats) Plus(earlier Stats) Stats {
+	s.VideoPackets += earlier.VideoPackets
+	s.VideoBytes += earlier.VideoBytes
+	s.PacketsLost += earlier.PacketsLost
+	s.AccessUnits += earlier.AccessUnits
+	s.FramesDropped += earlier.FramesDropped
+	s.OversizeNALUs += earlier.OversizeNALUs
+	d, e := &s.Depacketizer, earlier.Depacketizer
+	d.Packets += e.Packets
+	d.NALUs += e.NALUs
+	d.FUACompleted += e.FUACompleted
+	d.FUADropped += e.FUADropped
+	d.FUAOrphans += e.FUAOrphans
+	d.FUAOversize += e.FUAOversize
+	d.ForbiddenBit += e.ForbiddenBit
+	d.InvalidType += e.InvalidType
+	d.Unsupported += e.Unsupported
+	return s
+}
+
+// rttRefresh is how long Stats reuses a round trip time. Getting one
+// means asking pion for the stats of every transport, and the status
+// display, the quality log and the progress reporter all poll Stats; the
+// ICE pair's own measurement changes more slowly than that.
+const rttRefresh = time.Second
+
+// rttCache holds the last round trip time read, and when.
+type rttCache struct {
+	mu    sync.Mutex
+	at    time.Time
+	value time.Duration
+}
+
+// Stats returns a snapshot of the peer's counters. It is safe to call
+// from any goroutine. RTT may be up to rttRefresh old.
+func (p *Peer) Stats() Stats {
+	now := p.clock.Now()
+	p.statsMu.Lock()
+	s := p.stats
+	s.Bitrate = p.bitrate.bitrate(now)
+	p.statsMu.Unlock()
+	s.RTT = p.cachedRoundTripTime(now)
+	return s
+}
+
+// cachedRoundTripTime returns roundTripTime, read again only if the last
+// reading is rttRefresh older than now.
+func (p *Peer) cachedRoundTripTime(now time.Time) time.Duration {
+	p.rtt.mu.Lock()
+	defer p.rtt.mu.Unlock()
+	if p.rtt.at.IsZero() || now.Sub(p.rtt.at) >= rttRefresh {
+		p.rtt.at, p.rtt.value = now, p.roundTripTime()
+	}
+	return p.rtt.value
+}
+
+// roundTripTime returns the latest STUN round trip time measured on the
+// nominated ICE candidate pair.
+func (p *Peer) roundTripTime() time.Duration {
+	for _, st := range p.pcStats() {
+		cp, ok := st.(pion.ICECandidatePairStats)
+		if ok && cp.Nominated && cp.State == pion.StatsICECandidatePairStateSucceeded {
+			return time.Duration(cp.CurrentRoundTripTime * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+func (p *Peer) updateStats(fn func(s *Stats)) {
+	p.statsMu.Lock()
+	fn(&p.stats)
+	p.statsMu.Unlock()
+}
+
+// PreviewStats returns a snapshot of the preview stream's video counters
+// and info; the connection fields are left empty. It is the zero value
+// unless Options.Preview is set and the camera sends a preview.
+func (p *Peer) PreviewStats() Stats {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+	s := p.previewStats
+	s.Bitrate = p.previewBitrate.bitrate(p.clock.Now())
+	return s
+}
+
+func (p *Peer) updatePreviewStats(fn func(s *Stats)) {
+	p.statsMu.Lock()
+	fn(&p.previewStats)
+	p.statsMu.Unlock()
+}
+
+// seqGap returns how many packets are missing between last and seq,
+// treating RTP sequence numbers as wrapping 16-bit counters. Duplicate and
+// reordered (older) packets count as no loss.
+func seqGap(last, seq uint16) uint64 {
+	diff := seq - last
+	if diff == 0 || diff >= 0x8000 {
+		return 0
+	}
+	return uint64(diff - 1)
+}
+
+// seqNewer reports whether seq comes after last in RTP's wrapping 16-bit
+// sequence space, the serial number comparison of RFC 1982.
+func seqNewer(seq, last uint16) bool {
+	diff := seq - last
+	return diff != 0 && diff < 0x8000
+}
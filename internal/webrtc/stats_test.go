@@ -0,0 +1,159 @@
+package webrtc
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+// TestPeerStats_ConcurrentWithPacketProcessing reads Stats from several
+// goroutines while video packets are processed, the way a status display
+// or stats endpoint does. Run it with -race.
+func TestPeerStats_ConcurrentWithPacketProcessing(t *testing.T) {
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{WaitKeyframe: true, LowLatency: true})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+
+	packets := loadPackets(t, "testdata/golden.rtp")
+	const rounds = 50
+
+	v := p.newVideoReceiver(90000, io.Discard, false, func() {})
+	defer v.Close()
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			prev := p.Stats()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				cur := p.Stats()
+				ClassifyQuality(prev, cur, DefaultQualityThresholds)
+				_ = cur.Video.Resolution()
+				prev = cur
+			}
+		}()
+	}
+
+	for r := 0; r < rounds; r++ {
+		for i, pkt := range packets {
+			seq := pkt.SequenceNumber + uint16(r*len(packets))
+			v.Handle(seq, uint32(r*len(packets)+i)*3000, true, pkt.Payload)
+		}
+	}
+	close(done)
+	readers.Wait()
+
+	s := p.Stats()
+	if want := uint64(rounds * len(packets)); s.VideoPackets != want {
+		t.Errorf("expected %d packets counted, got %d", want, s.VideoPackets)
+	}
+	if s.Depacketizer.Packets != s.VideoPackets {
+		t.Errorf("expected depacketizer to see every packet, got %d of %d", s.Depacketizer.Packets, s.VideoPackets)
+	}
+}
+
+func TestPeerStats_PreviewCountedSeparately(t *testing.T) {
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+
+	packets := loadPackets(t, "testdata/golden.rtp")
+	v := p.newVideoReceiver(90000, io.Discard, true, func() {})
+	defer v.Close()
+	for i, pkt := range packets {
+		v.Handle(pkt.SequenceNumber, uint32(i)*3000, true, pkt.Payload)
+	}
+
+	if got := p.Stats().VideoPackets; got != 0 {
+		t.Errorf("expected no main stream packets, got %d", got)
+	}
+	if got, want := p.PreviewStats().VideoPackets, uint64(len(packets)); got != want {
+		t.Errorf("expected %d preview packets, got %d", want, got)
+	}
+}
+
+func TestPeerStats_ReorderedPacketsCountLossOnce(t *testing.T) {
+	tests := []struct {
+		name string
+		seqs []uint16
+		lost uint64
+	}{
+		{"in order", []uint16{1, 2, 3, 4, 5}, 0},
+		{"one missing", []uint16{1, 2, 4, 5}, 1},
+		{"one late", []uint16{1, 2, 4, 3, 5}, 1},
+		{"duplicate", []uint16{1, 2, 2, 3}, 0},
+		{"late across the wrap", []uint16{65534, 0, 65535, 1}, 1},
+	}
+	for _, tt := range tests {
+		p := newTestPeer(t, Options{})
+		v := p.newVideoReceiver(90000, io.Discard, false, func() {})
+		for i, seq := range tt.seqs {
+			v.Handle(seq, uint32(i)*3000, true, []byte{0x41, 0x9a})
+		}
+		v.Close()
+		if got := p.Stats().PacketsLost; got != tt.lost {
+			t.Errorf("%s: expected %d packets lost, got %d", tt.name, tt.lost, got)
+		}
+	}
+}
+
+func TestPeerStats_CachesRoundTripTime(t *testing.T) {
+	p := newTestPeer(t, Options{})
+	clk := clock.NewFake(time.Now())
+	p.SetClock(clk)
+	calls := 0
+	rtt := 0.05
+	p.pcStats = func() pion.StatsReport {
+		calls++
+		return pion.StatsReport{"pair": pion.ICECandidatePairStats{
+			Nominated:            true,
+			State:                pion.StatsICECandidatePairStateSucceeded,
+			CurrentRoundTripTime: rtt,
+		}}
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := p.Stats().RTT; got != 50*time.Millisecond {
+			t.Fatalf("expected an RTT of 50ms, got %s", got)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected one stats read for polls within %s, got %d", rttRefresh, calls)
+	}
+
+	rtt = 0.08
+	clk.Advance(rttRefresh)
+	if got := p.Stats().RTT; got != 80*time.Millisecond || calls != 2 {
+		t.Errorf("expected the RTT read again after %s, got %s in %d reads", rttRefresh, got, calls)
+	}
+}
+
+func TestPeerStats_Plus(t *testing.T) {
+	earlier := Stats{ConnectionState: "closed", VideoPackets: 10, VideoBytes: 1000, PacketsLost: 2, AccessUnits: 3,
+		Depacketizer: DepacketizerStats{Packets: 10, NALUs: 4, FUADropped: 1}}
+	last := Stats{ConnectionState: "connected", VideoPackets: 5, VideoBytes: 500, AccessUnits: 1, OversizeNALUs: 1,
+		Depacketizer: DepacketizerStats{Packets: 5, NALUs: 2}}
+
+	got := last.Plus(earlier)
+	want := Stats{ConnectionState: "connected", VideoPackets: 15, VideoBytes: 1500, PacketsLost: 2, AccessUnits: 4, OversizeNALUs: 1,
+		Depacketizer: DepacketizerStats{Packets: 15, NALUs: 6, FUADropped: 1}}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
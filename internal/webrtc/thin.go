@@ -0,0 +1,95 @@
+package webrtc
+
+import "math"
+
+// frameThinner drops a fraction of the frames between keyframes to reduce
+// the output bitrate. Frames are recognised by RTP timestamp, so access
+// units split per packet in low-latency mode are kept or dropped whole.
+//
+// Non-reference frames (nal_ref_idc 0) can be dropped anywhere without
+// affecting later pictures. Reference frames cannot: every later P-frame
+// up to the next IDR depends on them. So once the GOP length is known,
+// reference frames are dropped from the end of each GOP, which keeps the
+// output decodable but makes the picture pause until the next keyframe.
+// The lower the camera's keyframe rate, the longer those pauses.
+type frameThinner struct {
+	drop float64 // fraction of non-IDR frames to drop, 0 to 1
+
+	gopLen  int // frames in the last complete GOP, 0 until one is seen
+	pos     int // frames since the last IDR, counting the IDR
+	credit  float64
+	started bool
+	lastTS  uint32
+	keep    bool // decision for the frame at lastTS
+}
+
+func newFrameThinner(drop float64) *frameThinner {
+	return &frameThinner{drop: math.Min(math.Max(drop, 0), 1)}
+}
+
+// Keep reports whether the NAL units of au should be written. Units
+// without slices, such as parameter sets and SEI, are always kept.
+func (t *frameThinner) Keep(au AccessUnit) bool {
+	idr, ref, slice := classifyFrame(au.NALUs)
+	if !slice {
+		return true
+	}
+	if t.started && au.Timestamp == t.lastTS {
+		return t.keep
+	}
+	t.started = true
+	t.lastTS = au.Timestamp
+	t.keep = t.decide(idr, ref)
+	return t.keep
+}
+
+func (t *frameThinner) decide(idr, ref bool) bool {
+	if idr {
+		if t.pos > 0 {
+			t.gopLen = t.pos
+		}
+		t.pos = 1
+		return true
+	}
+	if t.pos == 0 {
+		// No IDR yet; the decoder cannot use these anyway.
+		return true
+	}
+	t.pos++
+
+	if t.gopLen > 0 {
+		// Keep the first part of the GOP and drop its tail.
+		keep := 1 + int(math.Round(float64(t.gopLen-1)*(1-t.drop)))
+		return t.pos <= keep
+	}
+	if ref {
+		return true
+	}
+	// First GOP: only non-reference frames are safe to drop, spread evenly.
+	t.credit += t.drop
+	if t.credit >= 1 {
+		t.credit--
+		return false
+	}
+	return true
+}
+
+// classifyFrame reports whether nalus contain an IDR slice, a reference
+// slice (nal_ref_idc other than 0) and any slice at all.
+func classifyFrame(nalus [][]byte) (idr, ref, slice bool) {
+	for _, nalu := range nalus {
+		if len(nalu) == 0 {
+			continue
+		}
+		switch typ := nalu[0] & 0x1f; {
+		case typ == naluTypeIDR:
+			idr, ref, slice = true, true, true
+		case typ >= 1 && typ <= 4:
+			slice = true
+			if nalu[0]&0x60 != 0 {
+				ref = true
+			}
+		}
+	}
+	return idr, ref, slice
+}
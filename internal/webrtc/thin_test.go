@@ -0,0 +1,77 @@
+package webrtc
+
+import "testing"
+
+var (
+	thinIDR    = []byte{0x65, 0x88}
+	thinP      = []byte{0x41, 0x9a} // nal_ref_idc 2
+	thinNonRef = []byte{0x01, 0x9e} // nal_ref_idc 0
+	thinSPS    = []byte{0x67, 0x64}
+)
+
+func TestFrameThinner_DropsTailOfGOP(t *testing.T) {
+	th := newFrameThinner(0.5)
+
+	// Two GOPs of an IDR and 9 P-frames; the first measures the length.
+	var got []bool
+	ts := uint32(0)
+	for gop := 0; gop < 2; gop++ {
+		for i := 0; i < 10; i++ {
+			nalu := thinP
+			if i == 0 {
+				nalu = thinIDR
+			}
+			ts += 3000
+			got = append(got, th.Keep(AccessUnit{Timestamp: ts, NALUs: [][]byte{nalu}}))
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		if !got[i] {
+			t.Errorf("frame %d of first GOP: expected reference frame kept", i)
+		}
+	}
+	// 9 P-frames at 50% keeps round(4.5) = 5 after the IDR.
+	for i, keep := range got[10:] {
+		if want := i <= 5; keep != want {
+			t.Errorf("frame %d of second GOP: expected keep=%v, got %v", i, want, keep)
+		}
+	}
+}
+
+func TestFrameThinner_DropsNonReferenceBeforeGOPKnown(t *testing.T) {
+	th := newFrameThinner(0.5)
+
+	if !th.Keep(AccessUnit{Timestamp: 0, NALUs: [][]byte{thinSPS, thinIDR}}) {
+		t.Fatal("expected IDR kept")
+	}
+	var kept int
+	for i := 1; i <= 8; i++ {
+		if th.Keep(AccessUnit{Timestamp: uint32(i * 3000), NALUs: [][]byte{thinNonRef}}) {
+			kept++
+		}
+	}
+	if kept != 4 {
+		t.Errorf("expected 4 of 8 non-reference frames kept, got %d", kept)
+	}
+}
+
+func TestFrameThinner_SameTimestampSharesDecision(t *testing.T) {
+	th := newFrameThinner(1)
+
+	th.Keep(AccessUnit{Timestamp: 0, NALUs: [][]byte{thinIDR}})
+	th.Keep(AccessUnit{Timestamp: 3000, NALUs: [][]byte{thinP}})
+	th.Keep(AccessUnit{Timestamp: 6000, NALUs: [][]byte{thinIDR}})
+
+	// GOP length 2 with everything dropped: only IDRs survive, and every
+	// slice of a dropped frame goes with it.
+	if th.Keep(AccessUnit{Timestamp: 9000, NALUs: [][]byte{thinP}}) {
+		t.Fatal("expected P-frame dropped")
+	}
+	if th.Keep(AccessUnit{Timestamp: 9000, NALUs: [][]byte{thinP}}) {
+		t.Error("expected second slice of dropped frame dropped")
+	}
+	if !th.Keep(AccessUnit{Timestamp: 9000, NALUs: [][]byte{thinSPS}}) {
+		t.Error("expected parameter set kept")
+	}
+}
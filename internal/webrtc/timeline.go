@@ -0,0 +1,67 @@
+package webrtc
+
+import "time"
+
+// timelineRate is the clock rate of the normalized timeline, which is
+// H264's RTP clock rate and the MPEG-TS/MP4 convention.
+const timelineRate = 90000
+
+// maxTimestampJump is the largest step between consecutive RTP timestamps
+// taken as elapsed time. A larger step, in either direction, is a
+// discontinuity, such as the camera restarting its encoder with a new
+// random offset, and the timeline continues from where it was instead.
+const maxTimestampJump = 10 * timelineRate
+
+// rtpTimeline maps 32-bit RTP timestamps, which start at a random offset
+// and wrap about every 13 hours at 90 kHz, onto a zero-based,
+// non-decreasing 64-bit timeline at 90 kHz. The first timestamp maps to 0.
+type rtpTimeline struct {
+	clockRate uint32
+	started   bool
+	last      uint32 // last RTP timestamp seen
+	pos       int64  // position of last, in clockRate units from the first
+	step      int64  // last forward step, to continue across a discontinuity
+	high      uint64 // highest timeline value returned
+}
+
+func newRTPTimeline(clockRate uint32) *rtpTimeline {
+	if clockRate == 0 {
+		clockRate = timelineRate
+	}
+	return &rtpTimeline{clockRate: clockRate}
+}
+
+// Normalize returns the timeline value for the RTP timestamp ts. A
+// timestamp earlier than one already seen, from reordering or a camera
+// clock going backwards, returns the highest value so far.
+func (t *rtpTimeline) Normalize(ts uint32) uint64 {
+	if !t.started {
+		t.started, t.last = true, ts
+		return 0
+	}
+	// The signed difference is the shortest way around the 32-bit circle,
+	// which unwraps both forward wraps and late packets from before one.
+	delta := int64(int32(ts - t.last))
+	t.last = ts
+	if jump := delta * timelineRate / int64(t.clockRate); jump > maxTimestampJump || jump < -maxTimestampJump {
+		delta = t.step
+	}
+	t.pos += delta
+	if delta > 0 {
+		t.step = delta
+	}
+	if t.pos <= 0 {
+		return t.high
+	}
+	pts := uint64(t.pos) * timelineRate / uint64(t.clockRate)
+	if pts < t.high {
+		return t.high
+	}
+	t.high = pts
+	return pts
+}
+
+// timelineDuration converts a timeline value to a duration.
+func timelineDuration(pts uint64) time.Duration {
+	return time.Duration(pts) * time.Second / timelineRate
+}
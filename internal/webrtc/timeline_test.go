@@ -0,0 +1,52 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRTPTimeline_Normalize(t *testing.T) {
+	const frame = 3000 // 30 fps at 90 kHz
+	tests := []struct {
+		name      string
+		clockRate uint32
+		in        []uint32
+		want      []uint64
+	}{
+		{"zero-based", 90000, []uint32{123456, 123456 + frame, 123456 + 2*frame}, []uint64{0, frame, 2 * frame}},
+		{"repeated timestamp", 90000, []uint32{500, 500, 500 + frame}, []uint64{0, 0, frame}},
+		{"wraps", 90000, []uint32{1<<32 - frame, 0, frame}, []uint64{0, frame, 2 * frame}},
+		{"wraps between packets", 90000, []uint32{1<<32 - 1000, 2000}, []uint64{0, 3000}},
+		{"late packet across wrap", 90000, []uint32{1<<32 - frame, frame, 0, 2 * frame}, []uint64{0, 2 * frame, 2 * frame, 3 * frame}},
+		{"backwards stays monotonic", 90000, []uint32{10 * frame, 12 * frame, 11 * frame, 13 * frame}, []uint64{0, 2 * frame, 2 * frame, 3 * frame}},
+		{"starts after a late packet", 90000, []uint32{10 * frame, 9 * frame, 11 * frame}, []uint64{0, 0, frame}},
+		{"discontinuity continues", 90000, []uint32{1000, 1000 + frame, 0x80000000, 0x80000000 + frame}, []uint64{0, frame, 2 * frame, 3 * frame}},
+		{"rescales", 45000, []uint32{7, 7 + 1500, 7 + 3000}, []uint64{0, frame, 2 * frame}},
+	}
+	for _, tt := range tests {
+		tl := newRTPTimeline(tt.clockRate)
+		for i, ts := range tt.in {
+			if got := tl.Normalize(ts); got != tt.want[i] {
+				t.Errorf("%s: timestamp %d (#%d): expected %d, got %d", tt.name, ts, i, tt.want[i], got)
+			}
+		}
+	}
+}
+
+func TestRTPTimeline_LongRecording(t *testing.T) {
+	// Fourteen hours at 30 fps wraps a 90 kHz RTP clock once.
+	const frame = 3000
+	tl := newRTPTimeline(90000)
+	ts := uint32(1<<32 - 3600*90000)
+	var pts uint64
+	for i := 0; i < 14*3600*30; i++ {
+		pts = tl.Normalize(ts)
+		ts += frame
+	}
+	if want := uint64(14*3600*30-1) * frame; pts != want {
+		t.Errorf("expected %d after fourteen hours, got %d", want, pts)
+	}
+	if got := timelineDuration(pts + frame); got != 14*time.Hour {
+		t.Errorf("expected 14h, got %s", got)
+	}
+}
@@ -0,0 +1,434 @@
+package webrtc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/domain"
+	"vico_home/native/internal/logging"
+
+	pionlog "github.com/pion/logging"
+	"github.com/pion/transport/v3/vnet"
+	pion "github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// newVNetPair starts a virtual network with two hosts on it, one for the
+// peer and one for a fake camera, so a test can run a whole session
+// without touching the host's network.
+func newVNetPair(t testing.TB) (viewer, camera *vnet.Net) {
+	t.Helper()
+	wan, err := vnet.NewRouter(&vnet.RouterConfig{CIDR: "10.0.0.0/24", LoggerFactory: pionlog.NewDefaultLoggerFactory()})
+	if err != nil {
+		t.Fatalf("create router: %v", err)
+	}
+	viewer, err = vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{"10.0.0.2"}})
+	if err != nil {
+		t.Fatalf("create viewer network: %v", err)
+	}
+	camera, err = vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{"10.0.0.3"}})
+	if err != nil {
+		t.Fatalf("create camera network: %v", err)
+	}
+	for _, n := range []*vnet.Net{viewer, camera} {
+		if err := wan.AddNet(n); err != nil {
+			t.Fatalf("add network: %v", err)
+		}
+	}
+	if err := wan.Start(); err != nil {
+		t.Fatalf("start router: %v", err)
+	}
+	t.Cleanup(func() { _ = wan.Stop() })
+	return viewer, camera
+}
+
+// fakeCamera answers a Peer's offer the way a camera does: it sends H264
+// video on a track and waits for startLive on the peer's DataChannel.
+// stopLive receives each stopLive command sent after it.
+type fakeCamera struct {
+	pc        *pion.PeerConnection
+	video     *pion.TrackLocalStaticSample
+	startLive chan struct{}
+	stopLive  chan stopLiveCommand
+
+	mu        sync.Mutex
+	remoteSet bool
+	pending   []pion.ICECandidateInit
+}
+
+func newFakeCamera(t testing.TB, n *vnet.Net) *fakeCamera {
+	t.Helper()
+	m := &pion.MediaEngine{}
+	h264 := pion.RTPCodecCapability{
+		MimeType:    pion.MimeTypeH264,
+		ClockRate:   90000,
+		SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=0;profile-level-id=64001f",
+	}
+	if err := m.RegisterCodec(pion.RTPCodecParameters{RTPCodecCapability: h264, PayloadType: 96}, pion.RTPCodecTypeVideo); err != nil {
+		t.Fatalf("register H264: %v", err)
+	}
+	se := pion.SettingEngine{}
+	se.SetNet(n)
+	pc, err := pion.NewAPI(pion.WithMediaEngine(m), pion.WithSettingEngine(se)).NewPeerConnection(pion.Configuration{})
+	if err != nil {
+		t.Fatalf("create camera peer connection: %v", err)
+	}
+	t.Cleanup(func() { _ = pc.Close() })
+
+	video, err := pion.NewTrackLocalStaticSample(h264, "video", "camera")
+	if err != nil {
+		t.Fatalf("create video track: %v", err)
+	}
+	if _, err := pc.AddTrack(video); err != nil {
+		t.Fatalf("add video track: %v", err)
+	}
+
+	c := &fakeCamera{pc: pc, video: video, startLive: make(chan struct{}), stopLive: make(chan stopLiveCommand, 1)}
+	var once sync.Once
+	pc.OnDataChannel(func(dc *pion.DataChannel) {
+		dc.OnMessage(func(msg pion.DataChannelMessage) {
+			switch {
+			case strings.Contains(string(msg.Data), `"startLive"`):
+				once.Do(func() { close(c.startLive) })
+			case strings.Contains(string(msg.Data), `"stopLive"`):
+				var cmd stopLiveCommand
+				if err := json.Unmarshal(msg.Data, &cmd); err != nil {
+					t.Errorf("camera: unmarshal stopLive: %v", err)
+				}
+				c.stopLive <- cmd
+			}
+		})
+	})
+	return c
+}
+
+// connect runs the offer/answer exchange between p and the camera and
+// trickles each side's candidates to the other, as the signaling server
+// would.
+func (c *fakeCamera) connect(t testing.TB, p *Peer) {
+	t.Helper()
+	p.SetOnICECandidate(func(sdpMid string, sdpMLineIndex int, candidate string) {
+		idx := uint16(sdpMLineIndex)
+		c.addCandidate(pion.ICECandidateInit{Candidate: candidate, SDPMid: &sdpMid, SDPMLineIndex: &idx})
+	})
+	c.pc.OnICECandidate(func(cand *pion.ICECandidate) {
+		if cand == nil {
+			return
+		}
+		init := cand.ToJSON()
+		payload := domain.ICECandidatePayload{Candidate: init.Candidate}
+		if init.SDPMid != nil {
+			payload.SDPMid = *init.SDPMid
+		}
+		if init.SDPMLineIndex != nil {
+			payload.SDPMLineIndex = int(*init.SDPMLineIndex)
+		}
+		go func() {
+			if err := p.AddRemoteICECandidate(payload); err != nil && !p.closing() {
+				t.Errorf("add camera candidate: %v", err)
+			}
+		}()
+	})
+
+	if err := p.AddTransceivers(); err != nil {
+		t.Fatalf("add transceivers: %v", err)
+	}
+	offer, err := p.CreateOffer()
+	if err != nil {
+		t.Fatalf("create offer: %v", err)
+	}
+	if err := c.pc.SetRemoteDescription(pion.SessionDescription{Type: pion.SDPTypeOffer, SDP: offer}); err != nil {
+		t.Fatalf("camera: set offer: %v", err)
+	}
+	answer, err := c.pc.CreateAnswer(nil)
+	if err != nil {
+		t.Fatalf("camera: create answer: %v", err)
+	}
+	if err := c.pc.SetLocalDescription(answer); err != nil {
+		t.Fatalf("camera: set answer: %v", err)
+	}
+	c.mu.Lock()
+	c.remoteSet = true
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	for _, cand := range pending {
+		c.addCandidate(cand)
+	}
+
+	if err := p.SetRemoteDescription(domain.SDPPayload{Type: "answer", SDP: answer.SDP}); err != nil {
+		t.Fatalf("set answer: %v", err)
+	}
+}
+
+// addCandidate adds one of the peer's candidates, holding it until the
+// camera has the offer, like the peer's AddRemoteICECandidate.
+func (c *fakeCamera) addCandidate(cand pion.ICECandidateInit) {
+	c.mu.Lock()
+	if !c.remoteSet {
+		c.pending = append(c.pending, cand)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	_ = c.pc.AddICECandidate(cand)
+}
+
+// syncBuffer is a bytes.Buffer safe to read while the peer writes it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+// TestPeer_ReceivesVideoOverVirtualNetwork runs a session end to end:
+// negotiation, trickled candidates, ICE and DTLS over the virtual network,
+// startLive on the DataChannel, then an H264 keyframe sent by the camera
+// and written to the output through the depacketizer.
+func TestPeer_ReceivesVideoOverVirtualNetwork(t *testing.T) {
+	viewerNet, cameraNet := newVNetPair(t)
+	cam := newFakeCamera(t, cameraNet)
+
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{NoAudio: true, network: viewerNet})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	var out syncBuffer
+	p.SetOnTrack(&out)
+	cam.connect(t, p)
+
+	select {
+	case <-cam.startLive:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected startLive on the DataChannel; connectivity: %+v", p.ConnectivityReport())
+	}
+
+	sps := []byte{0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10}
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	idr := append([]byte{0x65, 0x88, 0x84}, bytes.Repeat([]byte{0x5a}, 3000)...)
+	var frame []byte
+	for _, nalu := range [][]byte{sps, pps, idr} {
+		frame = append(append(frame, 0, 0, 0, 1), nalu...)
+	}
+
+	ticker := time.NewTicker(40 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(10 * time.Second)
+	for !bytes.Contains(out.Bytes(), append([]byte{0, 0, 0, 1}, idr...)) {
+		select {
+		case <-ticker.C:
+			if err := cam.video.WriteSample(media.Sample{Data: frame, Duration: 40 * time.Millisecond}); err != nil {
+				t.Fatalf("camera: write sample: %v", err)
+			}
+		case <-deadline:
+			t.Fatalf("expected the keyframe in the output, got %d bytes; stats: %+v", len(out.Bytes()), p.Stats())
+		}
+	}
+
+	got := out.Bytes()
+	for name, nalu := range map[string][]byte{"SPS": sps, "PPS": pps} {
+		if !bytes.Contains(got, append([]byte{0, 0, 0, 1}, nalu...)) {
+			t.Errorf("expected the %s in the output", name)
+		}
+	}
+	if s := p.Stats(); s.VideoPackets == 0 || s.ConnectionState != "connected" {
+		t.Errorf("expected video packets on a connected peer, got %d packets, state %q", s.VideoPackets, s.ConnectionState)
+	}
+}
+
+// BenchmarkPeer_Connect measures how long a peer takes from creation to
+// startLive on the DataChannel under each candidate policy. The virtual
+// network has no STUN or TURN server, so only host pairs can connect.
+func BenchmarkPeer_Connect(b *testing.B) {
+	for _, bm := range []struct {
+		name       string
+		candidates domain.CandidateTypes
+	}{
+		{"all", 0},
+		{"host", domain.CandidateHost},
+		{"host,srflx", domain.CandidateHost | domain.CandidateSrflx},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			viewerNet, cameraNet := newVNetPair(b)
+			for i := 0; i < b.N; i++ {
+				cam := newFakeCamera(b, cameraNet)
+				p, err := NewPeer(nil, testSerial, Options{NoAudio: true, ICECandidates: bm.candidates, network: viewerNet})
+				if err != nil {
+					b.Fatalf("create peer: %v", err)
+				}
+				cam.connect(b, p)
+				select {
+				case <-cam.startLive:
+				case <-time.After(10 * time.Second):
+					b.Fatalf("expected startLive on the DataChannel; connectivity: %+v", p.ConnectivityReport())
+				}
+				p.Close()
+				_ = cam.pc.Close()
+			}
+		})
+	}
+}
+
+// TestPeer_CameraRejectsFirstProfile offers a profile the camera cannot
+// send, as the first of -h264-profiles might be, then one it can, each to
+// a new camera peer connection as the fallback does. pion answers any
+// H264 offer, so the camera stops its video transceiver, answering the
+// section inactive, when the offer lacks its own format, as strict
+// firmware does.
+// The first answer should fail SetRemoteDescription with
+// ErrAnswerRejected, the failure the fallback retries on, and the second
+// be accepted.
+func TestPeer_CameraRejectsFirstProfile(t *testing.T) {
+	tests := []struct {
+		profile domain.H264Profile
+		wantErr bool
+	}{
+		{domain.H264Profile{ProfileLevelID: "42e01f", PacketizationMode: 1}, true},
+		{domain.H264Profile{ProfileLevelID: "64001f", PacketizationMode: 0}, false},
+	}
+	viewerNet, cameraNet := newVNetPair(t)
+	for _, tt := range tests {
+		cam := newFakeCamera(t, cameraNet)
+		p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef",
+			Options{NoAudio: true, ValidateAnswer: true, H264Profile: tt.profile, network: viewerNet})
+		if err != nil {
+			t.Fatalf("create peer: %v", err)
+		}
+		defer p.Close()
+		if err := p.AddTransceivers(); err != nil {
+			t.Fatalf("add transceivers: %v", err)
+		}
+		offer, err := p.CreateOffer()
+		if err != nil {
+			t.Fatalf("create offer: %v", err)
+		}
+		if err := cam.pc.SetRemoteDescription(pion.SessionDescription{Type: pion.SDPTypeOffer, SDP: offer}); err != nil {
+			t.Fatalf("%s: camera: set offer: %v", tt.profile, err)
+		}
+		if !strings.Contains(offer, "packetization-mode=0;profile-level-id=64001f") {
+			for _, tr := range cam.pc.GetTransceivers() {
+				if tr.Kind() == pion.RTPCodecTypeVideo {
+					if err := tr.Stop(); err != nil {
+						t.Fatalf("camera: stop video: %v", err)
+					}
+				}
+			}
+		}
+		answer, err := cam.pc.CreateAnswer(nil)
+		if err != nil {
+			t.Fatalf("%s: camera: create answer: %v", tt.profile, err)
+		}
+
+		err = p.SetRemoteDescription(domain.SDPPayload{Type: "answer", SDP: answer.SDP})
+		if tt.wantErr && !errors.Is(err, ErrAnswerRejected) {
+			t.Errorf("%s: expected ErrAnswerRejected, got %v", tt.profile, err)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: expected the camera to accept the profile, got %v", tt.profile, err)
+		}
+	}
+}
+
+// TestPeer_ShutdownSendsStopLive checks that Shutdown asks the camera to
+// stop streaming over the DataChannel before the output is stopped.
+func TestPeer_ShutdownSendsStopLive(t *testing.T) {
+	viewerNet, cameraNet := newVNetPair(t)
+	cam := newFakeCamera(t, cameraNet)
+
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{NoAudio: true, network: viewerNet})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	p.SetOnTrack(io.Discard)
+	cam.connect(t, p)
+
+	select {
+	case <-cam.startLive:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected startLive on the DataChannel; connectivity: %+v", p.ConnectivityReport())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	select {
+	case cmd := <-cam.stopLive:
+		if cmd.Action != "stopLive" || cmd.RequestID == "" || cmd.TimeStamp != cmd.RequestID {
+			t.Errorf("expected a stopLive with a request ID, got %+v", cmd)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected stopLive on the DataChannel")
+	}
+}
+
+// TestPeer_CloseMidStreamLogsNoErrors closes a peer while the camera is
+// still sending video. The track read loop and the DataChannel should end
+// quietly rather than logging their errors.
+func TestPeer_CloseMidStreamLogsNoErrors(t *testing.T) {
+	viewerNet, cameraNet := newVNetPair(t)
+	cam := newFakeCamera(t, cameraNet)
+
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{NoAudio: true, network: viewerNet})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	var out syncBuffer
+	p.SetOnTrack(&out)
+	cam.connect(t, p)
+	select {
+	case <-cam.startLive:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected startLive on the DataChannel; connectivity: %+v", p.ConnectivityReport())
+	}
+
+	buf := captureLog(t)
+	logging.SetDebug([]string{logging.RTP})
+	defer logging.SetDebug(nil)
+	frame := []byte{0, 0, 0, 1, 0x65, 0x88, 0x84, 0x5a}
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(10 * time.Second)
+	closed := false
+	for !bytes.Contains(buf.Bytes(), []byte("video track ended by Close")) {
+		select {
+		case <-ticker.C:
+			if !closed && len(out.Bytes()) > 0 {
+				p.Close()
+				closed = true
+			}
+			cam.video.WriteSample(media.Sample{Data: frame, Duration: 20 * time.Millisecond})
+		case <-deadline:
+			t.Fatalf("expected the track read loop to end after Close (closed=%v); log:\n%s", closed, buf.Bytes())
+		}
+	}
+	p.sendStopLive()
+	p.requestKeyframe(nil, &p.lastKeyframeRequest)
+
+	for _, line := range strings.Split(string(buf.Bytes()), "\n") {
+		if strings.Contains(line, "error") {
+			t.Errorf("expected no errors logged after Close, got %q", line)
+		}
+	}
+}
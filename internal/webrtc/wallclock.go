@@ -0,0 +1,213 @@
+package webrtc
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	pion "github.com/pion/webrtc/v4"
+)
+
+// Timestamp sources, as recorded in a timestamp SEI.
+const (
+	// TimestampRTCP means the time was derived from the camera's RTCP
+	// sender reports, which tie its RTP clock to its wall clock.
+	TimestampRTCP = "rtcp"
+	// TimestampArrival means no sender report had arrived yet and the
+	// time is when the picture arrived here.
+	TimestampArrival = "arrival"
+)
+
+// TimestampSEIUUID identifies the user data unregistered SEI messages
+// carrying wall-clock timestamps, so tools reading the recording can find
+// them among other SEI.
+var TimestampSEIUUID = [16]byte{
+	0x5d, 0x1d, 0x8f, 0x3c, 0x6a, 0x1e, 0x4b, 0x8e,
+	0x9f, 0x3a, 0x2c, 0x7e, 0x0b, 0x9d, 0x4a, 0x61,
+}
+
+// seiTimeLayout is the payload after the UUID: the capture time in UTC to
+// the microsecond, a space and the source, e.g.
+// "2024-05-01T12:00:00.000000Z rtcp".
+const seiTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// seiPayloadTypeUserData is H264's user_data_unregistered SEI payload type.
+const seiPayloadTypeUserData = 5
+
+// ntpEpochOffset is the seconds from the NTP epoch, 1900, to the Unix one.
+const ntpEpochOffset = 2208988800
+
+// ntpTime converts a 64-bit NTP timestamp, seconds and a binary fraction,
+// to a time.
+func ntpTime(ntp uint64) time.Time {
+	secs := int64(ntp>>32) - ntpEpochOffset
+	nanos := (ntp & 0xffffffff) * 1e9 >> 32
+	return time.Unix(secs, int64(nanos)).UTC()
+}
+
+// wallClock maps RTP timestamps to the camera's wall clock from its latest
+// RTCP sender report. Sender reports arrive on the RTCP reader while
+// pictures are timed on the track reader, so it is safe for concurrent
+// use.
+type wallClock struct {
+	clockRate uint32
+
+	mu     sync.Mutex
+	synced bool
+	wall   time.Time // the sender report's NTP time
+	rtp    uint32    // the RTP timestamp it corresponds to
+}
+
+func newWallClock(clockRate uint32) *wallClock {
+	if clockRate == 0 {
+		clockRate = timelineRate
+	}
+	return &wallClock{clockRate: clockRate}
+}
+
+// SenderReport records a sender report's NTP and RTP timestamps. It
+// reports whether it is the first.
+func (w *wallClock) SenderReport(ntp uint64, rtp uint32) (first bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	first = !w.synced
+	w.synced, w.wall, w.rtp = true, ntpTime(ntp), rtp
+	return first
+}
+
+// Time returns the wall-clock capture time of the picture with RTP
+// timestamp ts and its source: the sender report mapping if there is one,
+// or arrival otherwise.
+func (w *wallClock) Time(ts uint32, arrival time.Time) (time.Time, string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.synced {
+		return arrival.UTC(), TimestampArrival
+	}
+	// The signed difference allows pictures from just before the report
+	// and unwraps the 32-bit RTP clock.
+	delta := int64(int32(ts - w.rtp))
+	return w.wall.Add(time.Duration(delta * int64(time.Second) / int64(w.clockRate))), TimestampRTCP
+}
+
+// timestampSEI returns an SEI NAL unit with one user data unregistered
+// message carrying t and its source.
+func timestampSEI(t time.Time, source string) []byte {
+	payload := append(TimestampSEIUUID[:16:16], t.UTC().Format(seiTimeLayout)+" "+source...)
+
+	rbsp := []byte{seiPayloadTypeUserData}
+	size := len(payload)
+	for ; size >= 0xff; size -= 0xff {
+		rbsp = append(rbsp, 0xff)
+	}
+	rbsp = append(rbsp, byte(size))
+	rbsp = append(rbsp, payload...)
+	rbsp = append(rbsp, 0x80) // rbsp_trailing_bits
+
+	return append([]byte{naluTypeSEI}, escapeRBSP(rbsp)...)
+}
+
+// escapeRBSP inserts emulation prevention bytes, the reverse of
+// unescapeRBSP, so no start code appears inside a NAL unit.
+func escapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b)+len(b)/64)
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c <= 0x03 {
+			out = append(out, 0x03)
+			zeros = 0
+		}
+		out = append(out, c)
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+// ParseTimestampSEI returns the capture time and source from a timestamp
+// SEI NAL unit written with Options.Timestamps. ok is false for any other
+// NAL unit, including SEI without a timestamp message.
+func ParseTimestampSEI(nalu []byte) (t time.Time, source string, ok bool) {
+	if len(nalu) < 2 || nalu[0]&0x1f != naluTypeSEI {
+		return time.Time{}, "", false
+	}
+	rbsp := unescapeRBSP(nalu[1:])
+	for len(rbsp) > 1 && rbsp[0] != 0x80 {
+		var typ, size int
+		for len(rbsp) > 0 && rbsp[0] == 0xff {
+			typ, rbsp = typ+0xff, rbsp[1:]
+		}
+		if len(rbsp) == 0 {
+			break
+		}
+		typ, rbsp = typ+int(rbsp[0]), rbsp[1:]
+		for len(rbsp) > 0 && rbsp[0] == 0xff {
+			size, rbsp = size+0xff, rbsp[1:]
+		}
+		if len(rbsp) == 0 {
+			break
+		}
+		size, rbsp = size+int(rbsp[0]), rbsp[1:]
+		if size > len(rbsp) {
+			break
+		}
+		msg := rbsp[:size]
+		rbsp = rbsp[size:]
+		if typ != seiPayloadTypeUserData || len(msg) < 16 || !bytes.Equal(msg[:16], TimestampSEIUUID[:]) {
+			continue
+		}
+		stamp, src, found := strings.Cut(string(msg[16:]), " ")
+		if !found {
+			return time.Time{}, "", false
+		}
+		t, err := time.Parse(seiTimeLayout, stamp)
+		if err != nil {
+			return time.Time{}, "", false
+		}
+		return t, src, true
+	}
+	return time.Time{}, "", false
+}
+
+// withTimestampSEI returns nalus, the start of an access unit, with sei
+// after any end-of-sequence NAL unit and access unit delimiter, which must
+// come first.
+func withTimestampSEI(nalus [][]byte, sei []byte) [][]byte {
+	i := 0
+	if i < len(nalus) && nalus[i][0]&0x1f == naluTypeEndOfSequence {
+		i++
+	}
+	if i < len(nalus) && nalus[i][0]&0x1f == naluTypeAUD {
+		i++
+	}
+	out := make([][]byte, 0, len(nalus)+1)
+	out = append(out, nalus[:i]...)
+	out = append(out, sei)
+	return append(out, nalus[i:]...)
+}
+
+// readSenderReports feeds the sender reports for track's SSRC from
+// receiver's RTCP to w until the receiver closes.
+func readSenderReports(receiver *pion.RTPReceiver, track *pion.TrackRemote, w *wallClock, name string) {
+	for {
+		pkts, _, err := receiver.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, pkt := range pkts {
+			sr, ok := pkt.(*rtcp.SenderReport)
+			if !ok || sr.SSRC != uint32(track.SSRC()) {
+				continue
+			}
+			if w.SenderReport(sr.NTPTime, sr.RTPTime) {
+				log.Printf("[webrtc] %s: timestamping pictures from the camera's RTCP sender reports", name)
+			}
+		}
+	}
+}
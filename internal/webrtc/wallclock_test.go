@@ -0,0 +1,135 @@
+package webrtc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+)
+
+func TestNTPTime(t *testing.T) {
+	// 2024-05-01T12:00:00.5Z: the Unix seconds plus the NTP epoch offset,
+	// and half of the 32-bit fraction.
+	unix := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).Unix()
+	ntp := uint64(unix+ntpEpochOffset)<<32 | 1<<31
+	want := time.Date(2024, 5, 1, 12, 0, 0, 500_000_000, time.UTC)
+	if got := ntpTime(ntp); !got.Equal(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestWallClock_Time(t *testing.T) {
+	arrival := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	w := newWallClock(90000)
+	if got, src := w.Time(1000, arrival); !got.Equal(arrival) || src != TimestampArrival {
+		t.Errorf("before a sender report: expected %s from arrival, got %s from %s", arrival, got, src)
+	}
+
+	report := time.Date(2024, 5, 1, 11, 59, 58, 0, time.UTC)
+	ntp := uint64(report.Unix()+ntpEpochOffset) << 32
+	var rtp uint32 = 0xffff_0000 // the pictures after it wrap
+	if !w.SenderReport(ntp, rtp) {
+		t.Error("expected the first sender report to say so")
+	}
+	if w.SenderReport(ntp, rtp) {
+		t.Error("expected a later sender report not to be the first")
+	}
+	tests := []struct {
+		ts   uint32
+		want time.Time
+	}{
+		{rtp, report},
+		{rtp + 90000, report.Add(time.Second)},
+		{rtp + 135000, report.Add(1500 * time.Millisecond)},
+		{rtp - 9000, report.Add(-100 * time.Millisecond)},
+	}
+	for _, tt := range tests {
+		if got, src := w.Time(tt.ts, arrival); !got.Equal(tt.want) || src != TimestampRTCP {
+			t.Errorf("ts %d: expected %s from rtcp, got %s from %s", tt.ts, tt.want, got, src)
+		}
+	}
+}
+
+func TestTimestampSEI_RoundTrip(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC)
+	sei := timestampSEI(want, TimestampRTCP)
+	if sei[0] != naluTypeSEI {
+		t.Fatalf("expected an SEI NAL unit, got type %d", sei[0]&0x1f)
+	}
+	if bytes.Contains(sei, []byte{0, 0, 1}) || bytes.Contains(sei, []byte{0, 0, 0}) {
+		t.Errorf("expected no start code inside the NAL unit, got % x", sei)
+	}
+	got, src, ok := ParseTimestampSEI(sei)
+	if !ok || !got.Equal(want) || src != TimestampRTCP {
+		t.Errorf("expected %s from rtcp, got %s from %q (ok=%v)", want, got, src, ok)
+	}
+
+	for _, nalu := range [][]byte{
+		{0x06, 0x05, 0x01, 0x00, 0x80},             // other user data
+		{0x06, 0x01, 0x01, 0x00, 0x80},             // picture timing
+		{0x65, 0x88, 0x84},                         // a slice
+		{0x06},                                     // empty
+		{0x06, 0x05, 0x20, 0x5d, 0x1d, 0x8f, 0x3c}, // truncated
+	} {
+		if _, _, ok := ParseTimestampSEI(nalu); ok {
+			t.Errorf("% x: expected no timestamp", nalu)
+		}
+	}
+}
+
+func TestEscapeRBSP(t *testing.T) {
+	tests := []struct{ in, want []byte }{
+		{[]byte{1, 2, 3}, []byte{1, 2, 3}},
+		{[]byte{0, 0, 1}, []byte{0, 0, 3, 1}},
+		{[]byte{0, 0, 0, 0}, []byte{0, 0, 3, 0, 0}},
+		{[]byte{0, 0, 3}, []byte{0, 0, 3, 3}},
+		{[]byte{0, 0, 4}, []byte{0, 0, 4}},
+	}
+	for _, tt := range tests {
+		got := escapeRBSP(tt.in)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("% x: expected % x, got % x", tt.in, tt.want, got)
+		}
+		if back := unescapeRBSP(got); !bytes.Equal(back, tt.in) {
+			t.Errorf("% x: expected unescaping to restore it, got % x", tt.in, back)
+		}
+	}
+}
+
+func TestVideoReceiver_Timestamps(t *testing.T) {
+	p, v := newTestReceiver(t, Options{Timestamps: true, InsertAUD: true})
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	p.SetClock(clock.NewFake(start))
+
+	var units [][][]byte
+	v.write = func(nalus [][]byte, _ bool) writeResult {
+		units = append(units, nalus)
+		return written
+	}
+	v.Handle(0, 3000, true, []byte{0x65, 0x88, 0x84})
+	report := time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)
+	v.wallClock.SenderReport(uint64(report.Unix()+ntpEpochOffset)<<32, 3000)
+	v.Handle(1, 12000, true, []byte{0x41, 0x9a, 0x02})
+
+	want := []struct {
+		t   time.Time
+		src string
+	}{
+		{start, TimestampArrival},
+		{report.Add(100 * time.Millisecond), TimestampRTCP},
+	}
+	if len(units) != len(want) {
+		t.Fatalf("expected %d access units, got %d", len(want), len(units))
+	}
+	for i, au := range units {
+		if len(au) != 3 || au[0][0] != naluTypeAUD {
+			t.Errorf("access unit %d: expected AUD, SEI and slice, got %d NAL units", i, len(au))
+			continue
+		}
+		got, src, ok := ParseTimestampSEI(au[1])
+		if !ok || !got.Equal(want[i].t) || src != want[i].src {
+			t.Errorf("access unit %d: expected %s from %s, got %s from %q (ok=%v)", i, want[i].t, want[i].src, got, src, ok)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package webrtc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	pion "github.com/pion/webrtc/v4"
+)
+
+// watchTrack waits Options.TrackTimeout after the connection comes up and,
+// if no video track has arrived by then, logs what was negotiated and the
+// likely causes. With FailWithoutTrack it also reports ErrNoTrack. A
+// ControlOnly session never asks for video, so it has none to wait for.
+func (p *Peer) watchTrack() {
+	if p.opts.ControlOnly {
+		return
+	}
+	select {
+	case <-p.clock.After(p.opts.TrackTimeout):
+	case <-p.closed:
+		return
+	}
+	if p.videoSeen.Load() || p.closing() {
+		return
+	}
+
+	log.Printf("[webrtc] warning: connected for %s but the camera sent no video track", p.opts.TrackTimeout)
+	if d := p.pc.LocalDescription(); d != nil {
+		for _, line := range mediaSummary(d.SDP) {
+			log.Printf("[webrtc]   offered/answered: %s", line)
+		}
+	}
+	if d := p.pc.RemoteDescription(); d != nil {
+		for _, line := range mediaSummary(d.SDP) {
+			log.Printf("[webrtc]   camera: %s", line)
+		}
+	}
+	for _, cause := range p.noTrackCauses() {
+		log.Printf("[webrtc]   likely cause: %s", cause)
+	}
+
+	if p.opts.FailWithoutTrack {
+		p.onError(fmt.Errorf("%w within %s of connecting", ErrNoTrack, p.opts.TrackTimeout))
+	}
+}
+
+// watchKeyframe waits Timeouts.FirstFrame after the connection comes up
+// and, if the main stream's keyframe wait has not opened, reports
+// ErrMediaStall. It counts from connecting rather than from the track, so
+// a camera that never sends one fails too.
+func (p *Peer) watchKeyframe() {
+	if p.opts.ControlOnly {
+		return
+	}
+	timeout := p.opts.Timeouts.FirstFrame
+	select {
+	case <-p.clock.After(timeout):
+	case <-p.closed:
+		return
+	}
+	if p.keyframeSeen.Load() || p.closing() {
+		return
+	}
+	p.onError(fmt.Errorf("%w: no keyframe received within %s of connecting", ErrMediaStall, timeout))
+}
+
+// watchPreview waits previewWait after the main video starts and logs if
+// the preview stream has not, unless done is closed first.
+func (p *Peer) watchPreview(done <-chan struct{}) {
+	select {
+	case <-p.clock.After(previewWait):
+	case <-done:
+		return
+	}
+	if !p.previewSeen.Load() {
+		log.Printf("[webrtc] camera sent no preview stream; continuing with the main stream only")
+	}
+}
+
+// watchDataChannel waits DataChannelOptions.OpenTimeout after the
+// connection comes up and, if the control channel is still not open,
+// logs its state. With FailIfNotOpen it also reports ErrDataChannelTimeout.
+func (p *Peer) watchDataChannel() {
+	timeout := p.opts.DataChannel.OpenTimeout
+	select {
+	case <-p.clock.After(timeout):
+	case <-p.closed:
+		return
+	}
+	state := p.dc.ReadyState()
+	if state == pion.DataChannelStateOpen || p.closing() {
+		return
+	}
+
+	log.Printf("[webrtc] warning: connected for %s but the control data channel is %s; startLive was not sent", timeout, state)
+	if sctp := p.pc.SCTP(); sctp != nil {
+		log.Printf("[webrtc]   SCTP transport: %s", sctp.State())
+	}
+	if d := p.pc.RemoteDescription(); d != nil && !strings.Contains(d.SDP, "m=application") {
+		log.Printf("[webrtc]   likely cause: the camera's description has no data channel section")
+	} else {
+		log.Printf("[webrtc]   likely cause: SCTP negotiation failed or the camera ignored the channel")
+	}
+
+	if p.opts.DataChannel.FailIfNotOpen {
+		p.onError(fmt.Errorf("%w within %s of connecting (state %s)", ErrDataChannelTimeout, timeout, state))
+	}
+}
+
+// noTrackCauses lists what the negotiated state suggests went wrong.
+func (p *Peer) noTrackCauses() []string {
+	var causes []string
+	for _, t := range p.pc.GetTransceivers() {
+		if t.Kind() != pion.RTPCodecTypeVideo || t.Receiver() == nil {
+			continue
+		}
+		if len(t.Receiver().GetParameters().Codecs) == 0 {
+			causes = append(causes, "codec mismatch: the camera accepted no H264 format we offer")
+		}
+		break
+	}
+	if d := p.pc.RemoteDescription(); d != nil {
+		switch dir := videoDirection(d.SDP); dir {
+		case "recvonly", "inactive":
+			causes = append(causes, fmt.Sprintf("the camera marked its video %s, so it will not send any", dir))
+		}
+	}
+	if p.dc.ReadyState() != pion.DataChannelStateOpen {
+		causes = append(causes, fmt.Sprintf("the control data channel is %s, so startLive may not have reached the camera", p.dc.ReadyState()))
+	}
+	if len(causes) == 0 {
+		causes = append(causes, "the camera is not sending: it may be busy with another viewer, asleep, or ignoring startLive")
+	}
+	return causes
+}
+
+// mediaSummary returns the lines of sdp that describe its media sections:
+// the m-lines, their direction and their codecs.
+func mediaSummary(sdp string) []string {
+	var lines []string
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "m="),
+			strings.HasPrefix(line, "a=rtpmap:"),
+			strings.HasPrefix(line, "a=fmtp:"),
+			line == "a=sendrecv", line == "a=sendonly", line == "a=recvonly", line == "a=inactive":
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// videoDirection returns the direction attribute of the first video
+// section of sdp, or "sendrecv", the default, if it has none.
+func videoDirection(sdp string) string {
+	inVideo := false
+	for _, line := range mediaSummary(sdp) {
+		switch {
+		case strings.HasPrefix(line, "m="):
+			if inVideo {
+				return "sendrecv"
+			}
+			inVideo = strings.HasPrefix(line, "m=video")
+		case inVideo && !strings.Contains(line, ":"):
+			return strings.TrimPrefix(line, "a=")
+		}
+	}
+	return "sendrecv"
+}
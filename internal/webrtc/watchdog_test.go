@@ -0,0 +1,237 @@
+package webrtc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"vico_home/native/internal/clock"
+	"vico_home/native/internal/domain"
+)
+
+const trackWatchSDP = "v=0\r\n" +
+	"o=- 1 2 IN IP4 127.0.0.1\r\n" +
+	"m=audio 9 UDP/TLS/RTP/SAVPF 0\r\n" +
+	"a=rtpmap:0 PCMU/8000\r\n" +
+	"a=sendrecv\r\n" +
+	"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+	"a=mid:1\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=fmtp:96 packetization-mode=1\r\n" +
+	"a=inactive\r\n"
+
+func TestMediaSummary_KeepsMediaLines(t *testing.T) {
+	want := []string{
+		"m=audio 9 UDP/TLS/RTP/SAVPF 0",
+		"a=rtpmap:0 PCMU/8000",
+		"a=sendrecv",
+		"m=video 9 UDP/TLS/RTP/SAVPF 96",
+		"a=rtpmap:96 H264/90000",
+		"a=fmtp:96 packetization-mode=1",
+		"a=inactive",
+	}
+	got := mediaSummary(trackWatchSDP)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d lines, got %q", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestVideoDirection(t *testing.T) {
+	if got := videoDirection(trackWatchSDP); got != "inactive" {
+		t.Errorf("expected inactive, got %q", got)
+	}
+	if got := videoDirection("m=video 9 UDP/TLS/RTP/SAVPF 96\r\na=rtpmap:96 H264/90000\r\n"); got != "sendrecv" {
+		t.Errorf("expected sendrecv default, got %q", got)
+	}
+}
+
+func TestWatchTrack_FailsWithoutTrack(t *testing.T) {
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", Options{TrackTimeout: 5 * time.Second, FailWithoutTrack: true})
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	clk := clock.NewFake(time.Now())
+	p.SetClock(clk)
+	errs := make(chan error, 1)
+	p.SetOnError(func(err error) { errs <- err })
+
+	go p.watchTrack()
+	clk.BlockUntil(1)
+	clk.Advance(5 * time.Second)
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrNoTrack) || !errors.Is(err, ErrMediaStall) {
+			t.Errorf("expected ErrNoTrack wrapping ErrMediaStall, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected an error when no track arrived")
+	}
+}
+
+func TestWatchTrack_SkipsControlOnly(t *testing.T) {
+	p := newTestPeer(t, Options{TrackTimeout: 5 * time.Second, FailWithoutTrack: true, ControlOnly: true})
+	p.SetClock(clock.NewFake(time.Now()))
+	p.SetOnError(func(err error) { t.Errorf("expected no error in a control-only session, got %v", err) })
+
+	done := make(chan struct{})
+	go func() {
+		p.watchTrack()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected a control-only session not to wait for a track")
+	}
+}
+
+func TestWatchKeyframe(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyframe bool
+		wantErr  bool
+	}{
+		{"no track", false, true},
+		{"keyframe", true, false},
+	}
+	for _, tt := range tests {
+		p := newTestPeer(t, Options{WaitKeyframe: true, Timeouts: domain.Timeouts{FirstFrame: 10 * time.Second}})
+		clk := clock.NewFake(time.Now())
+		p.SetClock(clk)
+		errs := make(chan error, 1)
+		p.SetOnError(func(err error) { errs <- err })
+		p.keyframeSeen.Store(tt.keyframe)
+
+		done := make(chan struct{})
+		go func() {
+			p.watchKeyframe()
+			close(done)
+		}()
+		clk.BlockUntil(1)
+		clk.Advance(10 * time.Second)
+		<-done
+
+		select {
+		case err := <-errs:
+			if !tt.wantErr {
+				t.Errorf("%s: expected no error, got %v", tt.name, err)
+			} else if !errors.Is(err, ErrMediaStall) {
+				t.Errorf("%s: expected ErrMediaStall, got %v", tt.name, err)
+			}
+		default:
+			if tt.wantErr {
+				t.Errorf("%s: expected ErrMediaStall when no keyframe arrived", tt.name)
+			}
+		}
+	}
+}
+
+func TestWatchPreview_LogsMissingPreview(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	for _, seen := range []bool{false, true} {
+		buf.Reset()
+		p := newTestPeer(t, Options{})
+		clk := clock.NewFake(time.Now())
+		p.SetClock(clk)
+		p.previewSeen.Store(seen)
+
+		finished := make(chan struct{})
+		go func() {
+			p.watchPreview(make(chan struct{}))
+			close(finished)
+		}()
+		clk.BlockUntil(1)
+		clk.Advance(previewWait)
+		<-finished
+
+		if logged := strings.Contains(buf.String(), "camera sent no preview stream"); logged == seen {
+			t.Errorf("preview seen %v: expected the warning logged %v, got %q", seen, !seen, buf.String())
+		}
+	}
+}
+
+func TestWatchDataChannel_FailsIfNotOpen(t *testing.T) {
+	opts := Options{DataChannel: DataChannelOptions{OpenTimeout: 10 * time.Second, FailIfNotOpen: true}}
+	p, err := NewPeer(nil, "0123456789abcdef0123456789abcdef", opts)
+	if err != nil {
+		t.Fatalf("create peer: %v", err)
+	}
+	defer p.Close()
+	clk := clock.NewFake(time.Now())
+	p.SetClock(clk)
+	errs := make(chan error, 1)
+	p.SetOnError(func(err error) { errs <- err })
+
+	go p.watchDataChannel()
+	clk.BlockUntil(1)
+	clk.Advance(10 * time.Second)
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrDataChannelTimeout) {
+			t.Errorf("expected ErrDataChannelTimeout, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected an error when the data channel did not open")
+	}
+}
+
+func TestVideoReceiver_ReportsStall(t *testing.T) {
+	p := newTestPeer(t, Options{Timeouts: domain.Timeouts{Stall: 4 * time.Second}})
+	clk := clock.NewFake(time.Now())
+	p.SetClock(clk)
+	errs := make(chan error, 1)
+	p.SetOnError(func(err error) { errs <- err })
+
+	// The stall watch takes its ticker from the clock as the receiver is
+	// created, so this one is created after SetClock.
+	v := p.newVideoReceiver(90000, io.Discard, false, func() {})
+	defer v.Close()
+	clk.BlockUntil(1)
+
+	// No video yet: the watch waits for it to start.
+	for i := 0; i < 8; i++ {
+		clk.Advance(time.Second)
+	}
+	v.Handle(0, 0, true, []byte{0x41, 0x9a})
+	for i := 0; i < 3; i++ {
+		clk.Advance(time.Second)
+	}
+	select {
+	case err := <-errs:
+		t.Fatalf("expected no stall within the timeout, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Ticks the watch has yet to take may be dropped, so keep the clock
+	// moving until it reports.
+	for i := 0; ; i++ {
+		clk.Advance(time.Second)
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrMediaStall) {
+				t.Errorf("expected ErrMediaStall, got %v", err)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+		if i == 20 {
+			t.Fatal("expected a stall once video stopped for the timeout")
+		}
+	}
+}